@@ -0,0 +1,169 @@
+package alert
+
+// Basic alerting on elevated 5xx and 429 response rates
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ClassServerError     = "5xx"
+	ClassTooManyRequests = "429"
+
+	DefaultWindow      = time.Minute
+	DefaultMinRequests = 20
+	DefaultCooldown    = 5 * time.Minute
+)
+
+type Alert struct {
+	Class     string        `json:"class"`
+	Count     int           `json:"count"`
+	Total     int           `json:"total"`
+	Rate      float64       `json:"rate"`
+	Threshold float64       `json:"threshold"`
+	Window    time.Duration `json:"window"`
+	Time      time.Time     `json:"time"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+type bucket struct {
+	second int64
+	total  int
+	counts map[string]int
+}
+
+// Monitor tracks response classes over a sliding window and notifies once
+// the rate of a class crosses its threshold. Notifications of a class are
+// limited to one per cooldown period.
+type Monitor struct {
+	Notifier    Notifier
+	Thresholds  map[string]float64 // rate (0-1] per class, a class without threshold is ignored
+	Window      time.Duration
+	MinRequests int
+	Cooldown    time.Duration
+
+	mu       sync.Mutex
+	buckets  []bucket
+	notified map[string]time.Time
+	now      func() time.Time
+}
+
+func (m *Monitor) init() {
+	if m.Window <= 0 {
+		m.Window = DefaultWindow
+	}
+	if m.MinRequests <= 0 {
+		m.MinRequests = DefaultMinRequests
+	}
+	if m.Cooldown <= 0 {
+		m.Cooldown = DefaultCooldown
+	}
+	if m.now == nil {
+		m.now = time.Now
+	}
+	size := int(m.Window / time.Second)
+	if size < 1 {
+		size = 1
+	}
+	m.buckets = make([]bucket, size)
+	m.notified = make(map[string]time.Time)
+}
+
+// Classify returns the alert class of a status code, or "" if none.
+func Classify(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ClassTooManyRequests
+	case status >= 500:
+		return ClassServerError
+	default:
+		return ""
+	}
+}
+
+// Record accounts for a response and returns the alerts which became due.
+func (m *Monitor) Record(status int) []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets == nil {
+		m.init()
+	}
+
+	now := m.now()
+	sec := now.Unix()
+	b := &m.buckets[sec%int64(len(m.buckets))]
+	if b.second != sec {
+		*b = bucket{second: sec, counts: make(map[string]int)}
+	}
+	b.total++
+	class := Classify(status)
+	if class == "" {
+		return nil
+	}
+	b.counts[class]++
+
+	threshold, ok := m.Thresholds[class]
+	if !ok || threshold <= 0 {
+		return nil
+	}
+
+	total, count := 0, 0
+	oldest := sec - int64(len(m.buckets))
+	for _, x := range m.buckets {
+		if x.second > oldest {
+			total += x.total
+			count += x.counts[class]
+		}
+	}
+	if total < m.MinRequests {
+		return nil
+	}
+	rate := float64(count) / float64(total)
+	if rate < threshold || now.Sub(m.notified[class]) < m.Cooldown {
+		return nil
+	}
+	m.notified[class] = now
+
+	return []Alert{{
+		Class:     class,
+		Count:     count,
+		Total:     total,
+		Rate:      rate,
+		Threshold: threshold,
+		Window:    m.Window,
+		Time:      now,
+	}}
+}
+
+func (m *Monitor) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			for _, a := range m.Record(ww.Status()) {
+				go m.notify(a)
+			}
+		}()
+		next.ServeHTTP(ww, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (m *Monitor) notify(a Alert) {
+	if m.Notifier == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.Notifier.Notify(ctx, a); err != nil {
+		logrus.WithError(err).WithField("class", a.Class).Warn("unable to send alert")
+	}
+}
@@ -0,0 +1,87 @@
+package alert_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/alert"
+)
+
+func TestRecord(t *testing.T) {
+	m := &alert.Monitor{
+		Thresholds:  map[string]float64{alert.ClassServerError: 0.5},
+		MinRequests: 4,
+		Cooldown:    time.Hour,
+	}
+
+	assert.Empty(t, m.Record(http.StatusInternalServerError), "below the minimum request count")
+	assert.Empty(t, m.Record(http.StatusOK))
+	assert.Empty(t, m.Record(http.StatusTooManyRequests), "429 has no threshold")
+
+	alerts := m.Record(http.StatusBadGateway)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, alert.ClassServerError, alerts[0].Class)
+	assert.Equal(t, 2, alerts[0].Count)
+	assert.Equal(t, 4, alerts[0].Total)
+
+	assert.Empty(t, m.Record(http.StatusInternalServerError), "within the cooldown")
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	alerts []alert.Alert
+}
+
+func (x *recorder) Notify(ctx context.Context, a alert.Alert) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.alerts = append(x.alerts, a)
+	return nil
+}
+
+func (x *recorder) count() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.alerts)
+}
+
+func TestMiddleware(t *testing.T) {
+	notifier := &recorder{}
+	m := &alert.Monitor{
+		Notifier:    notifier,
+		Thresholds:  map[string]float64{alert.ClassTooManyRequests: 0.5},
+		MinRequests: 2,
+	}
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	assert.Eventually(t, func() bool { return notifier.count() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestSlack(t *testing.T) {
+	var payload map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer srv.Close()
+
+	slack := &alert.Slack{WebhookURL: srv.URL, Service: "users"}
+	err := slack.Notify(context.Background(), alert.Alert{
+		Class: alert.ClassServerError, Count: 5, Total: 10, Rate: 0.5, Threshold: 0.1, Window: time.Minute,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "*users* :rotating_light: 5xx responses at 50.0% (5 of 10) over the last 1m0s, threshold 10.0%", payload["text"])
+}
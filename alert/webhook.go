@@ -0,0 +1,74 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Webhook posts the alert as JSON to the given URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (x *Webhook) Notify(ctx context.Context, a Alert) error {
+	return post(ctx, x.Client, x.URL, a)
+}
+
+// Slack posts the alert to a Slack incoming webhook.
+type Slack struct {
+	WebhookURL string
+	Service    string // included in the message when set
+	Client     *http.Client
+}
+
+func (x *Slack) Notify(ctx context.Context, a Alert) error {
+	text := fmt.Sprintf(":rotating_light: %s responses at %.1f%% (%d of %d) over the last %s, threshold %.1f%%",
+		a.Class, a.Rate*100, a.Count, a.Total, a.Window, a.Threshold*100)
+	if x.Service != "" {
+		text = "*" + x.Service + "* " + text
+	}
+	return post(ctx, x.Client, x.WebhookURL, map[string]string{"text": text})
+}
+
+func post(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Multi sends the alert to every notifier.
+type Multi []Notifier
+
+func (x Multi) Notify(ctx context.Context, a Alert) error {
+	errs := make([]error, 0)
+	for _, n := range x {
+		if err := n.Notify(ctx, a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -3,10 +3,13 @@ package api
 //Common API data, interfaces, helpers and handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/cors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/go-obvious/server/request"
@@ -16,10 +19,42 @@ type Server interface {
 	Router() interface{}
 }
 
+// ChiServer is implemented by servers exposing their router typed, sparing
+// the assertion of Router.
+type ChiServer interface {
+	ChiRouter() chi.Router
+}
+
+// ChiRouter returns the router of the server, or nil when it is not a
+// chi.Router.
+func ChiRouter(app Server) chi.Router {
+	if srv, ok := app.(ChiServer); ok {
+		return srv.ChiRouter()
+	}
+	router, _ := app.Router().(chi.Router)
+	return router
+}
+
+// CORSServer is implemented by servers supporting per-mount CORS policies.
+type CORSServer interface {
+	CORS(prefix string, opts cors.Options)
+}
+
+// WarmupServer is implemented by servers running warmup functions after
+// they start, their readiness check failing until the functions complete.
+type WarmupServer interface {
+	Warmup(name string, fn func(ctx context.Context) error)
+}
+
 type Service struct {
 	APIName string
 	Router  *chi.Mux
 	Mounts  map[string]*chi.Mux
+	CORS    map[string]cors.Options // CORS policies keyed by mount base
+	Docs    map[string]RouteDoc     // route documentation keyed by RouteKey
+
+	// Warmup functions keyed by name, run once the server started
+	Warmups map[string]func(ctx context.Context) error
 }
 
 func (a *Service) Name() string {
@@ -27,14 +62,40 @@ func (a *Service) Name() string {
 }
 
 func (a *Service) Register(app Server) error {
-	router, ok := app.Router().(*chi.Mux)
-	if !ok || router == nil {
+	router := ChiRouter(app)
+	if router == nil {
 		return fmt.Errorf("bad router")
 	}
+	if len(a.CORS) > 0 {
+		srv, ok := app.(CORSServer)
+		if !ok {
+			return fmt.Errorf("server does not support CORS policies")
+		}
+		for apiBase, opts := range a.CORS {
+			srv.CORS(apiBase, opts)
+		}
+	}
+	if len(a.Warmups) > 0 {
+		srv, ok := app.(WarmupServer)
+		if !ok {
+			return fmt.Errorf("server does not support warmup functions")
+		}
+		for name, fn := range a.Warmups {
+			srv.Warmup(name, fn)
+		}
+	}
+	if srv, ok := app.(DocServer); ok {
+		for key, doc := range a.Docs {
+			method, pattern, _ := strings.Cut(key, " ")
+			srv.Document(method, pattern, doc)
+		}
+	}
 	for apiBase, routes := range a.Mounts {
 		router.Mount(apiBase, routes)
 	}
-	a.Router = router
+	if mux, ok := router.(*chi.Mux); ok {
+		a.Router = mux
+	}
 	return nil
 }
 
@@ -0,0 +1,34 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/api"
+)
+
+// typedRouter exposes its router through ChiRouter only
+type typedRouter struct {
+	r chi.Router
+}
+
+func (t typedRouter) Router() interface{} {
+	return nil
+}
+
+func (t typedRouter) ChiRouter() chi.Router {
+	return t.r
+}
+
+func TestChiRouter(t *testing.T) {
+	mux := chi.NewRouter()
+	assert.Equal(t, mux, api.ChiRouter(router{mux}))
+	assert.Equal(t, mux, api.ChiRouter(typedRouter{mux}))
+
+	svc := &api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": chi.NewRouter()}}
+	assert.NoError(t, svc.Register(typedRouter{mux}))
+	assert.Equal(t, mux, svc.Router)
+	assert.Error(t, svc.Register(typedRouter{}))
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Request headers distinguishing the responses of a same URL, the
+// credentials keeping the clients from sharing each other's responses
+var coalesceHeaders = []string{
+	"Authorization", "Cookie", "X-Api-Key", "Accept", "Accept-Encoding", "Accept-Language",
+}
+
+// Coalesce runs the handler once for the identical GET and HEAD requests
+// arriving while it runs, the same URL presented with the same credentials
+// and Accept headers, and shares its response among them, so a burst of
+// clients requesting an expensive resource executes it once. Responses are
+// buffered, which suits the ones of a bounded size rather than streams.
+// The handler runs with the context of the first request.
+func Coalesce() func(http.Handler) http.Handler {
+	g := &flightGroup{calls: map[string]*flight{}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			g.do(coalesceKey(r), next, r).replay(w)
+		})
+	}
+}
+
+func coalesceKey(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.URL.RequestURI())
+	for _, name := range coalesceHeaders {
+		b.WriteByte('\n')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	resp *bufferedResponse
+}
+
+func (g *flightGroup) do(key string, next http.Handler, r *http.Request) *bufferedResponse {
+	g.mu.Lock()
+	if f, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.resp
+		case <-r.Context().Done():
+			return &bufferedResponse{status: http.StatusServiceUnavailable, header: http.Header{}}
+		}
+	}
+	f := &flight{done: make(chan struct{})}
+	g.calls[key] = f
+	g.mu.Unlock()
+
+	resp := &bufferedResponse{header: http.Header{}}
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		if resp.status == 0 {
+			// The handler panicked, the waiting requests fail
+			resp.status = http.StatusInternalServerError
+		}
+		f.resp = resp
+		close(f.done)
+	}()
+	next.ServeHTTP(resp, r)
+	if resp.status == 0 {
+		resp.status = http.StatusOK
+	}
+	return resp
+}
+
+// bufferedResponse records a response to send it to several clients.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status == 0 && code >= 200 {
+		b.status = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) replay(w http.ResponseWriter) {
+	header := w.Header()
+	for name, values := range b.header {
+		header[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(b.status)
+	_, _ = w.Write(b.body.Bytes())
+}
@@ -0,0 +1,70 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/api"
+)
+
+func TestCoalesce(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	report := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("X-Report", "q3")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("report " + r.Header.Get("Authorization")))
+	})
+	mux := chi.NewRouter()
+	api.MountRoutes(mux, api.Route{Method: http.MethodGet, Pattern: "/report", Handler: report, Coalesce: true})
+
+	get := func(auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/report?quarter=3", nil)
+		r.Header.Set("Authorization", auth)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, r)
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 6)
+	for i := range responses {
+		auth := "alice"
+		if i == len(responses)-1 {
+			auth = "bob"
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = get(auth)
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond, "one call per credentials")
+	time.Sleep(20 * time.Millisecond) // lets the other requests join
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), calls.Load())
+	for i, rr := range responses {
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Equal(t, "q3", rr.Header().Get("X-Report"))
+		if i == len(responses)-1 {
+			assert.Equal(t, "report bob", rr.Body.String())
+		} else {
+			assert.Equal(t, "report alice", rr.Body.String())
+		}
+	}
+
+	// Once done, the next request runs the handler again
+	get("alice")
+	assert.Equal(t, int32(3), calls.Load())
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// RouteDoc documents a route for the generated OpenAPI document and the
+// route listings.
+type RouteDoc struct {
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+}
+
+// DocServer is implemented by servers collecting route documentation.
+type DocServer interface {
+	Document(method, pattern string, doc RouteDoc)
+}
+
+// RouteKey identifies a route by method and full pattern, such as
+// "GET /api/v1/orders/{id}".
+func RouteKey(method, pattern string) string {
+	return strings.ToUpper(method) + " " + NormalizePattern(pattern)
+}
+
+// Describe documents the route of the given method and full pattern,
+// including the mount base.
+func (a *Service) Describe(method, pattern string, doc RouteDoc) {
+	if a.Docs == nil {
+		a.Docs = make(map[string]RouteDoc)
+	}
+	a.Docs[RouteKey(method, pattern)] = doc
+}
+
+var paramRegexp = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// NormalizePattern strips the regular expressions of the route parameters
+// and the trailing slash left by mounted routers.
+func NormalizePattern(pattern string) string {
+	pattern = paramRegexp.ReplaceAllString(pattern, "{$1}")
+	if len(pattern) > 1 {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	return pattern
+}
+
+type openAPIParameter struct {
+	Name     string            `json:"name"`
+	In       string            `json:"in"`
+	Required bool              `json:"required"`
+	Schema   map[string]string `json:"schema"`
+}
+
+type openAPIOperation struct {
+	RouteDoc
+	Parameters []openAPIParameter     `json:"parameters,omitempty"`
+	Responses  map[string]interface{} `json:"responses"`
+}
+
+// OpenAPI generates an OpenAPI 3 document listing the routes of the router,
+// documented with docs keyed by RouteKey. Wildcard routes are skipped.
+func OpenAPI(title, version string, routes chi.Routes, docs map[string]RouteDoc) ([]byte, error) {
+	paths := map[string]map[string]openAPIOperation{}
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = NormalizePattern(route)
+		if strings.Contains(route, "*") {
+			return nil
+		}
+
+		op := openAPIOperation{
+			RouteDoc:  docs[RouteKey(method, route)],
+			Responses: map[string]interface{}{"default": map[string]string{"description": "response"}},
+		}
+		for _, part := range strings.Split(route, "/") {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				op.Parameters = append(op.Parameters, openAPIParameter{
+					Name:     strings.Trim(part, "{}"),
+					In:       "path",
+					Required: true,
+					Schema:   map[string]string{"type": "string"},
+				})
+			}
+		}
+
+		if paths[route] == nil {
+			paths[route] = map[string]openAPIOperation{}
+		}
+		paths[route][strings.ToLower(method)] = op
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]string{"title": title, "version": version},
+		"paths":   paths,
+	}, "", "  ")
+}
@@ -0,0 +1,46 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/api"
+)
+
+func TestOpenAPI(t *testing.T) {
+	orders := chi.NewRouter()
+	orders.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	orders.Get("/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {})
+
+	svc := &api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": orders}}
+	svc.Describe(http.MethodGet, "/orders/{id:[0-9]+}", api.RouteDoc{Summary: "Get an order", Tags: []string{"orders"}})
+
+	mux := chi.NewRouter()
+	require.NoError(t, svc.Register(router{mux}))
+
+	doc, err := api.OpenAPI("Orders", "v1", mux, svc.Docs)
+	require.NoError(t, err)
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Summary    string   `json:"summary"`
+			Tags       []string `json:"tags"`
+			Parameters []struct {
+				Name string `json:"name"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(doc, &spec))
+
+	require.Contains(t, spec.Paths, "/orders")
+	get := spec.Paths["/orders/{id}"]["get"]
+	assert.Equal(t, "Get an order", get.Summary)
+	assert.Equal(t, []string{"orders"}, get.Tags)
+	require.Len(t, get.Parameters, 1)
+	assert.Equal(t, "id", get.Parameters[0].Name)
+}
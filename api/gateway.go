@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/go-obvious/server/request"
+)
+
+// GatewayMetadataPrefix is the prefix of the request headers a grpc-gateway
+// runtime.ServeMux forwards as gRPC metadata, with its default header
+// matcher.
+const GatewayMetadataPrefix = "Grpc-Metadata-"
+
+// gatewayStatus is the error body of grpc-gateway, a google.rpc.Status.
+type gatewayStatus struct {
+	Code    *int   `json:"code"`
+	Message string `json:"message"`
+}
+
+// Gateway adapts a grpc-gateway runtime.ServeMux to the server: the
+// request, correlation and trace IDs are forwarded to the gRPC services as
+// metadata, such as "x-correlation-id", and the gateway errors are replied
+// with request.ReplyErr, in the error format of the server.
+func Gateway(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out := r.Clone(r.Context())
+		for name, value := range request.TraceHeaders(r.Context()) {
+			out.Header.Set(GatewayMetadataPrefix+name, value)
+		}
+		gw := &gatewayWriter{ResponseWriter: w}
+		mux.ServeHTTP(gw, out)
+		if gw.failed {
+			gw.reply(r)
+		}
+	})
+}
+
+// gatewayWriter holds back the error responses of the gateway to reply
+// them in the error format of the server.
+type gatewayWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	failed      bool
+	status      int
+	body        bytes.Buffer
+}
+
+func (g *gatewayWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	if code >= 400 {
+		ct, _, _ := mime.ParseMediaType(g.Header().Get("Content-Type"))
+		if ct == request.ContentTypeJSON {
+			g.wroteHeader, g.failed, g.status = true, true, code
+			return
+		}
+	}
+	if code >= 200 {
+		g.wroteHeader = true
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *gatewayWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.failed {
+		return g.body.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+func (g *gatewayWriter) Flush() {
+	if !g.failed {
+		_ = http.NewResponseController(g.ResponseWriter).Flush()
+	}
+}
+
+func (g *gatewayWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// reply sends the held back error, as is when it is not a gateway error.
+func (g *gatewayWriter) reply(r *http.Request) {
+	var status gatewayStatus
+	if err := json.Unmarshal(g.body.Bytes(), &status); err != nil || status.Code == nil {
+		g.ResponseWriter.WriteHeader(g.status)
+		_, _ = g.ResponseWriter.Write(g.body.Bytes())
+		return
+	}
+	message := status.Message
+	if message == "" {
+		message = http.StatusText(g.status)
+	}
+	g.Header().Del("Content-Length")
+	request.ReplyErr(g.ResponseWriter, r, request.NewHTTPError(errors.New(message), g.status))
+}
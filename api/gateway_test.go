@@ -0,0 +1,50 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/api"
+	"github.com/go-obvious/server/internal/middleware/requestid"
+	"github.com/go-obvious/server/request"
+)
+
+func TestGateway(t *testing.T) {
+	// Replies as a grpc-gateway runtime.ServeMux would
+	mux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/orders/1":
+			_, _ = w.Write([]byte(`{"id":"1","correlation":"` + r.Header.Get("Grpc-Metadata-X-Correlation-Id") + `"}`))
+		case "/v1/orders/2":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":5,"message":"order not found","details":[]}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`{"upstream":"down"}`))
+		}
+	})
+	handler := requestid.Middleware(api.Gateway(mux))
+	get := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set(request.HeaderCorrelationID, "c1")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := get("/v1/orders/1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":"1","correlation":"c1"}`, rr.Body.String(), "the correlation ID is forwarded as metadata")
+
+	rr = get("/v1/orders/2")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.JSONEq(t, `{"success":false,"error":"order not found"}`, rr.Body.String())
+
+	rr = get("/v1/other")
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.JSONEq(t, `{"upstream":"down"}`, rr.Body.String(), "other errors are left as is")
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+
+	"github.com/go-obvious/server/request"
+)
+
+const ParamID = "id"
+
+// ErrNotFound is returned, possibly wrapped, by repositories for missing
+// items. Resources reply 404 Not Found for it.
+var ErrNotFound = errors.New("not found")
+
+// Repository stores the items of a Resource.
+type Repository[T any] interface {
+	List(ctx context.Context, opts request.PaginationOptions) ([]T, request.Cursor, error)
+	Get(ctx context.Context, id string) (T, error)
+	Create(ctx context.Context, item T) (T, error)
+	Update(ctx context.Context, id string, item T) (T, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Validator is implemented by items checking themselves before being
+// created or updated.
+type Validator interface {
+	Validate() error
+}
+
+// Resource wires the standard list, get, create, update and delete routes
+// of a repository, replying the SingleResponse and ListResponse envelopes.
+//
+//	svc := &api.Service{
+//		APIName: "orders",
+//		Mounts:  map[string]*chi.Mux{"/orders": (&api.Resource[Order]{Repository: repo}).Router()},
+//	}
+type Resource[T any] struct {
+	Repository Repository[T]
+
+	// Validate checks the items on top of their Validator implementation
+	Validate func(item T) error
+
+	// Cursors signs the list cursors when set, the repository then deals
+	// with plain positions and expired cursors are answered 410 Gone
+	Cursors *request.CursorSigner
+}
+
+// Router returns a router serving the resource routes, to be mounted.
+func (res *Resource[T]) Router() *chi.Mux {
+	r := chi.NewRouter()
+	res.Routes(r)
+	return r
+}
+
+// Routes registers the resource routes on r:
+//
+//	GET    /      list, paginated with the cursor and limit parameters and
+//	              tagged for conditional requests
+//	POST   /      create
+//	GET    /{id}  get
+//	PUT    /{id}  update
+//	DELETE /{id}  delete
+//
+// Create and update reply 415 Unsupported Media Type to non JSON bodies.
+func (res *Resource[T]) Routes(r chi.Router) {
+	json := r.With(request.RequireContentType(request.ContentTypeJSON))
+	r.Get("/", res.list)
+	json.Post("/", res.create)
+	r.Get("/{"+ParamID+"}", res.get)
+	json.Put("/{"+ParamID+"}", res.update)
+	r.Delete("/{"+ParamID+"}", res.delete)
+}
+
+func (res *Resource[T]) list(w http.ResponseWriter, r *http.Request) {
+	opts := request.GetPagingOpts(r)
+	if res.Cursors != nil {
+		var err error
+		if opts, err = res.Cursors.GetPagingOpts(r); err != nil {
+			request.ReplyErr(w, r, err)
+			return
+		}
+	}
+
+	items, cursor, err := res.Repository.List(r.Context(), opts)
+	if err != nil {
+		replyErr(w, r, err)
+		return
+	}
+	if res.Cursors != nil {
+		cursor = res.Cursors.NewCursor(deref(cursor.Prev), deref(cursor.Next))
+	}
+	if items == nil {
+		items = []T{}
+	}
+	request.ReplyList(r, w, request.ListResponse[T]{
+		Status: request.NewResult(),
+		Cursor: cursor,
+		Count:  len(items),
+		Data:   items,
+	}, http.StatusOK)
+}
+
+func (res *Resource[T]) get(w http.ResponseWriter, r *http.Request) {
+	item, err := res.Repository.Get(r.Context(), request.Param(r, ParamID))
+	if err != nil {
+		replyErr(w, r, err)
+		return
+	}
+	replyItem(w, r, item, http.StatusOK)
+}
+
+func (res *Resource[T]) create(w http.ResponseWriter, r *http.Request) {
+	item, ok := res.decode(w, r)
+	if !ok {
+		return
+	}
+	item, err := res.Repository.Create(r.Context(), item)
+	if err != nil {
+		replyErr(w, r, err)
+		return
+	}
+	replyItem(w, r, item, http.StatusCreated)
+}
+
+func (res *Resource[T]) update(w http.ResponseWriter, r *http.Request) {
+	item, ok := res.decode(w, r)
+	if !ok {
+		return
+	}
+	item, err := res.Repository.Update(r.Context(), request.Param(r, ParamID), item)
+	if err != nil {
+		replyErr(w, r, err)
+		return
+	}
+	replyItem(w, r, item, http.StatusOK)
+}
+
+func (res *Resource[T]) delete(w http.ResponseWriter, r *http.Request) {
+	if err := res.Repository.Delete(r.Context(), request.Param(r, ParamID)); err != nil {
+		replyErr(w, r, err)
+		return
+	}
+	request.Reply(r, w, request.NewResult(), http.StatusOK)
+}
+
+// decode reads and validates the item of the request body, replying
+// 400 Bad Request when it is invalid.
+func (res *Resource[T]) decode(w http.ResponseWriter, r *http.Request) (T, bool) {
+	var item T
+	err := request.GetBody(w, r, &item)
+	if err == nil {
+		err = res.validate(&item)
+	}
+	if err != nil {
+		request.ReplyErr(w, r, request.NewHTTPError(err, http.StatusBadRequest))
+		return item, false
+	}
+	return item, true
+}
+
+func (res *Resource[T]) validate(item *T) error {
+	if v, ok := any(item).(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	} else if v, ok := any(*item).(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	if res.Validate != nil {
+		return res.Validate(*item)
+	}
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func replyItem[T any](w http.ResponseWriter, r *http.Request, item T, status int) {
+	request.Reply(r, w, request.SingleResponse[T]{Status: request.NewResult(), Data: item}, status)
+}
+
+// replyErr maps ErrNotFound to 404 Not Found, other errors keep the status
+// of their HTTPErrorCoder or reply 500.
+func replyErr(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrNotFound) {
+		err = request.NewHTTPError(err, http.StatusNotFound)
+	}
+	request.ReplyErr(w, r, err)
+}
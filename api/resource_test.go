@@ -0,0 +1,125 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/api"
+	"github.com/go-obvious/server/request"
+)
+
+type order struct {
+	ID    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+func (o order) Validate() error {
+	if o.Total < 0 {
+		return errors.New("total must not be negative")
+	}
+	return nil
+}
+
+type orders struct {
+	mu    sync.Mutex
+	items map[string]order
+}
+
+func (s *orders) List(ctx context.Context, opts request.PaginationOptions) ([]order, request.Cursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []order
+	for _, o := range s.items {
+		out = append(out, o)
+	}
+	return out, request.Cursor{}, nil
+}
+
+func (s *orders) Get(ctx context.Context, id string) (order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.items[id]
+	if !ok {
+		return o, fmt.Errorf("order %s: %w", id, api.ErrNotFound)
+	}
+	return o, nil
+}
+
+func (s *orders) Create(ctx context.Context, o order) (order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o.ID = fmt.Sprint(len(s.items) + 1)
+	s.items[o.ID] = o
+	return o, nil
+}
+
+func (s *orders) Update(ctx context.Context, id string, o order) (order, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return o, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o.ID = id
+	s.items[id] = o
+	return o, nil
+}
+
+func (s *orders) Delete(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+	return nil
+}
+
+func TestResource(t *testing.T) {
+	router := (&api.Resource[order]{Repository: &orders{items: map[string]order{}}}).Router()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(request.HeaderContentType, request.ContentTypeJSON)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/", `{"total": 10}`)
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var created request.SingleResponse[order]
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, order{ID: "1", Total: 10}, created.Data)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/", `{"total": -1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/", `{`).Code)
+
+	form := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("total=10"))
+	form.Header.Set(request.HeaderContentType, request.ContentTypeForm)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, form)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/1", `{"total": 20}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/2", `{"total": 20}`).Code)
+
+	rr = do(http.MethodGet, "/", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var list request.ListResponse[order]
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.Count)
+	assert.Equal(t, []order{{ID: "1", Total: 20}}, list.Data)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/1", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/1", "").Code)
+}
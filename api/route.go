@@ -0,0 +1,342 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/go-obvious/server/internal/middleware/logger"
+	recovery "github.com/go-obvious/server/internal/middleware/panic"
+	"github.com/go-obvious/server/ratelimit"
+	"github.com/go-obvious/server/request"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("insufficient scope")
+	ErrTimeout         = errors.New("request timed out")
+)
+
+// ScopedPrincipal is implemented by the principals, stored with
+// request.WithPrincipal, granted scopes.
+type ScopedPrincipal interface {
+	HasScope(scope string) bool
+}
+
+// Route declares a route along with its policies, enforced by the
+// middlewares it is mounted with rather than scattered in configuration.
+//
+//	api.MountRoutes(mux,
+//		api.Route{Method: http.MethodGet, Pattern: "/orders", Handler: list, CacheTTL: time.Minute},
+//		api.Route{Method: http.MethodPost, Pattern: "/exports", Handler: export,
+//			Timeout: 30 * time.Second, RateCost: 10, AuthScopes: []string{"orders:export"}},
+//	)
+type Route struct {
+	Method  string
+	Pattern string
+	Handler http.Handler
+
+	// Cancels the request context once elapsed, replying 504 Gateway
+	// Timeout when the handler did not complete
+	Timeout time.Duration
+
+	// Sets Cache-Control max-age on the successful GET and HEAD responses
+	// not setting it
+	CacheTTL time.Duration
+
+	// Tokens charged by the rate limiter, one when unset
+	RateCost int
+
+	// Scopes the principal must all be granted, replying 401 Unauthorized
+	// without principal and 403 Forbidden when one is missing
+	AuthScopes []string
+
+	// Runs the handler once for the identical concurrent GET and HEAD
+	// requests, sharing its response
+	Coalesce bool
+
+	// Keeps the requests out of the logs, such as the high-frequency
+	// polling ones: no debug log and only the warnings and errors of the
+	// request logger
+	Quiet bool
+}
+
+// MountRoutes registers the routes on the router, each through the
+// middlewares enforcing its policies.
+func MountRoutes(r chi.Router, routes ...Route) {
+	for _, rt := range routes {
+		r.With(rt.Middlewares()...).Method(rt.Method, rt.Pattern, rt.Handler)
+	}
+}
+
+// Middlewares returns the middlewares enforcing the policies of the route.
+func (rt Route) Middlewares() []func(http.Handler) http.Handler {
+	var mws []func(http.Handler) http.Handler
+	if rt.Quiet {
+		mws = append(mws, Quiet)
+	}
+	if len(rt.AuthScopes) > 0 {
+		mws = append(mws, RequireScopes(rt.AuthScopes...))
+	}
+	if rt.RateCost > 1 {
+		mws = append(mws, RateCost(rt.RateCost))
+	}
+	if rt.Coalesce {
+		mws = append(mws, Coalesce())
+	}
+	if rt.Timeout > 0 {
+		mws = append(mws, Timeout(rt.Timeout))
+	}
+	if rt.CacheTTL > 0 {
+		mws = append(mws, CacheTTL(rt.CacheTTL))
+	}
+	return mws
+}
+
+// Quiet keeps the requests out of the logs: the debug log requested with
+// the debug token is skipped and request.Logger only logs warnings and
+// errors.
+func Quiet(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, logger.SetQuiet(r))
+	})
+}
+
+// RequireScopes replies 401 Unauthorized to the requests without principal
+// and 403 Forbidden to the ones whose principal misses one of the scopes.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := request.RequestMetadata(r).Principal
+			if principal == nil {
+				request.ReplyErr(w, r, request.NewHTTPError(ErrUnauthenticated, http.StatusUnauthorized))
+				return
+			}
+			scoped, ok := principal.(ScopedPrincipal)
+			for _, scope := range scopes {
+				if !ok || !scoped.HasScope(scope) {
+					request.ReplyErr(w, r, request.NewHTTPError(
+						fmt.Errorf("%w, %q required", ErrForbidden, scope), http.StatusForbidden))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateCost charges the requests cost tokens of the rate limiter in total,
+// replying 429 Too Many Requests when the client cannot afford them.
+func RateCost(cost int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The limiter charged a token when admitting the request
+			if !ratelimit.Consume(r.Context(), cost-1) {
+				request.ReplyErr(w, r, request.NewHTTPError(ratelimit.ErrTooManyRequests, http.StatusTooManyRequests))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timeout runs the handler with a context cancelled after d, replying 504
+// Gateway Timeout when it fires before the handler completes, as
+// http.TimeoutHandler does. The response is buffered until the handler
+// returns, its writes failing with http.ErrHandlerTimeout once timed out,
+// so streaming handlers must not be given a timeout. A panic of the handler
+// once timed out is logged.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan handlerPanic, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- handlerPanic{value: p, stack: debug.Stack()}
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				// Raised again for the recovery middleware of the server
+				panic(p.value)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				h := w.Header()
+				for k, v := range tw.header {
+					h[k] = v
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				_, _ = w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					request.ReplyErr(w, r, request.NewHTTPError(ErrTimeout, http.StatusGatewayTimeout))
+				}
+				// The handler still runs, no recovery middleware is left
+				// to catch its panic
+				header := w.Header().Clone()
+				go func() {
+					select {
+					case p := <-panicked:
+						if p.value != http.ErrAbortHandler {
+							recovery.Late(r, header, p.value, p.stack)
+						}
+					case <-done:
+					}
+				}()
+			}
+		})
+	}
+}
+
+// handlerPanic is a panic recovered from the handler run by Timeout.
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// timeoutWriter buffers the response of a handler run by Timeout.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.status != 0 {
+		return
+	}
+	w.status = code
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// CacheTTL lets the successful GET and HEAD responses be cached for ttl,
+// unless the handler set Cache-Control itself.
+func CacheTTL(ttl time.Duration) func(http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d", int(ttl.Seconds()))
+	stamp := BeforeResponse(func(r *http.Request, status int, h http.Header) {
+		if status >= 200 && status < 300 && h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", value)
+		}
+	})
+	return func(next http.Handler) http.Handler {
+		stamped := stamp(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			stamped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ResponseHook inspects the status and headers produced by a handler, and
+// may change the headers, before they are sent.
+type ResponseHook func(r *http.Request, status int, h http.Header)
+
+// BeforeResponse runs the hooks, in order, once the handler writes the
+// status of the response, or its body or flushes it without a status, and
+// before the headers are sent. Informational 1xx responses are not hooked.
+//
+//	r.Use(api.BeforeResponse(func(r *http.Request, status int, h http.Header) {
+//		if status >= 400 {
+//			h.Set("Cache-Control", "no-store")
+//		}
+//	}))
+func BeforeResponse(hooks ...ResponseHook) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&hookWriter{ResponseWriter: w, r: r, hooks: hooks}, r)
+		})
+	}
+}
+
+type hookWriter struct {
+	http.ResponseWriter
+	r     *http.Request
+	hooks []ResponseHook
+	wrote bool
+}
+
+func (w *hookWriter) WriteHeader(code int) {
+	if !w.wrote && code >= 200 {
+		w.wrote = true
+		for _, hook := range w.hooks {
+			hook(w.r, code, w.Header())
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *hookWriter) Flush() {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over, as the WebSocket upgrades do, the
+// hooks not running.
+func (w *hookWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *hookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
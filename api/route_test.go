@@ -0,0 +1,155 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/api"
+	"github.com/go-obvious/server/ratelimit"
+	"github.com/go-obvious/server/request"
+)
+
+type scopes []string
+
+func (s scopes) HasScope(scope string) bool {
+	for _, granted := range s {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMountRoutes(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	lateErr := make(chan error, 1)
+	late := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond) // ignoring the context
+		_, err := w.Write([]byte("late"))
+		lateErr <- err
+	})
+
+	mux := chi.NewRouter()
+	limiter := ratelimit.New(ratelimit.Config{Rate: 0.001, Burst: 5})
+	mux.Use(limiter.Middleware)
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if granted := r.Header.Get("X-Scopes"); granted != "" {
+				r = r.WithContext(request.WithPrincipal(r.Context(), scopes{granted}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	api.MountRoutes(mux,
+		api.Route{Method: http.MethodGet, Pattern: "/cached", Handler: ok, CacheTTL: 90 * time.Second},
+		api.Route{Method: http.MethodGet, Pattern: "/slow", Handler: slow, Timeout: 10 * time.Millisecond},
+		api.Route{Method: http.MethodGet, Pattern: "/late", Handler: late, Timeout: 10 * time.Millisecond},
+		api.Route{Method: http.MethodGet, Pattern: "/admin", Handler: ok, AuthScopes: []string{"admin"}},
+		api.Route{Method: http.MethodGet, Pattern: "/export", Handler: ok, RateCost: 3},
+		api.Route{Method: http.MethodGet, Pattern: "/poll", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request.Logger(r).Info("polled")
+		}), Quiet: true},
+	)
+
+	get := func(target, remote string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.RemoteAddr = remote + ":1234"
+		if len(header) == 2 {
+			r.Header.Set(header[0], header[1])
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/cached", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "max-age=90", w.Header().Get("Cache-Control"))
+	assert.Empty(t, get("/cached?fail=1", "10.0.0.1").Header().Get("Cache-Control"), "errors are not cached")
+
+	assert.Equal(t, http.StatusGatewayTimeout, get("/slow", "10.0.0.2").Code)
+	w = get("/late", "10.0.0.6")
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code, "replied when the deadline fires")
+	assert.NotContains(t, w.Body.String(), "late")
+	assert.ErrorIs(t, <-lateErr, http.ErrHandlerTimeout)
+
+	assert.Equal(t, http.StatusUnauthorized, get("/admin", "10.0.0.3").Code)
+	assert.Equal(t, http.StatusForbidden, get("/admin", "10.0.0.3", "X-Scopes", "orders").Code)
+	assert.Equal(t, http.StatusOK, get("/admin", "10.0.0.3", "X-Scopes", "admin").Code)
+
+	assert.Equal(t, http.StatusOK, get("/export", "10.0.0.4").Code, "3 of 5 tokens")
+	assert.Equal(t, http.StatusTooManyRequests, get("/export", "10.0.0.4").Code, "2 tokens left")
+	assert.Equal(t, http.StatusOK, get("/cached", "10.0.0.4").Code, "the refused cost was not charged")
+
+	hook := test.NewGlobal()
+	assert.Equal(t, http.StatusOK, get("/poll", "10.0.0.5").Code)
+	assert.Empty(t, hook.AllEntries(), "quiet routes only log warnings")
+}
+
+func TestTimeoutLatePanic(t *testing.T) {
+	hook := test.NewGlobal()
+	handler := api.Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		panic("late boom")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	assert.Eventually(t, func() bool {
+		entry := hook.LastEntry()
+		return entry != nil && entry.Data["panic"] == "late boom" && entry.Data["late"] == true
+	}, time.Second, 5*time.Millisecond, "the panic is logged once timed out")
+}
+
+func TestBeforeResponse(t *testing.T) {
+	var statuses []int
+	handler := api.BeforeResponse(
+		func(r *http.Request, status int, h http.Header) {
+			statuses = append(statuses, status)
+			if status >= 400 {
+				h.Set("Cache-Control", "no-store")
+			}
+		},
+		func(r *http.Request, status int, h http.Header) {
+			h.Set("X-Frame-Options", "SAMEORIGIN") // overrides the one of the handler
+		},
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		switch r.URL.Path {
+		case "/early":
+			w.WriteHeader(http.StatusEarlyHints)
+			_, _ = w.Write([]byte("body"))
+		case "/missing":
+			request.ReplyErr(w, r, request.NewErrNotFound())
+		}
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/early", nil))
+	assert.Equal(t, "body", rr.Body.String())
+	assert.Equal(t, "SAMEORIGIN", rr.Header().Get("X-Frame-Options"))
+	assert.Empty(t, rr.Header().Get("Cache-Control"))
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusNotFound}, statuses, "once per response, 1xx skipped")
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+
+	"github.com/go-chi/chi"
+)
+
+// RouteInfo describes a registered route, for debugging which APIs
+// registered what.
+type RouteInfo struct {
+	Method      string    `json:"method"`
+	Pattern     string    `json:"pattern"`
+	Handler     string    `json:"handler"`
+	Middlewares []string  `json:"middlewares,omitempty"`
+	Doc         *RouteDoc `json:"doc,omitempty"`
+}
+
+// Routes lists the routes of the router sorted by pattern and method,
+// along with the middlewares they run through and their documentation
+// keyed by RouteKey.
+func Routes(routes chi.Routes, docs map[string]RouteDoc) ([]RouteInfo, error) {
+	infos := []RouteInfo{}
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = NormalizePattern(route)
+		info := RouteInfo{
+			Method:  method,
+			Pattern: route,
+			Handler: funcName(handler),
+		}
+		for _, mw := range middlewares {
+			info.Middlewares = append(info.Middlewares, funcName(mw))
+		}
+		if doc, ok := docs[RouteKey(method, route)]; ok {
+			info.Doc = &doc
+		}
+		infos = append(infos, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Pattern != infos[j].Pattern {
+			return infos[i].Pattern < infos[j].Pattern
+		}
+		return infos[i].Method < infos[j].Method
+	})
+	return infos, nil
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$|-fm$`)
+
+// funcName returns the name of the function behind a handler or
+// middleware, or its type for other handlers.
+func funcName(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Func {
+		return rv.Type().String()
+	}
+	fn := runtime.FuncForPC(rv.Pointer())
+	if fn == nil {
+		return rv.Type().String()
+	}
+	// Closures are reported as the function returning them
+	return closureSuffix.ReplaceAllString(fn.Name(), "")
+}
@@ -0,0 +1,43 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/api"
+)
+
+func listOrders(w http.ResponseWriter, r *http.Request) {}
+
+func TestRoutes(t *testing.T) {
+	orders := chi.NewRouter()
+	orders.Use(middleware.NoCache)
+	orders.Get("/", listOrders)
+	orders.With(middleware.RequestID).Delete("/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {})
+
+	mux := chi.NewRouter()
+	mux.Mount("/orders", orders)
+	docs := map[string]api.RouteDoc{api.RouteKey(http.MethodGet, "/orders"): {Summary: "List orders"}}
+
+	routes, err := api.Routes(mux, docs)
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+
+	assert.Equal(t, http.MethodGet, routes[0].Method)
+	assert.Equal(t, "/orders", routes[0].Pattern)
+	assert.Equal(t, "github.com/go-obvious/server/api_test.listOrders", routes[0].Handler)
+	assert.Equal(t, []string{"github.com/go-chi/chi/middleware.NoCache"}, routes[0].Middlewares)
+	require.NotNil(t, routes[0].Doc)
+	assert.Equal(t, "List orders", routes[0].Doc.Summary)
+
+	assert.Equal(t, http.MethodDelete, routes[1].Method)
+	assert.Equal(t, "/orders/{id}", routes[1].Pattern)
+	assert.Equal(t, "github.com/go-obvious/server/api_test.TestRoutes", routes[1].Handler)
+	assert.Equal(t, []string{"github.com/go-chi/chi/middleware.NoCache", "github.com/go-chi/chi/middleware.RequestID"}, routes[1].Middlewares)
+	assert.Nil(t, routes[1].Doc)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+	HeaderLink        = "Link"
+)
+
+// Version of an API mounted by MountVersions under base/Name.
+type Version struct {
+	Name string
+
+	// Routes registers routes added to, or replacing, the shared ones for
+	// this version only
+	Routes func(r chi.Router)
+
+	// Deprecated versions answer with the Deprecation header, the Sunset
+	// header when set, and a Link to the latest version.
+	Deprecated bool
+	Sunset     time.Time
+}
+
+// MountVersions mounts the routes registered by routes under a prefix per
+// version, such as /api/v1 and /api/v2, applying the overrides of each
+// version. The last version is the latest, deprecated versions link to it.
+func (a *Service) MountVersions(base string, routes func(r chi.Router), versions ...Version) {
+	if a.Mounts == nil {
+		a.Mounts = make(map[string]*chi.Mux)
+	}
+	if len(versions) == 0 {
+		return
+	}
+	latest := path.Join(base, versions[len(versions)-1].Name)
+
+	for _, v := range versions {
+		r := chi.NewRouter()
+		if v.Deprecated {
+			r.Use(deprecation(v, latest))
+		}
+		routes(r)
+		if v.Routes != nil {
+			v.Routes(r)
+		}
+		a.Mounts[path.Join(base, v.Name)] = r
+	}
+}
+
+func deprecation(v Version, latest string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set(HeaderDeprecation, "true")
+			if !v.Sunset.IsZero() {
+				h.Set(HeaderSunset, v.Sunset.UTC().Format(http.TimeFormat))
+			}
+			h.Add(HeaderLink, "<"+latest+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
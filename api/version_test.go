@@ -0,0 +1,70 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/api"
+)
+
+type router struct {
+	mux *chi.Mux
+}
+
+func (r router) Router() interface{} {
+	return r.mux
+}
+
+func TestMountVersions(t *testing.T) {
+	reply := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}
+	}
+
+	svc := &api.Service{APIName: "orders"}
+	svc.MountVersions("/api",
+		func(r chi.Router) {
+			r.Get("/orders", reply("orders"))
+			r.Get("/status", reply("ok"))
+		},
+		api.Version{
+			Name:       "v1",
+			Deprecated: true,
+			Sunset:     time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		api.Version{
+			Name: "v2",
+			Routes: func(r chi.Router) {
+				r.Get("/orders", reply("orders v2"))
+			},
+		},
+	)
+
+	mux := chi.NewRouter()
+	require.NoError(t, svc.Register(router{mux}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr := get("/api/v1/orders")
+	assert.Equal(t, "orders", rr.Body.String())
+	assert.Equal(t, "true", rr.Header().Get(api.HeaderDeprecation))
+	assert.Equal(t, "Tue, 01 Jan 2030 00:00:00 GMT", rr.Header().Get(api.HeaderSunset))
+	assert.Equal(t, `</api/v2>; rel="successor-version"`, rr.Header().Get(api.HeaderLink))
+
+	rr = get("/api/v2/orders")
+	assert.Equal(t, "orders v2", rr.Body.String())
+	assert.Empty(t, rr.Header().Get(api.HeaderDeprecation))
+
+	assert.Equal(t, "ok", get("/api/v2/status").Body.String())
+}
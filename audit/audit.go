@@ -0,0 +1,196 @@
+package audit
+
+// Audit trail of the security-relevant events, chained so removing or
+// altering a recorded event is detected
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/request"
+)
+
+// Types of the events
+const (
+	TypeAuthFailure = "auth_failure" // 401 and 403 responses
+	TypeClientError = "client_error" // other 4xx responses
+	TypeServerError = "server_error" // 5xx responses
+	TypeAdminAction = "admin_action"
+)
+
+// Event is an entry of the trail. Seq numbers the events and Hash chains
+// each to the previous one, Prev, so a gap or an edit breaks the chain.
+type Event struct {
+	Seq           uint64                 `json:"seq"`
+	Time          time.Time              `json:"time"`
+	Type          string                 `json:"type"`
+	RequestID     string                 `json:"request_id,omitempty"`
+	CorrelationID string                 `json:"correlation_id,omitempty"`
+	Method        string                 `json:"method,omitempty"`
+	Path          string                 `json:"path,omitempty"`
+	Status        int                    `json:"status,omitempty"`
+	Remote        string                 `json:"remote,omitempty"`
+	Actor         string                 `json:"actor,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+	Prev          string                 `json:"prev"`
+	Hash          string                 `json:"hash"`
+}
+
+// Sink stores the events, in order.
+type Sink interface {
+	Write(ctx context.Context, e Event) error
+}
+
+// Resumer is implemented by the sinks able to return the last event
+// stored, so the chain continues across restarts.
+type Resumer interface {
+	Last() (Event, bool, error)
+}
+
+// Trail numbers, chains and writes the events to its sink.
+type Trail struct {
+	Sink Sink
+
+	mu      sync.Mutex
+	resumed bool
+	seq     uint64
+	prev    string
+}
+
+// Record completes the event, the request and correlation IDs being taken
+// from ctx when missing, and writes it.
+func (t *Trail) Record(ctx context.Context, e Event) error {
+	if e.RequestID == "" {
+		e.RequestID = request.GetRequestID(ctx)
+	}
+	if e.CorrelationID == "" {
+		e.CorrelationID = request.GetCorrelationID(ctx)
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.resumed {
+		t.resumed = true
+		if r, ok := t.Sink.(Resumer); ok {
+			last, found, err := r.Last()
+			if err != nil {
+				return fmt.Errorf("error while resuming the audit trail: %w", err)
+			}
+			if found {
+				t.seq, t.prev = last.Seq, last.Hash
+			}
+		}
+	}
+	e.Seq, e.Prev = t.seq+1, t.prev
+	hash, err := Hash(e)
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+	if err := t.Sink.Write(ctx, e); err != nil {
+		return err
+	}
+	t.seq, t.prev = e.Seq, e.Hash
+	return nil
+}
+
+// Hash returns the hash of the event, Hash excluded.
+func Hash(e Event) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks the events are numbered in sequence and chained, returning
+// an error naming the first one which is not.
+func Verify(events []Event) error {
+	for i, e := range events {
+		hash, err := Hash(e)
+		if err != nil {
+			return err
+		}
+		if hash != e.Hash {
+			return fmt.Errorf("audit event %d was altered", e.Seq)
+		}
+		if i > 0 && (e.Seq != events[i-1].Seq+1 || e.Prev != events[i-1].Hash) {
+			return fmt.Errorf("audit events missing between %d and %d", events[i-1].Seq, e.Seq)
+		}
+	}
+	return nil
+}
+
+type trailKeyType int
+
+const trailKey trailKeyType = 0
+
+// FromContext returns the trail of the request, nil when auditing is
+// disabled.
+func FromContext(ctx context.Context) *Trail {
+	t, _ := ctx.Value(trailKey).(*Trail)
+	return t
+}
+
+// Record records the event in the trail of the request, such as an admin
+// action, doing nothing when auditing is disabled.
+func Record(r *http.Request, e Event) {
+	t := FromContext(r.Context())
+	if t == nil {
+		return
+	}
+	if e.Method == "" {
+		e.Method, e.Path, e.Remote = r.Method, r.URL.Path, r.RemoteAddr
+	}
+	if err := t.Record(r.Context(), e); err != nil {
+		logrus.WithError(err).WithField("type", e.Type).Error("error while recording the audit event")
+	}
+}
+
+// Middleware records the 4xx and 5xx responses, and makes the trail
+// available to the handlers through FromContext and Record. Installed
+// ahead of the request IDs and panic recovery, it reads the IDs from the
+// response headers.
+func (t *Trail) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), trailKey, t)))
+
+		e := Event{
+			Type:          classify(ww.Status()),
+			RequestID:     ww.Header().Get(request.HeaderRequestID),
+			CorrelationID: ww.Header().Get(request.HeaderCorrelationID),
+			Status:        ww.Status(),
+		}
+		if e.Type != "" {
+			Record(r.WithContext(context.WithValue(r.Context(), trailKey, t)), e)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+func classify(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return TypeAuthFailure
+	case status >= 500:
+		return TypeServerError
+	case status >= 400:
+		return TypeClientError
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package audit_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/audit"
+	"github.com/go-obvious/server/request"
+)
+
+// memory keeps the events written.
+type memory struct {
+	events []audit.Event
+}
+
+func (x *memory) Write(_ context.Context, e audit.Event) error {
+	x.events = append(x.events, e)
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	sink := &memory{}
+	trail := &audit.Trail{Sink: sink}
+	handler := trail.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(request.HeaderRequestID, "req-1")
+		w.Header().Set(request.HeaderCorrelationID, "corr-1")
+		switch r.URL.Path {
+		case "/private":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/admin":
+			audit.Record(r, audit.Event{Type: audit.TypeAdminAction, Actor: "alice", Details: map[string]interface{}{"maintenance": "false -> true"}})
+		}
+	}))
+	for _, path := range []string{"/public", "/private", "/missing", "/broken", "/admin"} {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.RemoteAddr = "203.0.113.7:4242"
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	require.Len(t, sink.events, 4, "successful responses are not audited")
+	types := make([]string, 0, len(sink.events))
+	for _, e := range sink.events {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []string{audit.TypeAuthFailure, audit.TypeClientError, audit.TypeServerError, audit.TypeAdminAction}, types)
+	failure := sink.events[0]
+	assert.Equal(t, uint64(1), failure.Seq)
+	assert.Equal(t, "req-1", failure.RequestID)
+	assert.Equal(t, "corr-1", failure.CorrelationID)
+	assert.Equal(t, http.StatusUnauthorized, failure.Status)
+	assert.Equal(t, "/private", failure.Path)
+	assert.Equal(t, "203.0.113.7:4242", failure.Remote)
+	assert.Equal(t, "alice", sink.events[3].Actor)
+	assert.NoError(t, audit.Verify(sink.events))
+
+	audit.Record(httptest.NewRequest(http.MethodGet, "/", nil), audit.Event{Type: audit.TypeAdminAction})
+	assert.Len(t, sink.events, 4, "nothing recorded outside of the middleware")
+}
+
+func TestVerify(t *testing.T) {
+	sink := &memory{}
+	trail := &audit.Trail{Sink: sink}
+	for _, status := range []int{401, 403, 500} {
+		require.NoError(t, trail.Record(context.Background(), audit.Event{Type: audit.TypeAuthFailure, Status: status}))
+	}
+	require.NoError(t, audit.Verify(sink.events))
+
+	altered := append([]audit.Event{}, sink.events...)
+	altered[1].Status = 200
+	assert.ErrorContains(t, audit.Verify(altered), "audit event 2 was altered")
+
+	removed := []audit.Event{sink.events[0], sink.events[2]}
+	assert.ErrorContains(t, audit.Verify(removed), "audit events missing between 1 and 3")
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "audit-2020-01-01.jsonl")
+	require.NoError(t, os.WriteFile(stale, []byte("{}\n"), 0o600))
+
+	file := &audit.File{Dir: dir, Retention: 24 * time.Hour}
+	trail := &audit.Trail{Sink: file}
+	require.NoError(t, trail.Record(context.Background(), audit.Event{Type: audit.TypeServerError}))
+	require.NoError(t, trail.Record(context.Background(), audit.Event{Type: audit.TypeServerError}))
+	require.NoError(t, file.Close())
+	assert.NoFileExists(t, stale, "removed past the retention")
+
+	// A new trail resumes the chain
+	trail = &audit.Trail{Sink: file}
+	require.NoError(t, trail.Record(context.Background(), audit.Event{Type: audit.TypeClientError}))
+	require.NoError(t, file.Close())
+
+	f, err := os.Open(filepath.Join(dir, "audit-"+time.Now().UTC().Format(time.DateOnly)+".jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+	events := []audit.Event{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 3)
+	assert.Equal(t, uint64(3), events[2].Seq)
+	assert.NoError(t, audit.Verify(events))
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan audit.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e audit.Event
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		received <- e
+	}))
+	defer srv.Close()
+
+	trail := &audit.Trail{Sink: &audit.Webhook{URL: srv.URL}}
+	require.NoError(t, trail.Record(context.Background(), audit.Event{Type: audit.TypeAdminAction, Actor: "alice"}))
+	e := <-received
+	assert.Equal(t, "alice", e.Actor)
+	assert.NotEmpty(t, e.Hash)
+}
@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Writer writes the events as JSON lines, such as to os.Stdout.
+type Writer struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+func (x *Writer) Write(_ context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	_, err = x.W.Write(append(data, '\n'))
+	return err
+}
+
+// Webhook posts each event as JSON to the given URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (x *Webhook) Write(ctx context.Context, e Event) error {
+	client := x.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, x.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// File writes the events as JSON lines to a file a day under Dir, named
+// audit-2006-01-02.jsonl, removing the files older than Retention, kept
+// forever when zero.
+type File struct {
+	Dir       string
+	Retention time.Duration
+
+	mu   sync.Mutex
+	day  string
+	file *os.File
+}
+
+const filePrefix, fileSuffix = "audit-", ".jsonl"
+
+func (x *File) Write(_ context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	day := e.Time.UTC().Format(time.DateOnly)
+	if day != x.day || x.file == nil {
+		if err := x.open(day); err != nil {
+			return err
+		}
+		x.prune(e.Time)
+	}
+	if _, err := x.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return x.file.Sync()
+}
+
+func (x *File) open(day string) error {
+	if x.file != nil {
+		_ = x.file.Close()
+		x.file = nil
+	}
+	if err := os.MkdirAll(x.Dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(x.Dir, filePrefix+day+fileSuffix), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	x.file, x.day = f, day
+	return nil
+}
+
+// prune removes the files of the days past the retention.
+func (x *File) prune(now time.Time) {
+	if x.Retention <= 0 {
+		return
+	}
+	oldest := now.UTC().Add(-x.Retention).Format(time.DateOnly)
+	for _, name := range x.files() {
+		if day := strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix); day < oldest {
+			_ = os.Remove(filepath.Join(x.Dir, name))
+		}
+	}
+}
+
+// files returns the names of the audit files, oldest first.
+func (x *File) files() []string {
+	entries, _ := os.ReadDir(x.Dir)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Last returns the last event of the newest file.
+func (x *File) Last() (Event, bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	names := x.files()
+	if len(names) == 0 {
+		return Event{}, false, nil
+	}
+	f, err := os.Open(filepath.Join(x.Dir, names[len(names)-1]))
+	if err != nil {
+		return Event{}, false, err
+	}
+	defer f.Close()
+	var last []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil || last == nil {
+		return Event{}, false, err
+	}
+	var e Event
+	if err := json.Unmarshal(last, &e); err != nil {
+		return Event{}, false, err
+	}
+	return e, true, nil
+}
+
+// Close closes the current file.
+func (x *File) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.file == nil {
+		return nil
+	}
+	err := x.file.Close()
+	x.file = nil
+	return err
+}
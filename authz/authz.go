@@ -0,0 +1,112 @@
+package authz
+
+// Authorization of the requests by an external policy engine, such as an
+// OPA sidecar, an embedded Rego evaluator or Cedar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/request"
+)
+
+var (
+	ErrDenied = errors.New("access denied")
+	ErrPolicy = errors.New("policy evaluation failed")
+)
+
+// Input is the document a request is evaluated against.
+type Input struct {
+	Principal interface{}            `json:"principal"`
+	Method    string                 `json:"method"`
+	Path      string                 `json:"path"`
+	Route     string                 `json:"route,omitempty"` // route pattern, such as "/orders/{id}"
+	Resource  map[string]interface{} `json:"resource,omitempty"`
+}
+
+// Decision is the verdict of the policy engine. ID identifies it in the
+// decision logs of the engine, and is returned to the denied clients.
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	ID     string `json:"decision_id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Engine evaluates the inputs against the policies.
+type Engine interface {
+	Decide(ctx context.Context, input Input) (Decision, error)
+}
+
+// EngineFunc adapts a function, such as one evaluating an embedded Rego
+// query or Cedar policy set, to the Engine interface.
+type EngineFunc func(ctx context.Context, input Input) (Decision, error)
+
+func (f EngineFunc) Decide(ctx context.Context, input Input) (Decision, error) {
+	return f(ctx, input)
+}
+
+// Authorizer submits the requests to Engine, replying 403 Forbidden, as a
+// request.Problem carrying the decision_id and reason of the decision, to
+// the denied ones. Requests are denied with 503 Service Unavailable when
+// the engine fails.
+//
+// The principal is the one stored with request.WithPrincipal, so the
+// authorizer goes after the authentication middleware. Mounted on the
+// routes, with Router.With or in a Route group, the input also holds the
+// route pattern and the URL parameters.
+type Authorizer struct {
+	Engine Engine
+
+	// Resource returns the attributes of the resource targeted by the
+	// request, its URL parameters by default
+	Resource func(r *http.Request) map[string]interface{}
+}
+
+func (a *Authorizer) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		input := a.input(r)
+		decision, err := a.Engine.Decide(r.Context(), input)
+		if err != nil {
+			logrus.WithError(err).WithField("path", input.Path).Error("authorization failed")
+			request.ReplyErr(w, r, request.NewHTTPError(ErrPolicy, http.StatusServiceUnavailable))
+			return
+		}
+		if !decision.Allow {
+			p := request.NewProblem(ErrDenied, http.StatusForbidden)
+			p.Detail = decision.Reason
+			if decision.ID != "" {
+				p.Extensions = map[string]interface{}{"decision_id": decision.ID}
+			}
+			request.ReplyErr(w, r, p)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (a *Authorizer) input(r *http.Request) Input {
+	input := Input{
+		Principal: request.RequestMetadata(r).Principal,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+	}
+	rctx := chi.RouteContext(r.Context())
+	if rctx != nil {
+		input.Route = rctx.RoutePattern()
+	}
+	switch {
+	case a.Resource != nil:
+		input.Resource = a.Resource(r)
+	case rctx != nil && len(rctx.URLParams.Keys) > 0:
+		input.Resource = make(map[string]interface{}, len(rctx.URLParams.Keys))
+		for i, key := range rctx.URLParams.Keys {
+			input.Resource[key] = rctx.URLParams.Values[i]
+		}
+	}
+	return input
+}
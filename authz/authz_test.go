@@ -0,0 +1,121 @@
+package authz_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/authz"
+	"github.com/go-obvious/server/request"
+)
+
+type user struct {
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+}
+
+func router(engine authz.Engine) http.Handler {
+	az := &authz.Authorizer{Engine: engine}
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := user{Name: r.Header.Get("X-User"), Admin: r.Header.Get("X-Admin") != ""}
+			next.ServeHTTP(w, r.WithContext(request.WithPrincipal(r.Context(), principal)))
+		})
+	})
+	r.With(az.Middleware).Delete("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return r
+}
+
+func TestAuthorizer(t *testing.T) {
+	var got authz.Input
+	engine := authz.EngineFunc(func(ctx context.Context, input authz.Input) (authz.Decision, error) {
+		got = input
+		if input.Principal.(user).Admin {
+			return authz.Decision{Allow: true, ID: "d-1"}, nil
+		}
+		return authz.Decision{ID: "d-2", Reason: "admins only"}, nil
+	})
+	h := router(engine)
+
+	r := httptest.NewRequest(http.MethodDelete, "/orders/42", nil)
+	r.Header.Set("X-User", "ann")
+	r.Header.Set("X-Admin", "1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, authz.Input{
+		Principal: user{Name: "ann", Admin: true},
+		Method:    http.MethodDelete,
+		Path:      "/orders/42",
+		Route:     "/orders/{id}",
+		Resource:  map[string]interface{}{"id": "42"},
+	}, got)
+
+	r = httptest.NewRequest(http.MethodDelete, "/orders/42", nil)
+	r.Header.Set("X-User", "bob")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, request.ContentTypeProblemJSON, w.Header().Get(request.HeaderContentType))
+	var problem map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "admins only", problem["detail"])
+	assert.Equal(t, "d-2", problem["decision_id"])
+}
+
+func TestAuthorizerEngineFailure(t *testing.T) {
+	h := router(authz.EngineFunc(func(ctx context.Context, input authz.Input) (authz.Decision, error) {
+		return authz.Decision{}, errors.New("connection refused")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/orders/42", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "connection refused")
+}
+
+func TestOPA(t *testing.T) {
+	var result string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input authz.Input `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Input.Method != http.MethodGet {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"decision_id": "opa-1"` + result + `}`))
+	}))
+	defer srv.Close()
+	opa := &authz.OPA{URL: srv.URL + "/v1/data/httpapi/authz"}
+	input := authz.Input{Method: http.MethodGet, Path: "/orders"}
+
+	for res, want := range map[string]authz.Decision{
+		`, "result": true`:  {Allow: true, ID: "opa-1"},
+		`, "result": false`: {ID: "opa-1"},
+		`, "result": {"allow": false, "reason": "suspended"}`: {ID: "opa-1", Reason: "suspended"},
+		``: {ID: "opa-1", Reason: "undefined policy decision"},
+	} {
+		result = res
+		decision, err := opa.Decide(context.Background(), input)
+		require.NoError(t, err, res)
+		assert.Equal(t, want, decision, res)
+	}
+
+	result = `, "result": "yes"`
+	_, err := opa.Decide(context.Background(), input)
+	assert.Error(t, err)
+
+	_, err = opa.Decide(context.Background(), authz.Input{Method: http.MethodPost})
+	assert.ErrorContains(t, err, "unexpected status 400")
+}
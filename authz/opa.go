@@ -0,0 +1,69 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// OPA evaluates the inputs with the data API of an Open Policy Agent
+// server, usually a sidecar, the decision being the document of URL:
+//
+//	&authz.OPA{URL: "http://localhost:8181/v1/data/httpapi/authz"}
+//
+// The document is either a boolean or an object with an "allow" boolean and
+// an optional "reason". Decision IDs are the ones of the OPA decision logs.
+type OPA struct {
+	URL    string
+	Client *http.Client // http.DefaultClient when nil
+}
+
+type opaResponse struct {
+	Result     json.RawMessage `json:"result"`
+	DecisionID string          `json:"decision_id"`
+}
+
+func (o *OPA) Decide(ctx context.Context, input Input) (Decision, error) {
+	body, err := json.Marshal(map[string]Input{"input": input})
+	if err != nil {
+		return Decision{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("opa: unexpected status %d", resp.StatusCode)
+	}
+
+	var out opaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Decision{}, fmt.Errorf("opa: %w", err)
+	}
+	decision := Decision{ID: out.DecisionID}
+	switch {
+	case len(out.Result) == 0:
+		// Undefined decision, the policy is missing or has no default
+		decision.Reason = "undefined policy decision"
+	case json.Unmarshal(out.Result, &decision.Allow) == nil:
+	default:
+		if err := json.Unmarshal(out.Result, &decision); err != nil {
+			return Decision{}, fmt.Errorf("opa: unexpected result %s", out.Result)
+		}
+		decision.ID = out.DecisionID
+	}
+	return decision, nil
+}
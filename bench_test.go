@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server"
+	"github.com/go-obvious/server/api"
+	"github.com/go-obvious/server/request"
+)
+
+// benchServer returns the router of a server with the default middleware
+// chain, rate limiting included, serving a small JSON document on /orders.
+// The logs are formatted but discarded.
+func benchServer(b *testing.B) http.Handler {
+	out := logrus.StandardLogger().Out
+	logrus.SetOutput(io.Discard)
+	b.Cleanup(func() { logrus.SetOutput(out) })
+	b.Setenv("SERVER_RATE_LIMIT", "1000000000")
+	b.Setenv("SERVER_RATE_LIMIT_BURST", "1000000000")
+	svc := &api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": chi.NewRouter()}}
+	svc.Mounts["/orders"].Get("/", func(w http.ResponseWriter, r *http.Request) {
+		request.Reply(r, w, map[string]string{"id": "42"}, http.StatusOK)
+	})
+	return api.ChiRouter(server.NewWithOptions(version, server.WithAPIs(service{svc})))
+}
+
+func benchRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Accept", "application/json")
+	return r
+}
+
+// BenchmarkMiddlewareChain measures the per-request overhead of the
+// middlewares: rate limiting, security headers, CORS, request IDs, panic
+// recovery and logging.
+func BenchmarkMiddlewareChain(b *testing.B) {
+	handler := benchServer(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, benchRequest())
+		if rr.Code != http.StatusOK {
+			b.Fatalf("status %d", rr.Code)
+		}
+	}
+}
+
+func BenchmarkMiddlewareChainParallel(b *testing.B) {
+	handler := benchServer(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			handler.ServeHTTP(httptest.NewRecorder(), benchRequest())
+		}
+	})
+}
+
+// BenchmarkMiddlewareChainSkipping measures the chain with quiet routes and
+// runtime toggles configured, both left out of the compiled chain of
+// /orders and /healthz respectively.
+func BenchmarkMiddlewareChainSkipping(b *testing.B) {
+	b.Setenv("SERVER_QUIET_ROUTES", "/jobs/*/status,/metrics,/ping")
+	b.Setenv("SERVER_ADMIN_TOKENS", "bench-token")
+	handler := benchServer(b)
+	for _, path := range []string{"/orders", "/healthz"} {
+		b.Run(path, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r := benchRequest()
+				r.URL.Path = path
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, r)
+				if rr.Code != http.StatusOK {
+					b.Fatalf("status %d", rr.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package client
+
+// Outbound HTTP client propagating the correlation of the request being
+// served to the downstream services
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"github.com/go-obvious/server/egress"
+	"github.com/go-obvious/server/request"
+)
+
+// Config of the outbound client, which may be registered with
+// config.Register to be loaded from the environment. Zero values keep the
+// settings of http.DefaultTransport.
+type Config struct {
+	Timeout time.Duration `envconfig:"CLIENT_TIMEOUT" default:"30s"` // bounds each request, zero for no timeout
+
+	// Idempotent requests unanswered after HedgeDelay are sent again, the
+	// first success being used. Zero disables hedging.
+	HedgeDelay    time.Duration `envconfig:"CLIENT_HEDGE_DELAY" default:"0"`
+	HedgeAttempts int           `envconfig:"CLIENT_HEDGE_ATTEMPTS" default:"2"` // attempts in total
+
+	// Failed idempotent requests are sent again up to Retries times, after
+	// a jittered exponential backoff starting at RetryBackoff. Zero
+	// disables the retries.
+	Retries      int           `envconfig:"CLIENT_RETRIES" default:"0"`
+	RetryBackoff time.Duration `envconfig:"CLIENT_RETRY_BACKOFF" default:"100ms"`
+
+	// Connection pool, the net/http default of 2 idle connections per host
+	// throttles services fanning out to a few downstreams
+	MaxIdleConns          int           `envconfig:"CLIENT_MAX_IDLE_CONNS" default:"100"`
+	MaxIdleConnsPerHost   int           `envconfig:"CLIENT_MAX_IDLE_CONNS_PER_HOST" default:"32"`
+	MaxConnsPerHost       int           `envconfig:"CLIENT_MAX_CONNS_PER_HOST" default:"0"`
+	IdleConnTimeout       time.Duration `envconfig:"CLIENT_IDLE_CONN_TIMEOUT" default:"90s"`
+	DialTimeout           time.Duration `envconfig:"CLIENT_DIAL_TIMEOUT" default:"30s"`
+	TLSHandshakeTimeout   time.Duration `envconfig:"CLIENT_TLS_HANDSHAKE_TIMEOUT" default:"10s"`
+	ResponseHeaderTimeout time.Duration `envconfig:"CLIENT_RESPONSE_HEADER_TIMEOUT" default:"0"`
+
+	// Restricts the destinations when set, for requests to user supplied URLs
+	Egress *egress.Policy `ignored:"true"`
+}
+
+func (c *Config) Load() error {
+	return envconfig.Process("client", c)
+}
+
+// transport returns a clone of http.DefaultTransport tuned with the
+// configuration.
+func (c *Config) transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c.DialTimeout > 0 || c.Egress != nil {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if c.DialTimeout > 0 {
+			dialer.Timeout = c.DialTimeout
+		}
+		if c.Egress != nil {
+			dialer.Control = c.Egress.Control
+		}
+		t.DialContext = dialer.DialContext
+	}
+	if c.MaxIdleConns > 0 {
+		t.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+	if c.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = c.IdleConnTimeout
+	}
+	if c.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	}
+	if c.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+	}
+	return t
+}
+
+// New returns an http.Client propagating the correlation headers and
+// hedging the idempotent requests as cfg sets, its requests, retries and
+// connection pool being reported by DefaultMetrics. Destinations denied by
+// the egress policy, if any, fail with egress.ErrDenied.
+func New(cfg Config) *http.Client {
+	var base http.RoundTripper = cfg.transport()
+	if cfg.Egress != nil {
+		base = cfg.Egress.RoundTripper(base)
+	}
+	var rt http.RoundTripper = &Transport{Base: base}
+	if cfg.Retries > 0 {
+		rt = &Retry{Base: rt, Retries: cfg.Retries, Backoff: cfg.RetryBackoff}
+	}
+	if cfg.HedgeDelay > 0 {
+		rt = &Hedged{Base: rt, Delay: cfg.HedgeDelay, Attempts: cfg.HedgeAttempts}
+	}
+	return &http.Client{Transport: rt, Timeout: cfg.Timeout}
+}
+
+// Transport sets the request, correlation and trace IDs of the request
+// context, along with its W3C trace context and the B3 and baggage headers
+// of the caller, on the outbound requests which do not carry their own,
+// and records the requests and connections in Metrics.
+type Transport struct {
+	Base    http.RoundTripper // defaults to http.DefaultTransport
+	Metrics *Metrics          // defaults to DefaultMetrics
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx := req.Context()
+	var out *http.Request
+	for name, value := range request.TraceHeaders(ctx) {
+		if req.Header.Get(name) != "" {
+			continue
+		}
+		// A RoundTripper must not modify the request
+		if out == nil {
+			out = req.Clone(ctx)
+		}
+		out.Header.Set(name, value)
+	}
+	if out == nil {
+		out = req
+	}
+
+	m := t.Metrics
+	if m == nil {
+		m = DefaultMetrics
+	}
+	out = out.WithContext(httptrace.WithClientTrace(out.Context(), m.trace()))
+	m.requests.Add(1)
+	m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+	resp, err := base.RoundTrip(out)
+	if err != nil {
+		m.errors.Add(1)
+	}
+	return resp, err
+}
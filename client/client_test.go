@@ -0,0 +1,178 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/client"
+	"github.com/go-obvious/server/internal/middleware/requestid"
+	"github.com/go-obvious/server/request"
+)
+
+func TestTransport(t *testing.T) {
+	var requestID, correlation, trace, traceparent, b3 string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = r.Header.Get(request.HeaderRequestID)
+		correlation = r.Header.Get(request.HeaderCorrelationID)
+		trace = r.Header.Get(request.HeaderTraceID)
+		traceparent = r.Header.Get(request.HeaderTraceParent)
+		b3 = r.Header.Get(request.HeaderB3)
+	}))
+	defer srv.Close()
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := requestid.SaveContext(context.Background(), &requestid.Context{
+		RequestID:     "r1",
+		CorrelationID: "c1",
+		TraceID:       "t1",
+		TraceParent:   parent,
+		B3:            http.Header{request.HeaderB3: {"4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1"}},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+
+	resp, err := client.New(client.Config{}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "r1", requestID)
+	assert.Equal(t, "c1", correlation)
+	assert.Equal(t, "t1", trace)
+	assert.Equal(t, parent, traceparent)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1", b3)
+	assert.Empty(t, req.Header.Get(request.HeaderCorrelationID), "the request is left untouched")
+}
+
+func TestHedged(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte("fast"))
+	}))
+	defer srv.Close()
+	c := client.New(client.Config{HedgeDelay: 50 * time.Millisecond})
+
+	start := time.Now()
+	resp, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	buf := new(strings.Builder)
+	_, _ = io.Copy(buf, resp.Body)
+	assert.Equal(t, "fast", buf.String())
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(2), calls.Load())
+
+	calls.Store(1)
+	resp, err = c.Post(srv.URL, request.ContentTypeJSON, strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(2), calls.Load(), "POST requests are not hedged")
+}
+
+func TestHedgedFailure(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	resp, err := client.New(client.Config{HedgeDelay: time.Minute, HedgeAttempts: 3}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "a failure is hedged without waiting")
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRetry(t *testing.T) {
+	var calls atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+	m := &client.Metrics{}
+	c := &http.Client{Transport: &client.Retry{Base: srv.Client().Transport, Retries: 3, Backoff: time.Millisecond, Metrics: m}}
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("payload"))
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"payload", "payload", "payload"}, bodies, "the body is sent again")
+	assert.Equal(t, int64(2), m.Stats().Retries)
+
+	calls.Store(0)
+	resp, err = c.Post(srv.URL, request.ContentTypeJSON, strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "POST requests are not retried")
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(1)
+	req, err = http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("{}"))
+	require.NoError(t, err)
+	req.Header.Set("Idempotency-Key", "k1")
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "unless they carry an idempotency key")
+}
+
+func TestMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	m := &client.Metrics{}
+	c := &http.Client{Transport: &client.Transport{Base: srv.Client().Transport, Metrics: m}}
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(srv.URL)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, client.Stats{Requests: 2, ConnsNew: 1, ConnsReused: 1}, m.Stats())
+}
+
+func TestConfigLoad(t *testing.T) {
+	t.Setenv("CLIENT_MAX_IDLE_CONNS_PER_HOST", "64")
+	t.Setenv("CLIENT_HEDGE_DELAY", "150ms")
+	t.Setenv("CLIENT_RETRIES", "2")
+
+	cfg := client.Config{}
+	require.NoError(t, cfg.Load())
+	assert.Equal(t, 64, cfg.MaxIdleConnsPerHost)
+	assert.Equal(t, 150*time.Millisecond, cfg.HedgeDelay)
+	assert.Equal(t, 2, cfg.Retries)
+	assert.Equal(t, 100*time.Millisecond, cfg.RetryBackoff)
+	assert.Equal(t, 30*time.Second, cfg.Timeout)
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Hedged sends another attempt of the GET and HEAD requests left
+// unanswered after Delay, or failed, and returns the first success, so a
+// single slow or flaky instance of a downstream does not stall the caller.
+// Responses with a 5xx status are failures.
+type Hedged struct {
+	Base     http.RoundTripper // defaults to http.DefaultTransport
+	Delay    time.Duration
+	Attempts int // attempts in total, defaults to 2
+}
+
+type attempt struct {
+	n    int
+	resp *http.Response
+	err  error
+}
+
+func (a attempt) success() bool {
+	return a.err == nil && a.resp.StatusCode < http.StatusInternalServerError
+}
+
+func (h *Hedged) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := h.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead || req.Body != nil && req.Body != http.NoBody {
+		return base.RoundTrip(req)
+	}
+	attempts := h.Attempts
+	if attempts <= 0 {
+		attempts = 2
+	}
+
+	results := make(chan attempt, attempts)
+	cancels := make([]context.CancelFunc, 0, attempts)
+	pending := 0
+	send := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		n := len(cancels)
+		cancels = append(cancels, cancel)
+		pending++
+		go func() {
+			resp, err := base.RoundTrip(req.Clone(ctx))
+			results <- attempt{n: n, resp: resp, err: err}
+		}()
+	}
+
+	timer := time.NewTimer(h.Delay)
+	defer timer.Stop()
+	send()
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) < attempts {
+				send()
+				timer.Reset(h.Delay)
+			}
+			continue
+		case a := <-results:
+			pending--
+			if a.success() {
+				for n, cancel := range cancels {
+					if n != a.n {
+						cancel()
+					}
+				}
+				go discard(results, pending, cancels)
+				a.resp.Body = &cancelBody{ReadCloser: a.resp.Body, cancel: cancels[a.n]}
+				return a.resp, nil
+			}
+
+			retry := len(cancels) < attempts && req.Context().Err() == nil
+			if pending == 0 && !retry {
+				// Every attempt failed, the last one is returned
+				if a.resp == nil {
+					cancels[a.n]()
+					return nil, a.err
+				}
+				a.resp.Body = &cancelBody{ReadCloser: a.resp.Body, cancel: cancels[a.n]}
+				return a.resp, nil
+			}
+			release(a, cancels)
+			// A failure is hedged right away
+			if retry {
+				send()
+				timer.Reset(h.Delay)
+			}
+		}
+	}
+}
+
+// discard releases the attempts still in flight once one succeeded.
+func discard(results chan attempt, pending int, cancels []context.CancelFunc) {
+	for ; pending > 0; pending-- {
+		release(<-results, cancels)
+	}
+}
+
+func release(a attempt, cancels []context.CancelFunc) {
+	cancels[a.n]()
+	if a.resp != nil {
+		_, _ = io.Copy(io.Discard, a.resp.Body)
+		a.resp.Body.Close()
+	}
+}
+
+// cancelBody cancels the context of its attempt once closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
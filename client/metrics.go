@@ -0,0 +1,67 @@
+package client
+
+import (
+	"expvar"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// DefaultMetrics records the requests of the clients returned by New. It is
+// published as the "client" expvar, served under /debug/vars.
+var DefaultMetrics = &Metrics{}
+
+func init() {
+	expvar.Publish("client", expvar.Func(func() interface{} {
+		return DefaultMetrics.Stats()
+	}))
+}
+
+// Metrics counts the outbound requests and the connections of their pool.
+type Metrics struct {
+	requests    atomic.Int64
+	inFlight    atomic.Int64
+	errors      atomic.Int64
+	retries     atomic.Int64
+	connsNew    atomic.Int64
+	connsReused atomic.Int64
+	dialErrors  atomic.Int64
+}
+
+type Stats struct {
+	Requests    int64 `json:"requests"`
+	InFlight    int64 `json:"in_flight"`
+	Errors      int64 `json:"errors"`
+	Retries     int64 `json:"retries"`
+	ConnsNew    int64 `json:"conns_new"`    // connections opened
+	ConnsReused int64 `json:"conns_reused"` // requests sent on a pooled connection
+	DialErrors  int64 `json:"dial_errors"`
+}
+
+func (m *Metrics) Stats() Stats {
+	return Stats{
+		Requests:    m.requests.Load(),
+		InFlight:    m.inFlight.Load(),
+		Errors:      m.errors.Load(),
+		Retries:     m.retries.Load(),
+		ConnsNew:    m.connsNew.Load(),
+		ConnsReused: m.connsReused.Load(),
+		DialErrors:  m.dialErrors.Load(),
+	}
+}
+
+func (m *Metrics) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				m.connsReused.Add(1)
+			} else {
+				m.connsNew.Add(1)
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				m.dialErrors.Add(1)
+			}
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRetryAfter bounds the wait a Retry-After header asks for, longer ones
+// returning the response instead.
+const maxRetryAfter = 10 * time.Second
+
+// Retry sends the idempotent requests again when they fail with a network
+// error or a 429, 502, 503 or 504 status, waiting a jittered exponential
+// backoff or the Retry-After of the response. The methods GET, HEAD,
+// OPTIONS, PUT and DELETE are idempotent, as are the requests carrying an
+// Idempotency-Key header. Requests with a body need GetBody, which
+// http.NewRequest sets for the usual readers.
+type Retry struct {
+	Base    http.RoundTripper // defaults to http.DefaultTransport
+	Retries int               // retries after the first attempt
+	Backoff time.Duration     // defaults to 100ms
+	Metrics *Metrics          // defaults to DefaultMetrics
+}
+
+func (rt *Retry) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := rt.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !retryable(req) {
+		return base.RoundTrip(req)
+	}
+	backoff := rt.Backoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	m := rt.Metrics
+	if m == nil {
+		m = DefaultMetrics
+	}
+
+	for n := 0; ; n++ {
+		attempt := req
+		if n > 0 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt = req.Clone(req.Context())
+			attempt.Body = body
+		}
+		resp, err := base.RoundTrip(attempt)
+		if n >= rt.Retries || !failed(resp, err) {
+			return resp, err
+		}
+
+		wait := backoff << n
+		wait = wait/2 + rand.N(wait/2+1)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				if after > maxRetryAfter {
+					return resp, nil
+				}
+				wait = after
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		m.retries.Add(1)
+	}
+}
+
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func failed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay of the Retry-After header, in seconds or as
+// an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
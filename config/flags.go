@@ -0,0 +1,254 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-obvious/server/redact"
+)
+
+var (
+	flagArgs []string
+	flagSet  *flag.FlagSet
+)
+
+// UseFlags makes Load override the configurations with the command-line
+// flags found in args, typically os.Args[1:]. Flags are declared with a
+// `flag` struct tag on the fields of the registered configurations:
+//
+//	Port uint `envconfig:"SERVER_PORT" default:"8080" flag:"port"`
+//
+// A flag which is not set keeps the environment value. Passing nil stops
+// parsing flags.
+func UseFlags(args []string) {
+	mu.Lock()
+	defer mu.Unlock()
+	flagArgs = args
+	flagSet = nil
+}
+
+// Args returns the arguments remaining after the flags, such as a
+// subcommand, once Load has parsed them.
+func Args() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	if flagSet == nil {
+		return nil
+	}
+	return flagSet.Args()
+}
+
+// parseFlags binds the tagged fields of the configurations and parses the
+// command-line flags into them.
+func parseFlags(cfgs []Configurable) error {
+	if flagArgs == nil {
+		return nil
+	}
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(redact.Writer(os.Stderr))
+	values := map[string]*flagValue{}
+	for _, cfg := range cfgs {
+		if err := bindFlags(fs, values, reflect.ValueOf(cfg), false); err != nil {
+			return err
+		}
+	}
+	flagSet = fs
+	return fs.Parse(flagArgs)
+}
+
+// Peek loads cfg from the environment, then applies the command-line flags
+// as Load would, without registering it nor loading the registered
+// configurations. The flags of Server and of the registered configurations
+// are accepted but ignored, so that none of their secrets is resolved.
+func Peek(cfg Configurable) error {
+	if err := cfg.Load(); err != nil {
+		return redact.Error(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if flagArgs == nil {
+		return nil
+	}
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(redact.Writer(os.Stderr))
+	values := map[string]*flagValue{}
+	if err := bindFlags(fs, values, reflect.ValueOf(cfg), false); err != nil {
+		return redact.Error(err)
+	}
+	for _, other := range append([]Configurable{&Server{}}, configurations...) {
+		// Bound to a copy, the registered configuration being left untouched
+		t := reflect.TypeOf(other)
+		if t.Kind() != reflect.Ptr {
+			continue
+		}
+		if err := bindFlags(fs, values, reflect.New(t.Elem()), true); err != nil {
+			return redact.Error(err)
+		}
+	}
+	flagSet = fs
+	return redact.Error(fs.Parse(flagArgs))
+}
+
+// bindFlags binds the tagged fields of v, whose flags are parsed but not
+// set when ignored.
+func bindFlags(fs *flag.FlagSet, values map[string]*flagValue, v reflect.Value, ignored bool) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if !v.CanSet() {
+				return nil
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, f := t.Field(i), v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("flag")
+		if name == "" {
+			if field.Anonymous {
+				if err := bindFlags(fs, values, f, ignored); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// The same configuration may be registered more than once
+		if value, ok := values[name]; ok {
+			value.targets = append(value.targets, f)
+			continue
+		}
+		env := field.Tag.Get("envconfig")
+		value := &flagValue{
+			targets:   []reflect.Value{f},
+			sensitive: redact.Sensitive(name) || env != "" && redact.Sensitive(env),
+			ignored:   ignored,
+		}
+		if _, err := parse(f.Type(), value.String()); err != nil {
+			return fmt.Errorf("flag %s: %w", name, err)
+		}
+		usage := field.Name
+		if env != "" {
+			usage = "overrides " + env
+		}
+		values[name] = value
+		fs.Var(value, name, usage)
+	}
+	return nil
+}
+
+// flagValue sets the fields bound to a flag.
+type flagValue struct {
+	targets   []reflect.Value
+	sensitive bool // values redacted from the errors and logs
+	ignored   bool // values dropped, neither parsed nor set
+}
+
+func (v *flagValue) String() string {
+	if v == nil || len(v.targets) == 0 {
+		return ""
+	}
+	f := v.targets[0]
+	// Keep secrets out of the usage message
+	if _, ok := f.Addr().Interface().(decoder); ok {
+		return ""
+	}
+	if f.Kind() == reflect.Slice {
+		parts := make([]string, f.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(f.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(f.Interface())
+}
+
+func (v *flagValue) Set(s string) error {
+	if v.sensitive {
+		redact.AddValue(s)
+	}
+	if v.ignored {
+		return nil
+	}
+	parsed, err := parse(v.targets[0].Type(), s)
+	if err != nil {
+		return err
+	}
+	for _, f := range v.targets {
+		f.Set(parsed)
+	}
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return len(v.targets) > 0 && v.targets[0].Kind() == reflect.Bool
+}
+
+// decoder matches envconfig.Decoder, such as Secret.
+type decoder interface {
+	Decode(value string) error
+}
+
+func parse(t reflect.Type, s string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if d, ok := v.Addr().Interface().(decoder); ok {
+		return v, d.Decode(s)
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		v.SetInt(int64(d))
+		return v, err
+	}
+
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, t.Bits())
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, t.Bits())
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		n, err = strconv.ParseFloat(s, t.Bits())
+		v.SetFloat(n)
+	case reflect.Slice:
+		if s == "" {
+			return v, nil
+		}
+		parts := strings.Split(s, ",")
+		v = reflect.MakeSlice(t, len(parts), len(parts))
+		for i, part := range parts {
+			item, err := parse(t.Elem(), strings.TrimSpace(part))
+			if err != nil {
+				return v, err
+			}
+			v.Index(i).Set(item)
+		}
+	default:
+		err = fmt.Errorf("unsupported type %s", t)
+	}
+	return v, err
+}
@@ -0,0 +1,100 @@
+package config_test
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/config"
+)
+
+func TestFlags(t *testing.T) {
+	t.Setenv("SERVER_PORT", "9000")
+	t.Setenv("SERVER_MODE", "https")
+
+	first, second := config.Server{}, config.Server{}
+	config.Register(&first, &second)
+	config.UseFlags([]string{"--port", "9100", "--cert-file=/tls/cert.pem", "--debug-endpoints", "--cors-allowed-origins", "https://a.example.com,https://b.example.com", "healthcheck"})
+	defer config.UseFlags(nil)
+
+	require.NoError(t, config.Load())
+
+	for _, cfg := range []config.Server{first, second} {
+		assert.Equal(t, uint(9100), cfg.Port)
+		assert.Equal(t, "https", cfg.Mode, "unset flags keep the environment value")
+		assert.Equal(t, config.Secret("/tls/cert.pem"), cfg.Certificate.Cert)
+		assert.True(t, cfg.DebugEndpoints)
+		assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.AllowedOrigins)
+	}
+	assert.Equal(t, []string{"healthcheck"}, config.Args())
+
+	config.UseFlags([]string{"--port", "http"})
+	assert.Error(t, config.Load())
+}
+
+// appConfig is a configuration failing to load with a value of the
+// environment in its error
+type appConfig struct {
+	fail bool
+}
+
+func (c *appConfig) Load() error {
+	if c.fail {
+		return fmt.Errorf("converting %q to type int", os.Getenv("APP_API_TOKEN"))
+	}
+	return nil
+}
+
+func TestLoadRedactsErrors(t *testing.T) {
+	t.Setenv("APP_API_TOKEN", "tok-123456")
+	app := &appConfig{fail: true}
+	config.Register(app)
+	defer func() { app.fail = false }()
+
+	err := config.Load()
+	require.Error(t, err)
+	assert.Equal(t, `converting "[REDACTED]" to type int`, err.Error())
+}
+
+// tokenConfig is a configuration of the application declaring a secret flag
+type tokenConfig struct {
+	Token config.Secret `envconfig:"APP_TOKEN" flag:"app-token"`
+}
+
+func (c *tokenConfig) Load() error {
+	return envconfig.Process("app", c)
+}
+
+func TestPeek(t *testing.T) {
+	t.Setenv("SERVER_MODE", "https")
+	t.Setenv("SERVER_COOKIE_KEYS", "env://APP_MISSING_KEY")
+	app := &tokenConfig{}
+	config.Register(app)
+	config.UseFlags([]string{"--port", "9100", "--cert-file", "env://APP_MISSING_KEY", "--app-token", "env://APP_MISSING_KEY", "healthcheck"})
+	defer config.UseFlags(nil)
+
+	probe := config.Probe{}
+	require.NoError(t, config.Peek(&probe), "the secrets are not resolved")
+	assert.Equal(t, uint(9100), probe.Port)
+	assert.Equal(t, "https", probe.Mode)
+	assert.Equal(t, "/healthz", probe.HealthPath)
+	assert.Equal(t, []string{"healthcheck"}, config.Args())
+	assert.Empty(t, app.Token, "the registered configurations are left untouched")
+}
+
+func TestProbeFields(t *testing.T) {
+	server := reflect.TypeOf(config.Server{})
+	probe := reflect.TypeOf(config.Probe{})
+	for i := 0; i < probe.NumField(); i++ {
+		field := probe.Field(i)
+		same, ok := server.FieldByName(field.Name)
+		require.True(t, ok, field.Name)
+		assert.Equal(t, same.Type, field.Type, field.Name)
+		assert.Equal(t, same.Tag, field.Tag, field.Name)
+	}
+}
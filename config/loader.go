@@ -2,6 +2,8 @@ package config
 
 import (
 	"sync"
+
+	"github.com/go-obvious/server/redact"
 )
 
 type Configurable interface {
@@ -19,11 +21,17 @@ func Register(cfgs ...Configurable) {
 	configurations = append(configurations, cfgs...)
 }
 
+// Load loads the registered configurations, then applies the command-line
+// flags. The values of the sensitive variables, flags and secrets are
+// redacted from the errors.
 func Load() error {
 	for _, cfg := range configurations {
 		if err := cfg.Load(); err != nil {
-			return err
+			return redact.Error(err)
 		}
 	}
-	return nil
+
+	mu.Lock()
+	defer mu.Unlock()
+	return redact.Error(parseFlags(configurations))
 }
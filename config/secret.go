@@ -0,0 +1,77 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-obvious/server/redact"
+	"github.com/go-obvious/server/secrets"
+)
+
+// Secret is a configuration value which may be a reference resolved by the
+// secrets providers when loaded, such as "vault://secret/data/app#jwt",
+// "file:///run/secrets/jwt" or "env://JWT_KEY". Other values are kept as is.
+// The resolved values are redacted from the logs of the server.
+//
+//	JWTSigningKey config.Secret `envconfig:"APP_JWT_SIGNING_KEY"`
+type Secret string
+
+// secretTimeout bounds the resolution of a secret when loading the configuration.
+const secretTimeout = 30 * time.Second
+
+// Decode implements envconfig.Decoder, failing when the secret cannot be
+// resolved within 30 seconds.
+func (s *Secret) Decode(value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+
+	resolved, err := secrets.Resolve(ctx, value)
+	if err != nil {
+		return fmt.Errorf("decoding secret: %w", err)
+	}
+	redact.AddValue(resolved)
+	*s = Secret(resolved)
+	return nil
+}
+
+func (s Secret) String() string {
+	return string(s)
+}
+
+// TLS returns the certificate key pair. Cert and Key hold either PEM
+// material, typically resolved from a secret, or the path of a PEM file.
+func (c *Certificate) TLS() (tls.Certificate, error) {
+	if isPEM(string(c.Cert)) || isPEM(string(c.Key)) {
+		return tls.X509KeyPair([]byte(c.Cert), []byte(c.Key))
+	}
+	return tls.LoadX509KeyPair(string(c.Cert), string(c.Key))
+}
+
+// ClientCAs returns the pool of the ClientCA bundle, nil when unset.
+func (c *TLSClientAuth) ClientCAs() (*x509.CertPool, error) {
+	if c.ClientCA == "" {
+		return nil, nil
+	}
+	data := []byte(c.ClientCA)
+	if !isPEM(string(c.ClientCA)) {
+		var err error
+		if data, err = os.ReadFile(string(c.ClientCA)); err != nil {
+			return nil, err
+		}
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificate found in the client CA bundle")
+	}
+	return pool, nil
+}
+
+func isPEM(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), "-----BEGIN")
+}
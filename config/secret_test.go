@@ -0,0 +1,39 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/config"
+	"github.com/go-obvious/server/redact"
+)
+
+func TestSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(path, []byte("file-secret\n"), 0o600))
+
+	t.Setenv("APP_SECRET_KEY", "env-secret")
+	t.Setenv("APP_SIGNING_KEY", "env://APP_SECRET_KEY")
+	t.Setenv("APP_FILE_KEY", "file://"+path)
+	t.Setenv("APP_PLAIN_KEY", "plain")
+
+	var cfg struct {
+		SigningKey config.Secret `envconfig:"APP_SIGNING_KEY"`
+		FileKey    config.Secret `envconfig:"APP_FILE_KEY"`
+		PlainKey   config.Secret `envconfig:"APP_PLAIN_KEY"`
+	}
+	require.NoError(t, envconfig.Process("app", &cfg))
+
+	assert.Equal(t, config.Secret("env-secret"), cfg.SigningKey)
+	assert.Equal(t, config.Secret("file-secret"), cfg.FileKey)
+	assert.Equal(t, config.Secret("plain"), cfg.PlainKey)
+	assert.Equal(t, "key "+redact.Placeholder, redact.String("key file-secret"), "resolved secrets are redacted")
+
+	t.Setenv("APP_SIGNING_KEY", "env://APP_MISSING_KEY")
+	assert.Error(t, envconfig.Process("app", &cfg))
+}
@@ -1,21 +1,325 @@
 package config
 
 import (
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Server struct {
-	Mode   string `envconfig:"SERVER_MODE" default:"http"`
-	Domain string `envconfig:"SERVER_DOMAIN" default:"example.com"`
-	Port   uint   `envconfig:"SERVER_PORT" default:"8080"`
+	Mode   string `envconfig:"SERVER_MODE" default:"http" flag:"mode"`
+	Domain string `envconfig:"SERVER_DOMAIN" default:"example.com" flag:"domain"`
+	Port   uint   `envconfig:"SERVER_PORT" default:"8080" flag:"port"`
+
+	// Hosts served besides Domain, requests for other hosts are rejected
+	// when set. "*.example.com" allows the subdomains of example.com
+	AllowedHosts []string `envconfig:"SERVER_ALLOWED_HOSTS" flag:"allowed-hosts"`
+
+	// Networks of the proxies whose Forwarded and X-Forwarded-* headers are
+	// honored when building absolute URLs
+	TrustedProxies []string `envconfig:"SERVER_TRUSTED_PROXIES"`
+
+	// Paths of the built in endpoints, an empty value disables the endpoint
+	HealthPath  string `envconfig:"SERVER_HEALTH_PATH" default:"/healthz"`
+	VersionPath string `envconfig:"SERVER_VERSION_PATH" default:"/about"`
+
+	// Format of the error responses, "result" or RFC 7807 "problem"
+	ErrorFormat string `envconfig:"SERVER_ERROR_FORMAT" default:"result" flag:"error-format"`
+
+	// Handling of the request, correlation and trace IDs supplied by the
+	// clients, which flow into the logs and response headers: "echo",
+	// "sanitize", "replace" or "reject"
+	RequestIDPolicy string `envconfig:"SERVER_REQUEST_ID_POLICY" default:"sanitize" flag:"request-id-policy"`
+
+	// Format of the generated request IDs: "uuidv4", "uuidv7", "ulid",
+	// "ksuid" or "hex", chi's prefix and counter when empty
+	RequestIDFormat string `envconfig:"SERVER_REQUEST_ID_FORMAT" flag:"request-id-format"`
+
+	// Headers carried along with the request IDs, such as X-Tenant-ID: in
+	// the logs, the response headers and the outbound requests
+	BaggageHeaders []string `envconfig:"SERVER_BAGGAGE_HEADERS"`
+
+	// Serves the operational endpoints on a dedicated port when set
+	AdminPort uint `envconfig:"SERVER_ADMIN_PORT" flag:"admin-port"`
+
+	// Serves the gRPC server registered with WithGRPC on a dedicated port
+	// when set, rather than on Port along with HTTP
+	GRPCPort uint `envconfig:"SERVER_GRPC_PORT" flag:"grpc-port"`
+
+	// Mounts net/http/pprof and expvar under /debug, on the admin port when set
+	DebugEndpoints bool `envconfig:"SERVER_DEBUG_ENDPOINTS_ENABLED" default:"false" flag:"debug-endpoints"`
+
+	// Serves the JSON list of the routes under /routes, on the admin port when set
+	RoutesEndpoint bool `envconfig:"SERVER_ROUTES_ENDPOINT_ENABLED" default:"false" flag:"routes-endpoint"`
+
+	// Serves the runtime settings and statistics under /runtime, on the
+	// admin port when set
+	RuntimeEndpoint bool `envconfig:"SERVER_RUNTIME_ENDPOINT_ENABLED" default:"false" flag:"runtime-endpoint"`
+
+	// Bearer tokens of the /admin/toggles endpoint flipping the runtime
+	// switches, one per operator as changes are audited with the token ID
+	AdminTokens []Secret `envconfig:"SERVER_ADMIN_TOKENS"`
+
+	// Serves the GET and HEAD requests once more after a panic, when nothing
+	// was sent yet, before answering 500
+	PanicRetry bool `envconfig:"SERVER_PANIC_RETRY" default:"false"`
+
+	// Requests presenting this token in X-Debug-Token are logged at trace level
+	DebugToken string `envconfig:"SERVER_DEBUG_TOKEN"`
+
+	// Paths of the requests kept out of the logs, such as the high-frequency
+	// polling ones, in the syntax of path.Match such as "/jobs/*/status"
+	QuietRoutes []string `envconfig:"SERVER_QUIET_ROUTES"`
+
+	// Names of the environment variables, headers and query parameters whose
+	// values are redacted from the logs and configuration errors, such as
+	// "*token*"; redact.DefaultPatterns when empty
+	RedactPatterns []string `envconfig:"SERVER_REDACT_PATTERNS"`
+
+	// Keys of the encrypted cookies, the first one encrypting and all of
+	// them decrypting so the keys may be rotated
+	CookieKeys []Secret `envconfig:"SERVER_COOKIE_KEYS"`
+
+	// Development aid logging warnings about insecure response headers
+	HeaderAudit          bool     `envconfig:"SERVER_HEADER_AUDIT" default:"false" flag:"header-audit"`
+	HeaderAuditSensitive []string `envconfig:"SERVER_HEADER_AUDIT_SENSITIVE_PATHS"`
+
+	// Staging aid reporting JSON response schema drift from a baseline file
+	SchemaDriftBaseline   string  `envconfig:"SERVER_SCHEMA_DRIFT_BASELINE"`
+	SchemaDriftSampleRate float64 `envconfig:"SERVER_SCHEMA_DRIFT_SAMPLE_RATE" default:"0.1"`
+
+	// Validates the requests against an OpenAPI 3 JSON document, and the
+	// responses too as a development aid
+	OpenAPISpec              string `envconfig:"SERVER_OPENAPI_SPEC" flag:"openapi-spec"`
+	OpenAPIValidateResponses bool   `envconfig:"SERVER_OPENAPI_VALIDATE_RESPONSES" default:"false"`
+
+	// Readiness fails until the warmup functions of the APIs complete, at
+	// most for this duration, zero waiting indefinitely
+	WarmupTimeout time.Duration `envconfig:"SERVER_WARMUP_TIMEOUT" default:"1m"`
+
+	HTTP
+	Compression
+	Shutdown
+	Runtime
+	BodyCapture
+	CORS
+	Security
+	Egress
+	Discovery
+	Audit
+	Alert
+	RateLimit
+	TLSClientAuth
+	TLSMonitor
+	TLSTickets
 	*Certificate
 }
 
+// Limits of the http.Server used by the http and https modes, zero disables
+// a timeout
+type HTTP struct {
+	ReadTimeout       time.Duration `envconfig:"SERVER_READ_TIMEOUT" default:"0"`
+	ReadHeaderTimeout time.Duration `envconfig:"SERVER_READ_HEADER_TIMEOUT" default:"10s"`
+	WriteTimeout      time.Duration `envconfig:"SERVER_WRITE_TIMEOUT" default:"0"`
+	IdleTimeout       time.Duration `envconfig:"SERVER_IDLE_TIMEOUT" default:"2m"`
+	MaxHeaderBytes    int           `envconfig:"SERVER_MAX_HEADER_BYTES" default:"1048576"`
+
+	// Rejects requests with an ambiguous framing, such as both
+	// Transfer-Encoding and Content-Length, when terminating HTTP directly
+	StrictFraming bool `envconfig:"SERVER_STRICT_FRAMING" default:"false"`
+
+	// Address the ports are bound to, such as 127.0.0.1, ::1 or the address
+	// of an interface, all the interfaces when empty, over the network
+	// "tcp" for both IPv4 and IPv6, "tcp4" or "tcp6"
+	BindAddress string `envconfig:"SERVER_BIND_ADDRESS"`
+	BindNetwork string `envconfig:"SERVER_BIND_NETWORK" default:"tcp"`
+
+	// Retries binding a port taken, such as by the lingering sockets of a
+	// previous process, waiting BindBackoff doubled after each attempt, then
+	// listens on FallbackPort instead of Port when set
+	BindRetries  int           `envconfig:"SERVER_BIND_RETRIES" default:"0"`
+	BindBackoff  time.Duration `envconfig:"SERVER_BIND_BACKOFF" default:"250ms"`
+	FallbackPort uint          `envconfig:"SERVER_FALLBACK_PORT"`
+}
+
+// Gzip compression of the responses accepting it, those smaller than
+// MinSize, of an excluded content type, "image/*" matching any image, or
+// under an excluded path prefix being sent as is
+type Compression struct {
+	Enabled              bool     `envconfig:"SERVER_COMPRESSION" default:"false"`
+	MinSize              int      `envconfig:"SERVER_COMPRESSION_MIN_SIZE" default:"1024"`
+	ExcludedContentTypes []string `envconfig:"SERVER_COMPRESSION_EXCLUDED_CONTENT_TYPES" default:"image/*,video/*,audio/*,font/woff,font/woff2,application/zip,application/gzip,application/octet-stream,application/pdf,text/event-stream"`
+	ExcludedPaths        []string `envconfig:"SERVER_COMPRESSION_EXCLUDED_PATHS"`
+}
+
+// Debug aid capturing the first Size bytes of the request and response
+// bodies, redacted, to "log" or to a "ring" of RingSize captures served under
+// /captures, on the admin port when set. Redact patterns name the headers
+// and the JSON and form fields redacted besides SERVER_REDACT_PATTERNS
+type BodyCapture struct {
+	Sink       string   `envconfig:"SERVER_BODY_CAPTURE"`
+	Size       int      `envconfig:"SERVER_BODY_CAPTURE_SIZE" default:"4096"`
+	RingSize   int      `envconfig:"SERVER_BODY_CAPTURE_RING_SIZE" default:"100"`
+	ErrorsOnly bool     `envconfig:"SERVER_BODY_CAPTURE_ERRORS_ONLY" default:"false"`
+	Redact     []string `envconfig:"SERVER_BODY_CAPTURE_REDACT"`
+}
+
+// Sizing of the Go runtime to the cgroup limits of the container at
+// startup: GOMAXPROCS to the CPU quota, and the soft memory limit to
+// MemoryLimitRatio of the memory limit, disabled when zero. The GOMAXPROCS
+// and GOMEMLIMIT environment variables take precedence
+type Runtime struct {
+	AutoMaxProcs     bool    `envconfig:"SERVER_AUTOMAXPROCS" default:"false"`
+	MemoryLimitRatio float64 `envconfig:"SERVER_MEMORY_LIMIT_RATIO" default:"0"`
+}
+
+// Draining of the in-flight requests on shutdown, the readiness check fails
+// during the grace period so load balancers stop routing new requests
+type Shutdown struct {
+	GracePeriod time.Duration `envconfig:"SERVER_SHUTDOWN_GRACE_PERIOD" default:"0"`
+	Timeout     time.Duration `envconfig:"SERVER_SHUTDOWN_TIMEOUT" default:"30s"`
+
+	// Signals shutting the server down, SIGINT and SIGTERM when empty, the
+	// dump signals after writing the goroutines to stderr, and signals
+	// ignored, such as SIGHUP
+	Signals        []string `envconfig:"SERVER_SHUTDOWN_SIGNALS"`
+	DumpSignals    []string `envconfig:"SERVER_SHUTDOWN_DUMP_SIGNALS"`
+	IgnoredSignals []string `envconfig:"SERVER_IGNORED_SIGNALS"`
+
+	// Signals handing the listeners over to a new process of the binary,
+	// which has UpgradeTimeout to be ready before this one drains
+	UpgradeSignals []string      `envconfig:"SERVER_UPGRADE_SIGNALS"`
+	UpgradeTimeout time.Duration `envconfig:"SERVER_UPGRADE_TIMEOUT" default:"30s"`
+}
+
+type CORS struct {
+	AllowedOrigins    []string `envconfig:"SERVER_CORS_ALLOWED_ORIGINS" default:"*" flag:"cors-allowed-origins"`
+	AllowedMethods    []string `envconfig:"SERVER_CORS_ALLOWED_METHODS" default:"GET,POST,PUT,PATCH,DELETE,OPTIONS"`
+	AllowedHeaders    []string `envconfig:"SERVER_CORS_ALLOWED_HEADERS" default:"Origin,Accept,Authorization,Content-Type,X-Api-Key,User-Agent,Referer,Accept-Encoding,Accept-Language,Sec-Fetch-Dest,Sec-Fetch-Mode,Sec-Fetch-Site"`
+	AllowCredentials  bool     `envconfig:"SERVER_CORS_ALLOW_CREDENTIALS" default:"false"`
+	MaxAge            int      `envconfig:"SERVER_CORS_MAX_AGE" default:"0"`
+	DevAllowLocalhost bool     `envconfig:"SERVER_CORS_DEV_ALLOW_LOCALHOST" default:"false"`
+
+	// Origins also allowed, resolved from the TXT records of a DNS name,
+	// "dns:_cors.example.com", or from an http(s) endpoint
+	OriginsSource  string        `envconfig:"SERVER_CORS_ORIGINS_SOURCE"`
+	OriginsRefresh time.Duration `envconfig:"SERVER_CORS_ORIGINS_REFRESH" default:"1m"`
+}
+
+// Security header values, an empty value disables the header. The policy
+// and frame options restrict the pages served, hence are opt-in
+type Security struct {
+	ContentSecurityPolicy string `envconfig:"SERVER_CSP"`
+	FrameOptions          string `envconfig:"SERVER_FRAME_OPTIONS"`
+	ReferrerPolicy        string `envconfig:"SERVER_REFERRER_POLICY" default:"strict-origin-when-cross-origin"`
+	PermissionsPolicy     string `envconfig:"SERVER_PERMISSIONS_POLICY" default:"camera=(), geolocation=(), microphone=()"`
+	ContentTypeOptions    string `envconfig:"SERVER_CONTENT_TYPE_OPTIONS" default:"nosniff"`
+}
+
+// Destinations of the server initiated requests, such as the alert
+// webhooks. Private, loopback and link-local addresses are denied unless
+// within AllowedNetworks
+type Egress struct {
+	AllowedHosts    []string `envconfig:"SERVER_EGRESS_ALLOWED_HOSTS"`
+	AllowedNetworks []string `envconfig:"SERVER_EGRESS_ALLOWED_NETWORKS"`
+}
+
+// Audit trail of the authentication failures, 4xx and 5xx responses and
+// admin actions, written to "stdout", to daily files under Dir, "file",
+// or to a "webhook". Disabled when Sink is empty
+type Audit struct {
+	Sink       string        `envconfig:"SERVER_AUDIT_SINK"`
+	Dir        string        `envconfig:"SERVER_AUDIT_DIR" default:"audit"`
+	WebhookURL string        `envconfig:"SERVER_AUDIT_WEBHOOK_URL"`
+	Retention  time.Duration `envconfig:"SERVER_AUDIT_RETENTION" default:"2160h"` // of the files, forever when 0
+}
+
+// Alerting on elevated 5xx/429 rates, enabled by setting a webhook URL
+type Alert struct {
+	WebhookURL      string        `envconfig:"SERVER_ALERT_WEBHOOK_URL"`
+	SlackWebhookURL string        `envconfig:"SERVER_ALERT_SLACK_WEBHOOK_URL"`
+	ServerErrorRate float64       `envconfig:"SERVER_ALERT_5XX_THRESHOLD" default:"0.05"`
+	TooManyRate     float64       `envconfig:"SERVER_ALERT_429_THRESHOLD" default:"0.25"`
+	Window          time.Duration `envconfig:"SERVER_ALERT_WINDOW" default:"1m"`
+	MinRequests     int           `envconfig:"SERVER_ALERT_MIN_REQUESTS" default:"20"`
+	Cooldown        time.Duration `envconfig:"SERVER_ALERT_COOLDOWN" default:"5m"`
+}
+
+// Registration with a service discovery, "consul", "etcd" or "webhook",
+// once the server listens, and deregistration when it starts draining.
+// Disabled when Provider is empty
+type Discovery struct {
+	Provider string        `envconfig:"SERVER_DISCOVERY_PROVIDER"`
+	URL      string        `envconfig:"SERVER_DISCOVERY_URL"`
+	Token    Secret        `envconfig:"SERVER_DISCOVERY_TOKEN"`
+	Service  string        `envconfig:"SERVER_DISCOVERY_SERVICE"`
+	Address  string        `envconfig:"SERVER_DISCOVERY_ADDRESS"` // the hostname when empty
+	Tags     []string      `envconfig:"SERVER_DISCOVERY_TAGS"`
+	TTL      time.Duration `envconfig:"SERVER_DISCOVERY_TTL" default:"30s"` // of the etcd lease
+}
+
+// Per client rate limiting, enabled by setting a rate
+type RateLimit struct {
+	Rate  float64 `envconfig:"SERVER_RATE_LIMIT" default:"0" flag:"rate-limit"`
+	Burst int     `envconfig:"SERVER_RATE_LIMIT_BURST" default:"0" flag:"rate-limit-burst"`
+
+	// Keeps the client quotas across restarts
+	StateFile string `envconfig:"SERVER_RATE_LIMIT_STATE_FILE"`
+}
+
+// Client certificates asked for by the https mode, verified against the CA
+// bundle of ClientCA, PEM material or a file path: "none", "request",
+// "require-any", "verify-if-given" or "require-and-verify", the last one by
+// default when ClientCA is set. The admin port serves TLS too, asking for
+// the client certificates as AdminClientAuth, when it is set
+type TLSClientAuth struct {
+	ClientCA        Secret `envconfig:"SERVER_TLS_CLIENT_CA"`
+	ClientAuth      string `envconfig:"SERVER_TLS_CLIENT_AUTH"`
+	AdminClientAuth string `envconfig:"SERVER_ADMIN_TLS_CLIENT_AUTH"`
+}
+
+// OCSP stapling and expiry monitoring of the certificate of the https mode.
+// Warnings are logged once it expires within ExpiryWarning, and the health
+// check fails within ExpiryCheck, or once expired or revoked
+type TLSMonitor struct {
+	OCSPStapling  bool          `envconfig:"SERVER_TLS_OCSP_STAPLING" default:"true"`
+	ExpiryWarning time.Duration `envconfig:"SERVER_TLS_EXPIRY_WARNING" default:"336h"`
+	ExpiryCheck   time.Duration `envconfig:"SERVER_TLS_EXPIRY_CHECK" default:"0"`
+}
+
+// Rotation of the session ticket keys of the https mode, left to crypto/tls
+// unless TicketRotation or TicketSecrets is set. TicketSecrets are secret
+// references, reloaded on every rotation, the keys derive from so the
+// instances of a service resume the sessions of one another
+type TLSTickets struct {
+	TicketRotation time.Duration `envconfig:"SERVER_TLS_TICKET_ROTATION" default:"0"`
+	TicketSecrets  []string      `envconfig:"SERVER_TLS_TICKET_SECRETS"`
+}
+
+// PEM material or file paths, either may be a secret reference
 type Certificate struct {
-	Cert string `envconfig:"SERVER_CERTIFICATE_CERT"`
-	Key  string `envconfig:"SERVER_CERTIFICATE_KEY"`
+	Cert Secret `envconfig:"SERVER_CERTIFICATE_CERT" flag:"cert-file"`
+	Key  Secret `envconfig:"SERVER_CERTIFICATE_KEY" flag:"key-file"`
 }
 
 func (c *Server) Load() error {
 	return envconfig.Process("server", c)
 }
+
+// Probe is the part of Server locating the health endpoint, loaded by
+// server.Healthcheck without resolving the secrets of Server. Its fields
+// are read from the variables and flags of the Server fields of the same
+// names.
+type Probe struct {
+	Mode            string `envconfig:"SERVER_MODE" default:"http" flag:"mode"`
+	Port            uint   `envconfig:"SERVER_PORT" default:"8080" flag:"port"`
+	AdminPort       uint   `envconfig:"SERVER_ADMIN_PORT" flag:"admin-port"`
+	HealthPath      string `envconfig:"SERVER_HEALTH_PATH" default:"/healthz"`
+	BindAddress     string `envconfig:"SERVER_BIND_ADDRESS"`
+	BindNetwork     string `envconfig:"SERVER_BIND_NETWORK" default:"tcp"`
+	AdminClientAuth string `envconfig:"SERVER_ADMIN_TLS_CLIENT_AUTH"`
+}
+
+func (c *Probe) Load() error {
+	return envconfig.Process("server", c)
+}
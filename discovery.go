@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/client"
+	"github.com/go-obvious/server/config"
+	"github.com/go-obvious/server/discovery"
+	"github.com/go-obvious/server/egress"
+	"github.com/go-obvious/server/internal/listener"
+)
+
+// DiscoveryTimeout bounds the registration and the deregistration.
+var DiscoveryTimeout = 10 * time.Second
+
+// discoveryRegistrar returns the registrar of the configured provider, nil
+// when disabled.
+func discoveryRegistrar(cfg *config.Discovery, policy *egress.Policy) discovery.Registrar {
+	httpClient := client.New(client.Config{Timeout: DiscoveryTimeout, Egress: policy})
+	switch cfg.Provider {
+	case "":
+		return nil
+	case "consul":
+		return &discovery.Consul{URL: cfg.URL, Token: cfg.Token.String(), Client: httpClient}
+	case "etcd":
+		return &discovery.Etcd{URL: cfg.URL, Token: cfg.Token.String(), TTL: cfg.TTL, Client: httpClient}
+	case "webhook":
+		return &discovery.Webhook{URL: cfg.URL, Token: cfg.Token.String(), Client: httpClient}
+	}
+	logrus.WithField("provider", cfg.Provider).Fatal("unknown service discovery provider")
+	return nil
+}
+
+// discoveryService describes the instance as registered, reachable on the
+// advertised address and checked on the health endpoint.
+func discoveryService(cfg *config.Server) (discovery.Service, error) {
+	if cfg.Discovery.Service == "" {
+		return discovery.Service{}, fmt.Errorf("SERVER_DISCOVERY_SERVICE is required")
+	}
+	address := cfg.Discovery.Address
+	if address == "" {
+		var err error
+		if address, err = os.Hostname(); err != nil {
+			return discovery.Service{}, err
+		}
+	}
+	port := listener.Port(cfg.Mode, cfg.Port)
+	s := discovery.Service{
+		ID:      fmt.Sprintf("%s-%s-%d", cfg.Discovery.Service, address, port),
+		Name:    cfg.Discovery.Service,
+		Address: address,
+		Port:    int(port),
+		Tags:    cfg.Discovery.Tags,
+	}
+	if cfg.HealthPath != "" {
+		scheme, healthPort := healthScheme(cfg), port
+		if cfg.AdminPort != 0 {
+			healthPort = cfg.AdminPort
+		}
+		s.HealthURL = fmt.Sprintf("%s://%s:%d%s", scheme, address, healthPort, cfg.HealthPath)
+	}
+	return s, nil
+}
+
+// withDiscovery registers the instance once the server listens and
+// deregisters it when the server starts draining, the failures being
+// logged rather than stopping the server.
+func (a *server) withDiscovery(r discovery.Registrar) {
+	s, err := discoveryService(a.cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("error while describing the service to register")
+	}
+	call := func(action, done string, fn func(context.Context, discovery.Service) error) func() {
+		return func() {
+			ctx, cancel := context.WithTimeout(context.Background(), DiscoveryTimeout)
+			defer cancel()
+			log := logrus.WithFields(logrus.Fields{"service": s.Name, "id": s.ID})
+			if err := fn(ctx, s); err != nil {
+				log.WithError(err).Warnf("error while %s the service", action)
+				return
+			}
+			log.Info(done + " the service")
+		}
+	}
+	a.onReady = append(a.onReady, call("registering", "registered", r.Register))
+	deregister := call("deregistering", "deregistered", r.Deregister)
+	a.onDraining = append(a.onDraining, func() {
+		// The new process took over the registration
+		if !a.upgraded.Load() {
+			deregister()
+		}
+	})
+}
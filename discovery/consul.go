@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Consul registers the service with a Consul agent through its HTTP API,
+// with an HTTP check of the health URL.
+type Consul struct {
+	URL    string // of the agent, such as http://127.0.0.1:8500
+	Token  string // ACL token sent when set
+	Client *http.Client
+
+	// Interval of the health check, 10s when zero, and delay after which
+	// the agent deregisters an instance failing it, 1m when zero
+	CheckInterval   time.Duration
+	DeregisterAfter time.Duration
+}
+
+type consulService struct {
+	ID      string
+	Name    string
+	Address string
+	Port    int
+	Tags    []string     `json:",omitempty"`
+	Check   *consulCheck `json:",omitempty"`
+}
+
+type consulCheck struct {
+	HTTP                           string
+	Interval                       string
+	DeregisterCriticalServiceAfter string
+}
+
+func (x *Consul) Register(ctx context.Context, s Service) error {
+	body := consulService{ID: s.ID, Name: s.Name, Address: s.Address, Port: s.Port, Tags: s.Tags}
+	if s.HealthURL != "" {
+		body.Check = &consulCheck{
+			HTTP:                           s.HealthURL,
+			Interval:                       orDefault(x.CheckInterval, 10*time.Second).String(),
+			DeregisterCriticalServiceAfter: orDefault(x.DeregisterAfter, time.Minute).String(),
+		}
+	}
+	return send(ctx, x.Client, http.MethodPut, x.endpoint("register"), x.header(), body, nil)
+}
+
+func (x *Consul) Deregister(ctx context.Context, s Service) error {
+	return send(ctx, x.Client, http.MethodPut, x.endpoint("deregister/"+url.PathEscape(s.ID)), x.header(), nil, nil)
+}
+
+func (x *Consul) endpoint(path string) string {
+	return strings.TrimSuffix(x.URL, "/") + "/v1/agent/service/" + path
+}
+
+func (x *Consul) header() http.Header {
+	header := http.Header{}
+	if x.Token != "" {
+		header.Set("X-Consul-Token", x.Token)
+	}
+	return header
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,104 @@
+package discovery
+
+// Registration of the server with a service discovery, so the clients find
+// the instances accepting traffic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Events posted by Webhook
+const (
+	EventRegister   = "register"
+	EventDeregister = "deregister"
+)
+
+// Service describes the instance registered.
+type Service struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Address   string   `json:"address"`
+	Port      int      `json:"port"`
+	HealthURL string   `json:"health_url,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// Registrar registers the instance once it accepts traffic, and
+// deregisters it when it starts draining.
+type Registrar interface {
+	Register(ctx context.Context, s Service) error
+	Deregister(ctx context.Context, s Service) error
+}
+
+// Webhook posts the event and the service as JSON to the given URL, such
+// as {"event": "register", "service": {...}}.
+type Webhook struct {
+	URL    string
+	Token  string // bearer token sent when set
+	Client *http.Client
+}
+
+type webhookEvent struct {
+	Event   string  `json:"event"`
+	Service Service `json:"service"`
+}
+
+func (x *Webhook) Register(ctx context.Context, s Service) error {
+	return x.post(ctx, webhookEvent{Event: EventRegister, Service: s})
+}
+
+func (x *Webhook) Deregister(ctx context.Context, s Service) error {
+	return x.post(ctx, webhookEvent{Event: EventDeregister, Service: s})
+}
+
+func (x *Webhook) post(ctx context.Context, event webhookEvent) error {
+	header := http.Header{}
+	if x.Token != "" {
+		header.Set("Authorization", "Bearer "+x.Token)
+	}
+	return send(ctx, x.Client, http.MethodPost, x.URL, header, event, nil)
+}
+
+// send issues the request with payload as JSON, decoding the response in
+// out when not nil.
+func send(ctx context.Context, client *http.Client, method, url string, header http.Header, payload, out interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("discovery %s %s responded %d", method, req.URL.Path, resp.StatusCode)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
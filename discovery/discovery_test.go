@@ -0,0 +1,134 @@
+package discovery_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/discovery"
+)
+
+var service = discovery.Service{
+	ID:        "orders-10.0.0.7-8080",
+	Name:      "orders",
+	Address:   "10.0.0.7",
+	Port:      8080,
+	HealthURL: "http://10.0.0.7:8080/healthz",
+	Tags:      []string{"v2"},
+}
+
+// call is a request received by the fake discovery.
+type call struct {
+	method, path, auth string
+	body               map[string]interface{}
+}
+
+func record(t *testing.T, reply func(path string) string) (*httptest.Server, func() []call) {
+	var mu sync.Mutex
+	calls := []call{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := call{method: r.Method, path: r.URL.Path, auth: r.Header.Get("Authorization") + r.Header.Get("X-Consul-Token")}
+		data, _ := io.ReadAll(r.Body)
+		if len(data) > 0 {
+			require.NoError(t, json.Unmarshal(data, &c.body))
+		}
+		mu.Lock()
+		calls = append(calls, c)
+		mu.Unlock()
+		if reply != nil {
+			_, _ = w.Write([]byte(reply(r.URL.Path)))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []call {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]call{}, calls...)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	srv, calls := record(t, nil)
+	hook := &discovery.Webhook{URL: srv.URL + "/hook", Token: "secret"}
+	ctx := context.Background()
+
+	require.NoError(t, hook.Register(ctx, service))
+	require.NoError(t, hook.Deregister(ctx, service))
+	got := calls()
+	require.Len(t, got, 2)
+	assert.Equal(t, "Bearer secret", got[0].auth)
+	assert.Equal(t, discovery.EventRegister, got[0].body["event"])
+	assert.Equal(t, discovery.EventDeregister, got[1].body["event"])
+	assert.Equal(t, map[string]interface{}{
+		"id": service.ID, "name": "orders", "address": "10.0.0.7", "port": 8080.0,
+		"health_url": service.HealthURL, "tags": []interface{}{"v2"},
+	}, got[1].body["service"])
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	assert.Error(t, (&discovery.Webhook{URL: failing.URL}).Register(ctx, service))
+}
+
+func TestConsul(t *testing.T) {
+	srv, calls := record(t, nil)
+	consul := &discovery.Consul{URL: srv.URL + "/", Token: "acl"}
+	ctx := context.Background()
+
+	require.NoError(t, consul.Register(ctx, service))
+	require.NoError(t, consul.Deregister(ctx, service))
+	got := calls()
+	require.Len(t, got, 2)
+	assert.Equal(t, http.MethodPut, got[0].method)
+	assert.Equal(t, "/v1/agent/service/register", got[0].path)
+	assert.Equal(t, "acl", got[0].auth)
+	assert.Equal(t, service.ID, got[0].body["ID"])
+	assert.Equal(t, map[string]interface{}{
+		"HTTP": service.HealthURL, "Interval": "10s", "DeregisterCriticalServiceAfter": "1m0s",
+	}, got[0].body["Check"])
+	assert.Equal(t, http.MethodPut, got[1].method)
+	assert.Equal(t, "/v1/agent/service/deregister/"+service.ID, got[1].path)
+}
+
+func TestEtcd(t *testing.T) {
+	srv, calls := record(t, func(path string) string {
+		if path == "/v3/lease/grant" {
+			return `{"ID": "7587869", "TTL": "1"}`
+		}
+		return `{}`
+	})
+	etcd := &discovery.Etcd{URL: srv.URL, TTL: time.Second}
+	ctx := context.Background()
+
+	require.NoError(t, etcd.Register(ctx, service))
+	require.Eventually(t, func() bool {
+		got := calls()
+		return len(got) > 2 && got[2].path == "/v3/lease/keepalive"
+	}, 2*time.Second, 10*time.Millisecond, "the lease is kept alive")
+	require.NoError(t, etcd.Deregister(ctx, service))
+
+	got := calls()
+	assert.Equal(t, "/v3/lease/grant", got[0].path)
+	assert.Equal(t, "1", got[0].body["TTL"])
+	assert.Equal(t, "/v3/kv/put", got[1].path)
+	assert.Equal(t, "7587869", got[1].body["lease"])
+	key, _ := base64.StdEncoding.DecodeString(got[1].body["key"].(string))
+	assert.Equal(t, "/services/orders/"+service.ID, string(key))
+	value, _ := base64.StdEncoding.DecodeString(got[1].body["value"].(string))
+	var registered discovery.Service
+	require.NoError(t, json.Unmarshal(value, &registered))
+	assert.Equal(t, service, registered)
+	last := got[len(got)-1]
+	assert.Equal(t, "/v3/lease/revoke", last.path)
+	assert.Equal(t, "7587869", last.body["ID"])
+}
@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Etcd puts the service as JSON under Prefix/<name>/<id> through the JSON
+// gateway of etcd v3, attached to a lease kept alive until deregistered,
+// so the key expires with an instance which vanished.
+type Etcd struct {
+	URL    string // of the gateway, such as http://127.0.0.1:2379
+	Token  string // auth token sent when set
+	Prefix string // "/services" when empty
+	TTL    time.Duration
+	Client *http.Client
+
+	mu    sync.Mutex
+	lease string
+	stop  chan struct{}
+}
+
+type etcdLease struct {
+	ID  string `json:"ID,omitempty"`
+	TTL int64  `json:"TTL,omitempty,string"` // int64 are strings in the JSON of etcd
+}
+
+type etcdPut struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Lease string `json:"lease"`
+}
+
+func (x *Etcd) Register(ctx context.Context, s Service) error {
+	value, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ttl := orDefault(x.TTL, 30*time.Second)
+	var lease etcdLease
+	if err := x.call(ctx, "lease/grant", etcdLease{TTL: int64(ttl / time.Second)}, &lease); err != nil {
+		return err
+	}
+	if err := x.call(ctx, "kv/put", etcdPut{Key: encode(x.key(s)), Value: encode(string(value)), Lease: lease.ID}, nil); err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.lease, x.stop = lease.ID, make(chan struct{})
+	go x.keepAlive(lease.ID, ttl/3, x.stop)
+	return nil
+}
+
+func (x *Etcd) Deregister(ctx context.Context, s Service) error {
+	x.mu.Lock()
+	lease, stop := x.lease, x.stop
+	x.lease, x.stop = "", nil
+	x.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	// Revoking the lease deletes the key
+	return x.call(ctx, "lease/revoke", etcdLease{ID: lease}, nil)
+}
+
+func (x *Etcd) keepAlive(lease string, every time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), every)
+			if err := x.call(ctx, "lease/keepalive", etcdLease{ID: lease}, nil); err != nil {
+				logrus.WithError(err).Warn("error while renewing the etcd lease")
+			}
+			cancel()
+		}
+	}
+}
+
+func (x *Etcd) call(ctx context.Context, method string, payload, out interface{}) error {
+	header := http.Header{}
+	if x.Token != "" {
+		header.Set("Authorization", x.Token)
+	}
+	return send(ctx, x.Client, http.MethodPost, strings.TrimSuffix(x.URL, "/")+"/v3/"+method, header, payload, out)
+}
+
+func (x *Etcd) key(s Service) string {
+	prefix := x.Prefix
+	if prefix == "" {
+		prefix = "/services"
+	}
+	return path.Join(prefix, s.Name, s.ID)
+}
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
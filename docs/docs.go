@@ -0,0 +1,102 @@
+package docs
+
+// Serves markdown and OpenAPI documents embedded in the binary
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// Index is rendered at the root of the documentation when present,
+// otherwise the documents are listed.
+const Index = "index.md"
+
+// page carries no inline styles or scripts so it renders under the default
+// Content-Security-Policy
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+{{.Body}}
+</body>
+</html>
+`))
+
+type document struct {
+	Title string
+	Body  template.HTML
+}
+
+// Endpoint serves the documents of fsys, typically an embed.FS. Markdown
+// documents are rendered to HTML, any other file is served as is so OpenAPI
+// specifications and examples may be fetched by tools.
+//
+//	//go:embed docs
+//	var content embed.FS
+//
+//	sub, _ := fs.Sub(content, "docs")
+//	server.NewWithOptions(version, server.WithDocs(sub))
+func Endpoint(fsys fs.FS) http.Handler {
+	files := http.FileServer(http.FS(fsys))
+
+	r := chi.NewRouter()
+	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+chi.URLParam(r, "*")), "/")
+		if name == "" {
+			// Relative links resolve against the documentation root
+			if !strings.HasSuffix(r.URL.Path, "/") {
+				http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+				return
+			}
+			if _, err := fs.Stat(fsys, Index); err != nil {
+				serveListing(w, fsys)
+				return
+			}
+			name = Index
+		}
+
+		if path.Ext(name) != ".md" {
+			r.URL.Path = "/" + name
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		render(w, document{Title: name, Body: Markdown(src)})
+	})
+	return r
+}
+
+func serveListing(w http.ResponseWriter, fsys fs.FS) {
+	var b strings.Builder
+	b.WriteString("<h1>Documentation</h1>\n<ul>\n")
+	_ = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		escaped := template.HTMLEscapeString(name)
+		b.WriteString(`<li><a href="` + escaped + `">` + escaped + "</a></li>\n")
+		return nil
+	})
+	b.WriteString("</ul>\n")
+	render(w, document{Title: "Documentation", Body: template.HTML(b.String())})
+}
+
+func render(w http.ResponseWriter, doc document) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,59 @@
+package docs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/docs"
+)
+
+func TestMarkdown(t *testing.T) {
+	html := docs.Markdown([]byte("# Orders\n\nList **all** orders, see [spec](openapi.yaml).\n\n- `GET /orders`\n- <b>\n\n```\nif a < b {}\n```\n"))
+
+	assert.Equal(t, `<h1>Orders</h1>
+<p>List <strong>all</strong> orders, see <a href="openapi.yaml">spec</a>.</p>
+<ul>
+<li><code>GET /orders</code></li>
+<li>&lt;b&gt;</li>
+</ul>
+<pre><code>if a &lt; b {}
+</code></pre>
+`, string(html))
+}
+
+func TestEndpoint(t *testing.T) {
+	router := chi.NewRouter()
+	router.Mount("/docs", docs.Endpoint(fstest.MapFS{
+		"guide.md":     {Data: []byte("# Guide")},
+		"openapi.yaml": {Data: []byte("openapi: 3.0.0")},
+	}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr := get("/docs")
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "/docs/", rr.Header().Get("Location"))
+
+	rr = get("/docs/")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `<a href="guide.md">guide.md</a>`)
+
+	rr = get("/docs/guide.md")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "<h1>Guide</h1>")
+
+	rr = get("/docs/openapi.yaml")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "openapi: 3.0.0", rr.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, get("/docs/missing.md").Code)
+}
@@ -0,0 +1,119 @@
+package docs
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	heading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bullet  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	ordered = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+
+	code   = regexp.MustCompile("`([^`]+)`")
+	link   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strong = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	em     = regexp.MustCompile(`\*([^*]+)\*`)
+)
+
+// Markdown renders the common subset of markdown used in API documentation:
+// headings, paragraphs, lists, fenced code blocks, inline code, links and
+// emphasis. Any embedded HTML is escaped.
+func Markdown(src []byte) template.HTML {
+	var (
+		out   strings.Builder
+		para  []string
+		list  string
+		fence bool
+	)
+
+	flush := func() {
+		if len(para) > 0 {
+			out.WriteString("<p>" + inline(strings.Join(para, " ")) + "</p>\n")
+			para = nil
+		}
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	item := func(tag, text string) {
+		if len(para) > 0 || (list != "" && list != tag) {
+			flush()
+		}
+		if list == "" {
+			out.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+		out.WriteString("<li>" + inline(text) + "</li>\n")
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n") {
+		if fence {
+			if strings.HasPrefix(line, "```") {
+				out.WriteString("</code></pre>\n")
+				fence = false
+				continue
+			}
+			out.WriteString(template.HTMLEscapeString(line) + "\n")
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "```"):
+			flush()
+			out.WriteString("<pre><code>")
+			fence = true
+		case strings.TrimSpace(line) == "":
+			flush()
+		case heading.MatchString(line):
+			flush()
+			m := heading.FindStringSubmatch(line)
+			tag := "h" + string(rune('0'+len(m[1])))
+			out.WriteString("<" + tag + ">" + inline(m[2]) + "</" + tag + ">\n")
+		case bullet.MatchString(line):
+			item("ul", bullet.FindStringSubmatch(line)[1])
+		case ordered.MatchString(line):
+			item("ol", ordered.FindStringSubmatch(line)[1])
+		default:
+			if list != "" {
+				flush()
+			}
+			para = append(para, strings.TrimSpace(line))
+		}
+	}
+	if fence {
+		out.WriteString("</code></pre>\n")
+	}
+	flush()
+
+	return template.HTML(out.String())
+}
+
+// inline escapes text and renders its inline markup, code spans are kept
+// verbatim.
+func inline(text string) string {
+	parts := code.Split(text, -1)
+	spans := code.FindAllStringSubmatch(text, -1)
+
+	var out strings.Builder
+	for i, part := range parts {
+		part = template.HTMLEscapeString(part)
+		part = link.ReplaceAllStringFunc(part, func(s string) string {
+			m := link.FindStringSubmatch(s)
+			href := m[2]
+			if strings.HasPrefix(strings.ToLower(href), "javascript:") {
+				href = "#"
+			}
+			return `<a href="` + href + `">` + m[1] + "</a>"
+		})
+		part = strong.ReplaceAllString(part, "<strong>$1</strong>")
+		part = em.ReplaceAllString(part, "<em>$1</em>")
+		out.WriteString(part)
+		if i < len(spans) {
+			out.WriteString("<code>" + template.HTMLEscapeString(spans[i][1]) + "</code>")
+		}
+	}
+	return out.String()
+}
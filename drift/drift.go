@@ -0,0 +1,284 @@
+package drift
+
+// Detects JSON response schema drift per route against a stored baseline,
+// meant for staging environments
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultSampleRate = 0.1
+	DefaultMinSamples = 20
+
+	// MaxBodySize bounds the responses inspected, larger ones are skipped
+	MaxBodySize = 1048576 // 1MB
+)
+
+// Schema maps the field paths of a JSON document to their type, such as
+// "items[].id": "number". Types are the JSON ones: object, array, string,
+// number, boolean and null.
+type Schema map[string]string
+
+// Drift lists the differences between the responses of a route and its
+// baseline. Removed fields are only reported once the route has been
+// sampled MinSamples times, as optional fields may be missing from a
+// single response.
+type Drift struct {
+	Route   string   `json:"route"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Detector samples successful JSON responses, infers their schema and
+// reports the fields which drifted from the baseline of the route. Each
+// drifted field is reported once. Routes without baseline are only
+// observed, so running without baseline records one with WriteBaseline.
+type Detector struct {
+	Baseline   map[string]Schema // keyed by "METHOD /route/{pattern}"
+	SampleRate float64           // fraction of responses inspected
+	MinSamples int
+	Report     func(Drift) // defaults to logging a warning
+
+	mu       sync.Mutex
+	observed map[string]Schema
+	samples  map[string]int
+	reported map[string]bool
+}
+
+func (d *Detector) init() {
+	if d.SampleRate <= 0 {
+		d.SampleRate = DefaultSampleRate
+	}
+	if d.MinSamples <= 0 {
+		d.MinSamples = DefaultMinSamples
+	}
+	if d.Report == nil {
+		d.Report = logDrift
+	}
+	d.observed = make(map[string]Schema)
+	d.samples = make(map[string]int)
+	d.reported = make(map[string]bool)
+}
+
+// LoadBaseline reads a baseline written by WriteBaseline.
+func LoadBaseline(path string) (map[string]Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	baseline := map[string]Schema{}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, err
+	}
+	return baseline, nil
+}
+
+// WriteBaseline stores the schemas observed so far, to be used as the
+// baseline of later runs.
+func (d *Detector) WriteBaseline(path string) error {
+	data, err := json.MarshalIndent(d.Observed(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Observed returns a copy of the schemas observed so far, keyed by route.
+func (d *Detector) Observed() map[string]Schema {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[string]Schema, len(d.observed))
+	for route, schema := range d.observed {
+		out[route] = make(Schema, len(schema))
+		for path, typ := range schema {
+			out[route][path] = typ
+		}
+	}
+	return out
+}
+
+// Infer returns the schema of a JSON document.
+func Infer(v interface{}) Schema {
+	s := Schema{}
+	infer(s, "", v)
+	return s
+}
+
+func infer(s Schema, path string, v interface{}) {
+	typ := "null"
+	switch x := v.(type) {
+	case map[string]interface{}:
+		typ = "object"
+		for k, v := range x {
+			if path == "" {
+				infer(s, k, v)
+			} else {
+				infer(s, path+"."+k, v)
+			}
+		}
+	case []interface{}:
+		typ = "array"
+		for _, v := range x {
+			infer(s, path+"[]", v)
+		}
+	case string:
+		typ = "string"
+	case float64:
+		typ = "number"
+	case bool:
+		typ = "boolean"
+	}
+	if path == "" {
+		return
+	}
+	// null is compatible with any type, keep the informative one
+	if prev, ok := s[path]; !ok || prev == "null" {
+		s[path] = typ
+	}
+}
+
+// Record accounts for a response body of the route and returns the drift
+// which became due, if any.
+func (d *Detector) Record(route string, body []byte) *Drift {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.observed == nil {
+		d.init()
+	}
+
+	observed := d.observed[route]
+	if observed == nil {
+		observed = Schema{}
+		d.observed[route] = observed
+	}
+	sample := Infer(doc)
+	for path, typ := range sample {
+		if prev, ok := observed[path]; !ok || prev == "null" {
+			observed[path] = typ
+		}
+	}
+	d.samples[route]++
+
+	baseline, ok := d.Baseline[route]
+	if !ok {
+		return nil
+	}
+
+	drift := Drift{Route: route}
+	for path, typ := range sample {
+		want, ok := baseline[path]
+		switch {
+		case !ok:
+			d.due(&drift.Added, route, "+", path)
+		case typ != want && typ != "null" && want != "null":
+			d.due(&drift.Changed, route, "~", path)
+		}
+	}
+	if d.samples[route] >= d.MinSamples {
+		for path := range baseline {
+			if _, ok := observed[path]; !ok {
+				d.due(&drift.Removed, route, "-", path)
+			}
+		}
+	}
+	if len(drift.Added)+len(drift.Removed)+len(drift.Changed) == 0 {
+		return nil
+	}
+	sort.Strings(drift.Added)
+	sort.Strings(drift.Removed)
+	sort.Strings(drift.Changed)
+	return &drift
+}
+
+// due appends the path to the list unless it was already reported.
+func (d *Detector) due(list *[]string, route, kind, path string) {
+	key := route + " " + kind + path
+	if d.reported[key] {
+		return
+	}
+	d.reported[key] = true
+	*list = append(*list, path)
+}
+
+func (d *Detector) sampled() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.observed == nil {
+		d.init()
+	}
+	return rand.Float64() < d.SampleRate
+}
+
+func (d *Detector) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !d.sampled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body := &capped{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(body)
+		next.ServeHTTP(ww, r)
+
+		if ww.Status() < 200 || ww.Status() >= 300 || body.overflow || !isJSON(ww.Header()) {
+			return
+		}
+		rctx := chi.RouteContext(r.Context())
+		if rctx == nil || rctx.RoutePattern() == "" {
+			return
+		}
+		if drift := d.Record(r.Method+" "+rctx.RoutePattern(), body.Bytes()); drift != nil {
+			d.Report(*drift)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+func isJSON(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// capped buffers up to MaxBodySize bytes written to it.
+type capped struct {
+	bytes.Buffer
+	overflow bool
+}
+
+func (c *capped) Write(p []byte) (int, error) {
+	if c.overflow || c.Len()+len(p) > MaxBodySize {
+		c.overflow = true
+		c.Reset()
+		return len(p), nil
+	}
+	return c.Buffer.Write(p)
+}
+
+func logDrift(drift Drift) {
+	logrus.WithFields(logrus.Fields{
+		"route":   drift.Route,
+		"added":   drift.Added,
+		"removed": drift.Removed,
+		"changed": drift.Changed,
+	}).Warn("response schema drifted from the baseline")
+}
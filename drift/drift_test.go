@@ -0,0 +1,91 @@
+package drift_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/drift"
+)
+
+func TestInfer(t *testing.T) {
+	assert.Equal(t, drift.Schema{
+		"id":          "number",
+		"name":        "null",
+		"owner":       "object",
+		"owner.admin": "boolean",
+		"items":       "array",
+		"items[]":     "object",
+		"items[].sku": "string",
+	}, drift.Infer(map[string]interface{}{
+		"id":    1.0,
+		"name":  nil,
+		"owner": map[string]interface{}{"admin": true},
+		"items": []interface{}{map[string]interface{}{"sku": "a"}, map[string]interface{}{"sku": nil}},
+	}))
+}
+
+func TestRecord(t *testing.T) {
+	d := &drift.Detector{
+		Baseline: map[string]drift.Schema{
+			"GET /orders/{id}": {"id": "number", "total": "number", "note": "string"},
+		},
+		MinSamples: 2,
+	}
+
+	assert.Nil(t, d.Record("GET /orders/{id}", []byte(`{"id": 1, "total": 2, "note": null}`)))
+	assert.Nil(t, d.Record("GET /other", []byte(`{"x": 1}`)), "routes without baseline are only observed")
+
+	got := d.Record("GET /orders/{id}", []byte(`{"id": "1", "currency": "EUR", "note": null}`))
+	require.NotNil(t, got)
+	assert.Equal(t, []string{"currency"}, got.Added)
+	assert.Equal(t, []string{"id"}, got.Changed)
+	assert.Empty(t, got.Removed, "total was seen in the first sample")
+
+	assert.Nil(t, d.Record("GET /orders/{id}", []byte(`{"id": "1", "currency": "EUR"}`)), "drift is reported once")
+	assert.Contains(t, d.Observed(), "GET /other")
+}
+
+func TestRecordRemoved(t *testing.T) {
+	d := &drift.Detector{
+		Baseline:   map[string]drift.Schema{"GET /": {"id": "number", "legacy": "string"}},
+		MinSamples: 2,
+	}
+
+	assert.Nil(t, d.Record("GET /", []byte(`{"id": 1}`)), "below the minimum sample count")
+	got := d.Record("GET /", []byte(`{"id": 2}`))
+	require.NotNil(t, got)
+	assert.Equal(t, []string{"legacy"}, got.Removed)
+}
+
+func TestMiddleware(t *testing.T) {
+	var reports []drift.Drift
+	d := &drift.Detector{
+		Baseline:   map[string]drift.Schema{"GET /orders/{id}": {"id": "number"}},
+		SampleRate: 1,
+		Report:     func(x drift.Drift) { reports = append(reports, x) },
+	}
+
+	router := chi.NewRouter()
+	router.Use(d.Middleware)
+	router.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write([]byte(`{"id": 1, "status": "new"}`))
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+
+	require.Len(t, reports, 1)
+	assert.Equal(t, "GET /orders/{id}", reports[0].Route)
+	assert.Equal(t, []string{"status"}, reports[0].Added)
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	require.NoError(t, d.WriteBaseline(path))
+	baseline, err := drift.LoadBaseline(path)
+	require.NoError(t, err)
+	assert.Equal(t, drift.Schema{"id": "number", "status": "string"}, baseline["GET /orders/{id}"])
+}
@@ -0,0 +1,152 @@
+package egress
+
+// Egress policy guarding the server initiated outbound requests, such as
+// webhook deliveries, against server-side request forgery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+var ErrDenied = errors.New("egress denied")
+
+// Policy restricts the destinations of outbound requests. Loopback,
+// private (RFC 1918 and RFC 4193), link-local, such as the cloud metadata
+// endpoints, unspecified and multicast addresses are denied unless within
+// AllowedNetworks. The zero value allows any public destination.
+//
+// Destinations are checked twice: the URL before the request is sent, and
+// the address dialed once the host is resolved, so a public name resolving
+// to a private address is denied too. A proxy on a private network must be
+// part of AllowedNetworks.
+type Policy struct {
+	// Hosts requests may be sent to, "*.example.com" allowing the
+	// subdomains of example.com. Any host when empty.
+	AllowedHosts []string
+
+	// Networks allowed despite being denied by default, such as the one of
+	// an internal webhook receiver, e.g. "10.1.0.0/16"
+	AllowedNetworks []*net.IPNet
+}
+
+// New returns a policy allowing the hosts and the networks, in CIDR
+// notation, on top of the public addresses.
+func New(hosts, networks []string) (*Policy, error) {
+	p := &Policy{}
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			p.AllowedHosts = append(p.AllowedHosts, h)
+		}
+	}
+	for _, cidr := range networks {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		p.AllowedNetworks = append(p.AllowedNetworks, n)
+	}
+	return p, nil
+}
+
+// CheckURL validates the scheme and host of a URL, and its address when it
+// is an IP literal.
+func (p *Policy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q", ErrDenied, u.Scheme)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("%w: no host", ErrDenied)
+	}
+	if !p.hostAllowed(host) {
+		return fmt.Errorf("%w: host %q", ErrDenied, host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return p.CheckIP(ip)
+	}
+	return nil
+}
+
+// CheckIP validates an address against the denied and allowed networks.
+func (p *Policy) CheckIP(ip net.IP) error {
+	for _, n := range p.AllowedNetworks {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	if Denied(ip) {
+		return fmt.Errorf("%w: address %s", ErrDenied, ip)
+	}
+	return nil
+}
+
+// Denied reports whether the address is denied by default.
+func Denied(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// Control is a net.Dialer Control function denying the connections to the
+// denied addresses, once resolved.
+func (p *Policy) Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDenied, err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: address %q", ErrDenied, host)
+	}
+	return p.CheckIP(ip)
+}
+
+// RoundTripper checks the URL of the requests, redirects included, before
+// handing them to base. The addresses dialed by base are checked when its
+// dialer uses Control.
+func (p *Policy) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &guard{policy: p, base: base}
+}
+
+func (p *Policy) hostAllowed(host string) bool {
+	if len(p.AllowedHosts) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedHosts {
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+type guard struct {
+	policy *Policy
+	base   http.RoundTripper
+}
+
+func (g *guard) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := g.policy.CheckURL(req.URL); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return g.base.RoundTrip(req)
+}
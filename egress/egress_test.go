@@ -0,0 +1,93 @@
+package egress_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/client"
+	"github.com/go-obvious/server/egress"
+)
+
+func TestCheckURL(t *testing.T) {
+	p, err := egress.New([]string{"hooks.example.com", "*.slack.com"}, []string{"10.1.0.0/16"})
+	require.NoError(t, err)
+	open := &egress.Policy{}
+
+	for raw, allowed := range map[string]bool{
+		"https://hooks.example.com/x":  true,
+		"https://HOOKS.example.com./x": true,
+		"https://api.slack.com/x":      true,
+		"https://slack.com/x":          false,
+		"https://evil.example.com/x":   false,
+		"ftp://hooks.example.com/x":    false,
+		"file:///etc/passwd":           false,
+		"http://10.1.2.3/x":            false, // not an allowed host
+	} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		if allowed {
+			assert.NoError(t, p.CheckURL(u), raw)
+		} else {
+			assert.ErrorIs(t, p.CheckURL(u), egress.ErrDenied, raw)
+		}
+	}
+
+	for raw, allowed := range map[string]bool{
+		"http://93.184.216.34/":                    true,
+		"http://[2606:2800:220:1::248]/":           true,
+		"http://127.0.0.1:8080/":                   false,
+		"http://[::1]/":                            false,
+		"http://10.0.0.1/":                         false,
+		"http://172.16.5.4/":                       false,
+		"http://192.168.1.1/":                      false,
+		"http://169.254.169.254/latest/meta-data/": false,
+		"http://[fe80::1]/":                        false,
+		"http://[fd00::1]/":                        false,
+		"http://0.0.0.0/":                          false,
+		"http://example.com/":                      true, // checked once resolved
+	} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		if allowed {
+			assert.NoError(t, open.CheckURL(u), raw)
+		} else {
+			assert.ErrorIs(t, open.CheckURL(u), egress.ErrDenied, raw)
+		}
+	}
+
+	assert.NoError(t, p.CheckIP(net.ParseIP("10.1.200.1")), "allowed network")
+	assert.Error(t, p.CheckIP(net.ParseIP("10.2.0.1")))
+}
+
+func TestClientEgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	get := func(p *egress.Policy, target string) error {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, target, nil)
+		require.NoError(t, err)
+		resp, err := client.New(client.Config{Egress: p}).Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	assert.ErrorIs(t, get(&egress.Policy{}, srv.URL), egress.ErrDenied)
+	// A name resolving to a denied address is caught when dialing
+	assert.ErrorIs(t, get(&egress.Policy{}, "http://localhost:"+u.Port()), egress.ErrDenied)
+
+	p, err := egress.New(nil, []string{"127.0.0.0/8", "::1/128"})
+	require.NoError(t, err)
+	assert.NoError(t, get(p, srv.URL))
+	assert.NoError(t, get(p, "http://localhost:"+u.Port()))
+}
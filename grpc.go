@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/go-obvious/server/api"
+)
+
+// GRPCServer is the gRPC server co-hosted with the HTTP one, implemented
+// by *grpc.Server.
+type GRPCServer interface {
+	http.Handler
+	Serve(l net.Listener) error
+	GracefulStop()
+	Stop()
+}
+
+// GRPCHealth is the health service of the gRPC server, implemented by the
+// *health.Server of google.golang.org/grpc/health. It reports NOT_SERVING
+// once the server drains, along with the HTTP readiness check.
+type GRPCHealth interface {
+	Shutdown()
+}
+
+// withGRPC routes the gRPC requests received on the HTTP port to the gRPC
+// server, accepting HTTP/2 without TLS. The calls in flight are tracked as
+// requests, shutdown waiting for them.
+func (a *server) withGRPC(next http.Handler) http.Handler {
+	rpc := a.drain.Middleware(a.grpc)
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			rpc.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
+
+// stopGRPC stops the gRPC server served on its dedicated port, waiting for
+// the calls in flight until ctx is done.
+func (a *server) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		a.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		a.grpc.Stop()
+	}
+}
+
+// GRPCGateway returns the API serving a grpc-gateway runtime.ServeMux under
+// prefix, such as "/v1". The gateway sees the full path of the requests, as
+// declared by the google.api.http annotations. It is adapted by
+// api.Gateway, forwarding the correlation IDs as gRPC metadata and
+// replying the errors in the format of the server.
+func GRPCGateway(name, prefix string, mux http.Handler) API {
+	return &gatewayAPI{name: name, prefix: prefix, handler: api.Gateway(mux)}
+}
+
+type gatewayAPI struct {
+	name    string
+	prefix  string
+	handler http.Handler
+}
+
+func (g *gatewayAPI) Name() string {
+	return g.name
+}
+
+func (g *gatewayAPI) Register(app Server) error {
+	api.ChiRouter(app).Mount(g.prefix, g.handler)
+	return nil
+}
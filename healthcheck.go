@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/cors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/config"
+	"github.com/go-obvious/server/internal/listener"
+)
+
+// HealthcheckTimeout bounds the request made by Healthcheck.
+var HealthcheckTimeout = 5 * time.Second
+
+// Healthcheck performs a GET against the health endpoint of the server
+// running on this host, using the admin port when one is configured. It
+// returns an error unless the endpoint answers 200 OK.
+//
+// The endpoint is located from the environment and the command-line flags,
+// without resolving the secrets of the configuration, and from the options
+// the server was given, such as WithPort, opts not applying to the probe
+// being ignored. WithHealthcheckCertificate presents a client certificate
+// to the ports requiring one.
+func Healthcheck(ctx context.Context, opts ...Option) error {
+	probe := config.Probe{}
+	if err := config.Peek(&probe); err != nil {
+		return err
+	}
+	cfg := config.Server{
+		Mode:          probe.Mode,
+		Port:          probe.Port,
+		AdminPort:     probe.AdminPort,
+		HealthPath:    probe.HealthPath,
+		HTTP:          config.HTTP{BindAddress: probe.BindAddress, BindNetwork: probe.BindNetwork},
+		TLSClientAuth: config.TLSClientAuth{AdminClientAuth: probe.AdminClientAuth},
+	}
+	app := server{cfg: &cfg, cors: &cors.Options{}}
+	for _, opt := range opts {
+		opt(&app)
+	}
+
+	if cfg.HealthPath == "" {
+		return fmt.Errorf("the health endpoint is disabled")
+	}
+	port := listener.Port(cfg.Mode, cfg.Port)
+	if cfg.AdminPort != 0 {
+		port = cfg.AdminPort
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, HealthcheckTimeout)
+	defer cancel()
+
+	scheme, client := healthScheme(&cfg), http.DefaultClient
+	if scheme == "https" {
+		// The local server is reached by its IP address, not the names of
+		// its certificate
+		tlsCfg := &tls.Config{InsecureSkipVerify: true}
+		if app.probeCert != nil {
+			tlsCfg.Certificates = []tls.Certificate{*app.probeCert}
+		}
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+	}
+	url := scheme + "://" + listener.Addr(healthHost(&cfg.HTTP), port) + cfg.HealthPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("healthcheck failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// healthScheme returns the scheme of the health endpoint, https when served
+// on a TLS port.
+func healthScheme(cfg *config.Server) string {
+	if cfg.Mode == listener.Https && (cfg.AdminPort == 0 || cfg.AdminClientAuth != "") {
+		return "https"
+	}
+	return "http"
+}
+
+// healthHost returns the address the health check connects to: the bind
+// address, or the loopback one of the network when bound to all the
+// interfaces.
+func healthHost(cfg *config.HTTP) string {
+	if ip := net.ParseIP(cfg.BindAddress); cfg.BindAddress != "" && (ip == nil || !ip.IsUnspecified()) {
+		return cfg.BindAddress
+	}
+	if cfg.BindNetwork == "tcp6" {
+		return "::1"
+	}
+	return "127.0.0.1"
+}
+
+// HealthcheckCommand runs Healthcheck with opts and exits the process with status 0
+// when healthy and 1 otherwise. It is meant to back a Docker HEALTHCHECK or
+// Kubernetes exec probe in images that ship without curl:
+//
+//	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+//		server.HealthcheckCommand(opts...)
+//	}
+func HealthcheckCommand(opts ...Option) {
+	if err := Healthcheck(context.Background(), opts...); err != nil {
+		logrus.WithError(err).Error("unhealthy")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -16,6 +16,11 @@ func Register(name string, fn HealthCheck) {
 	NewHealthz().(*checker).add(name, fn)
 }
 
+// Deregister a health check function
+func Deregister(name string) {
+	NewHealthz().(*checker).remove(name)
+}
+
 var (
 	h    *checker
 	once sync.Once
@@ -41,6 +46,12 @@ func (x *checker) add(name string, fn HealthCheck) {
 	x.checks[name] = fn
 }
 
+func (x *checker) remove(name string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.checks, name)
+}
+
 func (x *checker) Checks() map[string]HealthCheck {
 	x.mu.Lock()
 	defer x.mu.Unlock()
@@ -49,7 +60,10 @@ func (x *checker) Checks() map[string]HealthCheck {
 
 func (x *checker) Run() error {
 	x.mu.Lock()
-	checks := x.checks
+	checks := make([]HealthCheck, 0, len(x.checks))
+	for _, check := range x.checks {
+		checks = append(checks, check)
+	}
 	x.mu.Unlock()
 
 	var wg sync.WaitGroup
@@ -22,4 +22,7 @@ func TestRun(t *testing.T) {
 		t.Errorf("Expected an error but got none")
 	}
 	assert.True(t, firstCheckCalled, "Expected the first check to be called")
+
+	healthz.Deregister("check2")
+	assert.NoError(t, healthz.NewHealthz().Run())
 }
@@ -30,6 +30,11 @@ func SetVersion(i *ServerVersion) {
 	})
 }
 
+// GetVersion returns the version of the server.
+func GetVersion() *ServerVersion {
+	return info
+}
+
 func Endpoint() http.Handler {
 	r := chi.NewRouter()
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
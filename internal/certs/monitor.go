@@ -0,0 +1,227 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultWarning is how long before its expiry the certificate is
+	// reported as expiring
+	DefaultWarning = 14 * 24 * time.Hour
+
+	retryDelay    = 5 * time.Minute // after failing to fetch a staple
+	checkInterval = time.Hour       // of the expiry warnings
+)
+
+// current is the monitor published as the "tls" expvar, the last one run.
+var current atomic.Pointer[Monitor]
+
+func init() {
+	expvar.Publish("tls", expvar.Func(func() interface{} {
+		if m := current.Load(); m != nil {
+			return m.Stats()
+		}
+		return nil
+	}))
+}
+
+// Monitor serves a certificate stapled with its OCSP response, fetched
+// from the responder of the certificate and refreshed halfway through its
+// validity, and reports the certificate expiring within Warning. It serves
+// the certificate without staple when it has no issuer in its chain or no
+// OCSP responder, and once the staple expires.
+type Monitor struct {
+	Client   *http.Client  // defaults to one timing out after 10s
+	Stapling bool          // fetches the OCSP staples
+	Warning  time.Duration // defaults to DefaultWarning
+
+	leaf, issuer *x509.Certificate
+	cert         atomic.Pointer[tls.Certificate]
+
+	mu        sync.Mutex
+	staple    *staple
+	refreshes int64
+	failures  int64
+
+	now func() time.Time
+}
+
+// Stats are the expiry of the certificate and the state of its staple.
+type Stats struct {
+	NotAfter        time.Time  `json:"not_after"`
+	DaysUntilExpiry int        `json:"days_until_expiry"`
+	Expiring        bool       `json:"expiring"` // within Warning
+	OCSPStatus      string     `json:"ocsp_status,omitempty"`
+	OCSPNextUpdate  *time.Time `json:"ocsp_next_update,omitempty"`
+	OCSPRefreshes   int64      `json:"ocsp_refreshes"`
+	OCSPErrors      int64      `json:"ocsp_errors"`
+}
+
+// New returns the Monitor of cert, the issuer being the second certificate
+// of its chain.
+func New(cert tls.Certificate) (*Monitor, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("empty certificate chain")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing the certificate: %w", err)
+	}
+	cert.Leaf = leaf
+	m := &Monitor{leaf: leaf, now: time.Now}
+	if len(cert.Certificate) > 1 {
+		if m.issuer, err = x509.ParseCertificate(cert.Certificate[1]); err != nil {
+			return nil, fmt.Errorf("error while parsing the issuer certificate: %w", err)
+		}
+	}
+	m.cert.Store(&cert)
+	return m, nil
+}
+
+// GetCertificate returns the certificate with its current staple, for
+// tls.Config.GetCertificate.
+func (m *Monitor) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.cert.Load(), nil
+}
+
+// Staples reports whether the certificate can be stapled.
+func (m *Monitor) Staples() bool {
+	return m.Stapling && m.issuer != nil && len(m.leaf.OCSPServer) > 0
+}
+
+// Refresh fetches the staple of the certificate, the previous one being
+// kept on failure until it expires, and returns when to refresh it next.
+func (m *Monitor) Refresh(ctx context.Context) (time.Duration, error) {
+	if m.issuer == nil || len(m.leaf.OCSPServer) == 0 {
+		return 0, errors.New("the certificate has no issuer in its chain or no OCSP responder")
+	}
+	client := m.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	fetched, err := fetchStaple(ctx, client, m.leaf, m.issuer)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if err == nil && !fetched.nextUpdate.IsZero() && !now.Before(fetched.nextUpdate) {
+		err = errors.New("expired OCSP response")
+	}
+	if err != nil {
+		m.failures++
+		if m.staple != nil && !m.staple.nextUpdate.IsZero() && !now.Before(m.staple.nextUpdate) {
+			m.staple = nil
+			m.serve(nil)
+		}
+		return retryDelay, fmt.Errorf("error while fetching the OCSP staple from %s: %w", m.leaf.OCSPServer[0], err)
+	}
+	m.refreshes++
+	m.staple = fetched
+	m.serve(fetched.raw)
+	if fetched.nextUpdate.IsZero() {
+		return checkInterval, nil
+	}
+	next := fetched.thisUpdate.Add(fetched.nextUpdate.Sub(fetched.thisUpdate) / 2).Sub(now)
+	return max(next, time.Minute), nil
+}
+
+// serve replaces the served certificate by one with the staple raw.
+func (m *Monitor) serve(raw []byte) {
+	cert := *m.cert.Load()
+	cert.OCSPStaple = raw
+	m.cert.Store(&cert)
+}
+
+// Run refreshes the staple until ctx is done, and logs a warning every
+// hour while the certificate is expiring, publishing its Stats as the
+// "tls" expvar, served under /debug/vars.
+func (m *Monitor) Run(ctx context.Context) {
+	current.Store(m)
+	m.warn()
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	refresh := time.NewTimer(0)
+	defer refresh.Stop()
+	if !m.Staples() {
+		refresh.Stop()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.warn()
+		case <-refresh.C:
+			next, err := m.Refresh(ctx)
+			if err != nil && ctx.Err() == nil {
+				logrus.WithError(err).Warn("keeping the previous OCSP staple")
+			}
+			refresh.Reset(next)
+		}
+	}
+}
+
+func (m *Monitor) warn() {
+	if err := m.Check(m.warning()); err != nil {
+		logrus.WithError(err).Warn("renew the TLS certificate")
+	}
+}
+
+func (m *Monitor) warning() time.Duration {
+	if m.Warning <= 0 {
+		return DefaultWarning
+	}
+	return m.Warning
+}
+
+// Check returns an error when the certificate expires within the
+// duration, or has been revoked.
+func (m *Monitor) Check(within time.Duration) error {
+	m.mu.Lock()
+	revoked := m.staple != nil && m.staple.status == StatusRevoked
+	m.mu.Unlock()
+	if revoked {
+		return errors.New("the TLS certificate has been revoked")
+	}
+	left := m.leaf.NotAfter.Sub(m.now())
+	switch {
+	case left <= 0:
+		return fmt.Errorf("the TLS certificate expired on %s", m.leaf.NotAfter.UTC().Format(time.RFC3339))
+	case left <= within:
+		return fmt.Errorf("the TLS certificate expires on %s, in %d days", m.leaf.NotAfter.UTC().Format(time.RFC3339), int(left.Hours()/24))
+	}
+	return nil
+}
+
+// Stats returns the expiry of the certificate and the state of its staple.
+func (m *Monitor) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	left := m.leaf.NotAfter.Sub(m.now())
+	s := Stats{
+		NotAfter:        m.leaf.NotAfter,
+		DaysUntilExpiry: int(left.Hours() / 24),
+		Expiring:        left <= m.warning(),
+		OCSPRefreshes:   m.refreshes,
+		OCSPErrors:      m.failures,
+	}
+	if m.staple != nil {
+		s.OCSPStatus = m.staple.status
+		if !m.staple.nextUpdate.IsZero() {
+			next := m.staple.nextUpdate
+			s.OCSPNextUpdate = &next
+		}
+	}
+	return s
+}
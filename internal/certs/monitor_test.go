@@ -0,0 +1,207 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/certs"
+)
+
+type certID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type singleResponse struct {
+	CertID  certID
+	Good    asn1.Flag `asn1:"tag:0,optional"`
+	Revoked struct {
+		RevocationTime time.Time `asn1:"generalized"`
+	} `asn1:"tag:1,optional"`
+	ThisUpdate time.Time `asn1:"generalized"`
+	NextUpdate time.Time `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type responseData struct {
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []singleResponse
+}
+
+type basicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	} `asn1:"explicit,tag:0,optional"`
+}
+
+// responder answers the OCSP requests with the status, signed by key.
+type responder struct {
+	key     *ecdsa.PrivateKey
+	revoked bool
+	next    time.Duration // validity of the responses
+}
+
+func (x *responder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req struct {
+		TBSRequest struct {
+			RequestList []struct {
+				ReqCert certID
+			}
+		}
+	}
+	if _, err := asn1.Unmarshal(body, &req); err != nil || len(req.TBSRequest.RequestList) != 1 {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	single := singleResponse{CertID: req.TBSRequest.RequestList[0].ReqCert, ThisUpdate: now, NextUpdate: now.Add(x.next)}
+	if x.revoked {
+		single.Revoked.RevocationTime = now.Add(-time.Hour)
+	} else {
+		single.Good = true
+	}
+	keyID, _ := asn1.Marshal([]byte("responder"))
+	tbs, _ := asn1.Marshal(responseData{
+		ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: keyID},
+		ProducedAt:  now,
+		Responses:   []singleResponse{single},
+	})
+	digest := sha256.Sum256(tbs)
+	sig, _ := ecdsa.SignASN1(rand.Reader, x.key, digest[:])
+	basic, _ := asn1.Marshal(basicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+	var resp ocspResponse
+	resp.ResponseBytes.ResponseType = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	resp.ResponseBytes.Response = basic
+	der, _ := asn1.Marshal(resp)
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = w.Write(der)
+}
+
+// issue returns the chain of a certificate valid for validity, issued by a
+// new CA, and the key of the CA.
+func issue(t *testing.T, validity time.Duration, ocspServer string) (tls.Certificate, *ecdsa.PrivateKey) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err = x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+	}
+	if ocspServer != "" {
+		leaf.OCSPServer = []string{ocspServer}
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{leafDER, caDER}, PrivateKey: key}, caKey
+}
+
+func TestStapling(t *testing.T) {
+	x := &responder{next: 4 * time.Hour}
+	srv := httptest.NewServer(x)
+	defer srv.Close()
+	cert, caKey := issue(t, 90*24*time.Hour, srv.URL)
+	x.key = caKey
+
+	m, err := certs.New(cert)
+	require.NoError(t, err)
+	m.Stapling = true
+	require.True(t, m.Staples())
+
+	next, err := m.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.InDelta(t, 2*time.Hour, next, float64(time.Minute), "refreshed halfway through the validity")
+	served, err := m.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, served.OCSPStaple)
+	stats := m.Stats()
+	assert.Equal(t, certs.StatusGood, stats.OCSPStatus)
+	assert.Equal(t, int64(1), stats.OCSPRefreshes)
+	assert.Equal(t, 89, stats.DaysUntilExpiry)
+	assert.False(t, stats.Expiring)
+	assert.NoError(t, m.Check(0))
+
+	// A response signed by another key keeps the previous staple
+	x.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = m.Refresh(context.Background())
+	assert.ErrorContains(t, err, "invalid OCSP response signature")
+	again, _ := m.GetCertificate(nil)
+	assert.Equal(t, served.OCSPStaple, again.OCSPStaple)
+	assert.Equal(t, int64(1), m.Stats().OCSPErrors)
+
+	x.key, x.revoked = caKey, true
+	_, err = m.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, certs.StatusRevoked, m.Stats().OCSPStatus)
+	assert.ErrorContains(t, m.Check(0), "revoked")
+}
+
+func TestExpiry(t *testing.T) {
+	cert, _ := issue(t, 3*24*time.Hour, "")
+	m, err := certs.New(cert)
+	require.NoError(t, err)
+	m.Stapling = true
+	assert.False(t, m.Staples(), "no OCSP responder")
+	_, err = m.Refresh(context.Background())
+	assert.Error(t, err)
+
+	stats := m.Stats()
+	assert.Equal(t, 2, stats.DaysUntilExpiry)
+	assert.True(t, stats.Expiring, "within the default warning")
+	assert.Empty(t, stats.OCSPStatus)
+	assert.NoError(t, m.Check(0))
+	assert.ErrorContains(t, m.Check(7*24*time.Hour), "expires on")
+
+	expired, _ := issue(t, -time.Minute, "")
+	m, err = certs.New(expired)
+	require.NoError(t, err)
+	assert.ErrorContains(t, m.Check(0), "expired on")
+}
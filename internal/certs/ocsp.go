@@ -0,0 +1,247 @@
+package certs
+
+// Certificate served in https mode, stapled with its OCSP response and
+// watched for expiry, and the session ticket keys of its handshakes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// OCSP statuses of a certificate
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+	StatusUnknown = "unknown"
+)
+
+// maxResponseSize bounds the OCSP responses read
+const maxResponseSize = 1 << 20
+
+var (
+	oidSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+)
+
+// signatureAlgorithms are the algorithms of the OCSP responses verified
+var signatureAlgorithms = map[string]x509.SignatureAlgorithm{
+	"1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+	"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+	"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+	"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+	"1.2.840.10045.4.1":     x509.ECDSAWithSHA1,
+	"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+	"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+	"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+	"1.3.101.112":           x509.PureEd25519,
+}
+
+// RFC 6960 structures, the optional ones left out of the request
+
+type certID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest struct {
+		RequestList []struct {
+			ReqCert certID
+		}
+	}
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	} `asn1:"explicit,tag:0,optional"`
+}
+
+type basicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type responseData struct {
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []singleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type singleResponse struct {
+	CertID     certID
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    revokedInfo      `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type revokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// staple is an OCSP response of a certificate, stapled to the TLS
+// handshakes while valid.
+type staple struct {
+	raw        []byte
+	status     string
+	thisUpdate time.Time
+	nextUpdate time.Time // zero when the responder sets none
+}
+
+// ocspRequestFor returns the DER OCSP request of cert, issued by issuer.
+func ocspRequestFor(cert, issuer *x509.Certificate) ([]byte, error) {
+	id, err := newCertID(cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	var req ocspRequest
+	req.TBSRequest.RequestList = append(req.TBSRequest.RequestList, struct{ ReqCert certID }{id})
+	return asn1.Marshal(req)
+}
+
+func newCertID(cert, issuer *x509.Certificate) (certID, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return certID{}, fmt.Errorf("error while reading the public key of the issuer: %w", err)
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	return certID{
+		HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		IssuerNameHash: nameHash[:],
+		IssuerKeyHash:  keyHash[:],
+		SerialNumber:   cert.SerialNumber,
+	}, nil
+}
+
+// parseStaple returns the OCSP response der of cert, verified to be signed
+// by issuer or by a responder issuer delegates to.
+func parseStaple(der []byte, cert, issuer *x509.Certificate) (*staple, error) {
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil || len(rest) > 0 {
+		return nil, errors.New("malformed OCSP response")
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("OCSP responder error %d", resp.Status)
+	}
+	if !resp.ResponseBytes.ResponseType.Equal(oidBasicResponse) {
+		return nil, errors.New("unsupported OCSP response type")
+	}
+	var basic basicResponse
+	if _, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return nil, errors.New("malformed basic OCSP response")
+	}
+	var data responseData
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return nil, errors.New("malformed OCSP response data")
+	}
+
+	signer := issuer
+	if len(basic.Certificates) > 0 {
+		responder, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing the OCSP responder certificate: %w", err)
+		}
+		if !responder.Equal(issuer) {
+			if err := responder.CheckSignatureFrom(issuer); err != nil {
+				return nil, fmt.Errorf("OCSP responder not issued by the issuer: %w", err)
+			}
+			if !delegated(responder) {
+				return nil, errors.New("OCSP responder not authorized to sign responses")
+			}
+		}
+		signer = responder
+	}
+	algorithm, ok := signatureAlgorithms[basic.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported OCSP signature algorithm %s", basic.SignatureAlgorithm.Algorithm)
+	}
+	if err := signer.CheckSignature(algorithm, basic.TBSResponseData.FullBytes, basic.Signature.RightAlign()); err != nil {
+		return nil, fmt.Errorf("invalid OCSP response signature: %w", err)
+	}
+
+	for _, r := range data.Responses {
+		if r.CertID.SerialNumber == nil || r.CertID.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			continue
+		}
+		if r.CertID.HashAlgorithm.Algorithm.Equal(oidSHA1) {
+			if id, err := newCertID(cert, issuer); err != nil || !bytes.Equal(id.IssuerNameHash, r.CertID.IssuerNameHash) || !bytes.Equal(id.IssuerKeyHash, r.CertID.IssuerKeyHash) {
+				continue
+			}
+		}
+		status := StatusUnknown
+		switch {
+		case bool(r.Good):
+			status = StatusGood
+		case !r.Revoked.RevocationTime.IsZero():
+			status = StatusRevoked
+		}
+		return &staple{raw: der, status: status, thisUpdate: r.ThisUpdate, nextUpdate: r.NextUpdate}, nil
+	}
+	return nil, errors.New("OCSP response not of the certificate")
+}
+
+// delegated reports whether responder may sign OCSP responses.
+func delegated(responder *x509.Certificate) bool {
+	for _, usage := range responder.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchStaple queries the first OCSP responder of cert.
+func fetchStaple(ctx context.Context, client *http.Client, cert, issuer *x509.Certificate) (*staple, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, errors.New("no OCSP responder in the certificate")
+	}
+	body, err := ocspRequestFor(cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cert.OCSPServer[0], bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder replied %s", resp.Status)
+	}
+	der, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	return parseStaple(der, cert, issuer)
+}
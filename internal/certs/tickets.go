@@ -0,0 +1,127 @@
+package certs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/keys"
+	"github.com/go-obvious/server/redact"
+)
+
+const (
+	// DefaultTicketRotation is the interval of the session ticket keys
+	// when none is set
+	DefaultTicketRotation = 24 * time.Hour
+
+	ticketKeysKept = 3 // intervals whose sessions resume, the current one included
+)
+
+// Tickets rotates the session ticket keys of TLS configurations at the
+// start of every Interval, the keys of the previous intervals resuming the
+// sessions they issued until retired, so a key leaked from memory only
+// decrypts the sessions of a few intervals. Keys are random to the
+// instance, or derived from the secrets of Secrets, the first one being
+// the current one, so the instances behind a load balancer resume the
+// sessions of one another; the secrets are reloaded on every rotation to
+// pick up the rotations made in the secrets provider.
+type Tickets struct {
+	Interval time.Duration // defaults to DefaultTicketRotation
+	Secrets  []string      // references such as "vault://secret/data/app#tickets"
+
+	configs []*tls.Config
+	ring    keys.Ring
+	random  [][32]byte // of the intervals from epoch on, newest first
+	epoch   int64
+
+	now func() time.Time
+}
+
+// NewTickets returns the rotation of the session ticket keys of configs.
+func NewTickets(configs ...*tls.Config) *Tickets {
+	return &Tickets{configs: configs, now: time.Now}
+}
+
+func (t *Tickets) interval() time.Duration {
+	if t.Interval <= 0 {
+		return DefaultTicketRotation
+	}
+	return t.Interval
+}
+
+// Rotate sets the keys of the current interval, and returns when the next
+// one starts. A failed reload of the secrets keeps the previous keys.
+func (t *Tickets) Rotate(ctx context.Context) (time.Duration, error) {
+	interval := int64(t.interval())
+	now := t.now().UnixNano()
+	epoch := now / interval
+	next := time.Duration((epoch+1)*interval - now)
+
+	var ticketKeys [][32]byte
+	if len(t.Secrets) > 0 {
+		if err := t.ring.Load(ctx, t.Secrets...); err != nil {
+			return min(retryDelay, next), err
+		}
+		secrets := t.ring.Keys()
+		if len(secrets) == 0 {
+			return min(retryDelay, next), errors.New("empty session ticket secrets")
+		}
+		// The next interval decrypts the tickets of the instances whose
+		// clock is ahead
+		ticketKeys = append(ticketKeys, ticketKey(secrets[0].Secret, epoch), ticketKey(secrets[0].Secret, epoch+1))
+		for i := int64(1); i < ticketKeysKept; i++ {
+			ticketKeys = append(ticketKeys, ticketKey(secrets[0].Secret, epoch-i))
+		}
+		for _, k := range secrets[1:] {
+			for i := int64(0); i < ticketKeysKept; i++ {
+				ticketKeys = append(ticketKeys, ticketKey(k.Secret, epoch-i))
+			}
+		}
+	} else {
+		if t.random == nil || epoch != t.epoch {
+			var key [32]byte
+			_, _ = rand.Read(key[:])
+			t.random = append([][32]byte{key}, t.random[:min(len(t.random), ticketKeysKept-1)]...)
+			t.epoch = epoch
+		}
+		ticketKeys = t.random
+	}
+	for _, c := range t.configs {
+		c.SetSessionTicketKeys(ticketKeys)
+	}
+	return next, nil
+}
+
+// ticketKey derives the session ticket key of an interval from secret.
+func ticketKey(secret []byte, epoch int64) (key [32]byte) {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("tls-session-ticket:"))
+	_ = binary.Write(mac, binary.BigEndian, epoch)
+	copy(key[:], mac.Sum(nil))
+	return key
+}
+
+// Run rotates the keys until ctx is done.
+func (t *Tickets) Run(ctx context.Context) {
+	rotate := time.NewTimer(0)
+	defer rotate.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rotate.C:
+			next, err := t.Rotate(ctx)
+			if err != nil && ctx.Err() == nil {
+				logrus.WithError(redact.Error(err)).Warn("keeping the previous session ticket keys")
+			}
+			rotate.Reset(next)
+		}
+	}
+}
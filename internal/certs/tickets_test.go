@@ -0,0 +1,88 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/certs"
+)
+
+// resumes reports whether the client resumed its session with the server.
+func resumes(t *testing.T, server, client *tls.Config) bool {
+	sc, cc := net.Pipe()
+	defer sc.Close()
+	defer cc.Close()
+	errCh := make(chan error, 1)
+	go func() { errCh <- tls.Server(sc, server).Handshake() }()
+	conn := tls.Client(cc, client)
+	require.NoError(t, conn.Handshake())
+	require.NoError(t, <-errCh)
+	return conn.ConnectionState().DidResume
+}
+
+func TestSharedTickets(t *testing.T) {
+	cert, _ := issue(t, 24*time.Hour, "")
+	instance := func(secrets ...string) *tls.Config {
+		cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+		tickets := certs.NewTickets(cfg)
+		tickets.Interval, tickets.Secrets = time.Hour, secrets
+		next, err := tickets.Rotate(context.Background())
+		require.NoError(t, err)
+		assert.LessOrEqual(t, next, time.Hour)
+		return cfg
+	}
+	a, b := instance("ticket-secret-1"), instance("ticket-secret-1")
+	rotated := instance("ticket-secret-2", "ticket-secret-1")
+	other := instance("ticket-secret-3")
+
+	client := &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12, ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+	assert.False(t, resumes(t, a, client))
+	assert.True(t, resumes(t, b, client), "the instances share the keys")
+	assert.True(t, resumes(t, rotated, client), "the previous secret decrypts")
+	assert.False(t, resumes(t, other, client))
+
+	tickets := certs.NewTickets(&tls.Config{})
+	tickets.Secrets = []string{""}
+	_, err := tickets.Rotate(context.Background())
+	assert.Error(t, err)
+}
+
+func TestRotatedTickets(t *testing.T) {
+	cert, _ := issue(t, 24*time.Hour, "")
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	tickets := certs.NewTickets(cfg)
+	// Long enough for the handshakes between two rotations, even under the
+	// race detector, not to overrun an interval
+	tickets.Interval = 250 * time.Millisecond
+	rotate := func() {
+		next, err := tickets.Rotate(context.Background())
+		require.NoError(t, err)
+		time.Sleep(next)
+		_, err = tickets.Rotate(context.Background())
+		require.NoError(t, err)
+	}
+	_, err := tickets.Rotate(context.Background())
+	require.NoError(t, err)
+
+	client := &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12, ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+	assert.False(t, resumes(t, cfg, client))
+	assert.True(t, resumes(t, cfg, client))
+
+	rotate()
+	rotate()
+	assert.True(t, resumes(t, cfg, client), "the previous keys decrypt")
+	assert.True(t, resumes(t, cfg, client))
+
+	client.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	assert.False(t, resumes(t, cfg, client))
+	for range 3 {
+		rotate()
+	}
+	assert.False(t, resumes(t, cfg, client), "the key is retired")
+}
@@ -0,0 +1,125 @@
+package chain
+
+// Middleware chain composed ahead of time for each static path, leaving out
+// the middlewares passing its requests through untouched
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-chi/chi"
+)
+
+// Chain runs its middlewares in the order they are added. Installed as the
+// single middleware of a router, it serves the compiled paths by their own
+// chain and any other path by the full one. The zero value is ready to use.
+type Chain struct {
+	mu    sync.Mutex
+	links []link
+	next  http.Handler
+	full  http.Handler
+	paths atomic.Pointer[map[string]http.Handler]
+}
+
+type link struct {
+	middleware func(http.Handler) http.Handler
+	skips      func(path string) bool
+}
+
+// Use adds a middleware applying to every path.
+func (c *Chain) Use(middleware func(http.Handler) http.Handler) {
+	c.UseUnless(nil, middleware)
+}
+
+// UseUnless adds a middleware left out of the compiled chain of the paths
+// skips reports, which must be those the middleware passes through
+// untouched, such as the paths it exempts.
+func (c *Chain) UseUnless(skips func(path string) bool, middleware func(http.Handler) http.Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.links = append(c.links, link{middleware: middleware, skips: skips})
+}
+
+// Middleware runs the chain ahead of next.
+func (c *Chain) Middleware(next http.Handler) http.Handler {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next = next
+	c.full = c.compose("", true)
+	return http.HandlerFunc(c.serveHTTP)
+}
+
+func (c *Chain) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if paths := c.paths.Load(); paths != nil {
+		if h, ok := (*paths)[r.URL.Path]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+	c.full.ServeHTTP(w, r)
+}
+
+// Compile composes the chain of each path some middleware skips, replacing
+// those compiled before. The other paths keep the full chain.
+func (c *Chain) Compile(paths ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next == nil {
+		return
+	}
+	compiled := map[string]http.Handler{}
+	for _, path := range paths {
+		if _, ok := compiled[path]; !ok && c.skipped(path) {
+			compiled[path] = c.compose(path, false)
+		}
+	}
+	c.paths.Store(&compiled)
+}
+
+// Compiled returns the number of paths served by their own chain.
+func (c *Chain) Compiled() int {
+	if paths := c.paths.Load(); paths != nil {
+		return len(*paths)
+	}
+	return 0
+}
+
+func (c *Chain) skipped(path string) bool {
+	for _, l := range c.links {
+		if l.skips != nil && l.skips(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// compose returns the chain of path, or the full chain.
+func (c *Chain) compose(path string, full bool) http.Handler {
+	middlewares := make(chi.Middlewares, 0, len(c.links))
+	for _, l := range c.links {
+		if full || l.skips == nil || !l.skips(path) {
+			middlewares = append(middlewares, l.middleware)
+		}
+	}
+	return middlewares.Handler(c.next)
+}
+
+// StaticPaths returns the paths of the routes without parameters nor
+// wildcards, with and without their trailing slash, those a mounted router
+// being served on both.
+func StaticPaths(routes chi.Routes) []string {
+	paths := []string{}
+	_ = chi.Walk(routes, func(_ string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if strings.ContainsAny(route, "{*") {
+			return nil
+		}
+		paths = append(paths, route)
+		if trimmed := strings.TrimSuffix(route, "/"); trimmed != route && trimmed != "" {
+			paths = append(paths, trimmed)
+		}
+		return nil
+	})
+	return paths
+}
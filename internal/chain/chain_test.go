@@ -0,0 +1,57 @@
+package chain_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/internal/chain"
+)
+
+// trace appends name to the X-Trace header of the response.
+func trace(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	c := &chain.Chain{}
+	c.Use(trace("first"))
+	c.UseUnless(func(path string) bool { return strings.HasPrefix(path, "/health") }, trace("maintenance"))
+	c.UseUnless(func(path string) bool { return path != "/jobs/status" }, trace("quiet"))
+	c.Use(trace("last"))
+
+	mux := chi.NewRouter()
+	mux.Use(c.Middleware)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	mux.Get("/healthz", ok)
+	mux.Get("/orders/{id}", ok)
+	mux.Route("/jobs", func(r chi.Router) {
+		r.Get("/", ok)
+		r.Get("/status", ok)
+	})
+
+	assert.ElementsMatch(t, []string{"/healthz", "/jobs/", "/jobs", "/jobs/status"}, chain.StaticPaths(mux))
+	serve := func(path string) []string {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Header().Values("X-Trace")
+	}
+	all := []string{"first", "maintenance", "quiet", "last"}
+	assert.Equal(t, all, serve("/healthz"), "the full chain until compiled")
+
+	c.Compile(chain.StaticPaths(mux)...)
+	assert.Equal(t, 3, c.Compiled())
+	assert.Equal(t, []string{"first", "last"}, serve("/healthz"))
+	assert.Equal(t, []string{"first", "maintenance", "last"}, serve("/jobs"))
+	assert.Equal(t, all, serve("/jobs/status"), "nothing skipped")
+	assert.Equal(t, all, serve("/orders/42"), "the full chain for the other paths")
+}
@@ -0,0 +1,127 @@
+package drain
+
+// Tracks the in-flight requests so shutdown can drain them
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrDraining = errors.New("server is draining")
+
+// Tracker counts the in-flight requests and holds the drain state of a
+// server. The zero value is ready to use.
+type Tracker struct {
+	active   atomic.Int64
+	done     atomic.Int64
+	draining atomic.Bool
+
+	doneAtStart atomic.Int64
+
+	mu    sync.Mutex
+	fresh map[net.Conn]time.Time // connections yet to send a request, by accept time
+}
+
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.active.Add(1)
+		defer func() {
+			t.active.Add(-1)
+			t.done.Add(1)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Active returns the number of in-flight requests.
+func (t *Tracker) Active() int64 {
+	return t.active.Load()
+}
+
+// Draining reports whether the server stopped being ready.
+func (t *Tracker) Draining() bool {
+	return t.draining.Load()
+}
+
+// Start flips the server to draining, requests are still served but the
+// readiness check fails so load balancers stop routing new ones.
+func (t *Tracker) Start() {
+	t.doneAtStart.Store(t.done.Load())
+	t.draining.Store(true)
+}
+
+// Ready is a health check failing once draining started.
+func (t *Tracker) Ready() error {
+	if t.Draining() {
+		return ErrDraining
+	}
+	return nil
+}
+
+// Drained returns the number of requests completed since draining started.
+func (t *Tracker) Drained() int64 {
+	if !t.Draining() {
+		return 0
+	}
+	return t.done.Load() - t.doneAtStart.Load()
+}
+
+// Wait blocks until no request is in flight or ctx is done, returning the
+// number of requests still in flight.
+func (t *Tracker) Wait(ctx context.Context) int64 {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if t.Active() == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return t.Active()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ConnState is the http.Server.ConnState hook tracking the connections
+// which did not send a request yet.
+func (t *Tracker) ConnState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state == http.StateNew {
+		if t.fresh == nil {
+			t.fresh = make(map[net.Conn]time.Time)
+		}
+		t.fresh[c] = time.Now()
+		return
+	}
+	delete(t.fresh, c)
+}
+
+// CloseFresh closes, until ctx is done, the connections which sent no
+// request within idle of being accepted, such as those dialed ahead by the
+// client pools, which http.Server.Shutdown otherwise waits 5 seconds for.
+func (t *Tracker) CloseFresh(ctx context.Context, idle time.Duration) {
+	ticker := time.NewTicker(idle / 10)
+	defer ticker.Stop()
+	for {
+		t.mu.Lock()
+		for c, accepted := range t.fresh {
+			if time.Since(accepted) >= idle {
+				_ = c.Close()
+				delete(t.fresh, c)
+			}
+		}
+		t.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package drain_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/internal/drain"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := &drain.Tracker{}
+	release := make(chan struct{})
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+
+	served := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(served)
+	}()
+	assert.Eventually(t, func() bool { return tracker.Active() == 1 }, time.Second, time.Millisecond)
+
+	assert.NoError(t, tracker.Ready())
+	tracker.Start()
+	assert.ErrorIs(t, tracker.Ready(), drain.ErrDraining)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, int64(1), tracker.Wait(ctx), "the request is still in flight")
+
+	close(release)
+	<-served
+	assert.Equal(t, int64(0), tracker.Wait(context.Background()))
+	assert.Equal(t, int64(1), tracker.Drained())
+}
+
+func TestCloseFresh(t *testing.T) {
+	tracker := &drain.Tracker{}
+	fresh, peer := net.Pipe()
+	defer peer.Close()
+	served, servedPeer := net.Pipe()
+	defer servedPeer.Close()
+	tracker.ConnState(fresh, http.StateNew)
+	tracker.ConnState(served, http.StateNew)
+	tracker.ConnState(served, http.StateActive)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	tracker.CloseFresh(ctx, 10*time.Millisecond)
+
+	_, err := peer.Read(make([]byte, 1))
+	assert.Error(t, err, "closed without request")
+	assert.NoError(t, served.SetDeadline(time.Now().Add(time.Millisecond)), "kept open")
+}
@@ -8,10 +8,16 @@ import (
 	"github.com/go-obvious/server/request"
 )
 
-func Endpoint() http.Handler {
+// Endpoint replies the outcome of the registered health checks, preceded
+// by the server checks such as its readiness.
+func Endpoint(checks ...healthz.HealthCheck) http.Handler {
 	r := chi.NewRouter()
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		if err := healthz.NewHealthz().Run(); err != nil {
+		err := run(checks)
+		if err == nil {
+			err = healthz.NewHealthz().Run()
+		}
+		if err != nil {
 			request.Reply(r, w,
 				request.Result{
 					Success: false,
@@ -25,3 +31,12 @@ func Endpoint() http.Handler {
 	})
 	return r
 }
+
+func run(checks []healthz.HealthCheck) error {
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package healthz_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -22,3 +23,13 @@ func TestEndpoint(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 }
+
+func TestEndpointChecks(t *testing.T) {
+	handler := healthz.Endpoint(func() error { return errors.New("draining") })
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "draining")
+}
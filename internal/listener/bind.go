@@ -0,0 +1,80 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// BindError is returned when an address could not be listened on, after
+// Attempts attempts.
+type BindError struct {
+	Addr     string
+	Attempts int
+	Err      error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("error while listening on %s after %d attempt(s): %v", e.Addr, e.Attempts, e.Err)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// Addr returns the address of port on host, all the interfaces when host is
+// empty, an IPv6 host being bracketed.
+func Addr(host string, port uint) string {
+	return net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+}
+
+// ValidNetwork reports whether network is "tcp", "tcp4" or "tcp6".
+func ValidNetwork(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return true
+	}
+	return false
+}
+
+// AddrInUse reports whether err is caused by the address being taken, such
+// as by the lingering sockets of a previous process.
+func AddrInUse(err error) bool {
+	return addrInUse(err)
+}
+
+// bind listens on addr, retrying while the address is taken, up to
+// BindRetries times, the backoff doubling after each attempt.
+func (o Options) bind(ctx context.Context, addr string) (net.Listener, error) {
+	bind := o.Bind
+	if bind == nil {
+		bind = net.Listen
+	}
+	network := o.Network
+	if network == "" {
+		network = "tcp"
+	}
+	backoff := o.BindBackoff
+	if backoff <= 0 {
+		backoff = 250 * time.Millisecond
+	}
+	for attempt := 1; ; attempt++ {
+		l, err := bind(network, addr)
+		if err == nil {
+			return l, nil
+		}
+		if attempt > o.BindRetries || !AddrInUse(err) {
+			return nil, &BindError{Addr: addr, Attempts: attempt, Err: err}
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, &BindError{Addr: addr, Attempts: attempt, Err: err}
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package listener
+
+import (
+	"errors"
+	"syscall"
+)
+
+func addrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
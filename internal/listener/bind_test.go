@@ -0,0 +1,59 @@
+package listener_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/listener"
+)
+
+func TestListenRetries(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := taken.Addr().String()
+
+	opts := listener.Options{BindRetries: 1, BindBackoff: time.Millisecond}
+	_, err = opts.Listen(addr)
+	var bindErr *listener.BindError
+	require.ErrorAs(t, err, &bindErr)
+	assert.Equal(t, addr, bindErr.Addr)
+	assert.Equal(t, 2, bindErr.Attempts)
+	assert.True(t, listener.AddrInUse(err))
+
+	// The socket is released while retrying
+	time.AfterFunc(50*time.Millisecond, func() { _ = taken.Close() })
+	opts = listener.Options{BindRetries: 10, BindBackoff: 20 * time.Millisecond}
+	l, err := opts.Listen(addr)
+	require.NoError(t, err)
+	l.Close()
+}
+
+func TestListenFailures(t *testing.T) {
+	attempts := 0
+	denied := errors.New("permission denied")
+	opts := listener.Options{BindRetries: 3, Bind: func(string, string) (net.Listener, error) {
+		attempts++
+		return nil, denied
+	}}
+	_, err := opts.Listen(":80")
+	assert.ErrorIs(t, err, denied)
+	assert.Equal(t, 1, attempts, "only an address taken is retried")
+	assert.False(t, listener.AddrInUse(err))
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	opts = listener.Options{BindRetries: 100, BindBackoff: time.Second}
+	start := time.Now()
+	_, err = opts.ListenContext(ctx, taken.Addr().String())
+	assert.True(t, listener.AddrInUse(err))
+	assert.Less(t, time.Since(start), time.Second, "the retries end with the context")
+}
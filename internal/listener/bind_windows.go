@@ -0,0 +1,14 @@
+package listener
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// addrInUse also matches the Winsock error, syscall.EADDRINUSE being an
+// invented value on Windows.
+func addrInUse(err error) bool {
+	return errors.Is(err, windows.WSAEADDRINUSE) || errors.Is(err, syscall.EADDRINUSE)
+}
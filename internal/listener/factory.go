@@ -1,7 +1,13 @@
 package listener
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-obvious/gateway"
 )
@@ -9,19 +15,151 @@ import (
 const (
 	AwsGatewayLambda   = "aws-gateway-v1"
 	AwsGatewayV2Lambda = "aws-gateway-v2"
+	AwsALBLambda       = "aws-alb"
+	AwsFunctionURL     = "aws-function-url"
+	AwsLambda          = "aws-lambda" // ALB, Function URL or HTTP API, detected from each event
 	Https              = "https"
 	Http               = "http"
+	GcpCloudRun        = "gcp-cloud-run"
+	GcpCloudFunctions  = "gcp-cloud-functions"
 )
 
+// IsHTTP reports whether the mode serves an http.Server, shut down
+// gracefully, rather than a serverless adapter.
+func IsHTTP(mode string) bool {
+	switch mode {
+	case Http, Https, GcpCloudRun, GcpCloudFunctions:
+		return true
+	}
+	return false
+}
+
+// IsGCP reports whether the mode runs on the GCP serverless platforms,
+// Cloud Run and Cloud Functions, which run the container behind the
+// Google Front End.
+func IsGCP(mode string) bool {
+	return mode == GcpCloudRun || mode == GcpCloudFunctions
+}
+
+// Port returns the port to listen on, the one the GCP serverless platforms
+// set in PORT taking the place of the configured one.
+func Port(mode string, port uint) uint {
+	if IsGCP(mode) {
+		if p, err := strconv.ParseUint(os.Getenv("PORT"), 10, 16); err == nil && p > 0 {
+			return uint(p)
+		}
+	}
+	return port
+}
+
 type ListenAndServeFunc func(addr string, router http.Handler) error
 
+// Options of the http.Server used by the http and https modes, zero values
+// keep the net/http defaults.
+type Options struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	// Strict rejects the requests with an ambiguous HTTP/1 framing, for
+	// servers receiving requests directly rather than behind a proxy. It
+	// does not apply to TLS
+	Strict bool
+
+	// TLS terminates TLS when set, such as from TLSConfig
+	TLS *tls.Config
+
+	// Network listened on, "tcp" for both IPv4 and IPv6 when empty, "tcp4"
+	// or "tcp6"
+	Network string
+
+	// Bind listens on an address, net.Listen when nil, such as
+	// Upgrader.Listen taking over the listeners of a previous process
+	Bind func(network, addr string) (net.Listener, error)
+
+	// BindRetries retries listening on an address taken, waiting
+	// BindBackoff, 250ms when zero, doubled after each attempt
+	BindRetries int
+	BindBackoff time.Duration
+}
+
+// Server returns an http.Server serving router on addr with the options.
+func (o Options) Server(addr string, router http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           router,
+		ReadTimeout:       o.ReadTimeout,
+		ReadHeaderTimeout: o.ReadHeaderTimeout,
+		WriteTimeout:      o.WriteTimeout,
+		IdleTimeout:       o.IdleTimeout,
+		MaxHeaderBytes:    o.MaxHeaderBytes,
+	}
+	if o.Strict && o.TLS == nil {
+		srv.Handler = StrictHandler(router)
+		srv.ConnContext = StrictConnContext
+	}
+	return srv
+}
+
+// ListenAndServe listens on the address of srv, terminating TLS when set
+// or validating the framing of the requests in strict mode.
+func (o Options) ListenAndServe(srv *http.Server) error {
+	l, err := o.Listen(srv.Addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(l)
+}
+
+// Listen listens on addr, terminating TLS when set or validating the
+// framing of the requests in strict mode, for the listener to be served by
+// an http.Server from Server.
+func (o Options) Listen(addr string) (net.Listener, error) {
+	return o.ListenContext(context.Background(), addr)
+}
+
+// ListenContext is Listen, the retries of BindRetries ending with ctx. It
+// fails with a *BindError.
+func (o Options) ListenContext(ctx context.Context, addr string) (net.Listener, error) {
+	if addr == "" {
+		addr = ":http"
+	}
+	l, err := o.bind(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if o.TLS != nil {
+		return tls.NewListener(l, o.TLS), nil
+	}
+	if o.Strict {
+		return StrictListener(l), nil
+	}
+	return l, nil
+}
+
 func GetListener(mode string) ListenAndServeFunc {
+	return NewListener(mode, Options{})
+}
+
+// NewListener returns the listener of the mode, the http.Server of the
+// http and https modes being configured with opts.
+func NewListener(mode string, opts Options) ListenAndServeFunc {
 	switch mode {
 	case AwsGatewayLambda:
 		return gateway.ListenAndServeV1
 	case AwsGatewayV2Lambda:
 		return gateway.ListenAndServeV2
+	case AwsALBLambda:
+		return ListenAndServeALB
+	case AwsFunctionURL:
+		return ListenAndServeFunctionURL
+	case AwsLambda:
+		return ListenAndServeLambda
 	default:
-		return http.ListenAndServe
+		return func(addr string, router http.Handler) error {
+			return opts.ListenAndServe(opts.Server(addr, router))
+		}
 	}
 }
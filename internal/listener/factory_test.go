@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/go-obvious/gateway"
 	"github.com/stretchr/testify/assert"
@@ -33,3 +34,36 @@ func TestGetListener(t *testing.T) {
 func funcType(f interface{}) string {
 	return fmt.Sprintf("%T", f)
 }
+
+func TestOptionsServer(t *testing.T) {
+	opts := listener.Options{
+		ReadTimeout:       time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+		WriteTimeout:      3 * time.Second,
+		IdleTimeout:       4 * time.Second,
+		MaxHeaderBytes:    1024,
+	}
+	handler := http.NotFoundHandler()
+
+	srv := opts.Server(":8080", handler)
+	assert.Equal(t, ":8080", srv.Addr)
+	assert.Equal(t, time.Second, srv.ReadTimeout)
+	assert.Equal(t, 2*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 3*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 4*time.Second, srv.IdleTimeout)
+	assert.Equal(t, 1024, srv.MaxHeaderBytes)
+}
+
+func TestGCPModes(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	for _, mode := range []string{listener.GcpCloudRun, listener.GcpCloudFunctions} {
+		assert.True(t, listener.IsHTTP(mode), mode)
+		assert.True(t, listener.IsGCP(mode), mode)
+		assert.Equal(t, uint(9090), listener.Port(mode, 8080), "the port of the platform is used")
+	}
+	assert.False(t, listener.IsHTTP(listener.AwsGatewayV2Lambda))
+	assert.Equal(t, uint(8080), listener.Port(listener.Http, 8080))
+
+	t.Setenv("PORT", "")
+	assert.Equal(t, uint(8080), listener.Port(listener.GcpCloudRun, 8080))
+}
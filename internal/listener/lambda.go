@@ -0,0 +1,226 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// ListenAndServeALB serves router to the events of an ALB target group.
+func ListenAndServeALB(_ string, router http.Handler) error {
+	lambda.Start(ALBHandler(router))
+	return nil
+}
+
+// ListenAndServeFunctionURL serves router to the events of a Lambda
+// Function URL.
+func ListenAndServeFunctionURL(_ string, router http.Handler) error {
+	lambda.Start(FunctionURLHandler(router))
+	return nil
+}
+
+// ListenAndServeLambda serves router to the events of an ALB target group,
+// a Function URL or an API Gateway HTTP API, detected from each event.
+func ListenAndServeLambda(_ string, router http.Handler) error {
+	lambda.Start(LambdaHandler(router))
+	return nil
+}
+
+// ALBHandler adapts router to the events of an ALB target group, replying
+// with multi-value headers when the target group sends them.
+func ALBHandler(router http.Handler) func(context.Context, events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+	return func(ctx context.Context, e events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		header := http.Header{}
+		for name, values := range e.MultiValueHeaders {
+			header[http.CanonicalHeaderKey(name)] = values
+		}
+		for name, value := range e.Headers {
+			header.Set(name, value)
+		}
+		// The ALB leaves the query parameters encoded as received
+		query := make([]string, 0, len(e.QueryStringParameters))
+		for name, values := range e.MultiValueQueryStringParameters {
+			for _, value := range values {
+				query = append(query, name+"="+value)
+			}
+		}
+		for name, value := range e.QueryStringParameters {
+			query = append(query, name+"="+value)
+		}
+		sort.Strings(query)
+
+		r, err := newRequest(ctx, e.HTTPMethod, e.Path, strings.Join(query, "&"), header, e.Body, e.IsBase64Encoded)
+		if err != nil {
+			return events.ALBTargetGroupResponse{}, err
+		}
+		if forwarded := header.Get("X-Forwarded-For"); forwarded != "" {
+			client, _, _ := strings.Cut(forwarded, ",")
+			r.RemoteAddr = net.JoinHostPort(strings.TrimSpace(client), "0")
+		}
+		rw := serve(router, r)
+
+		resp := events.ALBTargetGroupResponse{
+			StatusCode:        rw.status,
+			StatusDescription: fmt.Sprintf("%d %s", rw.status, http.StatusText(rw.status)),
+		}
+		resp.Body, resp.IsBase64Encoded = rw.encode()
+		if len(e.MultiValueHeaders) > 0 {
+			resp.MultiValueHeaders = rw.header
+		} else {
+			resp.Headers = singleValued(rw.header)
+		}
+		return resp, nil
+	}
+}
+
+// FunctionURLHandler adapts router to the events of a Lambda Function URL,
+// the payload format 2.0 of the API Gateway HTTP APIs too.
+func FunctionURLHandler(router http.Handler) func(context.Context, events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	return func(ctx context.Context, e events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+		header := http.Header{}
+		for name, value := range e.Headers {
+			// Repeated headers are joined with commas
+			header.Set(name, value)
+		}
+		if len(e.Cookies) > 0 {
+			header.Set("Cookie", strings.Join(e.Cookies, "; "))
+		}
+		path := e.RawPath
+		if path == "" {
+			path = e.RequestContext.HTTP.Path
+		}
+
+		r, err := newRequest(ctx, e.RequestContext.HTTP.Method, path, e.RawQueryString, header, e.Body, e.IsBase64Encoded)
+		if err != nil {
+			return events.LambdaFunctionURLResponse{}, err
+		}
+		if ip := e.RequestContext.HTTP.SourceIP; ip != "" {
+			r.RemoteAddr = net.JoinHostPort(ip, "0")
+		}
+		if r.Host == "" {
+			r.Host = e.RequestContext.DomainName
+		}
+		rw := serve(router, r)
+
+		resp := events.LambdaFunctionURLResponse{StatusCode: rw.status, Cookies: rw.header.Values("Set-Cookie")}
+		rw.header.Del("Set-Cookie")
+		resp.Headers = singleValued(rw.header)
+		resp.Body, resp.IsBase64Encoded = rw.encode()
+		return resp, nil
+	}
+}
+
+var errUnknownEvent = errors.New("unsupported Lambda event, select its SERVER_MODE")
+
+// LambdaHandler adapts router to the events of an ALB target group, those
+// with a requestContext.elb, and to the events of the payload format 2.0,
+// Function URLs and API Gateway HTTP APIs. Other events fail.
+func LambdaHandler(router http.Handler) func(context.Context, json.RawMessage) (interface{}, error) {
+	alb, functionURL := ALBHandler(router), FunctionURLHandler(router)
+	return func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var probe struct {
+			Version        string `json:"version"`
+			RequestContext struct {
+				ELB *json.RawMessage `json:"elb"`
+			} `json:"requestContext"`
+		}
+		if err := json.Unmarshal(payload, &probe); err != nil {
+			return nil, err
+		}
+		switch {
+		case probe.RequestContext.ELB != nil:
+			var e events.ALBTargetGroupRequest
+			if err := json.Unmarshal(payload, &e); err != nil {
+				return nil, err
+			}
+			return alb(ctx, e)
+		case probe.Version == "2.0":
+			var e events.LambdaFunctionURLRequest
+			if err := json.Unmarshal(payload, &e); err != nil {
+				return nil, err
+			}
+			return functionURL(ctx, e)
+		}
+		return nil, errUnknownEvent
+	}
+}
+
+func newRequest(ctx context.Context, method, path, query string, header http.Header, body string, base64Encoded bool) (*http.Request, error) {
+	data := []byte(body)
+	if base64Encoded {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(body); err != nil {
+			return nil, err
+		}
+	}
+	u := &url.URL{Path: path, RawQuery: query}
+	if unescaped, err := url.PathUnescape(path); err == nil && unescaped != path {
+		u.Path, u.RawPath = unescaped, path
+	}
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	r.Header = header
+	r.Host = header.Get("Host")
+	r.RequestURI = u.RequestURI()
+	return r, nil
+}
+
+// eventWriter records the response replied to an event.
+type eventWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func serve(router http.Handler, r *http.Request) *eventWriter {
+	rw := &eventWriter{header: http.Header{}, status: http.StatusOK}
+	router.ServeHTTP(rw, r)
+	return rw
+}
+
+func (w *eventWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *eventWriter) WriteHeader(code int) {
+	if w.wroteHeader || code < 200 {
+		return
+	}
+	w.status, w.wroteHeader = code, true
+}
+
+func (w *eventWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// encode returns the body, base64 encoded unless valid UTF-8.
+func (w *eventWriter) encode() (string, bool) {
+	if utf8.Valid(w.body.Bytes()) {
+		return w.body.String(), false
+	}
+	return base64.StdEncoding.EncodeToString(w.body.Bytes()), true
+}
+
+func singleValued(header http.Header) map[string]string {
+	single := make(map[string]string, len(header))
+	for name, values := range header {
+		single[name] = strings.Join(values, ", ")
+	}
+	return single
+}
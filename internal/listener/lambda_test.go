@@ -0,0 +1,123 @@
+package listener_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/listener"
+)
+
+// echo replies the request as seen by the handlers.
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Add("X-Tag", "a")
+	w.Header().Add("X-Tag", "b")
+	http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+	http.SetCookie(w, &http.Cookie{Name: "theme", Value: "dark"})
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"method": r.Method,
+		"uri":    r.RequestURI,
+		"query":  r.URL.Query().Get("q"),
+		"host":   r.Host,
+		"remote": r.RemoteAddr,
+		"cookie": r.Header.Get("Cookie"),
+		"body":   string(body),
+	})
+})
+
+func decode(t *testing.T, body string) map[string]string {
+	var got map[string]string
+	require.NoError(t, json.Unmarshal([]byte(body), &got))
+	return got
+}
+
+func TestALBHandler(t *testing.T) {
+	handler := listener.ALBHandler(echo)
+	resp, err := handler(context.Background(), events.ALBTargetGroupRequest{
+		HTTPMethod:            http.MethodPost,
+		Path:                  "/orders",
+		QueryStringParameters: map[string]string{"q": "a%20b"},
+		Headers:               map[string]string{"host": "api.example.com", "x-forwarded-for": "203.0.113.7, 10.0.0.1"},
+		Body:                  base64.StdEncoding.EncodeToString([]byte("payload")),
+		IsBase64Encoded:       true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "201 Created", resp.StatusDescription)
+	assert.Equal(t, "a, b", resp.Headers["X-Tag"])
+	assert.Nil(t, resp.MultiValueHeaders)
+	assert.Equal(t, map[string]string{
+		"method": "POST", "uri": "/orders?q=a%20b", "query": "a b", "host": "api.example.com",
+		"remote": "203.0.113.7:0", "cookie": "", "body": "payload",
+	}, decode(t, resp.Body))
+
+	resp, err = handler(context.Background(), events.ALBTargetGroupRequest{
+		HTTPMethod:                      http.MethodGet,
+		Path:                            "/orders",
+		MultiValueQueryStringParameters: map[string][]string{"q": {"x"}},
+		MultiValueHeaders:               map[string][]string{"host": {"api.example.com"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, resp.MultiValueHeaders["X-Tag"], "multi-value headers in, multi-value headers out")
+	assert.Equal(t, "x", decode(t, resp.Body)["query"])
+}
+
+func TestFunctionURLHandler(t *testing.T) {
+	handler := listener.FunctionURLHandler(echo)
+	e := events.LambdaFunctionURLRequest{
+		Version:        "2.0",
+		RawPath:        "/orders/a%2Fb",
+		RawQueryString: "q=1",
+		Cookies:        []string{"session=1", "theme=dark"},
+		Headers:        map[string]string{"content-type": "text/plain"},
+		Body:           "payload",
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			DomainName: "abc.lambda-url.us-east-1.on.aws",
+			HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: http.MethodPut, SourceIP: "203.0.113.7"},
+		},
+	}
+	resp, err := handler(context.Background(), e)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []string{"session=1", "theme=dark"}, resp.Cookies)
+	assert.NotContains(t, resp.Headers, "Set-Cookie")
+	assert.False(t, resp.IsBase64Encoded)
+	assert.Equal(t, map[string]string{
+		"method": "PUT", "uri": "/orders/a%2Fb?q=1", "query": "1", "host": "abc.lambda-url.us-east-1.on.aws",
+		"remote": "203.0.113.7:0", "cookie": "session=1; theme=dark", "body": "payload",
+	}, decode(t, resp.Body))
+
+	binary := listener.FunctionURLHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte{0xff, 0x00})
+	}))
+	resp, err = binary(context.Background(), e)
+	require.NoError(t, err)
+	assert.True(t, resp.IsBase64Encoded)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte{0xff, 0x00}), resp.Body)
+}
+
+func TestLambdaHandler(t *testing.T) {
+	handler := listener.LambdaHandler(echo)
+
+	resp, err := handler(context.Background(), json.RawMessage(`{"httpMethod": "GET", "path": "/alb", "requestContext": {"elb": {"targetGroupArn": "arn"}}}`))
+	require.NoError(t, err)
+	require.IsType(t, events.ALBTargetGroupResponse{}, resp)
+	assert.Equal(t, "/alb", decode(t, resp.(events.ALBTargetGroupResponse).Body)["uri"])
+
+	resp, err = handler(context.Background(), json.RawMessage(`{"version": "2.0", "rawPath": "/url", "requestContext": {"http": {"method": "GET"}}}`))
+	require.NoError(t, err)
+	require.IsType(t, events.LambdaFunctionURLResponse{}, resp)
+	assert.Equal(t, "/url", decode(t, resp.(events.LambdaFunctionURLResponse).Body)["uri"])
+
+	_, err = handler(context.Background(), json.RawMessage(`{"httpMethod": "GET", "path": "/rest", "requestContext": {"resourceId": "abc"}}`))
+	assert.Error(t, err, "API Gateway REST APIs are served by the aws-gateway-v1 mode")
+}
@@ -0,0 +1,382 @@
+package listener
+
+// Strict HTTP/1 framing validation, rejecting the ambiguous requests used
+// to smuggle a request past a proxy disagreeing on where a body ends
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-obvious/server/request"
+)
+
+var (
+	ErrAmbiguousLength  = errors.New("both Transfer-Encoding and Content-Length are set")
+	ErrTransferEncoding = errors.New("unsupported Transfer-Encoding")
+	ErrObsoleteFolding  = errors.New("obsolete header line folding")
+	ErrMalformedChunk   = errors.New("malformed chunk")
+	ErrChunkExtension   = errors.New("abnormal chunk extension")
+)
+
+const (
+	maxHeadBytes      = 1 << 20
+	maxChunkLine      = 4096
+	maxChunkExtension = 256
+)
+
+type connKeyType int
+
+const connKey connKeyType = 0
+
+// StrictListener validates the framing of the requests read from the
+// connections of l. The server must serve StrictHandler and set
+// StrictConnContext as its ConnContext for the violations to be answered.
+func StrictListener(l net.Listener) net.Listener {
+	return &strictListener{Listener: l}
+}
+
+// StrictConnContext makes the connection available to StrictHandler.
+func StrictConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey, c)
+}
+
+// StrictHandler replies 400 Bad Request to the requests whose framing was
+// rejected, closing the connection as its framing can no longer be trusted.
+func StrictHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := r.Context().Value(connKey).(*strictConn)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		f := c.next()
+		if f == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := f.error(); err != nil {
+			w.Header().Set("Connection", "close")
+			request.ReplyErr(w, r, request.NewHTTPError(err, http.StatusBadRequest))
+			return
+		}
+		// The body is validated as the handler reads it
+		r.Body = &strictBody{ReadCloser: r.Body, frame: f}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type strictListener struct {
+	net.Listener
+}
+
+func (l *strictListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &strictConn{Conn: c}, nil
+}
+
+// frame holds the verdict on the framing of a request.
+type frame struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *frame) error() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *frame) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+type strictBody struct {
+	io.ReadCloser
+	frame *frame
+}
+
+func (b *strictBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if ferr := b.frame.error(); ferr != nil {
+		return n, request.NewHTTPError(ferr, http.StatusBadRequest)
+	}
+	return n, err
+}
+
+type parserState int
+
+const (
+	stateHead parserState = iota
+	stateBody
+	stateChunkLine
+	stateChunkData
+	stateChunkEnd
+	stateTrailer
+	statePassthrough
+)
+
+// strictConn parses the HTTP/1 framing of the bytes read by the server,
+// queueing a frame per request head. The server handles the requests of a
+// connection one at a time, in order, so StrictHandler pops the frames in
+// the order they were queued.
+type strictConn struct {
+	net.Conn
+
+	mu        sync.Mutex
+	state     parserState
+	line      []byte
+	remaining int64
+	frames    []*frame
+	current   *frame
+}
+
+func (c *strictConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mu.Lock()
+		c.feed(b[:n])
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *strictConn) next() *frame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.frames) == 0 {
+		return nil
+	}
+	f := c.frames[0]
+	c.frames = c.frames[1:]
+	return f
+}
+
+// fail records the violation on the current request and stops parsing, the
+// framing of what follows being ambiguous.
+func (c *strictConn) fail(err error) {
+	c.current.fail(err)
+	c.state = statePassthrough
+}
+
+func (c *strictConn) feed(data []byte) {
+	for len(data) > 0 {
+		switch c.state {
+		case statePassthrough:
+			return
+
+		case stateHead:
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				c.line = append(c.line, data...)
+				data = nil
+				if len(c.line) > maxHeadBytes {
+					c.state = statePassthrough
+				}
+				continue
+			}
+			c.line = append(c.line, data[:i+1]...)
+			data = data[i+1:]
+			if bytes.HasSuffix(c.line, []byte("\n\r\n")) || bytes.HasSuffix(c.line, []byte("\n\n")) {
+				c.head(c.line)
+				c.line = c.line[:0]
+			} else if len(bytes.TrimLeft(c.line, "\r\n")) == 0 {
+				// Empty lines preceding a request are ignored
+				c.line = c.line[:0]
+			} else if len(c.line) > maxHeadBytes {
+				c.state = statePassthrough
+			}
+
+		case stateBody:
+			n := int64(len(data))
+			if n > c.remaining {
+				n = c.remaining
+			}
+			c.remaining -= n
+			data = data[n:]
+			if c.remaining == 0 {
+				c.state = stateHead
+			}
+
+		case stateChunkLine, stateTrailer:
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				c.line = append(c.line, data...)
+				data = nil
+				if len(c.line) > maxChunkLine {
+					c.fail(ErrMalformedChunk)
+				}
+				continue
+			}
+			c.line = append(c.line, data[:i+1]...)
+			data = data[i+1:]
+			line := c.line
+			c.line = nil
+			if !bytes.HasSuffix(line, []byte("\r\n")) {
+				c.fail(ErrMalformedChunk)
+				continue
+			}
+			line = line[:len(line)-2]
+			if c.state == stateTrailer {
+				if len(line) == 0 {
+					c.state = stateHead
+				}
+				continue
+			}
+			c.chunkLine(string(line))
+
+		case stateChunkData:
+			n := int64(len(data))
+			if n > c.remaining {
+				n = c.remaining
+			}
+			c.remaining -= n
+			data = data[n:]
+			if c.remaining == 0 {
+				c.state = stateChunkEnd
+				c.line = nil
+			}
+
+		case stateChunkEnd:
+			c.line = append(c.line, data[0])
+			data = data[1:]
+			if len(c.line) == 2 {
+				if string(c.line) != "\r\n" {
+					c.fail(ErrMalformedChunk)
+					continue
+				}
+				c.line = nil
+				c.state = stateChunkLine
+			}
+		}
+	}
+}
+
+// head parses a request head, queueing its frame and setting up the
+// parsing of its body.
+func (c *strictConn) head(head []byte) {
+	lines := strings.Split(strings.TrimLeft(string(head), "\r\n"), "\n")
+	if strings.HasPrefix(lines[0], "PRI * HTTP/2") {
+		c.state = statePassthrough
+		return
+	}
+
+	c.current = &frame{}
+	c.frames = append(c.frames, c.current)
+
+	var te, cl []string
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			c.fail(ErrObsoleteFolding)
+			return
+		}
+		name, value, _ := strings.Cut(line, ":")
+		switch strings.ToLower(name) {
+		case "transfer-encoding":
+			te = append(te, strings.TrimSpace(value))
+		case "content-length":
+			cl = append(cl, strings.TrimSpace(value))
+		}
+	}
+
+	switch {
+	case len(te) > 0 && len(cl) > 0:
+		c.fail(ErrAmbiguousLength)
+	case len(te) > 1 || len(te) == 1 && !strings.EqualFold(te[0], "chunked"):
+		c.fail(ErrTransferEncoding)
+	case len(cl) > 1:
+		c.fail(ErrAmbiguousLength)
+	case len(te) == 1:
+		c.state = stateChunkLine
+		c.line = nil
+	case len(cl) == 1:
+		n, err := strconv.ParseInt(cl[0], 10, 64)
+		if err != nil || n < 0 {
+			// Rejected by the server itself
+			c.state = statePassthrough
+			return
+		}
+		if n > 0 {
+			c.remaining = n
+			c.state = stateBody
+		}
+	}
+}
+
+// chunkLine parses a chunk size line, "size[;name[=value]]...".
+func (c *strictConn) chunkLine(line string) {
+	size, ext, _ := strings.Cut(line, ";")
+	n, err := strconv.ParseInt(size, 16, 64)
+	if err != nil || n < 0 || size == "" || len(size) > 16 {
+		c.fail(ErrMalformedChunk)
+		return
+	}
+	if ext != "" && !validChunkExtension(ext) {
+		c.fail(ErrChunkExtension)
+		return
+	}
+
+	if n == 0 {
+		c.state = stateTrailer
+		return
+	}
+	c.remaining = n
+	c.state = stateChunkData
+}
+
+// validChunkExtension checks the extensions of a chunk follow the RFC 9112
+// grammar and are of a reasonable length.
+func validChunkExtension(ext string) bool {
+	if len(ext) > maxChunkExtension {
+		return false
+	}
+	for _, e := range strings.Split(ext, ";") {
+		name, value, hasValue := strings.Cut(strings.Trim(e, " \t"), "=")
+		if !isToken(strings.TrimRight(name, " \t")) {
+			return false
+		}
+		if !hasValue {
+			continue
+		}
+		value = strings.TrimLeft(value, " \t")
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			for _, r := range value[1 : len(value)-1] {
+				if r < ' ' && r != '\t' || r == 0x7f || r == '"' {
+					return false
+				}
+			}
+		} else if !isToken(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r > 0x7e || r <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
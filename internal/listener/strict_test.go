@@ -0,0 +1,119 @@
+package listener_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/listener"
+)
+
+func TestStrict(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := listener.Options{Strict: true}.Server("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	go func() { _ = srv.Serve(listener.StrictListener(l)) }()
+	defer srv.Close()
+
+	send := func(raw string) (int, string) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+		_, err = conn.Write([]byte(raw))
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	tests := []struct {
+		name     string
+		raw      string
+		status   int
+		contains string
+	}{
+		{
+			name:     "Content-Length",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello",
+			status:   http.StatusOK,
+			contains: "hello",
+		},
+		{
+			name:     "Chunked",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n5;name=\"v\"\r\nhello\r\n0\r\n\r\n",
+			status:   http.StatusOK,
+			contains: "hello",
+		},
+		{
+			name:     "Transfer-Encoding and Content-Length",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			status:   http.StatusBadRequest,
+			contains: listener.ErrAmbiguousLength.Error(),
+		},
+		{
+			name:     "Folded header",
+			raw:      "GET / HTTP/1.1\r\nHost: x\r\nX-Note: a\r\n b\r\n\r\n",
+			status:   http.StatusBadRequest,
+			contains: listener.ErrObsoleteFolding.Error(),
+		},
+		{
+			name:     "Abnormal chunk extension",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n5;" + strings.Repeat("a", 300) + "\r\nhello\r\n0\r\n\r\n",
+			status:   http.StatusBadRequest,
+			contains: listener.ErrChunkExtension.Error(),
+		},
+		{
+			name:     "Bare LF chunk line",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n5\nhello\r\n0\r\n\r\n",
+			status:   http.StatusBadRequest,
+			contains: listener.ErrMalformedChunk.Error(),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := send(tc.raw)
+			assert.Equal(t, tc.status, status)
+			assert.Contains(t, body, tc.contains)
+		})
+	}
+
+	t.Run("Keep-alive", func(t *testing.T) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+		_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n3\r\none\r\n0\r\n\r\n" +
+			"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 3\r\n\r\ntwo" +
+			"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"))
+		require.NoError(t, err)
+
+		r := bufio.NewReader(conn)
+		for _, expected := range []int{http.StatusOK, http.StatusOK, http.StatusBadRequest} {
+			resp, err := http.ReadResponse(r, nil)
+			require.NoError(t, err)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, expected, resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package listener
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// Client authentications by name
+var clientAuths = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require-any":        tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+// TLSConfig returns the configuration serving cert, asking for the client
+// certificates as clientAuth names, "none", "request", "require-any",
+// "verify-if-given" or "require-and-verify", verified against clientCAs.
+// An empty clientAuth requires and verifies them when clientCAs is set.
+func TLSConfig(cert tls.Certificate, clientCAs *x509.CertPool, clientAuth string) (*tls.Config, error) {
+	auth, ok := clientAuths[clientAuth]
+	switch {
+	case clientAuth == "" && clientCAs != nil:
+		auth = tls.RequireAndVerifyClientCert
+	case clientAuth != "" && !ok:
+		return nil, fmt.Errorf("unknown TLS client authentication %q, expecting none, request, require-any, verify-if-given or require-and-verify", clientAuth)
+	}
+	if clientCAs == nil && (auth == tls.VerifyClientCertIfGiven || auth == tls.RequireAndVerifyClientCert) {
+		return nil, fmt.Errorf("TLS client authentication %q requires a client CA", clientAuth)
+	}
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   auth,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
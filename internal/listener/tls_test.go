@@ -0,0 +1,88 @@
+package listener_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/listener"
+)
+
+// selfSigned returns a certificate of 127.0.0.1 signed by its own key.
+func selfSigned(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	cfg, err := listener.TLSConfig(selfSigned(t), nil, "")
+	require.NoError(t, err)
+	serve := listener.NewListener(listener.Https, listener.Options{TLS: cfg})
+	go func() { _ = serve(addr, http.NotFoundHandler()) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = client.Get("https://" + addr + "/")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	resp.Body.Close()
+	require.NotNil(t, resp.TLS)
+	assert.GreaterOrEqual(t, resp.TLS.Version, uint16(tls.VersionTLS12))
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+}
+
+func TestTLSConfig(t *testing.T) {
+	pool := x509.NewCertPool()
+	for _, tt := range []struct {
+		clientAuth string
+		clientCAs  *x509.CertPool
+		expected   tls.ClientAuthType
+	}{
+		{clientAuth: "", expected: tls.NoClientCert},
+		{clientAuth: "", clientCAs: pool, expected: tls.RequireAndVerifyClientCert},
+		{clientAuth: "none", clientCAs: pool, expected: tls.NoClientCert},
+		{clientAuth: "request", expected: tls.RequestClientCert},
+		{clientAuth: "require-any", expected: tls.RequireAnyClientCert},
+		{clientAuth: "verify-if-given", clientCAs: pool, expected: tls.VerifyClientCertIfGiven},
+	} {
+		cfg, err := listener.TLSConfig(tls.Certificate{}, tt.clientCAs, tt.clientAuth)
+		require.NoError(t, err, tt.clientAuth)
+		assert.Equal(t, tt.expected, cfg.ClientAuth, tt.clientAuth)
+		assert.Equal(t, []string{"h2", "http/1.1"}, cfg.NextProtos)
+	}
+
+	_, err := listener.TLSConfig(tls.Certificate{}, nil, "require-and-verify")
+	assert.ErrorContains(t, err, "requires a client CA")
+	_, err = listener.TLSConfig(tls.Certificate{}, pool, "always")
+	assert.ErrorContains(t, err, `unknown TLS client authentication "always"`)
+}
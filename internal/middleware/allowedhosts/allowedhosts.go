@@ -0,0 +1,59 @@
+package allowedhosts
+
+// Rejects requests for hosts the server does not serve, defending against
+// DNS rebinding and host header injection
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-obvious/server/request"
+)
+
+var ErrHostNotAllowed = errors.New("host not allowed")
+
+// Allowed reports whether host, with or without a port, matches one of the
+// allowed hosts. A "*.example.com" entry matches the subdomains of
+// example.com, and the loopback hosts are always allowed for local probes.
+func Allowed(host string, allowed []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware replies 400 Bad Request to requests whose host is not allowed,
+// the host forwarded by a trusted proxy taking the place of its own.
+func Middleware(allowed []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin, err := url.Parse(request.Origin(r))
+			if err != nil || !Allowed(origin.Host, allowed) {
+				request.ReplyErr(w, r, request.NewHTTPError(ErrHostNotAllowed, http.StatusBadRequest))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
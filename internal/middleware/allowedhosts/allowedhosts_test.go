@@ -0,0 +1,53 @@
+package allowedhosts_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/internal/middleware/allowedhosts"
+)
+
+func TestAllowed(t *testing.T) {
+	allowed := []string{"api.example.com", "*.example.org"}
+	tests := map[string]bool{
+		"api.example.com":      true,
+		"API.example.com:8443": true,
+		"eu.example.org":       true,
+		"example.org":          false,
+		"evil.example.com":     false,
+		"rebind.attacker.net":  false,
+		"localhost:8080":       true,
+		"127.0.0.1:8080":       true,
+		"[::1]:8080":           true,
+	}
+	for host, expected := range tests {
+		assert.Equal(t, expected, allowedhosts.Allowed(host, allowed), host)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := allowedhosts.Middleware([]string{"api.example.com"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(host, forwardedHost, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		req.RemoteAddr = remoteAddr
+		if forwardedHost != "" {
+			req.Header.Set("X-Forwarded-Host", forwardedHost)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve("api.example.com", "", "203.0.113.9:41000"))
+	assert.Equal(t, http.StatusBadRequest, serve("rebind.attacker.net", "", "203.0.113.9:41000"))
+	assert.Equal(t, http.StatusNoContent, serve("api.example.com", "evil.example.net", "203.0.113.9:41000"), "untrusted forwarded hosts are ignored")
+	assert.Equal(t, http.StatusBadRequest, serve("api.example.com", "evil.example.net", "127.0.0.1:41000"))
+	assert.Equal(t, http.StatusNoContent, serve("app.internal:8080", "api.example.com", "127.0.0.1:41000"))
+}
@@ -0,0 +1,208 @@
+package bodycapture
+
+// Debug aid capturing the beginning of the request and response bodies,
+// redacted, to diagnose the malformed requests of a client
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/internal/middleware/logger"
+	"github.com/go-obvious/server/redact"
+	"github.com/go-obvious/server/request"
+)
+
+// Capture is a request and its response as captured.
+type Capture struct {
+	Time              time.Time   `json:"time"`
+	RequestID         string      `json:"request_id,omitempty"`
+	Method            string      `json:"method"`
+	URL               string      `json:"url"`
+	Status            int         `json:"status"`
+	RequestHeader     http.Header `json:"request_headers"`
+	RequestBody       string      `json:"request_body,omitempty"`
+	RequestTruncated  bool        `json:"request_truncated,omitempty"`
+	ResponseHeader    http.Header `json:"response_headers"`
+	ResponseBody      string      `json:"response_body,omitempty"`
+	ResponseTruncated bool        `json:"response_truncated,omitempty"`
+}
+
+// Config of the middleware. Size bytes of each body are captured, the
+// headers and the fields of the JSON and form bodies matching the redaction
+// patterns, or the Redact ones, being redacted. The captures are logged
+// without a Ring, and only those of the 4xx and 5xx responses with
+// ErrorsOnly.
+type Config struct {
+	Size       int
+	Redact     []string
+	ErrorsOnly bool
+	Ring       *Ring
+}
+
+// limited keeps the first size bytes written to it.
+type limited struct {
+	bytes.Buffer
+	size      int
+	truncated bool
+}
+
+func (l *limited) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := l.size - l.Len(); n > room {
+		l.truncated = true
+		p = p[:max(room, 0)]
+	}
+	l.Buffer.Write(p)
+	return n, nil
+}
+
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// Middleware captures the requests, the quiet ones excepted. It must be
+// installed after the request IDs and the logger, and within the
+// compression.
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			reqBody := &limited{size: cfg.Size}
+			body := r.Body
+			if body != nil && body != http.NoBody {
+				r.Body = teeBody{Reader: io.TeeReader(body, reqBody), Closer: body}
+			}
+			respBody := &limited{size: cfg.Size}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(respBody)
+			start := time.Now().UTC()
+			next.ServeHTTP(ww, r)
+			if body != nil && body != http.NoBody && !reqBody.truncated {
+				// The part the handler did not read, such as when rejecting
+				// the request early
+				_, _ = io.CopyN(reqBody, body, int64(cfg.Size-reqBody.Len()+1))
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			// Routes may be quieted once routed
+			if logger.IsQuiet(r.Context()) || cfg.ErrorsOnly && status < 400 {
+				return
+			}
+			secrets := redact.RequestSecrets(r)
+			c := Capture{
+				Time:              start,
+				RequestID:         request.GetRequestID(r.Context()),
+				Method:            r.Method,
+				URL:               redact.URL(r.URL),
+				Status:            status,
+				RequestHeader:     cfg.header(r.Header),
+				RequestBody:       cfg.body(r.Header.Get("Content-Type"), reqBody, secrets),
+				RequestTruncated:  reqBody.truncated,
+				ResponseHeader:    cfg.header(ww.Header()),
+				ResponseBody:      cfg.body(ww.Header().Get("Content-Type"), respBody, secrets),
+				ResponseTruncated: respBody.truncated,
+			}
+			if cfg.Ring != nil {
+				cfg.Ring.Add(c)
+				return
+			}
+			entry := logger.GetContext(r.Context())
+			if entry == nil {
+				entry = logrus.NewEntry(logrus.StandardLogger())
+			}
+			entry.WithFields(logrus.Fields{
+				"status":             c.Status,
+				"request_headers":    c.RequestHeader,
+				"request_body":       c.RequestBody,
+				"request_truncated":  c.RequestTruncated,
+				"response_headers":   c.ResponseHeader,
+				"response_body":      c.ResponseBody,
+				"response_truncated": c.ResponseTruncated,
+			}).Info("captured request")
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func (cfg Config) header(h http.Header) http.Header {
+	out := redact.Header(h)
+	for name := range out {
+		if redact.Sensitive(name, cfg.Redact...) {
+			out[name] = []string{redact.Placeholder}
+		}
+	}
+	return out
+}
+
+// body returns the captured body redacted, or a placeholder when it is not
+// text.
+func (cfg Config) body(contentType string, b *limited, secrets []string) string {
+	if b.Len() == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return redact.String(redact.JSON(b.String(), cfg.Redact...), secrets...)
+	case mediaType == "application/x-www-form-urlencoded":
+		return redact.String(redact.Query(b.String(), cfg.Redact...), secrets...)
+	case mediaType == "" || strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "xml"):
+		return redact.String(b.String(), secrets...)
+	}
+	return "[" + mediaType + "]"
+}
+
+// Ring keeps the last captures.
+type Ring struct {
+	mu       sync.Mutex
+	captures []Capture
+	next     int
+	full     bool
+}
+
+// NewRing returns a Ring keeping size captures.
+func NewRing(size int) *Ring {
+	return &Ring{captures: make([]Capture, max(size, 1))}
+}
+
+// Add keeps c, dropping the oldest capture when full.
+func (x *Ring) Add(c Capture) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.captures[x.next] = c
+	x.next = (x.next + 1) % len(x.captures)
+	if x.next == 0 {
+		x.full = true
+	}
+}
+
+// Captures returns the captures kept, newest first.
+func (x *Ring) Captures() []Capture {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	n := x.next
+	if x.full {
+		n = len(x.captures)
+	}
+	out := make([]Capture, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, x.captures[(x.next-i+len(x.captures))%len(x.captures)])
+	}
+	return out
+}
+
+// Endpoint serves the captures of the ring as JSON, newest first.
+func (x *Ring) Endpoint(w http.ResponseWriter, r *http.Request) {
+	request.Reply(r, w, x.Captures(), http.StatusOK)
+}
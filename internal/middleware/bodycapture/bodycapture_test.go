@@ -0,0 +1,108 @@
+package bodycapture_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/middleware/bodycapture"
+	"github.com/go-obvious/server/internal/middleware/logger"
+)
+
+// echo answers 400 with the body of the request.
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Session-Hint", "s3cr3t")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write(body)
+})
+
+func newRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/orders?access_token=abc123", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer abc123")
+	r.Header.Set("X-Customer", "alice")
+	return r
+}
+
+func TestRing(t *testing.T) {
+	ring := bodycapture.NewRing(2)
+	handler := bodycapture.Middleware(bodycapture.Config{Size: 64, Redact: []string{"card*", "x-customer"}, Ring: ring})(echo)
+	for _, id := range []string{"1", "2", "3"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(`{"id": "`+id+`", "card_number": "4111111111111111", "password": "hunter22"}`))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "4111111111111111", "the response is unchanged")
+	}
+
+	captures := ring.Captures()
+	require.Len(t, captures, 2, "the oldest dropped")
+	c := captures[0]
+	assert.Equal(t, http.MethodPost, c.Method)
+	assert.Equal(t, "/orders?access_token=%5BREDACTED%5D", c.URL)
+	assert.Equal(t, http.StatusBadRequest, c.Status)
+	assert.Equal(t, "[REDACTED]", c.RequestHeader.Get("Authorization"))
+	assert.Equal(t, "[REDACTED]", c.RequestHeader.Get("X-Customer"))
+	assert.Equal(t, "[REDACTED]", c.ResponseHeader.Get("X-Session-Hint"))
+	assert.Equal(t, `{"id": "3", "card_number": "[REDACTED]", "password": "[REDACTED]"`, c.RequestBody)
+	assert.True(t, c.RequestTruncated)
+	assert.Equal(t, c.RequestBody, c.ResponseBody)
+	assert.Contains(t, captures[1].RequestBody, `"id": "2"`)
+
+	rr := httptest.NewRecorder()
+	ring.Endpoint(rr, httptest.NewRequest(http.MethodGet, "/captures", nil))
+	var served []bodycapture.Capture
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &served))
+	assert.Len(t, served, 2)
+}
+
+func TestLog(t *testing.T) {
+	hook := test.NewGlobal()
+	logrus.SetLevel(logrus.InfoLevel)
+	handler := logger.Middleware(bodycapture.Middleware(bodycapture.Config{Size: 1024, ErrorsOnly: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		echo(w, r)
+	})))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	for _, entry := range hook.AllEntries() {
+		assert.NotEqual(t, "captured request", entry.Message, "only the errors")
+	}
+
+	hook.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(`{"token": "abc123", "qty": -1}`))
+	var captured *logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "captured request" {
+			captured = entry
+		}
+	}
+	require.NotNil(t, captured)
+	assert.Equal(t, `{"token": "[REDACTED]", "qty": -1}`, captured.Data["request_body"])
+	assert.Equal(t, http.StatusBadRequest, captured.Data["status"])
+}
+
+func TestBinaryBody(t *testing.T) {
+	ring := bodycapture.NewRing(1)
+	handler := bodycapture.Middleware(bodycapture.Config{Size: 16, Ring: ring})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("\x89PNG\r\n"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/logo.png", nil))
+	c := ring.Captures()[0]
+	assert.Equal(t, http.StatusOK, c.Status)
+	assert.Empty(t, c.RequestBody)
+	assert.Equal(t, "[image/png]", c.ResponseBody)
+}
@@ -0,0 +1,52 @@
+package cloudtrace
+
+// Converts the trace context set by the Google Front End in front of Cloud
+// Run and Cloud Functions to the headers read by the requestid middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-obvious/server/internal/middleware/requestid"
+)
+
+// HeaderCloudTraceContext is "TRACE_ID/SPAN_ID;o=OPTIONS", the span ID
+// being decimal.
+const HeaderCloudTraceContext = "X-Cloud-Trace-Context"
+
+var cloudTraceContext = regexp.MustCompile(`^([0-9a-fA-F]{32})/([0-9]+)(?:;o=([01]))?$`)
+
+// Middleware sets the trace ID and W3C traceparent of the requests from
+// their X-Cloud-Trace-Context, unless they carry their own, so the logs
+// and outbound requests join the Cloud Trace of the request. It must be
+// installed before the requestid middleware.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := cloudTraceContext.FindStringSubmatch(r.Header.Get(HeaderCloudTraceContext))
+		if m == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		span, err := strconv.ParseUint(m[2], 10, 64)
+		if err != nil || span == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sampled := "00"
+		if m[3] == "1" {
+			sampled = "01"
+		}
+
+		r = r.Clone(r.Context())
+		if r.Header.Get(requestid.HeaderTraceID) == "" {
+			r.Header.Set(requestid.HeaderTraceID, m[1])
+		}
+		if r.Header.Get(requestid.HeaderTraceParent) == "" {
+			r.Header.Set(requestid.HeaderTraceParent, fmt.Sprintf("00-%s-%016x-%s", strings.ToLower(m[1]), span, sampled))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,59 @@
+package cloudtrace_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/internal/middleware/cloudtrace"
+	"github.com/go-obvious/server/internal/middleware/requestid"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		header      string
+		traceParent string
+		want        *requestid.Context // generated when nil
+	}{
+		"sampled": {
+			header: "4BF92F3577B34DA6A3CE929D0E0E4736/12345;o=1",
+			want:   &requestid.Context{TraceID: "4BF92F3577B34DA6A3CE929D0E0E4736", TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000003039-01"},
+		},
+		"not sampled": {
+			header: "4bf92f3577b34da6a3ce929d0e0e4736/12345",
+			want:   &requestid.Context{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000003039-00"},
+		},
+		"own traceparent": {
+			header:      "4bf92f3577b34da6a3ce929d0e0e4736/12345;o=1",
+			traceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			want:        &requestid.Context{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", TraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		},
+		"malformed": {
+			header: "not-a-trace/1",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got *requestid.Context
+			handler := cloudtrace.Middleware(requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = requestid.GetContext(r.Context())
+			})))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(cloudtrace.HeaderCloudTraceContext, tt.header)
+			if tt.traceParent != "" {
+				req.Header.Set(requestid.HeaderTraceParent, tt.traceParent)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.want == nil {
+				assert.Len(t, got.TraceID, 32)
+				assert.Contains(t, got.TraceParent, got.TraceID)
+				return
+			}
+			assert.Equal(t, tt.want.TraceID, got.TraceID)
+			assert.Equal(t, tt.want.TraceParent, got.TraceParent)
+		})
+	}
+}
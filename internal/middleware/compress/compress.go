@@ -0,0 +1,220 @@
+package compress
+
+// Gzip compression of the responses negotiated with Accept-Encoding,
+// sparing the payloads too small or already compressed to gain from it
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Config of the compression. Excluded content types may end with "/*",
+// such as "image/*", and excluded paths are prefixes.
+type Config struct {
+	MinSize              int // bytes below which responses are sent as is
+	ExcludedContentTypes []string
+	ExcludedPaths        []string
+}
+
+var writers = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+
+// Middleware gzips the responses of the requests accepting it, unless
+// smaller than MinSize, excluded, already encoded, partial, or upgraded.
+// The ETag of a compressed response is made weak, the bytes sent differing
+// from those it was computed on.
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) || r.Header.Get("Upgrade") != "" || r.Method == http.MethodHead || excludedPath(cfg, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &writer{ResponseWriter: w, cfg: cfg, status: http.StatusOK}
+			completed := false
+			defer func() {
+				// A panicking handler leaves the reply to the panic middleware
+				if completed {
+					cw.close()
+				} else {
+					cw.release()
+				}
+			}()
+			next.ServeHTTP(cw, r)
+			completed = true
+		})
+	}
+}
+
+// acceptsGzip reports whether Accept-Encoding lists gzip, or "*", with a
+// non-zero quality.
+func acceptsGzip(r *http.Request) bool {
+	for _, field := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(field), ";")
+		if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func excludedPath(cfg Config, path string) bool {
+	for _, prefix := range cfg.ExcludedPaths {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func excludedType(cfg Config, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType != ""
+	}
+	for _, excluded := range cfg.ExcludedContentTypes {
+		excluded = strings.ToLower(strings.TrimSpace(excluded))
+		if excluded == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(excluded, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writer holds the response back until MinSize bytes are written to decide
+// whether to compress it.
+type writer struct {
+	http.ResponseWriter
+	cfg         Config
+	status      int
+	wroteHeader bool // by the handler
+	decided     bool
+	buf         bytes.Buffer
+	gz          *gzip.Writer
+}
+
+func (w *writer) WriteHeader(code int) {
+	if w.wroteHeader || w.decided {
+		return
+	}
+	if code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status, w.wroteHeader = code, true
+	if !bodyAllowed(code) {
+		_ = w.decide(false)
+	}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.buf.Write(p)
+		if w.buf.Len() >= w.cfg.MinSize {
+			if err := w.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide sends the headers, compressing when enough bytes were written
+// and the response is eligible, then the bytes held back.
+func (w *writer) decide(enough bool) error {
+	w.decided = true
+	h := w.Header()
+	if enough && bodyAllowed(w.status) && !partial(w.status, h) && h.Get("Content-Encoding") == "" && !excludedType(w.cfg, h.Get("Content-Type")) {
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+		}
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = writers.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// Flush sends the bytes held back, uncompressed when fewer than MinSize,
+// for the streamed responses.
+func (w *writer) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		_ = w.decide(w.buf.Len() >= w.cfg.MinSize)
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *writer) close() {
+	if !w.decided && (w.wroteHeader || w.buf.Len() > 0) {
+		_ = w.decide(false)
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+	}
+	w.release()
+}
+
+// release returns the gzip writer to the pool.
+func (w *writer) release() {
+	if w.gz != nil {
+		w.gz.Reset(nil)
+		writers.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// partial reports whether the response is a range of the representation,
+// whose offsets would not match once compressed.
+func partial(status int, h http.Header) bool {
+	return status == http.StatusPartialContent || h.Get("Content-Range") != ""
+}
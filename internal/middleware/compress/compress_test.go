@@ -0,0 +1,135 @@
+package compress_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/middleware/compress"
+)
+
+func TestMiddleware(t *testing.T) {
+	large := strings.Repeat("compressible ", 100)
+	handler := compress.Middleware(compress.Config{
+		MinSize:              256,
+		ExcludedContentTypes: []string{"image/*", "application/zip"},
+		ExcludedPaths:        []string{"/raw/"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if ct := r.URL.Query().Get("type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		if r.URL.Query().Has("encoded") {
+			w.Header().Set("Content-Encoding", "br")
+		}
+		if r.URL.Query().Has("small") {
+			_, _ = w.Write([]byte("tiny"))
+			return
+		}
+		if r.URL.Query().Has("partial") {
+			w.Header().Set("Content-Range", "bytes 0-1299/5000")
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+		// Written in pieces, across the threshold
+		for _, piece := range strings.SplitAfter(large, " ") {
+			_, _ = w.Write([]byte(piece))
+		}
+	}))
+	get := func(target, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := get("/data?type=application/json", "br, gzip;q=0.8")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	require.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+	assert.Equal(t, `W/"v1"`, rr.Header().Get("ETag"), "weakened once encoded")
+	gz, err := gzip.NewReader(rr.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, large, string(body))
+
+	tests := []struct {
+		name, target, acceptEncoding string
+	}{
+		{name: "not accepted", target: "/data", acceptEncoding: ""},
+		{name: "refused", target: "/data", acceptEncoding: "gzip;q=0, br"},
+		{name: "below the minimum size", target: "/data?small", acceptEncoding: "gzip"},
+		{name: "excluded wildcard content type", target: "/data?type=image/png", acceptEncoding: "gzip"},
+		{name: "excluded content type", target: "/data?type=application/zip", acceptEncoding: "gzip"},
+		{name: "excluded path", target: "/raw/data", acceptEncoding: "gzip"},
+		{name: "already encoded", target: "/data?encoded", acceptEncoding: "gzip"},
+		{name: "partial content", target: "/data?partial", acceptEncoding: "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := get(tt.target, tt.acceptEncoding)
+			if tt.target == "/data?encoded" {
+				assert.Equal(t, "br", rr.Header().Get("Content-Encoding"))
+			} else {
+				assert.Empty(t, rr.Header().Get("Content-Encoding"))
+			}
+			assert.True(t, rr.Body.String() == large || rr.Body.String() == "tiny", "sent as is")
+			assert.Equal(t, `"v1"`, rr.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestMiddlewareFlush(t *testing.T) {
+	handler := compress.Middleware(compress.Config{MinSize: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("event"))
+		require.NoError(t, http.NewResponseController(w).Flush())
+		_, _ = w.Write([]byte(" more"))
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	assert.True(t, rr.Flushed)
+	assert.Empty(t, rr.Header().Get("Content-Encoding"), "flushed below the minimum size")
+	assert.Equal(t, "event more", rr.Body.String())
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	handler := compress.Middleware(compress.Config{MinSize: 4})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("panic") {
+			_, _ = w.Write([]byte("partial response"))
+			panic("handler failed")
+		}
+		_, _ = w.Write([]byte("complete response"))
+	}))
+	serve := func(target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	assert.PanicsWithValue(t, "handler failed", func() { serve("/?panic") })
+
+	rr := serve("/")
+	require.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	gz, err := gzip.NewReader(rr.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "complete response", string(body), "the pooled writer was reset")
+}
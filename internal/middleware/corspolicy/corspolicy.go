@@ -0,0 +1,171 @@
+package corspolicy
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-chi/cors"
+)
+
+type policy struct {
+	prefix string
+	cors   *cors.Cors
+}
+
+// Policies selects the CORS policy by the longest mount prefix matching the
+// request path, falling back to the default policy. The options of every
+// policy, the default one included, go through the adjustments given to New.
+type Policies struct {
+	mu       sync.RWMutex
+	adjust   []func(cors.Options) cors.Options
+	fallback *cors.Cors
+	policies []policy
+	version  atomic.Uint64 // of the policies, for the handlers to compose them again
+}
+
+// New returns the policies falling back to the fallback options, those of
+// every policy being adjusted in order by adjust, such as AllowLocalhost.
+func New(fallback cors.Options, adjust ...func(cors.Options) cors.Options) *Policies {
+	x := &Policies{adjust: adjust}
+	x.fallback = cors.New(x.adjusted(fallback))
+	return x
+}
+
+func (x *Policies) adjusted(opts cors.Options) cors.Options {
+	for _, adjust := range x.adjust {
+		opts = adjust(opts)
+	}
+	return opts
+}
+
+// Set registers the policy applied to requests under the given prefix.
+func (x *Policies) Set(prefix string, opts cors.Options) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	c := cors.New(x.adjusted(opts))
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	policies := make([]policy, 0, len(x.policies)+1)
+	for _, p := range x.policies {
+		if p.prefix != prefix {
+			policies = append(policies, p)
+		}
+	}
+	policies = append(policies, policy{prefix: prefix, cors: c})
+	sort.SliceStable(policies, func(i, j int) bool {
+		return len(policies[i].prefix) > len(policies[j].prefix)
+	})
+	x.policies = policies
+	x.version.Add(1)
+}
+
+// composed holds the handlers of the policies ahead of a next handler.
+type composed struct {
+	version  uint64
+	fallback http.Handler
+	prefixes []string // longest first
+	handlers []http.Handler
+}
+
+func (x *Policies) compose(next http.Handler) *composed {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	c := &composed{
+		version:  x.version.Load(),
+		fallback: x.fallback.Handler(next),
+		prefixes: make([]string, len(x.policies)),
+		handlers: make([]http.Handler, len(x.policies)),
+	}
+	for i, p := range x.policies {
+		c.prefixes[i], c.handlers[i] = p.prefix, p.cors.Handler(next)
+	}
+	return c
+}
+
+func (c *composed) lookup(path string) http.Handler {
+	for i, prefix := range c.prefixes {
+		if prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return c.handlers[i]
+		}
+	}
+	return c.fallback
+}
+
+// Middleware applies the policy of the request path. Preflights are
+// answered without reaching the next handlers, unless the policy sets
+// OptionsPassthrough, and counted in DefaultMetrics. The policies are
+// composed ahead of next once, and again once others are set.
+func (x *Policies) Middleware(next http.Handler) http.Handler {
+	var current atomic.Pointer[composed]
+	current.Store(x.compose(next))
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		c := current.Load()
+		if c.version != x.version.Load() {
+			c = x.compose(next)
+			current.Store(c)
+		}
+		c.lookup(r.URL.Path).ServeHTTP(w, r)
+		if isPreflight(r) {
+			DefaultMetrics.preflight(w.Header().Get("Access-Control-Allow-Origin") != "")
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// AllowLocalhost returns opts also allowing the http and https origins of
+// localhost, 127.0.0.1 and [::1] on any port, for the frontends served by
+// the development servers on random ports.
+func AllowLocalhost(opts cors.Options) cors.Options {
+	allowed := opts.AllowOriginFunc
+	if allowed == nil {
+		allowed = originList(opts.AllowedOrigins)
+	}
+	opts.AllowOriginFunc = func(r *http.Request, origin string) bool {
+		return isLocalhost(origin) || allowed(r, origin)
+	}
+	return opts
+}
+
+func isLocalhost(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Path != "" {
+		return false
+	}
+	switch strings.ToLower(u.Hostname()) {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// originList matches the origins as the cors package does, an empty list or
+// "*" allowing all of them and a "*" within an origin any part of it.
+func originList(origins []string) func(r *http.Request, origin string) bool {
+	if len(origins) == 0 {
+		return func(*http.Request, string) bool { return true }
+	}
+	return func(r *http.Request, origin string) bool {
+		origin = strings.ToLower(origin)
+		for _, o := range origins {
+			o = strings.ToLower(o)
+			if o == "*" || o == origin {
+				return true
+			}
+			if start, end, ok := strings.Cut(o, "*"); ok && len(origin) >= len(start)+len(end) &&
+				strings.HasPrefix(origin, start) && strings.HasSuffix(origin, end) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,222 @@
+package corspolicy_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/cors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/middleware/corspolicy"
+)
+
+func TestMiddleware(t *testing.T) {
+	policies := corspolicy.New(cors.Options{AllowedOrigins: []string{"*"}})
+	policies.Set("/admin", cors.Options{AllowedOrigins: []string{"https://admin.example.com"}})
+	policies.Set("/admin/public/", cors.Options{AllowedOrigins: []string{"*"}})
+
+	handler := policies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path     string
+		origin   string
+		expected string
+	}{
+		{path: "/api/users", origin: "https://any.example.com", expected: "*"},
+		{path: "/admin/users", origin: "https://any.example.com", expected: ""},
+		{path: "/admin/users", origin: "https://admin.example.com", expected: "https://admin.example.com"},
+		{path: "/administrator", origin: "https://any.example.com", expected: "*"},
+		{path: "/admin/public/docs", origin: "https://any.example.com", expected: "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.expected, rr.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestSetAfterMiddleware(t *testing.T) {
+	policies := corspolicy.New(cors.Options{AllowedOrigins: []string{"*"}})
+	handler := policies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	allowOrigin := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+		req.Header.Set("Origin", "https://any.example.com")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	assert.Equal(t, "*", allowOrigin())
+	policies.Set("/admin", cors.Options{AllowedOrigins: []string{"https://admin.example.com"}})
+	assert.Empty(t, allowOrigin(), "the policies set once composed apply")
+}
+
+func TestAllowLocalhost(t *testing.T) {
+	opts := corspolicy.AllowLocalhost(cors.Options{AllowedOrigins: []string{"https://app.example.com", "https://*.preview.example.com"}})
+	handler := cors.New(opts).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "http://localhost:5173", allowed: true},
+		{origin: "http://127.0.0.1:41234", allowed: true},
+		{origin: "https://[::1]:3000", allowed: true},
+		{origin: "http://localhost", allowed: true},
+		{origin: "https://app.example.com", allowed: true},
+		{origin: "https://pr-1.preview.example.com", allowed: true},
+		{origin: "http://localhost.example.com:5173", allowed: false},
+		{origin: "file://localhost", allowed: false},
+		{origin: "https://any.example.com", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Origin", tt.origin)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			expected := ""
+			if tt.allowed {
+				expected = tt.origin
+			}
+			assert.Equal(t, expected, rr.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestAdjust(t *testing.T) {
+	policies := corspolicy.New(cors.Options{AllowedOrigins: []string{"https://app.example.com"}}, corspolicy.AllowLocalhost)
+	policies.Set("/admin", cors.Options{AllowedOrigins: []string{"https://admin.example.com"}})
+	handler := policies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, path := range []string{"/api/users", "/admin/users"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", "http://localhost:5173")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, "http://localhost:5173", rr.Header().Get("Access-Control-Allow-Origin"), "every policy is adjusted: %s", path)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	policies := corspolicy.New(cors.Options{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: 600})
+	reached := false
+	handler := policies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/api/users", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	before := corspolicy.DefaultMetrics.Stats()
+	rr := preflight("https://app.example.com")
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "600", rr.Header().Get("Access-Control-Max-Age"))
+	preflight("https://evil.example.com")
+	assert.False(t, reached, "preflights are answered by the policy")
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/users", nil))
+	assert.True(t, reached)
+
+	after := corspolicy.DefaultMetrics.Stats()
+	assert.Equal(t, int64(2), after.Preflights-before.Preflights)
+	assert.Equal(t, int64(1), after.Rejected-before.Rejected)
+}
+
+func TestOrigins(t *testing.T) {
+	records := []string{"https://pr-1.preview.example.com, https://pr-2.preview.example.com", "*"}
+	origins := &corspolicy.Origins{
+		Source: "dns:_cors.example.com",
+		LookupTXT: func(ctx context.Context, name string) ([]string, error) {
+			assert.Equal(t, "_cors.example.com", name)
+			if records == nil {
+				return nil, errors.New("no such host")
+			}
+			return records, nil
+		},
+	}
+	handler := cors.New(origins.Allow(cors.Options{AllowedOrigins: []string{"https://app.example.com"}})).Handler(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	allowed := func(origin string) bool {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Header().Get("Access-Control-Allow-Origin") == origin
+	}
+
+	assert.True(t, allowed("https://app.example.com"))
+	assert.False(t, allowed("https://pr-1.preview.example.com"), "nothing resolved yet")
+
+	require.NoError(t, origins.Refresh(context.Background()))
+	assert.Equal(t, []string{"https://pr-1.preview.example.com", "https://pr-2.preview.example.com"}, origins.Current(), "without wildcard")
+	assert.True(t, allowed("https://pr-1.preview.example.com"))
+	assert.True(t, allowed("https://app.example.com"))
+	assert.False(t, allowed("https://any.example.com"))
+
+	records = nil
+	assert.Error(t, origins.Refresh(context.Background()))
+	assert.True(t, allowed("https://pr-2.preview.example.com"), "the previous origins are kept")
+}
+
+func TestOriginsEndpoint(t *testing.T) {
+	body := `["https://*.preview.example.com"]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	origins := &corspolicy.Origins{Source: srv.URL}
+
+	require.NoError(t, origins.Refresh(context.Background()))
+	assert.Equal(t, []string{"https://*.preview.example.com"}, origins.Current())
+
+	body = "https://a.example.com\nhttps://b.example.com\n"
+	require.NoError(t, origins.Refresh(context.Background()))
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, origins.Current())
+}
+
+func TestOriginsEveryPolicy(t *testing.T) {
+	origins := &corspolicy.Origins{
+		Source: "dns:_cors.example.com",
+		LookupTXT: func(ctx context.Context, name string) ([]string, error) {
+			return []string{"https://pr-1.preview.example.com"}, nil
+		},
+	}
+	policies := corspolicy.New(cors.Options{AllowedOrigins: []string{"https://app.example.com"}}, origins.Allow)
+	handler := policies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	policies.Set("/admin", cors.Options{AllowedOrigins: []string{"https://admin.example.com"}})
+	require.NoError(t, origins.Refresh(context.Background()))
+
+	for _, path := range []string{"/api/users", "/admin/users"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", "https://pr-1.preview.example.com")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, "https://pr-1.preview.example.com", rr.Header().Get("Access-Control-Allow-Origin"), "refreshed origins apply to every policy: %s", path)
+	}
+}
@@ -0,0 +1,41 @@
+package corspolicy
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// DefaultMetrics counts the preflights answered by the policies. It is
+// published as the "cors" expvar, served under /debug/vars.
+var DefaultMetrics = &Metrics{}
+
+func init() {
+	expvar.Publish("cors", expvar.Func(func() interface{} {
+		return DefaultMetrics.Stats()
+	}))
+}
+
+// Metrics counts the CORS preflights, apart from the other requests.
+type Metrics struct {
+	preflights atomic.Int64
+	rejected   atomic.Int64
+}
+
+type Stats struct {
+	Preflights int64 `json:"preflights"`
+	Rejected   int64 `json:"preflights_rejected"` // origin, method or headers not allowed
+}
+
+func (m *Metrics) Stats() Stats {
+	return Stats{
+		Preflights: m.preflights.Load(),
+		Rejected:   m.rejected.Load(),
+	}
+}
+
+func (m *Metrics) preflight(allowed bool) {
+	m.preflights.Add(1)
+	if !allowed {
+		m.rejected.Add(1)
+	}
+}
@@ -0,0 +1,165 @@
+package corspolicy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/cors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxOriginsBody bounds the response of a remote origins endpoint.
+const maxOriginsBody = 1 << 20
+
+// Origins are allowed origins resolved from a source, the TXT records of a
+// DNS name, such as "dns:_cors.example.com", or an http(s) endpoint
+// serving a JSON array or one origin per line. Origins may be separated by
+// commas or spaces and carry a "*" like the configured ones, so preview
+// deployments are allowed as they come and go.
+type Origins struct {
+	Source   string
+	Interval time.Duration // between refreshes, 1m when zero
+	Client   *http.Client  // http.DefaultClient when nil
+
+	// LookupTXT resolves the TXT records, net.DefaultResolver when nil
+	LookupTXT func(ctx context.Context, name string) ([]string, error)
+
+	origins atomic.Pointer[[]string]
+}
+
+// Current returns the origins of the last successful refresh.
+func (o *Origins) Current() []string {
+	if p := o.origins.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// Refresh resolves the origins, the previous ones being kept on failure.
+func (o *Origins) Refresh(ctx context.Context) error {
+	var (
+		origins []string
+		err     error
+	)
+	if name, ok := strings.CutPrefix(o.Source, "dns:"); ok {
+		origins, err = o.lookup(ctx, name)
+	} else {
+		origins, err = o.fetch(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("error while resolving the CORS origins from %s: %w", o.Source, err)
+	}
+	origins = withoutWildcard(origins)
+	o.origins.Store(&origins)
+	return nil
+}
+
+// Run refreshes the origins on the interval until ctx is done, logging the
+// failures.
+func (o *Origins) Run(ctx context.Context) {
+	interval := o.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := o.Refresh(ctx); err != nil && ctx.Err() == nil {
+				logrus.WithError(err).Warn("keeping the previous CORS origins")
+			}
+		}
+	}
+}
+
+// Allow returns opts also allowing the current origins, composed like
+// AllowLocalhost. The configured origins stay allowed, an empty list
+// allowing none besides the resolved ones.
+func (o *Origins) Allow(opts cors.Options) cors.Options {
+	allowed := opts.AllowOriginFunc
+	if allowed == nil {
+		allowed = func(*http.Request, string) bool { return false }
+		if len(opts.AllowedOrigins) > 0 {
+			allowed = originList(opts.AllowedOrigins)
+		}
+	}
+	opts.AllowOriginFunc = func(r *http.Request, origin string) bool {
+		if allowed(r, origin) {
+			return true
+		}
+		current := o.Current()
+		return len(current) > 0 && originList(current)(r, origin)
+	}
+	return opts
+}
+
+func (o *Origins) lookup(ctx context.Context, name string) ([]string, error) {
+	lookup := o.LookupTXT
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupTXT
+	}
+	records, err := lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return splitOrigins(strings.Join(records, " ")), nil
+}
+
+func (o *Origins) fetch(ctx context.Context) ([]string, error) {
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("responded %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOriginsBody))
+	if err != nil {
+		return nil, err
+	}
+	if text := strings.TrimSpace(string(body)); strings.HasPrefix(text, "[") {
+		var origins []string
+		if err := json.Unmarshal(body, &origins); err != nil {
+			return nil, err
+		}
+		return origins, nil
+	}
+	return splitOrigins(string(body)), nil
+}
+
+func splitOrigins(s string) []string {
+	return strings.FieldsFunc(s, func(c rune) bool {
+		return c == ',' || c == ' ' || c == '\t' || c == '\n' || c == '\r'
+	})
+}
+
+// withoutWildcard drops the "*" origins, a resolved "*" allowing every
+// origin being a mistake rather than a policy.
+func withoutWildcard(origins []string) []string {
+	kept := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		if origin != "*" {
+			kept = append(kept, origin)
+		}
+	}
+	return kept
+}
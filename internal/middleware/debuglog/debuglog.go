@@ -0,0 +1,118 @@
+package debuglog
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/internal/middleware/logger"
+	"github.com/go-obvious/server/redact"
+)
+
+const (
+	HeaderDebugToken = "X-Debug-Token"
+	SnippetSize      = 1024
+)
+
+// snippet keeps the first SnippetSize bytes written to it.
+type snippet struct {
+	bytes.Buffer
+}
+
+func (s *snippet) Write(p []byte) (int, error) {
+	if room := SnippetSize - s.Len(); room > 0 {
+		if len(p) > room {
+			s.Buffer.Write(p[:room])
+		} else {
+			s.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// redactHeaders hides credentials, and the debug token, from the logged
+// request headers.
+func redactHeaders(h http.Header) http.Header {
+	out := redact.Header(h)
+	if out.Get(HeaderDebugToken) != "" {
+		out.Set(HeaderDebugToken, redact.Placeholder)
+	}
+	return out
+}
+
+// elevate returns a copy of the entry logging at trace level.
+func elevate(entry *logrus.Entry) *logrus.Entry {
+	std := entry.Logger
+	l := &logrus.Logger{
+		Out:          std.Out,
+		Hooks:        std.Hooks,
+		Formatter:    std.Formatter,
+		ReportCaller: std.ReportCaller,
+		ExitFunc:     std.ExitFunc,
+		Level:        logrus.TraceLevel,
+	}
+	return l.WithFields(entry.Data).WithField("debug", true)
+}
+
+// Middleware elevates the request logger to trace level for requests
+// presenting the debug token, logging timings and body snippets for that
+// request only. An empty token disables the override, as do the quiet
+// requests. It must be installed after the logger middleware.
+func Middleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			presented := r.Header.Get(HeaderDebugToken)
+			if presented == "" || logger.IsQuiet(r.Context()) || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			entry := logger.GetContext(r.Context())
+			if entry == nil {
+				entry = logger.NewEntry(r)
+			}
+			entry = elevate(entry)
+
+			reqBody := &snippet{}
+			if r.Body != nil {
+				r.Body = teeBody{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+			}
+			respBody := &snippet{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(respBody)
+
+			start := time.Now()
+			entry.WithField("headers", redactHeaders(r.Header)).Debug("debug request started")
+			defer func() {
+				// Routes may be quieted once routed
+				if logger.IsQuiet(r.Context()) {
+					return
+				}
+				entry.WithFields(logrus.Fields{
+					"status":        ww.Status(),
+					"bytes":         ww.BytesWritten(),
+					"duration":      time.Since(start).String(),
+					"request_body":  reqBody.String(),
+					"response_body": respBody.String(),
+				}).Debug("debug request completed")
+			}()
+
+			ctx := logger.SaveContext(r.Context(), entry)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,87 @@
+package debuglog_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/middleware/debuglog"
+	"github.com/go-obvious/server/internal/middleware/logger"
+)
+
+func TestMiddleware(t *testing.T) {
+	hook := test.NewGlobal()
+	logrus.SetLevel(logrus.InfoLevel)
+
+	handler := logger.Middleware(debuglog.Middleware("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		logger.GetContext(r.Context()).Trace("handler trace")
+		_, _ = w.Write(append([]byte("echo "), body...))
+	})))
+
+	tests := []struct {
+		name          string
+		token         string
+		expectEntries int
+	}{
+		{name: "Without Token", token: "", expectEntries: 0},
+		{name: "Wrong Token", token: "guess", expectEntries: 0},
+		{name: "With Token", token: "secret", expectEntries: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook.Reset()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("ping"))
+			if tt.token != "" {
+				req.Header.Set(debuglog.HeaderDebugToken, tt.token)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, "echo ping", rr.Body.String())
+			require.Len(t, hook.Entries, tt.expectEntries)
+			if tt.expectEntries > 0 {
+				last := hook.LastEntry()
+				assert.Equal(t, "ping", last.Data["request_body"])
+				assert.Equal(t, "echo ping", last.Data["response_body"])
+				assert.Equal(t, http.StatusOK, last.Data["status"])
+			}
+		})
+	}
+
+	// the global level is untouched
+	assert.Equal(t, logrus.InfoLevel, logrus.GetLevel())
+}
+
+func TestMiddlewareQuiet(t *testing.T) {
+	hook := test.NewGlobal()
+	handler := func(quiet []string) http.Handler {
+		return logger.Middleware(logger.Quiet(quiet)(debuglog.Middleware("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/routed" {
+				r = logger.SetQuiet(r)
+			}
+			logger.GetContext(r.Context()).Trace("handler trace")
+		}))))
+	}
+
+	for path, quiet := range map[string][]string{"/poll": {"/poll"}, "/routed": nil} {
+		hook.Reset()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(debuglog.HeaderDebugToken, "secret")
+		handler(quiet).ServeHTTP(httptest.NewRecorder(), req)
+
+		for _, entry := range hook.AllEntries() {
+			assert.NotEqual(t, "debug request completed", entry.Message, path)
+			assert.NotEqual(t, "handler trace", entry.Message, path)
+		}
+	}
+}
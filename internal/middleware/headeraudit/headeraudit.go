@@ -0,0 +1,120 @@
+package headeraudit
+
+// Development aid warning about insecure response headers
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Inspect returns the issues found in the response headers of the request.
+// Requests carrying credentials, responses setting cookies and paths under
+// one of the sensitive prefixes must not be cacheable.
+func Inspect(r *http.Request, h http.Header, sensitive []string) []string {
+	issues := make([]string, 0)
+
+	if isSensitive(r, h, sensitive) {
+		cc := strings.ToLower(h.Get("Cache-Control"))
+		if !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private") {
+			issues = append(issues, "sensitive response without Cache-Control no-store or private")
+		}
+	}
+
+	origin := h.Get("Access-Control-Allow-Origin")
+	switch {
+	case origin == "*" && h.Get("Access-Control-Allow-Credentials") == "true":
+		issues = append(issues, "wildcard CORS origin with credentials allowed")
+	case origin == "*":
+		issues = append(issues, "wildcard CORS origin")
+	case origin != "" && origin == r.Header.Get("Origin") && !varies(h, "Origin"):
+		issues = append(issues, "CORS origin echoed without Vary: Origin")
+	}
+
+	if !strings.EqualFold(h.Get("X-Content-Type-Options"), "nosniff") {
+		issues = append(issues, "missing X-Content-Type-Options: nosniff")
+	}
+
+	return issues
+}
+
+func isSensitive(r *http.Request, h http.Header, sensitive []string) bool {
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" || h.Get("Set-Cookie") != "" {
+		return true
+	}
+	for _, prefix := range sensitive {
+		if prefix != "" && strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func varies(h http.Header, name string) bool {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type auditWriter struct {
+	http.ResponseWriter
+	once    sync.Once
+	inspect func(h http.Header)
+}
+
+func (w *auditWriter) WriteHeader(code int) {
+	w.once.Do(func() { w.inspect(w.Header()) })
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	w.once.Do(func() { w.inspect(w.Header()) })
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditWriter) Flush() {
+	w.once.Do(func() { w.inspect(w.Header()) })
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over, as the WebSocket upgrades do, the
+// headers then written by the handler not being audited.
+func (w *auditWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *auditWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware logs a warning for each issue found in the outgoing headers.
+// It is intended for development and must be the outermost middleware.
+func Middleware(sensitive []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			aw := &auditWriter{ResponseWriter: w}
+			aw.inspect = func(h http.Header) {
+				for _, issue := range Inspect(r, h, sensitive) {
+					logrus.WithFields(logrus.Fields{
+						"method": r.Method,
+						"path":   r.URL.Path,
+					}).Warn("header audit: " + issue)
+				}
+			}
+			next.ServeHTTP(aw, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,119 @@
+package headeraudit_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/internal/middleware/headeraudit"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		request  map[string]string
+		response map[string]string
+		expected []string
+	}{
+		{
+			name:     "Secure",
+			path:     "/public",
+			response: map[string]string{"X-Content-Type-Options": "nosniff"},
+			expected: []string{},
+		},
+		{
+			name:     "Sensitive Path Cacheable",
+			path:     "/account/profile",
+			response: map[string]string{"X-Content-Type-Options": "nosniff"},
+			expected: []string{"sensitive response without Cache-Control no-store or private"},
+		},
+		{
+			name:     "Authorized Request Not Cached",
+			path:     "/public",
+			request:  map[string]string{"Authorization": "Bearer token"},
+			response: map[string]string{"X-Content-Type-Options": "nosniff", "Cache-Control": "no-store"},
+			expected: []string{},
+		},
+		{
+			name:     "Wildcard With Credentials",
+			path:     "/public",
+			response: map[string]string{"X-Content-Type-Options": "nosniff", "Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": "true"},
+			expected: []string{"wildcard CORS origin with credentials allowed"},
+		},
+		{
+			name:     "Echoed Origin Without Vary",
+			path:     "/public",
+			request:  map[string]string{"Origin": "https://app.example.com"},
+			response: map[string]string{"X-Content-Type-Options": "nosniff", "Access-Control-Allow-Origin": "https://app.example.com"},
+			expected: []string{"CORS origin echoed without Vary: Origin"},
+		},
+		{
+			name:     "Missing Nosniff",
+			path:     "/public",
+			expected: []string{"missing X-Content-Type-Options: nosniff"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.request {
+				req.Header.Set(k, v)
+			}
+			h := http.Header{}
+			for k, v := range tt.response {
+				h.Set(k, v)
+			}
+			assert.Equal(t, tt.expected, headeraudit.Inspect(req, h, []string{"/account"}))
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	hook := test.NewGlobal()
+
+	handler := headeraudit.Middleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, hook.Entries, 2)
+}
+
+type hijacker struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestMiddlewarePassThrough(t *testing.T) {
+	handler := headeraudit.Middleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		assert.True(t, ok, "flushes")
+		f.Flush()
+		hj, ok := w.(http.Hijacker)
+		assert.True(t, ok, "hijacks")
+		_, _, _ = hj.Hijack()
+	}))
+
+	rr := &hijacker{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.True(t, rr.Flushed)
+	assert.True(t, rr.hijacked)
+}
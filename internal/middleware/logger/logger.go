@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/internal/middleware/requestid"
+)
+
+type ctxKeyType int
+
+const (
+	CtxKey ctxKeyType = iota
+	QuietKey
+)
+
+// NewEntry returns a log entry carrying the request correlation fields.
+func NewEntry(r *http.Request) *logrus.Entry {
+	fields := logrus.Fields{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	}
+	return logrus.WithFields(withIDs(r.Context(), fields))
+}
+
+// NewContextEntry returns a log entry carrying the correlation fields of
+// ctx, such as the context of a job started by a request.
+func NewContextEntry(ctx context.Context) *logrus.Entry {
+	return logrus.WithFields(withIDs(ctx, logrus.Fields{}))
+}
+
+func withIDs(ctx context.Context, fields logrus.Fields) logrus.Fields {
+	if rid := requestid.GetContext(ctx); rid != nil {
+		fields["request_id"] = rid.RequestID
+		fields["correlation_id"] = rid.CorrelationID
+		if rid.TraceID != "" {
+			fields["trace_id"] = rid.TraceID
+		}
+		for name, value := range rid.Baggage {
+			fields[baggageField(name)] = value
+		}
+	}
+	return fields
+}
+
+// baggageField returns the log field of a baggage header, X-Tenant-ID
+// logged as "tenant_id".
+func baggageField(header string) string {
+	if len(header) > 2 && strings.EqualFold(header[:2], "x-") {
+		header = header[2:]
+	}
+	return strings.ReplaceAll(strings.ToLower(header), "-", "_")
+}
+
+func GetContext(ctx context.Context) *logrus.Entry {
+	if ctx == nil {
+		return nil
+	}
+
+	if entry, ok := ctx.Value(CtxKey).(*logrus.Entry); ok {
+		return entry
+	}
+
+	return nil
+}
+
+func SaveContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, CtxKey, entry)
+}
+
+// Middleware must be installed after the requestid middleware.
+func Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := SaveContext(r.Context(), NewEntry(r))
+		ctx = context.WithValue(ctx, QuietKey, &atomic.Bool{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// SetQuiet marks the request as quiet, such as the high-frequency polling
+// ones: its debug log is skipped and its entry only logs warnings and
+// errors. The returned request carries the quieted entry.
+func SetQuiet(r *http.Request) *http.Request {
+	if quiet, ok := r.Context().Value(QuietKey).(*atomic.Bool); ok {
+		// Marked in place, for the middlewares installed before
+		quiet.Store(true)
+	}
+	entry := GetContext(r.Context())
+	if entry == nil {
+		entry = NewEntry(r)
+	}
+	std := entry.Logger
+	l := &logrus.Logger{
+		Out:          std.Out,
+		Hooks:        std.Hooks,
+		Formatter:    std.Formatter,
+		ReportCaller: std.ReportCaller,
+		ExitFunc:     std.ExitFunc,
+		Level:        min(std.GetLevel(), logrus.WarnLevel),
+	}
+	return r.WithContext(SaveContext(r.Context(), l.WithFields(entry.Data)))
+}
+
+// IsQuiet reports whether the request was marked with SetQuiet.
+func IsQuiet(ctx context.Context) bool {
+	quiet, ok := ctx.Value(QuietKey).(*atomic.Bool)
+	return ok && quiet.Load()
+}
+
+// Quiet marks the requests whose path matches one of the patterns, in the
+// syntax of path.Match such as "/jobs/*/status", with SetQuiet. It must be
+// installed after Middleware.
+func Quiet(patterns []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(patterns) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if Quieted(patterns, r.URL.Path) {
+				r = SetQuiet(r)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Quieted reports whether Quiet marks the requests of p.
+func Quieted(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
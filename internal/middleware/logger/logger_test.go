@@ -0,0 +1,57 @@
+package logger_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/middleware/logger"
+	"github.com/go-obvious/server/internal/middleware/requestid"
+)
+
+func TestMiddleware(t *testing.T) {
+	ids, err := requestid.New(requestid.Config{Policy: requestid.PolicySanitize, Baggage: []string{"X-Tenant-ID"}})
+	require.NoError(t, err)
+	handler := ids(logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := logger.GetContext(r.Context())
+		require.NotNil(t, entry)
+		assert.Equal(t, "test-request-id", entry.Data["request_id"])
+		assert.Equal(t, "test-correlation-id", entry.Data["correlation_id"])
+		assert.Equal(t, "acme", entry.Data["tenant_id"])
+		assert.Equal(t, http.MethodGet, entry.Data["method"])
+		assert.Equal(t, "/foo", entry.Data["path"])
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	req.Header.Set(requestid.HeaderRequestID, "test-request-id")
+	req.Header.Set(requestid.HeaderCorrelationID, "test-correlation-id")
+	req.Header.Set("X-Tenant-ID", "acme")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestQuiet(t *testing.T) {
+	hook := test.NewGlobal()
+	logrus.SetLevel(logrus.InfoLevel)
+	handler := logger.Middleware(logger.Quiet([]string{"/jobs/*/status"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := logger.GetContext(r.Context())
+		entry.Info("polled")
+		entry.Warn("slow poll")
+		assert.Equal(t, r.URL.Path == "/jobs/1/status", logger.IsQuiet(r.Context()))
+	})))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/jobs/1/status", nil))
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Equal(t, "slow poll", hook.LastEntry().Message)
+	assert.Equal(t, "/jobs/1/status", hook.LastEntry().Data["path"])
+
+	hook.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/jobs/1", nil))
+	assert.Len(t, hook.AllEntries(), 2)
+	assert.Equal(t, logrus.InfoLevel, logrus.GetLevel(), "the global level is untouched")
+}
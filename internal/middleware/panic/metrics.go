@@ -0,0 +1,37 @@
+package panic
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// DefaultMetrics counts the panics recovered by the middlewares. It is
+// published as the "panic" expvar, served under /debug/vars.
+var DefaultMetrics = &Metrics{}
+
+func init() {
+	expvar.Publish("panic", expvar.Func(func() interface{} {
+		return DefaultMetrics.Stats()
+	}))
+}
+
+// Metrics counts the recovered panics and the requests retried after one.
+type Metrics struct {
+	panics           atomic.Int64
+	retries          atomic.Int64
+	retriesSucceeded atomic.Int64
+}
+
+type Stats struct {
+	Panics           int64 `json:"panics"`
+	Retries          int64 `json:"retries"`
+	RetriesSucceeded int64 `json:"retries_succeeded"` // served without panicking again
+}
+
+func (m *Metrics) Stats() Stats {
+	return Stats{
+		Panics:           m.panics.Load(),
+		Retries:          m.retries.Load(),
+		RetriesSucceeded: m.retriesSucceeded.Load(),
+	}
+}
@@ -1,36 +1,190 @@
 package panic
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
 	"strings"
 
+	"github.com/go-chi/chi/middleware"
 	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/redact"
+	"github.com/go-obvious/server/request"
 )
 
+// ErrPanic is the error sent for a recovered panic, whose value is only
+// logged.
+var ErrPanic = errors.New("internal server error")
+
+// Report describes a recovered panic to a Reporter. The stack and request
+// metadata are redacted as in the logs, Value is as recovered.
+type Report struct {
+	Value         interface{}
+	Message       string // redacted Value
+	Stack         string
+	Method        string
+	Host          string
+	URL           string
+	Remote        string
+	Header        http.Header
+	RequestID     string
+	CorrelationID string
+	TraceID       string
+}
+
+// Reporter forwards a recovered panic, such as to Sentry or Bugsnag. It is
+// called after the error response is sent, with the request context.
+type Reporter func(ctx context.Context, rep Report)
+
+// Config of the middleware returned by New.
+type Config struct {
+	Reporters []Reporter
+
+	// Retry serves the GET and HEAD requests once more after a panic, when
+	// nothing of the response was sent yet, before answering 500
+	Retry bool
+}
+
 // This is another middleware that must stay on the top since
 // we rely on it to convert business-logic-level panics into HTTP 500s.
 func Middleware(next http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			rvr := recover()
-			if rvr != nil && rvr != http.ErrAbortHandler {
-				stack := string(debug.Stack())
-				logrus.WithFields(logrus.Fields{
-					"panic":  fmt.Sprint(rvr),
-					"host":   r.Host,
-					"method": r.Method,
-					"uri":    r.RequestURI,
-					"url":    r.URL,
-					"remote": r.RemoteAddr,
-					"stack":  strings.Split(stack, "\n"),
-				}).Error("panicked!")
-
-				w.WriteHeader(http.StatusInternalServerError)
+	return New(Config{})(next)
+}
+
+// New returns the Middleware also calling the reporters with each recovered
+// panic. Installed ahead of the request IDs, it reads them from the
+// response headers.
+func New(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if cfg.Retry && retryable(r) {
+				header := w.Header().Clone()
+				ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+				rvr, stack := serve(next, ww, r)
+				if rvr == nil {
+					return
+				}
+				if ww.Status() == 0 && ww.BytesWritten() == 0 {
+					cfg.recovered(w, r, rvr, stack, true)
+					DefaultMetrics.retries.Add(1)
+					for key := range w.Header() {
+						delete(w.Header(), key)
+					}
+					for key, values := range header {
+						w.Header()[key] = values
+					}
+					if rvr, stack = serve(next, w, r); rvr == nil {
+						DefaultMetrics.retriesSucceeded.Add(1)
+						return
+					}
+				}
+				cfg.recovered(w, r, rvr, stack, false)
+				return
+			}
+			if rvr, stack := serve(next, w, r); rvr != nil {
+				cfg.recovered(w, r, rvr, stack, false)
 			}
-		}()
-		next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// retryable reports whether the request may be served twice, its method
+// being idempotent and the connection not to be hijacked.
+func retryable(r *http.Request) bool {
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) && r.Header.Get("Upgrade") == ""
+}
+
+// serve calls next, returning the value and the stack of its panic, if any,
+// http.ErrAbortHandler excepted.
+func serve(next http.Handler, w http.ResponseWriter, r *http.Request) (rvr interface{}, stack []byte) {
+	defer func() {
+		if rvr = recover(); rvr != nil && rvr != http.ErrAbortHandler {
+			stack = debug.Stack()
+		} else {
+			rvr = nil
+		}
+	}()
+	next.ServeHTTP(w, r)
+	return nil, nil
+}
+
+// recovered logs and reports the panic, then answers 500 unless the request
+// is retried.
+func (cfg Config) recovered(w http.ResponseWriter, r *http.Request, rvr interface{}, stack []byte, retrying bool) {
+	DefaultMetrics.panics.Add(1)
+	rep := newReport(r, w.Header(), rvr, stack)
+	fields := logrus.Fields{}
+	if retrying {
+		fields["retrying"] = true
+	}
+	logReport(r, rep, fields)
+
+	if !retrying {
+		request.ReplyErr(w, r, request.NewHTTPError(ErrPanic, http.StatusInternalServerError))
+	}
+	for _, report := range cfg.Reporters {
+		callReporter(r.Context(), report, rep)
+	}
+}
+
+// Late logs the panic of a handler recovered out of the middleware, such as
+// one still running once its response was sent, header holding the IDs of
+// the response. The panic is counted but neither answered nor reported.
+func Late(r *http.Request, header http.Header, rvr interface{}, stack []byte) {
+	DefaultMetrics.panics.Add(1)
+	logReport(r, newReport(r, header, rvr, stack), logrus.Fields{"late": true})
+}
+
+// newReport describes the panic, the value, URL and headers redacted as they
+// may carry credentials.
+func newReport(r *http.Request, header http.Header, rvr interface{}, stack []byte) Report {
+	secrets := redact.RequestSecrets(r)
+	return Report{
+		Value:         rvr,
+		Message:       redact.String(fmt.Sprint(rvr), secrets...),
+		Stack:         redact.String(string(stack), secrets...),
+		Method:        r.Method,
+		Host:          r.Host,
+		URL:           redact.URL(r.URL),
+		Remote:        r.RemoteAddr,
+		Header:        redact.Header(r.Header),
+		RequestID:     header.Get(request.HeaderRequestID),
+		CorrelationID: header.Get(request.HeaderCorrelationID),
+		TraceID:       header.Get(request.HeaderTraceID),
+	}
+}
+
+func logReport(r *http.Request, rep Report, fields logrus.Fields) {
+	fields["panic"] = rep.Message
+	fields["host"] = rep.Host
+	fields["method"] = rep.Method
+	fields["uri"] = redact.String(redactURI(r.RequestURI))
+	fields["url"] = rep.URL
+	fields["remote"] = rep.Remote
+	fields["headers"] = rep.Header
+	fields["stack"] = strings.Split(rep.Stack, "\n")
+	logrus.WithFields(fields).Error("panicked!")
+}
+
+// callReporter calls the reporter, logging rather than propagating its own
+// panic.
+func callReporter(ctx context.Context, report Reporter, rep Report) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			logrus.WithField("panic", fmt.Sprint(rvr)).Error("panicked while reporting a panic")
+		}
+	}()
+	report(ctx, rep)
+}
+
+func redactURI(uri string) string {
+	p, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
 	}
-	return http.HandlerFunc(fn)
+	return p + "?" + redact.Query(query)
 }
@@ -1,20 +1,23 @@
 package panic_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
-	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	middleware "github.com/go-obvious/server/internal/middleware/panic"
+	"github.com/go-obvious/server/request"
 )
 
 func TestMiddleware(t *testing.T) {
-	logger, hook := test.NewNullLogger()
-	logrus.SetOutput(logger.Writer())
+	hook := test.NewGlobal()
 
 	tests := []struct {
 		name           string
@@ -63,3 +66,141 @@ func TestMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestMiddlewareErrorEnvelope(t *testing.T) {
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("secret details")
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.JSONEq(t, `{"success": false, "error": "internal server error"}`, rr.Body.String())
+}
+
+func TestMiddlewareRedactsCredentials(t *testing.T) {
+	hook := test.NewGlobal()
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("auth failed for " + r.Header.Get("Authorization"))
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/orders?page=2&access_token=abc123", nil)
+	r.Header.Set("Authorization", "Bearer abc123")
+	r.Header.Set("Cookie", "sid=xyz789")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	entry := hook.LastEntry()
+	assert.NotNil(t, entry)
+	headers := entry.Data["headers"].(http.Header)
+	assert.Equal(t, "[REDACTED]", headers.Get("Authorization"))
+	assert.Equal(t, "[REDACTED]", headers.Get("Cookie"))
+	assert.Equal(t, "/orders?page=2&access_token=%5BREDACTED%5D", entry.Data["uri"])
+	assert.NotContains(t, fmt.Sprint(entry.Data), "abc123")
+}
+
+func TestReporting(t *testing.T) {
+	hook := test.NewGlobal()
+	var reports []middleware.Report
+	handler := middleware.New(middleware.Config{Reporters: []middleware.Reporter{
+		func(ctx context.Context, rep middleware.Report) {
+			panic("reporter down")
+		},
+		func(ctx context.Context, rep middleware.Report) {
+			reports = append(reports, rep)
+		},
+	}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(request.HeaderRequestID, "req-1")
+		w.Header().Set(request.HeaderCorrelationID, "corr-1")
+		panic(errors.New("boom with token abc123"))
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/orders?access_token=abc123", nil)
+	r.Header.Set("Authorization", "Bearer abc123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Len(t, reports, 1, "a panicking reporter does not stop the others")
+	rep := reports[0]
+	assert.EqualError(t, rep.Value.(error), "boom with token abc123")
+	assert.Equal(t, "boom with token [REDACTED]", rep.Message)
+	assert.Equal(t, http.MethodPost, rep.Method)
+	assert.Equal(t, "req-1", rep.RequestID)
+	assert.Equal(t, "corr-1", rep.CorrelationID)
+	assert.Equal(t, "[REDACTED]", rep.Header.Get("Authorization"))
+	assert.NotContains(t, rep.URL+rep.Stack, "abc123")
+	assert.Contains(t, rep.Stack, "panic_test.go")
+	assert.Equal(t, "panicked while reporting a panic", hook.LastEntry().Message)
+}
+
+func TestRetry(t *testing.T) {
+	var calls int
+	flaky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Attempt", fmt.Sprint(calls))
+		w.Header().Add("X-Added", "once")
+		if calls == 1 {
+			panic("transient")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		header  string
+		status  int
+		calls   int
+		panics  int
+		retried bool
+		success bool
+	}{
+		{name: "Retried", handler: flaky, method: http.MethodGet, status: http.StatusOK, calls: 2, panics: 1, retried: true, success: true},
+		{name: "Not idempotent", handler: flaky, method: http.MethodPost, status: http.StatusInternalServerError, calls: 1, panics: 1},
+		{name: "Upgrade", handler: flaky, method: http.MethodGet, header: "websocket", status: http.StatusInternalServerError, calls: 1, panics: 1},
+		{
+			name: "Response started",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(http.StatusAccepted)
+				panic("after writing")
+			},
+			method: http.MethodHead, status: http.StatusAccepted, calls: 1, panics: 1,
+		},
+		{
+			name: "Panics again",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				panic("persistent")
+			},
+			method: http.MethodGet, status: http.StatusInternalServerError, calls: 2, panics: 2, retried: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			before := middleware.DefaultMetrics.Stats()
+			r := httptest.NewRequest(tt.method, "/orders", nil)
+			if tt.header != "" {
+				r.Header.Set("Upgrade", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			middleware.New(middleware.Config{Retry: true})(tt.handler).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, tt.calls, calls)
+			after := middleware.DefaultMetrics.Stats()
+			assert.Equal(t, tt.panics, int(after.Panics-before.Panics))
+			assert.Equal(t, boolToInt(tt.retried), int(after.Retries-before.Retries))
+			assert.Equal(t, boolToInt(tt.success), int(after.RetriesSucceeded-before.RetriesSucceeded))
+			if tt.success {
+				assert.Equal(t, []string{"once"}, rr.Header().Values("X-Added"), "the headers of the first attempt are dropped")
+			}
+		})
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// Formats of the generated request IDs
+const (
+	FormatUUIDv4 = "uuidv4"
+	FormatUUIDv7 = "uuidv7" // sortable by creation time
+	FormatULID   = "ulid"   // sortable by creation time
+	FormatKSUID  = "ksuid"  // sortable by creation time
+	FormatHex    = "hex"
+)
+
+// Generator returns the function generating the request IDs in format,
+// nil for the empty format, leaving the IDs to chi, a prefix followed by a
+// counter.
+func Generator(format string) (func() string, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case FormatUUIDv4:
+		return NewUUIDv4, nil
+	case FormatUUIDv7:
+		return NewUUIDv7, nil
+	case FormatULID:
+		return NewULID, nil
+	case FormatKSUID:
+		return NewKSUID, nil
+	case FormatHex:
+		return func() string { return randomHex(16) }, nil
+	}
+	return nil, fmt.Errorf("unknown request ID format %q", format)
+}
+
+// NewUUIDv4 returns a random RFC 9562 UUID.
+func NewUUIDv4() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return uuid(b, 4)
+}
+
+// NewUUIDv7 returns an RFC 9562 UUID starting with the Unix time in
+// milliseconds.
+func NewUUIDv7() string {
+	var b [16]byte
+	_, _ = rand.Read(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	b[0], b[1], b[2], b[3], b[4], b[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	return uuid(b, 7)
+}
+
+func uuid(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// crockford is the base32 alphabet of ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID, the Unix time in milliseconds followed by 80
+// random bits in 26 characters of Crockford's base32.
+func NewULID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	b[0], b[1], b[2], b[3], b[4], b[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// ksuidEpoch is the epoch of the KSUID timestamps, in Unix seconds
+const ksuidEpoch = 1400000000
+
+// base62 is the alphabet of KSUIDs
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// NewKSUID returns a KSUID, the seconds since the KSUID epoch followed by
+// 128 random bits in 27 characters of base62.
+func NewKSUID() string {
+	var b [20]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	_, _ = rand.Read(b[4:])
+
+	n := new(big.Int).SetBytes(b[:])
+	digits := make([]byte, 0, 27)
+	radix, digit := big.NewInt(62), new(big.Int)
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, digit)
+		digits = append(digits, base62[digit.Int64()])
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return strings.Repeat("0", 27-len(digits)) + string(digits)
+}
+
+// generated sets the request ID of the requests without one to an ID of
+// generate, where chi would generate its own.
+func generated(generate func() string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(middleware.RequestIDHeader)
+		if id == "" {
+			id = generate()
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, id)))
+	})
+}
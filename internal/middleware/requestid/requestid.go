@@ -2,7 +2,14 @@ package requestid
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/go-chi/chi/middleware"
 )
@@ -13,14 +20,158 @@ const (
 	CtxKey ctxKeyType = iota
 )
 
+const (
+	HeaderRequestID     = "X-Request-Id"
+	HeaderCorrelationID = "X-Correlation-ID"
+	HeaderTraceID       = "X-Trace-ID"
+	HeaderTraceParent   = "Traceparent" // W3C Trace Context
+	HeaderTraceState    = "Tracestate"
+
+	// B3 propagation, of Zipkin, Envoy and Istio, in its single and
+	// multiple header forms
+	HeaderB3             = "B3"
+	HeaderB3TraceID      = "X-B3-TraceId"
+	HeaderB3SpanID       = "X-B3-SpanId"
+	HeaderB3ParentSpanID = "X-B3-ParentSpanId"
+	HeaderB3Sampled      = "X-B3-Sampled"
+	HeaderB3Flags        = "X-B3-Flags"
+)
+
+// b3Headers are the B3 headers, propagated as received
+var b3Headers = []string{HeaderB3, HeaderB3TraceID, HeaderB3SpanID, HeaderB3ParentSpanID, HeaderB3Sampled, HeaderB3Flags}
+
+// idHeaders are the headers of the IDs and trace context supplied by the
+// clients
+var idHeaders = append([]string{middleware.RequestIDHeader, HeaderCorrelationID, HeaderTraceID, HeaderTraceParent, HeaderTraceState}, b3Headers...)
+
+// Policies of the IDs supplied by the clients
+const (
+	PolicyEcho     = "echo"     // used verbatim
+	PolicySanitize = "sanitize" // stripped of the unexpected characters and truncated
+	PolicyReplace  = "replace"  // ignored, the request starting a new correlation
+	PolicyReject   = "reject"   // refused when malformed
+)
+
+var ErrInvalidID = errors.New("invalid request ID header")
+
+// MaxIDLength is the length of the longest ID accepted.
+const MaxIDLength = 128
+
+// maxTraceStateLength is the length of the longest tracestate accepted, the 32 members of 16 characters W3C Trace Context allows.
+const maxTraceStateLength = 512
+
+var (
+	traceParent = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+	// b3Single is "TRACEID-SPANID[-SAMPLED[-PARENTSPANID]]" or "SAMPLED",
+	// the trace ID having 64 or 128 bits
+	b3Single  = regexp.MustCompile(`^(?:([0-9a-f]{16}|[0-9a-f]{32})-([0-9a-f]{16})(?:-([01d])(?:-[0-9a-f]{16})?)?|([01d]))$`)
+	b3TraceID = regexp.MustCompile(`^(?:[0-9a-f]{16}|[0-9a-f]{32})$`)
+	b3SpanID  = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
 type Context struct {
-	RequestID string `json:"request_id"`
+	RequestID     string      `json:"request_id"`
+	CorrelationID string      `json:"correlation_id"`
+	TraceID       string      `json:"trace_id,omitempty"`
+	TraceParent   string      `json:"traceparent,omitempty"`
+	TraceState    string      `json:"-"`
+	B3            http.Header `json:"-"` // the B3 headers of the caller
+
+	// Baggage holds the values of the baggage headers of the caller, by
+	// canonical header name
+	Baggage map[string]string `json:"baggage,omitempty"`
 }
 
+// NewContext returns the IDs and trace context of the request. The
+// traceparent is converted from the B3 headers when missing, and generated
+// when neither is supplied, starting a trace sampled unless B3 denies it.
+// The trace ID defaults to the one of the traceparent.
 func NewContext(r *http.Request) *Context {
-	return &Context{
-		RequestID: middleware.GetReqID(r.Context()),
+	ref := Context{
+		RequestID:     middleware.GetReqID(r.Context()),
+		CorrelationID: r.Header.Get(HeaderCorrelationID),
+		TraceID:       r.Header.Get(HeaderTraceID),
+		TraceParent:   r.Header.Get(HeaderTraceParent),
+		TraceState:    r.Header.Get(HeaderTraceState),
+	}
+	for _, name := range b3Headers {
+		if value := r.Header.Get(name); value != "" {
+			if ref.B3 == nil {
+				ref.B3 = http.Header{}
+			}
+			ref.B3.Set(name, value)
+		}
+	}
+
+	// A request without correlation starts a new one
+	if ref.CorrelationID == "" {
+		ref.CorrelationID = ref.RequestID
+	}
+
+	if ref.TraceParent == "" {
+		parent, flags := fromB3(r.Header)
+		if parent == "" {
+			parent = "00-" + randomHex(16) + "-" + randomHex(8) + "-" + flags
+		}
+		ref.TraceParent = parent
+	}
+	if m := traceParent.FindStringSubmatch(ref.TraceParent); ref.TraceID == "" && m != nil {
+		ref.TraceID = m[1]
+	}
+
+	return &ref
+}
+
+// Headers returns the headers propagating the IDs, the trace context and
+// the baggage of ref to an outbound request, the B3 ones as the caller
+// sent them.
+func (ref *Context) Headers() map[string]string {
+	headers := map[string]string{
+		HeaderRequestID:     ref.RequestID,
+		HeaderCorrelationID: ref.CorrelationID,
+		HeaderTraceID:       ref.TraceID,
+		HeaderTraceParent:   ref.TraceParent,
+		HeaderTraceState:    ref.TraceState,
+	}
+	for name := range ref.B3 {
+		headers[name] = ref.B3.Get(name)
+	}
+	for name, value := range ref.Baggage {
+		headers[name] = value
+	}
+	for name, value := range headers {
+		if value == "" {
+			delete(headers, name)
+		}
+	}
+	return headers
+}
+
+// fromB3 returns the traceparent of the B3 headers, empty without trace
+// and span IDs, and the trace flags of their sampling decision, sampled
+// unless denied. The 64-bit trace IDs are left-padded with zeros.
+func fromB3(h http.Header) (parent, flags string) {
+	traceID, spanID, sampled := h.Get(HeaderB3TraceID), h.Get(HeaderB3SpanID), h.Get(HeaderB3Sampled)
+	if m := b3Single.FindStringSubmatch(h.Get(HeaderB3)); m != nil {
+		traceID, spanID, sampled = m[1], m[2], m[3]+m[4]
+	} else if !b3TraceID.MatchString(traceID) || !b3SpanID.MatchString(spanID) {
+		traceID, spanID = "", ""
+	}
+	flags = "01"
+	if sampled == "0" && h.Get(HeaderB3Flags) != "1" {
+		flags = "00"
 	}
+	if traceID == "" {
+		return "", flags
+	}
+	return "00-" + strings.Repeat("0", 32-len(traceID)) + traceID + "-" + spanID + "-" + flags, flags
+}
+
+// randomHex returns n random bytes in hexadecimal.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
 func GetContext(ctx context.Context) *Context {
@@ -39,14 +190,197 @@ func SaveContext(ctx context.Context, ref *Context) context.Context {
 	return context.WithValue(ctx, CtxKey, ref)
 }
 
-func Middleware(next http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		reqID := middleware.GetReqID(r.Context())
-		if reqID == "" {
-			reqID = middleware.RequestIDHeader
+// Middleware reads the IDs of the request with PolicySanitize.
+var Middleware = middlewareFor(Config{Policy: PolicySanitize})
+
+// Config of the middleware returned by New
+type Config struct {
+	Policy   string        // PolicyEcho, PolicySanitize, PolicyReplace or PolicyReject
+	Generate func() string // of the missing request IDs, see Generator, chi's when nil
+	Baggage  []string      // headers carried along with the IDs, such as X-Tenant-ID
+
+	// Reject replies to the requests PolicyReject refuses, with an error
+	// wrapping ErrInvalidID
+	Reject func(http.ResponseWriter, *http.Request, error)
+}
+
+// New returns the middleware reading the IDs and the baggage of the
+// request with the policy of cfg before they reach the logs, the response
+// headers and the outbound requests.
+func New(cfg Config) (func(http.Handler) http.Handler, error) {
+	switch cfg.Policy {
+	case PolicyEcho, PolicySanitize, PolicyReplace, PolicyReject:
+		baggage := make([]string, 0, len(cfg.Baggage))
+		for _, name := range cfg.Baggage {
+			if name = strings.TrimSpace(name); name != "" {
+				baggage = append(baggage, http.CanonicalHeaderKey(name))
+			}
+		}
+		cfg.Baggage = baggage
+		return middlewareFor(cfg), nil
+	}
+	return nil, fmt.Errorf("unknown request ID policy %q", cfg.Policy)
+}
+
+func middlewareFor(cfg Config) func(http.Handler) http.Handler {
+	policy, generate, reject := cfg.Policy, cfg.Generate, cfg.Reject
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ref := NewContext(r)
+			if ref.RequestID == "" {
+				ref.RequestID = middleware.RequestIDHeader
+			}
+			for _, name := range cfg.Baggage {
+				if value := r.Header.Get(name); value != "" {
+					if ref.Baggage == nil {
+						ref.Baggage = map[string]string{}
+					}
+					ref.Baggage[name] = value
+				}
+			}
+
+			w.Header().Set(HeaderRequestID, ref.RequestID)
+			w.Header().Set(HeaderCorrelationID, ref.CorrelationID)
+			if ref.TraceID != "" {
+				w.Header().Set(HeaderTraceID, ref.TraceID)
+			}
+			for name, value := range ref.Baggage {
+				w.Header().Set(name, value)
+			}
+
+			ctx := SaveContext(r.Context(), ref)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		handler := middleware.RequestID(http.HandlerFunc(fn))
+		if generate != nil {
+			handler = generated(generate, http.HandlerFunc(fn))
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if policy == PolicyReject {
+				if err := Check(r, cfg.Baggage...); err != nil {
+					if reject == nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+					} else {
+						reject(w, r, err)
+					}
+					return
+				}
+			}
+			handler.ServeHTTP(w, applyPolicy(policy, r, cfg.Baggage))
+		})
+	}
+}
+
+// Check returns an error wrapping ErrInvalidID when an ID or baggage header
+// of the request is repeated or malformed: an ID or value longer than
+// MaxIDLength or with other characters than the letters, digits and
+// "-_.:/+=@", or a trace context not following W3C Trace Context or B3.
+func Check(r *http.Request, baggage ...string) error {
+	for _, name := range slices.Concat(idHeaders, baggage) {
+		values := r.Header.Values(name)
+		if len(values) > 1 {
+			return fmt.Errorf("%w: repeated %s", ErrInvalidID, name)
 		}
-		ctx := SaveContext(r.Context(), &Context{RequestID: reqID})
-		next.ServeHTTP(w, r.WithContext(ctx))
+		if len(values) == 1 && !valid(name, values[0]) {
+			return fmt.Errorf("%w: malformed %s", ErrInvalidID, name)
+		}
+	}
+	if r.Header.Get(HeaderTraceState) != "" && r.Header.Get(HeaderTraceParent) == "" {
+		return fmt.Errorf("%w: %s without %s", ErrInvalidID, HeaderTraceState, HeaderTraceParent)
 	}
-	return middleware.RequestID(http.HandlerFunc(fn))
+	return nil
+}
+
+func valid(name, value string) bool {
+	switch name {
+	case HeaderTraceParent:
+		return traceParent.MatchString(value)
+	case HeaderTraceState:
+		return len(value) <= maxTraceStateLength && strings.IndexFunc(value, unprintable) < 0
+	case HeaderB3:
+		return b3Single.MatchString(value)
+	case HeaderB3TraceID:
+		return b3TraceID.MatchString(value)
+	case HeaderB3SpanID, HeaderB3ParentSpanID:
+		return b3SpanID.MatchString(value)
+	case HeaderB3Sampled:
+		return value == "0" || value == "1"
+	case HeaderB3Flags:
+		return value == "1"
+	}
+	return value != "" && value == sanitize(value)
+}
+
+// applyPolicy returns the request with the ID and baggage headers supplied
+// by the client rewritten by the policy, the request ID being generated
+// when removed.
+func applyPolicy(policy string, r *http.Request, baggage []string) *http.Request {
+	if policy == PolicyEcho || policy == PolicyReject {
+		return r
+	}
+	var out *http.Request
+	set := func(name, value string) {
+		if values := r.Header.Values(name); len(values) <= 1 && r.Header.Get(name) == value {
+			return
+		}
+		// The inbound headers are left untouched for the other handlers
+		if out == nil {
+			out = r.Clone(r.Context())
+		}
+		if value == "" {
+			out.Header.Del(name)
+		} else {
+			out.Header.Set(name, value)
+		}
+	}
+
+	if policy == PolicyReplace {
+		for _, name := range slices.Concat(idHeaders, baggage) {
+			set(name, "")
+		}
+	} else {
+		// Repeated headers are reduced to their first value
+		for _, name := range append([]string{middleware.RequestIDHeader, HeaderCorrelationID, HeaderTraceID}, baggage...) {
+			set(name, sanitize(r.Header.Get(name)))
+		}
+		parent, state := r.Header.Get(HeaderTraceParent), r.Header.Get(HeaderTraceState)
+		if !valid(HeaderTraceParent, parent) {
+			parent, state = "", ""
+		} else if !valid(HeaderTraceState, state) {
+			state = ""
+		}
+		set(HeaderTraceParent, parent)
+		set(HeaderTraceState, state)
+		for _, name := range b3Headers {
+			value := r.Header.Get(name)
+			if !valid(name, value) {
+				value = ""
+			}
+			set(name, value)
+		}
+	}
+	if out == nil {
+		return r
+	}
+	return out
+}
+
+// sanitize keeps the letters, digits and "-_.:/+=@" of an ID, truncated to
+// MaxIDLength.
+func sanitize(id string) string {
+	id = strings.Map(func(c rune) rune {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', strings.ContainsRune("-_.:/+=@", c):
+			return c
+		}
+		return -1
+	}, id)
+	if len(id) > MaxIDLength {
+		id = id[:MaxIDLength]
+	}
+	return id
+}
+
+func unprintable(c rune) bool {
+	return c < 0x20 || c > 0x7e
 }
@@ -1,9 +1,13 @@
 package requestid_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-obvious/server/internal/middleware/requestid"
@@ -11,14 +15,28 @@ import (
 
 func TestMiddleware(t *testing.T) {
 	tests := []struct {
-		name          string
-		requestID     string
-		expectedReqID string
+		name                  string
+		requestID             string
+		correlationID         string
+		traceID               string
+		expectedReqID         string
+		expectedCorrelationID string
+		expectedTraceID       string
 	}{
 		{
-			name:          "With Request ID",
-			requestID:     "test-request-id",
-			expectedReqID: "test-request-id",
+			name:                  "With Request ID",
+			requestID:             "test-request-id",
+			expectedReqID:         "test-request-id",
+			expectedCorrelationID: "test-request-id",
+		},
+		{
+			name:                  "With Correlation and Trace ID",
+			requestID:             "test-request-id",
+			correlationID:         "test-correlation-id",
+			traceID:               "test-trace-id",
+			expectedReqID:         "test-request-id",
+			expectedCorrelationID: "test-correlation-id",
+			expectedTraceID:       "test-trace-id",
 		},
 	}
 
@@ -32,6 +50,17 @@ func TestMiddleware(t *testing.T) {
 				if ctx.RequestID != tt.expectedReqID {
 					t.Errorf("Unexpected Request ID. Expected: %s, Got: %s", tt.expectedReqID, ctx.RequestID)
 				}
+				if ctx.CorrelationID != tt.expectedCorrelationID {
+					t.Errorf("Unexpected Correlation ID. Expected: %s, Got: %s", tt.expectedCorrelationID, ctx.CorrelationID)
+				}
+				if tt.expectedTraceID == "" {
+					// Generated along with the traceparent
+					if len(ctx.TraceID) != 32 || !strings.Contains(ctx.TraceParent, ctx.TraceID) {
+						t.Errorf("Trace ID not generated, Got: %q %q", ctx.TraceID, ctx.TraceParent)
+					}
+				} else if ctx.TraceID != tt.expectedTraceID {
+					t.Errorf("Unexpected Trace ID. Expected: %s, Got: %s", tt.expectedTraceID, ctx.TraceID)
+				}
 			}))
 
 			req, err := http.NewRequest("GET", "/", nil)
@@ -42,9 +71,321 @@ func TestMiddleware(t *testing.T) {
 			if tt.requestID != "" {
 				req.Header.Set(middleware.RequestIDHeader, tt.requestID)
 			}
+			if tt.correlationID != "" {
+				req.Header.Set(requestid.HeaderCorrelationID, tt.correlationID)
+			}
+			if tt.traceID != "" {
+				req.Header.Set(requestid.HeaderTraceID, tt.traceID)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get(requestid.HeaderCorrelationID); got != tt.expectedCorrelationID {
+				t.Errorf("Unexpected Correlation ID header. Expected: %s, Got: %s", tt.expectedCorrelationID, got)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	injected := "abc\r\ndef <script>" + strings.Repeat("x", 200)
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		policy                string
+		requestID             string
+		traceParent           string
+		expectedReqID         string // generated when empty
+		expectedCorrelationID string // the request ID when empty
+		expectedTraceParent   string // generated when empty
+	}{
+		{
+			policy:                requestid.PolicyEcho,
+			requestID:             injected,
+			traceParent:           "garbage",
+			expectedReqID:         injected,
+			expectedCorrelationID: injected,
+			expectedTraceParent:   "garbage",
+		},
+		{
+			policy:              requestid.PolicySanitize,
+			requestID:           injected,
+			traceParent:         parent,
+			expectedReqID:       ("abcdefscript" + strings.Repeat("x", 200))[:requestid.MaxIDLength],
+			expectedTraceParent: parent,
+		},
+		{
+			policy:      requestid.PolicySanitize,
+			requestID:   "<>",
+			traceParent: "garbage",
+		},
+		{
+			policy:      requestid.PolicyReplace,
+			requestID:   "test-request-id",
+			traceParent: parent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			mw, err := requestid.New(requestid.Config{Policy: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ref *requestid.Context
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ref = requestid.GetContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(middleware.RequestIDHeader, tt.requestID)
+			req.Header.Set(requestid.HeaderTraceParent, tt.traceParent)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.expectedReqID != "" && ref.RequestID != tt.expectedReqID {
+				t.Errorf("Unexpected Request ID. Expected: %q, Got: %q", tt.expectedReqID, ref.RequestID)
+			}
+			if tt.expectedReqID == "" && (ref.RequestID == "" || ref.RequestID == tt.requestID) {
+				t.Errorf("Request ID not generated, Got: %q", ref.RequestID)
+			}
+			expectedCorrelationID := tt.expectedCorrelationID
+			if expectedCorrelationID == "" {
+				expectedCorrelationID = ref.RequestID
+			}
+			if ref.CorrelationID != expectedCorrelationID {
+				t.Errorf("Unexpected Correlation ID. Expected: %q, Got: %q", expectedCorrelationID, ref.CorrelationID)
+			}
+			if tt.expectedTraceParent == "" && (ref.TraceParent == tt.traceParent || !traceParent.MatchString(ref.TraceParent)) {
+				t.Errorf("traceparent not generated, Got: %q", ref.TraceParent)
+			}
+			if tt.expectedTraceParent != "" && ref.TraceParent != tt.expectedTraceParent {
+				t.Errorf("Unexpected traceparent. Expected: %q, Got: %q", tt.expectedTraceParent, ref.TraceParent)
+			}
+			if req.Header.Get(middleware.RequestIDHeader) != tt.requestID {
+				t.Error("The inbound request was modified")
+			}
+		})
+	}
+
+	// Repeated headers are reduced to their first value
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Add(requestid.HeaderCorrelationID, "first")
+	req.Header.Add(requestid.HeaderCorrelationID, "second")
+	rr := httptest.NewRecorder()
+	requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	if got := rr.Header().Values(requestid.HeaderCorrelationID); len(got) != 1 || got[0] != "first" {
+		t.Errorf("Unexpected Correlation ID header. Expected: [first], Got: %q", got)
+	}
+
+	if _, err := requestid.New(requestid.Config{Policy: "strip"}); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+var traceParent = regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-0[01]$`)
+
+func TestTraceContext(t *testing.T) {
+	tests := map[string]struct {
+		headers             map[string]string
+		expectedTraceParent string // generated when empty
+		expectedFlags       string
+	}{
+		"none": {expectedFlags: "01"},
+		"traceparent": {
+			headers:             map[string]string{requestid.HeaderTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", requestid.HeaderB3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1"},
+			expectedTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+		"b3 single": {
+			headers:             map[string]string{requestid.HeaderB3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0-05e3ac9a4f6e3b90"},
+			expectedTraceParent: "00-80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-00",
+		},
+		"b3 multiple": {
+			headers:             map[string]string{requestid.HeaderB3TraceID: "a3ce929d0e0e4736", requestid.HeaderB3SpanID: "00f067aa0ba902b7"},
+			expectedTraceParent: "00-0000000000000000a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		"b3 debug": {
+			headers:             map[string]string{requestid.HeaderB3TraceID: "a3ce929d0e0e4736", requestid.HeaderB3SpanID: "00f067aa0ba902b7", requestid.HeaderB3Sampled: "0", requestid.HeaderB3Flags: "1"},
+			expectedTraceParent: "00-0000000000000000a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		"b3 sampling only": {headers: map[string]string{requestid.HeaderB3: "0"}, expectedFlags: "00"},
+		"b3 malformed":     {headers: map[string]string{requestid.HeaderB3TraceID: "a3ce929d0e0e4736", requestid.HeaderB3SpanID: "xyz"}, expectedFlags: "01"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var ref *requestid.Context
+			handler := requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ref = requestid.GetContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if tt.expectedTraceParent != "" && ref.TraceParent != tt.expectedTraceParent {
+				t.Errorf("Unexpected traceparent. Expected: %q, Got: %q", tt.expectedTraceParent, ref.TraceParent)
+			}
+			if tt.expectedTraceParent == "" && (!traceParent.MatchString(ref.TraceParent) || !strings.HasSuffix(ref.TraceParent, "-"+tt.expectedFlags)) {
+				t.Errorf("Unexpected generated traceparent, Got: %q", ref.TraceParent)
+			}
+			if ref.TraceID != ref.TraceParent[3:35] || rr.Header().Get(requestid.HeaderTraceID) != ref.TraceID {
+				t.Errorf("Unexpected Trace ID, Got: %q", ref.TraceID)
+			}
+
+			headers := ref.Headers()
+			if headers[requestid.HeaderTraceParent] != ref.TraceParent {
+				t.Errorf("traceparent not propagated, Got: %q", headers)
+			}
+			for header, value := range tt.headers {
+				if header == requestid.HeaderB3SpanID && value == "xyz" {
+					value = "" // dropped by PolicySanitize
+				}
+				if headers[http.CanonicalHeaderKey(header)] != value {
+					t.Errorf("Unexpected %s header. Expected: %q, Got: %q", header, value, headers)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyReject(t *testing.T) {
+	var rejected error
+	mw, err := requestid.New(requestid.Config{
+		Policy:  requestid.PolicyReject,
+		Baggage: []string{"X-Tenant-ID"},
+		Reject: func(w http.ResponseWriter, r *http.Request, err error) {
+			rejected = err
+			w.WriteHeader(http.StatusBadRequest)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := map[string]struct {
+		headers map[string][]string
+		valid   bool
+	}{
+		"none":         {valid: true},
+		"well formed":  {headers: map[string][]string{middleware.RequestIDHeader: {"r-1"}, requestid.HeaderTraceParent: {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, requestid.HeaderTraceState: {"vendor=a1"}}, valid: true},
+		"too long":     {headers: map[string][]string{requestid.HeaderCorrelationID: {strings.Repeat("x", requestid.MaxIDLength+1)}}},
+		"characters":   {headers: map[string][]string{requestid.HeaderTraceID: {"t 1"}}},
+		"repeated":     {headers: map[string][]string{middleware.RequestIDHeader: {"r-1", "r-2"}}},
+		"traceparent":  {headers: map[string][]string{requestid.HeaderTraceParent: {"00-xyz"}}},
+		"orphan state": {headers: map[string][]string{requestid.HeaderTraceState: {"vendor=a1"}}},
+		"b3":           {headers: map[string][]string{requestid.HeaderB3: {"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1"}, requestid.HeaderB3Sampled: {"1"}}, valid: true},
+		"b3 single":    {headers: map[string][]string{requestid.HeaderB3: {"80f198ee56343ba8-1"}}},
+		"b3 span":      {headers: map[string][]string{requestid.HeaderB3SpanID: {"E457B5A2E4D86BD1"}}},
+		"baggage":      {headers: map[string][]string{"X-Tenant-Id": {"acme corp"}}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rejected = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for header, values := range tt.headers {
+				for _, value := range values {
+					req.Header.Add(header, value)
+				}
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if tt.valid && (rr.Code != http.StatusOK || rejected != nil) {
+				t.Errorf("Unexpected rejection: %v", rejected)
+			}
+			if !tt.valid && (rr.Code != http.StatusBadRequest || !errors.Is(rejected, requestid.ErrInvalidID)) {
+				t.Errorf("Expected a rejection, Got: %d %v", rr.Code, rejected)
+			}
+		})
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	formats := map[string]*regexp.Regexp{
+		requestid.FormatUUIDv4: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		requestid.FormatUUIDv7: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		requestid.FormatULID:   regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+		requestid.FormatKSUID:  regexp.MustCompile(`^[0-9A-Za-z]{27}$`),
+		requestid.FormatHex:    regexp.MustCompile(`^[0-9a-f]{32}$`),
+	}
+	for format, pattern := range formats {
+		generate, err := requestid.Generator(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := generate()
+		if !pattern.MatchString(first) {
+			t.Errorf("Unexpected %s ID: %q", format, first)
+		}
+		if format == requestid.FormatUUIDv7 || format == requestid.FormatULID {
+			time.Sleep(2 * time.Millisecond)
+			if second := generate(); second <= first {
+				t.Errorf("%s IDs not sortable: %q then %q", format, first, second)
+			}
+		}
+	}
+	if generate, err := requestid.Generator(""); generate != nil || err != nil {
+		t.Errorf("Expected chi's IDs for the empty format, Got: %v", err)
+	}
+	if _, err := requestid.Generator("snowflake"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
 
+	mw, err := requestid.New(requestid.Config{Policy: requestid.PolicySanitize, Generate: func() string { return "generated" }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ref *requestid.Context
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ref = requestid.GetContext(r.Context())
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if ref.RequestID != "generated" || ref.CorrelationID != "generated" {
+		t.Errorf("Unexpected IDs. Expected: generated, Got: %q %q", ref.RequestID, ref.CorrelationID)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(middleware.RequestIDHeader, "r-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if ref.RequestID != "r-1" {
+		t.Errorf("Unexpected Request ID. Expected: r-1, Got: %q", ref.RequestID)
+	}
+}
+
+func TestBaggage(t *testing.T) {
+	for _, policy := range []string{requestid.PolicySanitize, requestid.PolicyReplace} {
+		t.Run(policy, func(t *testing.T) {
+			mw, err := requestid.New(requestid.Config{Policy: policy, Baggage: []string{"x-tenant-id", " X-User-ID"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ref *requestid.Context
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ref = requestid.GetContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Tenant-ID", "acme <corp>")
+			req.Header.Set("X-Other", "ignored")
 			rr := httptest.NewRecorder()
 			handler.ServeHTTP(rr, req)
+
+			expected := map[string]string{"X-Tenant-Id": "acmecorp"}
+			if policy == requestid.PolicyReplace {
+				expected = nil
+			}
+			if len(ref.Baggage) != len(expected) || ref.Baggage["X-Tenant-Id"] != expected["X-Tenant-Id"] {
+				t.Errorf("Unexpected baggage. Expected: %v, Got: %v", expected, ref.Baggage)
+			}
+			if got := rr.Header().Get("X-Tenant-ID"); got != expected["X-Tenant-Id"] {
+				t.Errorf("Unexpected X-Tenant-ID header. Expected: %q, Got: %q", expected["X-Tenant-Id"], got)
+			}
+			if got := ref.Headers()["X-Tenant-Id"]; got != expected["X-Tenant-Id"] {
+				t.Errorf("X-Tenant-ID not propagated. Expected: %q, Got: %q", expected["X-Tenant-Id"], got)
+			}
+			if _, ok := ref.Headers()["X-User-Id"]; ok {
+				t.Error("Unexpected X-User-ID header")
+			}
 		})
 	}
 }
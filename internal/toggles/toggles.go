@@ -0,0 +1,265 @@
+package toggles
+
+// Runtime switches flipped through the authenticated admin endpoint, for
+// the operational tweaks which should not require a restart
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/audit"
+	"github.com/go-obvious/server/keys"
+	"github.com/go-obvious/server/ratelimit"
+	"github.com/go-obvious/server/request"
+)
+
+// MaintenanceRetryAfter is the Retry-After, in seconds, of the responses
+// sent in maintenance mode.
+const MaintenanceRetryAfter = "120"
+
+var (
+	ErrMaintenance = errors.New("service under maintenance")
+	ErrChaos       = errors.New("injected failure")
+	ErrAdminToken  = errors.New("admin token required")
+)
+
+// State of the switches, as served and patched by the endpoint.
+type State struct {
+	LogLevel    string `json:"log_level"`
+	Maintenance bool   `json:"maintenance"`
+
+	// Share of the requests failed with 503 Service Unavailable, and
+	// latency added to every request
+	ChaosErrorRate float64 `json:"chaos_error_rate"`
+	ChaosLatency   string  `json:"chaos_latency"`
+
+	// Scale of the rate limits, omitted without rate limiter
+	RateLimitMultiplier float64 `json:"rate_limit_multiplier,omitempty"`
+}
+
+// patch holds the switches a request flips, the others being nil.
+type patch struct {
+	LogLevel            *string  `json:"log_level"`
+	Maintenance         *bool    `json:"maintenance"`
+	ChaosErrorRate      *float64 `json:"chaos_error_rate"`
+	ChaosLatency        *string  `json:"chaos_latency"`
+	RateLimitMultiplier *float64 `json:"rate_limit_multiplier"`
+}
+
+// Toggles holds the switches. The maintenance mode and the chaos injection
+// are enforced by Middleware, the log level and rate limits directly.
+type Toggles struct {
+	Limiter *ratelimit.Limiter // nil without rate limiter
+	Exempt  []string           // paths neither in maintenance nor failed, with their subpaths, such as the health check
+
+	mu          sync.RWMutex
+	maintenance bool
+	errorRate   float64
+	latency     time.Duration
+}
+
+// State returns the current state of the switches.
+func (t *Toggles) State() State {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	s := State{
+		LogLevel:       logrus.GetLevel().String(),
+		Maintenance:    t.maintenance,
+		ChaosErrorRate: t.errorRate,
+		ChaosLatency:   t.latency.String(),
+	}
+	if t.Limiter != nil {
+		s.RateLimitMultiplier = t.Limiter.Multiplier()
+	}
+	return s
+}
+
+// apply validates and flips the switches of the patch, all or none.
+func (t *Toggles) apply(p patch) error {
+	var level logrus.Level
+	if p.LogLevel != nil {
+		var err error
+		if level, err = logrus.ParseLevel(*p.LogLevel); err != nil {
+			return err
+		}
+	}
+	if p.ChaosErrorRate != nil && (*p.ChaosErrorRate < 0 || *p.ChaosErrorRate > 1) {
+		return errors.New("chaos_error_rate must be between 0 and 1")
+	}
+	var latency time.Duration
+	if p.ChaosLatency != nil {
+		var err error
+		if latency, err = time.ParseDuration(*p.ChaosLatency); err != nil || latency < 0 {
+			return fmt.Errorf("invalid chaos_latency %q", *p.ChaosLatency)
+		}
+	}
+	if p.RateLimitMultiplier != nil {
+		if t.Limiter == nil {
+			return errors.New("rate limiting is disabled")
+		}
+		if *p.RateLimitMultiplier <= 0 {
+			return errors.New("rate_limit_multiplier must be positive")
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p.LogLevel != nil {
+		logrus.SetLevel(level)
+	}
+	if p.Maintenance != nil {
+		t.maintenance = *p.Maintenance
+	}
+	if p.ChaosErrorRate != nil {
+		t.errorRate = *p.ChaosErrorRate
+	}
+	if p.ChaosLatency != nil {
+		t.latency = latency
+	}
+	if p.RateLimitMultiplier != nil {
+		t.Limiter.SetMultiplier(*p.RateLimitMultiplier)
+	}
+	return nil
+}
+
+// Middleware replies 503 Service Unavailable to the requests in
+// maintenance mode, and injects the chaos latency and failures, sparing
+// the Exempt paths.
+func (t *Toggles) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.Exempted(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t.mu.RLock()
+		maintenance, errorRate, latency := t.maintenance, t.errorRate, t.latency
+		t.mu.RUnlock()
+
+		if maintenance {
+			w.Header().Set("Retry-After", MaintenanceRetryAfter)
+			request.ReplyErr(w, r, request.NewHTTPError(ErrMaintenance, http.StatusServiceUnavailable))
+			return
+		}
+		if latency > 0 {
+			timer := time.NewTimer(latency)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		if errorRate > 0 && rand.Float64() < errorRate {
+			request.ReplyErr(w, r, request.NewHTTPError(ErrChaos, http.StatusServiceUnavailable))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Exempted reports whether path is one of the Exempt paths or under one,
+// passed through by Middleware.
+func (t *Toggles) Exempted(path string) bool {
+	for _, prefix := range t.Exempt {
+		if prefix != "" && (path == prefix || strings.HasPrefix(path, prefix+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Endpoint serves the state of the switches on GET and flips the ones of
+// the JSON object sent on PATCH, such as {"maintenance": true}, to the
+// requests presenting one of the tokens as a bearer token. Changes are
+// audited with the ID of the token, keys.ID, so each operator is given
+// their own token.
+func (t *Toggles) Endpoint(tokens []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := authenticate(r, tokens)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			request.ReplyErr(w, r, request.NewHTTPError(ErrAdminToken, http.StatusUnauthorized))
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPatch:
+			var p patch
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&p); err != nil {
+				request.ReplyErr(w, r, request.NewHTTPError(err, http.StatusBadRequest))
+				return
+			}
+			before := t.State()
+			if err := t.apply(p); err != nil {
+				request.ReplyErr(w, r, request.NewHTTPError(err, http.StatusBadRequest))
+				return
+			}
+			auditChanges(r, token, before, t.State())
+		default:
+			w.Header().Set("Allow", "GET, PATCH")
+			request.ReplyErr(w, r, request.NewHTTPError(
+				errors.New(http.StatusText(http.StatusMethodNotAllowed)), http.StatusMethodNotAllowed))
+			return
+		}
+		request.Reply(r, w, t.State(), http.StatusOK)
+	})
+}
+
+func authenticate(r *http.Request, tokens []string) (string, bool) {
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || presented == "" {
+		return "", false
+	}
+	for _, token := range tokens {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// auditChanges logs the switches changed, whatever the log level, and
+// records them in the audit trail.
+func auditChanges(r *http.Request, token string, before, after State) {
+	changes := logrus.Fields{}
+	changed := func(name string, from, to interface{}) {
+		if from != to {
+			changes[name] = fmt.Sprintf("%v -> %v", from, to)
+		}
+	}
+	changed("log_level", before.LogLevel, after.LogLevel)
+	changed("maintenance", before.Maintenance, after.Maintenance)
+	changed("chaos_error_rate", before.ChaosErrorRate, after.ChaosErrorRate)
+	changed("chaos_latency", before.ChaosLatency, after.ChaosLatency)
+	changed("rate_limit_multiplier", before.RateLimitMultiplier, after.RateLimitMultiplier)
+
+	std := logrus.StandardLogger()
+	l := &logrus.Logger{
+		Out:          std.Out,
+		Hooks:        std.Hooks,
+		Formatter:    std.Formatter,
+		ReportCaller: std.ReportCaller,
+		ExitFunc:     std.ExitFunc,
+		Level:        logrus.InfoLevel,
+	}
+	l.WithFields(request.Logger(r).Data).WithFields(logrus.Fields{
+		"audit":   true,
+		"admin":   keys.ID([]byte(token)),
+		"remote":  r.RemoteAddr,
+		"changes": changes,
+	}).Info("runtime toggles changed")
+	details := make(map[string]interface{}, len(changes))
+	for name, change := range changes {
+		details[name] = change
+	}
+	audit.Record(r, audit.Event{Type: audit.TypeAdminAction, Actor: keys.ID([]byte(token)), Details: details})
+}
@@ -0,0 +1,107 @@
+package toggles_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/toggles"
+	"github.com/go-obvious/server/keys"
+	"github.com/go-obvious/server/ratelimit"
+)
+
+func TestEndpoint(t *testing.T) {
+	hook := test.NewGlobal()
+	logrus.SetLevel(logrus.InfoLevel)
+	t.Cleanup(func() { logrus.SetLevel(logrus.InfoLevel) })
+
+	limiter := ratelimit.New(ratelimit.Config{Rate: 10})
+	tg := &toggles.Toggles{Limiter: limiter, Exempt: []string{"/healthz"}}
+	endpoint := tg.Endpoint([]string{"alice-token", "bob-token"})
+	call := func(method, token, body string) (*httptest.ResponseRecorder, toggles.State) {
+		r := httptest.NewRequest(method, "/admin/toggles", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		endpoint.ServeHTTP(rr, r)
+		var state toggles.State
+		_ = json.Unmarshal(rr.Body.Bytes(), &state)
+		return rr, state
+	}
+
+	rr, _ := call(http.MethodGet, "", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr, _ = call(http.MethodGet, "eve-token", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr, state := call(http.MethodGet, "alice-token", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, toggles.State{LogLevel: "info", ChaosLatency: "0s", RateLimitMultiplier: 1}, state)
+
+	rr, state = call(http.MethodPatch, "bob-token", `{"log_level": "debug", "maintenance": true, "rate_limit_multiplier": 2}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, toggles.State{LogLevel: "debug", Maintenance: true, ChaosLatency: "0s", RateLimitMultiplier: 2}, state)
+	assert.Equal(t, logrus.DebugLevel, logrus.GetLevel())
+	assert.Equal(t, 2.0, limiter.Multiplier())
+
+	audit := hook.LastEntry()
+	require.NotNil(t, audit)
+	assert.Equal(t, keys.ID([]byte("bob-token")), audit.Data["admin"])
+	assert.Equal(t, logrus.Fields{
+		"log_level":             "info -> debug",
+		"maintenance":           "false -> true",
+		"rate_limit_multiplier": "1 -> 2",
+	}, audit.Data["changes"])
+
+	rr, _ = call(http.MethodPatch, "bob-token", `{"maintenance": false, "chaos_error_rate": 2}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.True(t, tg.State().Maintenance, "invalid patches change nothing")
+
+	rr, _ = call(http.MethodDelete, "bob-token", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestMiddleware(t *testing.T) {
+	tg := &toggles.Toggles{Exempt: []string{"/healthz"}}
+	endpoint := tg.Endpoint([]string{"token"})
+	patch := func(body string) {
+		r := httptest.NewRequest(http.MethodPatch, "/admin/toggles", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		endpoint.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	}
+	handler := tg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	assert.Equal(t, http.StatusOK, get("/orders").Code)
+
+	patch(`{"maintenance": true}`)
+	rr := get("/orders")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, toggles.MaintenanceRetryAfter, rr.Header().Get("Retry-After"))
+	assert.Contains(t, rr.Body.String(), toggles.ErrMaintenance.Error())
+	assert.Equal(t, http.StatusOK, get("/healthz").Code, "exempt paths are served")
+	assert.Equal(t, http.StatusOK, get("/healthz/ready").Code, "exempt paths are served")
+	assert.Equal(t, http.StatusServiceUnavailable, get("/healthzX").Code, "exempt paths match whole segments")
+
+	patch(`{"maintenance": false, "chaos_error_rate": 1, "chaos_latency": "1ms"}`)
+	rr = get("/orders")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), toggles.ErrChaos.Error())
+
+	patch(`{"chaos_error_rate": 0}`)
+	assert.Equal(t, http.StatusOK, get("/orders").Code)
+}
@@ -0,0 +1,163 @@
+package tuning
+
+// Sizes the Go runtime to the cgroup limits of the container, GOMAXPROCS to
+// the CPU quota, so the scheduler does not run more threads than the quota
+// allows and get throttled, and the soft memory limit to a ratio of the
+// memory limit, so the GC works harder before the container is OOM killed
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi"
+
+	"github.com/go-obvious/server/request"
+)
+
+// CgroupRoot is where the cgroup filesystem is mounted, the container's own
+// cgroup with cgroup namespaces.
+const CgroupRoot = "/sys/fs/cgroup"
+
+// Limits are the limits of a cgroup, zero when unlimited.
+type Limits struct {
+	CPU    float64 `json:"cpu,omitempty"`    // cores
+	Memory int64   `json:"memory,omitempty"` // bytes
+}
+
+// ReadLimits reads the limits of the cgroup mounted at root, cgroup v2 then
+// v1.
+func ReadLimits(root string) (Limits, error) {
+	var l Limits
+	if cpuMax, err := readFile(root, "cpu.max"); err == nil {
+		// "max 100000" or "<quota> <period>"
+		if fields := strings.Fields(cpuMax); len(fields) == 2 && fields[0] != "max" {
+			l.CPU = ratio(fields[0], fields[1])
+		}
+		if memory, err := readFile(root, "memory.max"); err == nil && memory != "max" {
+			l.Memory, _ = strconv.ParseInt(memory, 10, 64)
+		}
+		return l, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return l, err
+	}
+	quota, err := readFile(root, "cpu", "cpu.cfs_quota_us")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return l, err
+	}
+	if period, err := readFile(root, "cpu", "cpu.cfs_period_us"); err == nil && quota != "-1" {
+		l.CPU = ratio(quota, period)
+	}
+	if memory, err := readFile(root, "memory", "memory.limit_in_bytes"); err == nil {
+		// Unlimited reads as a page-aligned maximum int64
+		if n, err := strconv.ParseInt(memory, 10, 64); err == nil && n < math.MaxInt64/2 {
+			l.Memory = n
+		}
+	}
+	return l, nil
+}
+
+func readFile(elem ...string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(elem...))
+	return strings.TrimSpace(string(data)), err
+}
+
+func ratio(quota, period string) float64 {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return q / p
+}
+
+// Settings are the runtime settings resolved at startup, and where they come
+// from: "cgroup", "env" when set by GOMAXPROCS or GOMEMLIMIT, or "default".
+type Settings struct {
+	Limits           Limits `json:"cgroup"`
+	GOMAXPROCS       int    `json:"gomaxprocs"`
+	GOMAXPROCSSource string `json:"gomaxprocs_source"`
+	GOMEMLIMIT       int64  `json:"gomemlimit,omitempty"`
+	GOMEMLIMITSource string `json:"gomemlimit_source"`
+}
+
+var (
+	mu      sync.Mutex
+	applied = Settings{GOMAXPROCSSource: "default", GOMEMLIMITSource: "default"}
+)
+
+// Apply sets GOMAXPROCS to the CPU limit rounded down, at least 1, when
+// maxProcs, and the soft memory limit to memoryRatio of the memory limit
+// when above zero. The GOMAXPROCS and GOMEMLIMIT environment variables take
+// precedence.
+func Apply(limits Limits, maxProcs bool, memoryRatio float64) Settings {
+	mu.Lock()
+	defer mu.Unlock()
+	s := Settings{Limits: limits, GOMAXPROCSSource: "default", GOMEMLIMITSource: "default"}
+	switch {
+	case os.Getenv("GOMAXPROCS") != "":
+		s.GOMAXPROCSSource = "env"
+	case maxProcs && limits.CPU > 0:
+		runtime.GOMAXPROCS(max(1, int(math.Floor(limits.CPU))))
+		s.GOMAXPROCSSource = "cgroup"
+	}
+	s.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	switch {
+	case os.Getenv("GOMEMLIMIT") != "":
+		s.GOMEMLIMITSource = "env"
+	case memoryRatio > 0 && limits.Memory > 0:
+		debug.SetMemoryLimit(int64(float64(limits.Memory) * memoryRatio))
+		s.GOMEMLIMITSource = "cgroup"
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		s.GOMEMLIMIT = limit
+	}
+	applied = s
+	return s
+}
+
+// Info is the runtime information served by Endpoint.
+type Info struct {
+	Settings
+	GoVersion  string `json:"go_version"`
+	NumCPU     int    `json:"num_cpu"`
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	Sys        uint64 `json:"sys"`
+}
+
+// Current returns the runtime information, GOMAXPROCS as it currently is.
+func Current() Info {
+	mu.Lock()
+	s := applied
+	mu.Unlock()
+	s.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return Info{
+		Settings:   s,
+		GoVersion:  runtime.Version(),
+		NumCPU:     runtime.NumCPU(),
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  stats.HeapAlloc,
+		Sys:        stats.Sys,
+	}
+}
+
+func Endpoint() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		request.Reply(r, w, Current(), http.StatusOK)
+	})
+	return r
+}
@@ -0,0 +1,114 @@
+package tuning_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/tuning"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content+"\n"), 0o644))
+	}
+	return root
+}
+
+func TestReadLimits(t *testing.T) {
+	cases := map[string]struct {
+		files map[string]string
+		want  tuning.Limits
+	}{
+		"v2": {
+			files: map[string]string{"cpu.max": "250000 100000", "memory.max": "536870912"},
+			want:  tuning.Limits{CPU: 2.5, Memory: 512 << 20},
+		},
+		"v2 unlimited": {
+			files: map[string]string{"cpu.max": "max 100000", "memory.max": "max"},
+		},
+		"v1": {
+			files: map[string]string{
+				"cpu/cpu.cfs_quota_us":         "150000",
+				"cpu/cpu.cfs_period_us":        "100000",
+				"memory/memory.limit_in_bytes": "1073741824",
+			},
+			want: tuning.Limits{CPU: 1.5, Memory: 1 << 30},
+		},
+		"v1 unlimited": {
+			files: map[string]string{
+				"cpu/cpu.cfs_quota_us":         "-1",
+				"cpu/cpu.cfs_period_us":        "100000",
+				"memory/memory.limit_in_bytes": "9223372036854771712",
+			},
+		},
+		"no cgroup": {},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			limits, err := tuning.ReadLimits(writeFiles(t, c.files))
+			require.NoError(t, err)
+			assert.Equal(t, c.want, limits)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	memLimit := debug.SetMemoryLimit(-1)
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(procs)
+		debug.SetMemoryLimit(memLimit)
+	})
+	t.Setenv("GOMAXPROCS", "")
+	t.Setenv("GOMEMLIMIT", "")
+
+	s := tuning.Apply(tuning.Limits{CPU: 1.5, Memory: 1 << 30}, true, 0.5)
+	assert.Equal(t, 1, s.GOMAXPROCS, "rounded down")
+	assert.Equal(t, 1, runtime.GOMAXPROCS(0))
+	assert.Equal(t, "cgroup", s.GOMAXPROCSSource)
+	assert.Equal(t, int64(512<<20), s.GOMEMLIMIT)
+	assert.Equal(t, int64(512<<20), debug.SetMemoryLimit(-1))
+	assert.Equal(t, "cgroup", s.GOMEMLIMITSource)
+
+	s = tuning.Apply(tuning.Limits{CPU: 0.5}, true, 0.5)
+	assert.Equal(t, 1, s.GOMAXPROCS, "at least 1")
+
+	debug.SetMemoryLimit(math.MaxInt64)
+	s = tuning.Apply(tuning.Limits{CPU: 2}, false, 0)
+	assert.Equal(t, "default", s.GOMAXPROCSSource)
+	assert.Equal(t, "default", s.GOMEMLIMITSource)
+	assert.Zero(t, s.GOMEMLIMIT)
+
+	t.Setenv("GOMAXPROCS", "3")
+	t.Setenv("GOMEMLIMIT", "1GiB")
+	s = tuning.Apply(tuning.Limits{CPU: 2, Memory: 1 << 30}, true, 0.5)
+	assert.Equal(t, "env", s.GOMAXPROCSSource)
+	assert.Equal(t, "env", s.GOMEMLIMITSource)
+	assert.Zero(t, s.GOMEMLIMIT, "left to the runtime")
+}
+
+func TestEndpoint(t *testing.T) {
+	rr := httptest.NewRecorder()
+	tuning.Endpoint().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var info tuning.Info
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &info))
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, runtime.GOMAXPROCS(0), info.GOMAXPROCS)
+	assert.NotZero(t, info.Goroutines)
+	assert.NotEmpty(t, info.GOMAXPROCSSource)
+}
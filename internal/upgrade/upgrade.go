@@ -0,0 +1,212 @@
+package upgrade
+
+// Zero-downtime restarts: the listening sockets are handed over to a new
+// process of the same binary, which reports ready before the old process
+// drains, so no connection is refused in between
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment of the new process, naming the inherited descriptors
+const (
+	EnvListeners = "SERVER_UPGRADE_LISTENERS" // addr=fd pairs, comma separated
+	EnvReady     = "SERVER_UPGRADE_READY_FD"
+)
+
+var (
+	ErrUpgrading = errors.New("an upgrade is already in progress")
+	ErrNotReady  = errors.New("the new process exited before being ready")
+)
+
+// Upgrader records the listeners so they may be handed over, and takes
+// over those of the previous process when started by Upgrade.
+type Upgrader struct {
+	Timeout time.Duration // for the new process to report ready, 30s when zero
+
+	mu        sync.Mutex
+	inherited map[string]*os.File
+	ready     *os.File
+	listeners map[string]*net.TCPListener
+	upgrading bool
+}
+
+// New returns the Upgrader of the process, with the listeners and the
+// readiness pipe inherited from the previous process, if any.
+func New() (*Upgrader, error) {
+	u := &Upgrader{inherited: map[string]*os.File{}, listeners: map[string]*net.TCPListener{}}
+	if pairs := os.Getenv(EnvListeners); pairs != "" {
+		for _, pair := range strings.Split(pairs, ",") {
+			addr, fd, ok := strings.Cut(pair, "=")
+			n, err := strconv.Atoi(fd)
+			if !ok || err != nil {
+				return nil, fmt.Errorf("malformed %s %q", EnvListeners, pair)
+			}
+			u.inherited[addr] = os.NewFile(uintptr(n), addr)
+		}
+	}
+	if fd := os.Getenv(EnvReady); fd != "" {
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s %q", EnvReady, fd)
+		}
+		u.ready = os.NewFile(uintptr(n), "ready")
+	}
+	return u, nil
+}
+
+// Inherited reports whether the process was started by Upgrade.
+func (u *Upgrader) Inherited() bool {
+	return u.ready != nil
+}
+
+// Listen returns the listener inherited for addr, or listens on it over
+// network, as net.Listen.
+func (u *Upgrader) Listen(network, addr string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var (
+		l   net.Listener
+		err error
+	)
+	if f, ok := u.inherited[addr]; ok {
+		delete(u.inherited, addr)
+		l, err = net.FileListener(f)
+		_ = f.Close()
+	} else {
+		l, err = net.Listen(network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tcp, ok := l.(*net.TCPListener); ok {
+		u.listeners[addr] = tcp
+	}
+	return l, nil
+}
+
+// Ready tells the previous process the listeners are served, so it may
+// drain. The listeners not taken over are closed.
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for addr, f := range u.inherited {
+		_ = f.Close()
+		delete(u.inherited, addr)
+	}
+	if u.ready == nil {
+		return nil
+	}
+	_, err := u.ready.Write([]byte{1})
+	_ = u.ready.Close()
+	u.ready = nil
+	return err
+}
+
+// Upgrade starts a new process of the binary, with the same arguments and
+// environment, handing the listeners over, and returns once it is ready.
+// On error, the new process is killed and this one keeps serving.
+func (u *Upgrader) Upgrade() error {
+	u.mu.Lock()
+	if u.upgrading {
+		u.mu.Unlock()
+		return ErrUpgrading
+	}
+	u.upgrading = true
+	files := make([]*os.File, 0, len(u.listeners)+1)
+	pairs := make([]string, 0, len(u.listeners))
+	var err error
+	for addr, l := range u.listeners {
+		var f *os.File
+		if f, err = l.File(); err != nil {
+			break
+		}
+		// The descriptors of ExtraFiles start at 3
+		pairs = append(pairs, fmt.Sprintf("%s=%d", addr, 3+len(files)))
+		files = append(files, f)
+	}
+	u.mu.Unlock()
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+		u.mu.Lock()
+		u.upgrading = false
+		u.mu.Unlock()
+	}()
+	if err != nil {
+		return err
+	}
+
+	ready, notify, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		_ = notify.Close()
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, notify)
+	cmd.Env = append(environ(),
+		EnvListeners+"="+strings.Join(pairs, ","),
+		fmt.Sprintf("%s=%d", EnvReady, 3+len(files)),
+	)
+	err = cmd.Start()
+	_ = notify.Close()
+	if err != nil {
+		return err
+	}
+	go func() {
+		// Reaps the new process should it exit
+		_ = cmd.Wait()
+	}()
+
+	result := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if n, _ := ready.Read(buf); n == 1 {
+			result <- nil
+			return
+		}
+		result <- ErrNotReady
+	}()
+	timeout := u.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-result:
+	case <-timer.C:
+		err = fmt.Errorf("the new process was not ready within %s", timeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+	}
+	return err
+}
+
+// environ returns the environment without the variables of a previous
+// upgrade.
+func environ() []string {
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, EnvListeners+"=") && !strings.HasPrefix(kv, EnvReady+"=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
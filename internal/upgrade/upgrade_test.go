@@ -0,0 +1,92 @@
+package upgrade_test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/upgrade"
+)
+
+const (
+	addr    = "127.0.0.1:0"
+	envMode = "UPGRADE_TEST_MODE"
+)
+
+// TestMain runs the test binary as the new process when started by
+// Upgrade.
+func TestMain(m *testing.M) {
+	if os.Getenv(upgrade.EnvReady) != "" {
+		newProcess()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// newProcess serves one request on the inherited listener, or exits
+// without being ready.
+func newProcess() {
+	if os.Getenv(envMode) == "fail" {
+		os.Exit(1)
+	}
+	u, err := upgrade.New()
+	if err != nil {
+		os.Exit(1)
+	}
+	l, err := u.Listen("tcp", addr)
+	if err != nil {
+		os.Exit(1)
+	}
+	served := make(chan struct{})
+	go func() {
+		_ = http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("new process"))
+			close(served)
+		}))
+	}()
+	if err := u.Ready(); err != nil {
+		os.Exit(1)
+	}
+	select {
+	case <-served:
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(10 * time.Second):
+	}
+	os.Exit(0)
+}
+
+func TestUpgrade(t *testing.T) {
+	u, err := upgrade.New()
+	require.NoError(t, err)
+	assert.False(t, u.Inherited())
+	l, err := u.Listen("tcp", addr)
+	require.NoError(t, err)
+	url := "http://" + l.Addr().String()
+
+	require.NoError(t, u.Upgrade())
+	require.NoError(t, l.Close(), "the old process stops accepting")
+
+	resp, err := http.Get(url)
+	require.NoError(t, err, "the socket outlives the old listener")
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "new process", string(body))
+}
+
+func TestUpgradeNotReady(t *testing.T) {
+	t.Setenv(envMode, "fail")
+	u, err := upgrade.New()
+	require.NoError(t, err)
+	l, err := u.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.ErrorIs(t, u.Upgrade(), upgrade.ErrNotReady)
+	u.Timeout = time.Millisecond
+	assert.Error(t, u.Upgrade(), "may be retried")
+}
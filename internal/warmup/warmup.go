@@ -0,0 +1,126 @@
+package warmup
+
+// Runs the warmup functions of the APIs, readiness failing until they complete
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrWarmingUp = errors.New("server is warming up")
+
+// Func primes a resource, such as a cache or templates, before the server
+// is ready.
+type Func func(ctx context.Context) error
+
+// Tracker holds the warmup functions and their progress. The zero value is
+// ready to use.
+type Tracker struct {
+	mu       sync.Mutex
+	names    []string
+	funcs    map[string]Func
+	done     map[string]bool
+	finished bool // all done or timed out
+}
+
+// Add registers a warmup function, replacing the one of the same name.
+func (t *Tracker) Add(name string, fn Func) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.funcs == nil {
+		t.funcs = make(map[string]Func)
+	}
+	if _, ok := t.funcs[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.funcs[name] = fn
+}
+
+// Run runs the warmup functions concurrently and returns once they all
+// completed, or timeout elapsed or ctx is done, whichever comes first. A
+// zero timeout waits indefinitely. Failures are logged, a failed function
+// does not hold readiness back.
+func (t *Tracker) Run(ctx context.Context, timeout time.Duration) {
+	t.mu.Lock()
+	funcs := make(map[string]Func, len(t.funcs))
+	for name, fn := range t.funcs {
+		funcs[name] = fn
+	}
+	t.done = make(map[string]bool, len(funcs))
+	t.mu.Unlock()
+	defer t.finish()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	completed := make(chan struct{})
+	var wg sync.WaitGroup
+	for name, fn := range funcs {
+		wg.Add(1)
+		go func(name string, fn Func) {
+			defer wg.Done()
+			start := time.Now()
+			err := fn(ctx)
+			log := logrus.WithFields(logrus.Fields{"warmup": name, "duration": time.Since(start)})
+			if err != nil {
+				log.WithError(err).Warn("warmup failed")
+			} else {
+				log.Debug("warmup done")
+			}
+			t.mu.Lock()
+			t.done[name] = true
+			t.mu.Unlock()
+		}(name, fn)
+	}
+	go func() {
+		wg.Wait()
+		close(completed)
+	}()
+
+	select {
+	case <-completed:
+	case <-ctx.Done():
+		logrus.WithField("pending", t.pending()).Warn("warmup timed out, the server is ready nonetheless")
+	}
+}
+
+func (t *Tracker) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.finished = true
+}
+
+// pending returns the names of the functions still running.
+func (t *Tracker) pending() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var pending []string
+	for _, name := range t.names {
+		if !t.done[name] {
+			pending = append(pending, name)
+		}
+	}
+	return pending
+}
+
+// Ready is a health check failing until the warmup finished, its error
+// reporting the progress.
+func (t *Tracker) Ready() error {
+	t.mu.Lock()
+	finished, total := t.finished, len(t.names)
+	t.mu.Unlock()
+	if finished || total == 0 {
+		return nil
+	}
+	pending := t.pending()
+	return fmt.Errorf("%w: %d/%d done, pending %s", ErrWarmingUp, total-len(pending), total, strings.Join(pending, ", "))
+}
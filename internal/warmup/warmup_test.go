@@ -0,0 +1,49 @@
+package warmup_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/internal/warmup"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := &warmup.Tracker{}
+	assert.NoError(t, tracker.Ready(), "nothing to warm up")
+
+	release := make(chan struct{})
+	tracker.Add("cache", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	tracker.Add("templates", func(ctx context.Context) error { return nil })
+
+	ran := make(chan struct{})
+	go func() {
+		tracker.Run(context.Background(), 0)
+		close(ran)
+	}()
+	assert.Eventually(t, func() bool {
+		err := tracker.Ready()
+		return err != nil && err.Error() == "server is warming up: 1/2 done, pending cache"
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(t, tracker.Ready(), warmup.ErrWarmingUp)
+
+	close(release)
+	<-ran
+	assert.NoError(t, tracker.Ready())
+}
+
+func TestTrackerTimeout(t *testing.T) {
+	tracker := &warmup.Tracker{}
+	tracker.Add("stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	tracker.Run(context.Background(), 20*time.Millisecond)
+	assert.NoError(t, tracker.Ready(), "readiness is no longer held back once timed out")
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package winsvc
+
+// Windows service control, not available on this platform
+
+import (
+	"context"
+	"time"
+)
+
+// Service reports the state of the server to the service control manager.
+type Service struct{}
+
+// Start returns a nil Service, the process not running as a Windows
+// service.
+func Start(ctx context.Context, _ time.Duration) (context.Context, *Service) {
+	return ctx, nil
+}
+
+// Running reports the server serving, accepting the stop requests.
+func (s *Service) Running() {}
+
+// Stopped reports the server stopped, returning once reported.
+func (s *Service) Stopped() {}
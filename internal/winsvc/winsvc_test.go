@@ -0,0 +1,20 @@
+package winsvc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/internal/winsvc"
+)
+
+func TestStartNotService(t *testing.T) {
+	ctx := context.Background()
+	started, s := winsvc.Start(ctx, time.Second)
+	assert.Nil(t, s, "the tests do not run as a service")
+	assert.Equal(t, ctx, started)
+	s.Running()
+	s.Stopped()
+}
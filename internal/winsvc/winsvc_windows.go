@@ -0,0 +1,103 @@
+package winsvc
+
+// Windows service control: the stop and shutdown requests of the service
+// control manager cancel the context the server runs with, and the state of
+// the service follows that of the server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+)
+
+// Service reports the state of the server to the service control manager.
+type Service struct {
+	StopHint time.Duration // expected duration of the shutdown, reported when stopping
+
+	cancel  context.CancelFunc
+	running chan struct{}
+	stopped chan struct{}
+	exited  chan struct{}
+}
+
+// New returns a Service canceling ctx when asked to stop, not yet started.
+func New(ctx context.Context) (context.Context, *Service) {
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, &Service{
+		cancel:  cancel,
+		running: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start connects to the service control manager when the process runs as
+// a Windows service, returning a nil Service otherwise.
+func Start(ctx context.Context, stopHint time.Duration) (context.Context, *Service) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		logrus.WithError(err).Warn("error while detecting the Windows service")
+	}
+	if !isService {
+		return ctx, nil
+	}
+	ctx, s := New(ctx)
+	s.StopHint = stopHint
+	s.exited = make(chan struct{})
+	go func() {
+		defer close(s.exited)
+		// The name is ignored for the services running in their own process
+		name := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+		if err := svc.Run(name, s); err != nil {
+			logrus.WithError(err).Error("error while running as a Windows service")
+		}
+	}()
+	return ctx, s
+}
+
+// Running reports the server serving, accepting the stop requests.
+func (s *Service) Running() {
+	if s != nil {
+		close(s.running)
+	}
+}
+
+// Stopped reports the server stopped, returning once reported.
+func (s *Service) Stopped() {
+	if s == nil {
+		return
+	}
+	s.cancel()
+	close(s.stopped)
+	if s.exited != nil {
+		<-s.exited
+	}
+}
+
+// Execute implements svc.Handler.
+func (s *Service) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	running := s.running
+	for {
+		select {
+		case <-running:
+			running = nil
+			status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				logrus.Info("Received service stop request")
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32(s.StopHint.Milliseconds())}
+				s.cancel()
+			}
+		case <-s.stopped:
+			return false, 0
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package winsvc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows/svc"
+
+	"github.com/go-obvious/server/internal/winsvc"
+)
+
+func TestExecute(t *testing.T) {
+	ctx, s := winsvc.New(context.Background())
+	s.StopHint = 30 * time.Second
+	requests := make(chan svc.ChangeRequest)
+	status := make(chan svc.Status, 1)
+	exited := make(chan struct{})
+	go func() {
+		s.Execute(nil, requests, status)
+		close(exited)
+	}()
+
+	assert.Equal(t, svc.StartPending, (<-status).State)
+	s.Running()
+	running := <-status
+	assert.Equal(t, svc.Running, running.State)
+	assert.Equal(t, svc.AcceptStop|svc.AcceptShutdown, running.Accepts)
+
+	requests <- svc.ChangeRequest{Cmd: svc.Interrogate, CurrentStatus: running}
+	assert.Equal(t, running, <-status)
+	assert.NoError(t, ctx.Err())
+
+	requests <- svc.ChangeRequest{Cmd: svc.Stop}
+	stopping := <-status
+	assert.Equal(t, svc.StopPending, stopping.State)
+	assert.Equal(t, uint32(30000), stopping.WaitHint)
+	<-ctx.Done()
+
+	s.Stopped()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the service did not stop")
+	}
+}
@@ -0,0 +1,233 @@
+package keys
+
+// Versioned keys of the signing and encryption material, tagged with their
+// ID so what the previous keys issued stays valid during a rotation
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/redact"
+	"github.com/go-obvious/server/secrets"
+)
+
+var (
+	ErrNoKey            = errors.New("no key")
+	ErrUnknownKey       = errors.New("unknown key")
+	ErrInvalidKey       = errors.New("invalid key")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Key is a version of the material, identified by ID in what it signed or
+// encrypted.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ID returns the identifier of a secret, the same wherever it is loaded so
+// the instances of a service agree on it without configuring it.
+func ID(secret []byte) string {
+	sum := sha256.Sum256(append([]byte("key-id:"), secret...))
+	return hex.EncodeToString(sum[:4])
+}
+
+// AEAD returns the AES-256-GCM cipher keyed by the hash of the secret.
+func (k Key) AEAD() (cipher.AEAD, error) {
+	sum := sha256.Sum256(k.Secret)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Ring holds the versions of a key, the current one signing and encrypting
+// and all of them verifying and decrypting. The zero value is an empty
+// ring, safe for concurrent use.
+//
+//	ring := keys.FromSecrets(os.Getenv("APP_SIGNING_KEY"), os.Getenv("APP_SIGNING_KEY_PREVIOUS"))
+//	tag, _ := ring.Sign([]byte(url))
+//	err := ring.Verify([]byte(url), tag)
+type Ring struct {
+	mu   sync.RWMutex
+	keys []Key
+}
+
+// New returns a ring of the keys, the first one being the current one.
+func New(keys ...Key) (*Ring, error) {
+	r := &Ring{}
+	if err := r.Set(keys...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// FromSecrets returns a ring of the secrets, the first one being the
+// current one, identified by their ID. Empty secrets are skipped.
+func FromSecrets(secrets ...string) *Ring {
+	r := &Ring{}
+	_ = r.Set(fromSecrets(secrets)...)
+	return r
+}
+
+func fromSecrets(secrets []string) []Key {
+	keys := make([]Key, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret != "" {
+			keys = append(keys, Key{ID: ID([]byte(secret)), Secret: []byte(secret)})
+		}
+	}
+	return keys
+}
+
+// Set replaces the keys of the ring, the first one being the current one.
+// IDs must be unique and free of dots, which separate them from what they
+// tag.
+func (r *Ring) Set(keys ...Key) error {
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k.ID == "" || strings.Contains(k.ID, ".") || seen[k.ID] || len(k.Secret) == 0 {
+			return fmt.Errorf("%w %q", ErrInvalidKey, k.ID)
+		}
+		seen[k.ID] = true
+	}
+	for _, k := range keys {
+		redact.AddValue(string(k.Secret))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append([]Key(nil), keys...)
+	return nil
+}
+
+// Rotate makes k the current key, the previous ones still verifying and
+// decrypting until retired.
+func (r *Ring) Rotate(k Key) error {
+	keys := append([]Key{k}, r.Keys()...)
+	for i := 1; i < len(keys); i++ {
+		if keys[i].ID == k.ID {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	return r.Set(keys...)
+}
+
+// Retire removes the key, once what it signed or encrypted expired.
+func (r *Ring) Retire(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, k := range r.keys {
+		if k.ID == id {
+			r.keys = append(r.keys[:i:i], r.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Keys returns the keys, the current one first.
+func (r *Ring) Keys() []Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Key(nil), r.keys...)
+}
+
+// Current returns the key signing and encrypting.
+func (r *Ring) Current() (Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.keys) == 0 {
+		return Key{}, ErrNoKey
+	}
+	return r.keys[0], nil
+}
+
+// Lookup returns the key of the ID.
+func (r *Ring) Lookup(id string) (Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if k.ID == id {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// Load replaces the keys with the secrets the references resolve to, such
+// as "vault://secret/data/app#signing" or "file:///run/secrets/signing",
+// the first one being the current one.
+func (r *Ring) Load(ctx context.Context, refs ...string) error {
+	resolved := make([]string, len(refs))
+	for i, ref := range refs {
+		secret, err := secrets.Resolve(ctx, ref)
+		if err != nil {
+			return err
+		}
+		resolved[i] = secret
+	}
+	return r.Set(fromSecrets(resolved)...)
+}
+
+// Watch loads the keys every interval until ctx is done, picking up the
+// rotations made in the secrets provider. Failed loads keep the keys.
+func (r *Ring) Watch(ctx context.Context, interval time.Duration, refs ...string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Load(ctx, refs...); err != nil {
+				logrus.WithError(redact.Error(err)).Warn("error while reloading the keys")
+			}
+		}
+	}
+}
+
+// Sign returns the tag of data, the ID of the current key followed by the
+// HMAC-SHA256 of data, "<id>.<mac>".
+func (r *Ring) Sign(data []byte) (string, error) {
+	k, err := r.Current()
+	if err != nil {
+		return "", err
+	}
+	return k.ID + "." + mac(k, data), nil
+}
+
+// Verify checks the tag of data was returned by Sign with one of the keys,
+// failing with ErrUnknownKey once the key was retired.
+func (r *Ring) Verify(data []byte, tag string) error {
+	id, sig, ok := strings.Cut(tag, ".")
+	if !ok {
+		return ErrInvalidSignature
+	}
+	k, ok := r.Lookup(id)
+	if !ok {
+		return ErrUnknownKey
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(k, data))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func mac(k Key, data []byte) string {
+	h := hmac.New(sha256.New, k.Secret)
+	h.Write(data)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
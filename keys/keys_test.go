@@ -0,0 +1,60 @@
+package keys_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/keys"
+)
+
+func TestRing(t *testing.T) {
+	ring := keys.FromSecrets("first-secret")
+	tag, err := ring.Sign([]byte("/exports/42?expires=1700000000"))
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}\.`, tag)
+	assert.NoError(t, ring.Verify([]byte("/exports/42?expires=1700000000"), tag))
+	assert.ErrorIs(t, ring.Verify([]byte("/exports/43?expires=1700000000"), tag), keys.ErrInvalidSignature)
+
+	// Rotated, the tags of the previous key still verify
+	require.NoError(t, ring.Rotate(keys.Key{ID: "v2", Secret: []byte("second-secret")}))
+	current, err := ring.Current()
+	require.NoError(t, err)
+	assert.Equal(t, "v2", current.ID)
+	assert.NoError(t, ring.Verify([]byte("/exports/42?expires=1700000000"), tag))
+	rotated, err := ring.Sign([]byte("data"))
+	require.NoError(t, err)
+	assert.Regexp(t, `^v2\.`, rotated)
+
+	// Retired, they do not
+	ring.Retire(keys.ID([]byte("first-secret")))
+	assert.ErrorIs(t, ring.Verify([]byte("/exports/42?expires=1700000000"), tag), keys.ErrUnknownKey)
+	assert.Len(t, ring.Keys(), 1)
+
+	assert.ErrorIs(t, ring.Set(keys.Key{ID: "a.b", Secret: []byte("x")}), keys.ErrInvalidKey)
+	assert.ErrorIs(t, ring.Set(keys.Key{ID: "a", Secret: []byte("x")}, keys.Key{ID: "a", Secret: []byte("y")}), keys.ErrInvalidKey)
+
+	_, err = (&keys.Ring{}).Sign([]byte("data"))
+	assert.ErrorIs(t, err, keys.ErrNoKey)
+}
+
+func TestRingLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing")
+	require.NoError(t, os.WriteFile(path, []byte("file-secret\n"), 0o600))
+	t.Setenv("KEYS_TEST_PREVIOUS", "env-secret")
+
+	ring := &keys.Ring{}
+	require.NoError(t, ring.Load(context.Background(), "file://"+path, "env://KEYS_TEST_PREVIOUS", ""))
+	assert.Equal(t, []keys.Key{
+		{ID: keys.ID([]byte("file-secret")), Secret: []byte("file-secret")},
+		{ID: keys.ID([]byte("env-secret")), Secret: []byte("env-secret")},
+	}, ring.Keys())
+	assert.Equal(t, keys.ID([]byte("env-secret")), keys.ID([]byte("env-secret")), "stable across instances")
+
+	assert.Error(t, ring.Load(context.Background(), "env://KEYS_TEST_MISSING"))
+	assert.Len(t, ring.Keys(), 2, "kept when the load fails")
+}
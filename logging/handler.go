@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NewHandler returns the slog.Handler logging to entry, so slog records
+// go through the logger of the server along with their fields, the
+// attributes of a group being prefixed by its name and a dot.
+func NewHandler(entry *logrus.Entry) slog.Handler {
+	return &handler{entry: entry}
+}
+
+type handler struct {
+	entry  *logrus.Entry
+	prefix string // of the attribute keys, from WithGroup
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.entry.Logger.IsLevelEnabled(toLogrus(level))
+}
+
+func (h *handler) Handle(ctx context.Context, rec slog.Record) error {
+	fields := make(logrus.Fields, rec.NumAttrs())
+	rec.Attrs(func(attr slog.Attr) bool {
+		addField(fields, h.prefix, attr)
+		return true
+	})
+	entry := h.entry.WithContext(ctx).WithFields(fields)
+	if !rec.Time.IsZero() {
+		entry = entry.WithTime(rec.Time)
+	}
+	entry.Log(toLogrus(rec.Level), rec.Message)
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(logrus.Fields, len(attrs))
+	for _, attr := range attrs {
+		addField(fields, h.prefix, attr)
+	}
+	return &handler{entry: h.entry.WithFields(fields), prefix: h.prefix}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &handler{entry: h.entry, prefix: h.prefix + name + "."}
+}
+
+// addField sets the field of attr, flattening the groups.
+func addField(fields logrus.Fields, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, a := range value.Group() {
+			addField(fields, prefix, a)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+	fields[prefix+attr.Key] = value.Any()
+}
@@ -0,0 +1,184 @@
+package logging
+
+// Logger abstraction receiving the logs of the server, so applications
+// logging with log/slog or zerolog keep a single logging stack
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LevelTrace is the level of the trace entries, below slog.LevelDebug.
+const LevelTrace = slog.LevelDebug - 4
+
+// Logger receives the entries of the server, the fields holding the request
+// and correlation IDs, the error and the like.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, fields map[string]interface{})
+}
+
+// Enabler is implemented by the loggers filtering the entries by level, the
+// server then skipping the entries filtered out.
+type Enabler interface {
+	Enabled(ctx context.Context, level slog.Level) bool
+}
+
+// Func adapts a function to Logger, such as one logging with zerolog.
+type Func func(ctx context.Context, level slog.Level, msg string, fields map[string]interface{})
+
+func (f Func) Log(ctx context.Context, level slog.Level, msg string, fields map[string]interface{}) {
+	f(ctx, level, msg, fields)
+}
+
+// Slog returns the Logger logging to l, the fields sorted by key.
+func Slog(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (x slogLogger) Log(ctx context.Context, level slog.Level, msg string, fields map[string]interface{}) {
+	if !x.l.Enabled(ctx, level) {
+		return
+	}
+	attrs := make([]slog.Attr, 0, len(fields))
+	for k, v := range fields {
+		attrs = append(attrs, slog.Any(k, v))
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	x.l.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (x slogLogger) Enabled(ctx context.Context, level slog.Level) bool {
+	return x.l.Enabled(ctx, level)
+}
+
+// Logrus returns the Logger logging to l, a logger other than the standard
+// one the server logs to.
+func Logrus(l *logrus.Logger) Logger {
+	return logrusLogger{l: l}
+}
+
+type logrusLogger struct {
+	l *logrus.Logger
+}
+
+func (x logrusLogger) Log(ctx context.Context, level slog.Level, msg string, fields map[string]interface{}) {
+	x.l.WithContext(ctx).WithFields(fields).Log(toLogrus(level), msg)
+}
+
+func (x logrusLogger) Enabled(_ context.Context, level slog.Level) bool {
+	return x.l.IsLevelEnabled(toLogrus(level))
+}
+
+// toLogrus maps a slog level to a logrus one, Error at most, logrus exiting
+// or panicking past it.
+func toLogrus(level slog.Level) logrus.Level {
+	switch {
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	case level >= slog.LevelDebug:
+		return logrus.DebugLevel
+	}
+	return logrus.TraceLevel
+}
+
+// fromLogrus maps a logrus level to a slog one, Fatal and Panic to Error.
+func fromLogrus(level logrus.Level) slog.Level {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return slog.LevelError
+	case logrus.WarnLevel:
+		return slog.LevelWarn
+	case logrus.InfoLevel:
+		return slog.LevelInfo
+	case logrus.DebugLevel:
+		return slog.LevelDebug
+	}
+	return LevelTrace
+}
+
+// forward is the hook of the standard logger sending its entries to the
+// installed Logger.
+var forward = &hook{}
+
+type hook struct {
+	mu        sync.RWMutex
+	logger    Logger
+	out       io.Writer // of the standard logger before Install
+	formatter logrus.Formatter
+}
+
+// discard skips formatting the entries sent to the Logger.
+type discard struct{}
+
+func (discard) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+func (h *hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *hook) Fire(entry *logrus.Entry) error {
+	h.mu.RLock()
+	logger := h.logger
+	h.mu.RUnlock()
+	if logger == nil {
+		return nil
+	}
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	logger.Log(ctx, fromLogrus(entry.Level), entry.Message, entry.Data)
+	return nil
+}
+
+var installHook sync.Once
+
+// Install sends the entries of the logrus standard logger, the one of the
+// server and of request.Logger, to l instead of its output. The level of
+// the standard logger is lowered to the lowest one l enables when an
+// Enabler, and still filters the entries otherwise. A nil l restores the
+// output.
+func Install(l Logger) {
+	std := logrus.StandardLogger()
+	installHook.Do(func() { std.AddHook(forward) })
+
+	forward.mu.Lock()
+	defer forward.mu.Unlock()
+	if l == nil {
+		if forward.logger != nil {
+			std.SetOutput(forward.out)
+			std.SetFormatter(forward.formatter)
+		}
+		forward.logger = nil
+		return
+	}
+	if forward.logger == nil {
+		forward.out, forward.formatter = std.Out, std.Formatter
+	}
+	forward.logger = l
+	std.SetOutput(io.Discard)
+	std.SetFormatter(discard{})
+	if e, ok := l.(Enabler); ok {
+		for _, level := range []logrus.Level{logrus.TraceLevel, logrus.DebugLevel, logrus.InfoLevel, logrus.WarnLevel, logrus.ErrorLevel} {
+			if e.Enabled(context.Background(), fromLogrus(level)) {
+				std.SetLevel(level)
+				break
+			}
+		}
+	}
+}
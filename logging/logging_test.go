@@ -0,0 +1,69 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/logging"
+)
+
+func TestInstall(t *testing.T) {
+	std := logrus.StandardLogger()
+	out, level := std.Out, std.GetLevel()
+	t.Cleanup(func() { std.SetLevel(level) })
+	std.SetLevel(logrus.InfoLevel)
+
+	var buf bytes.Buffer
+	logging.Install(logging.Slog(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	assert.Equal(t, logrus.DebugLevel, std.GetLevel(), "lowered to the level of the handler")
+
+	logrus.WithError(errors.New("boom")).WithField("request_id", "req-1").Warn("error while serving")
+	logrus.Trace("filtered out")
+	assert.Contains(t, buf.String(), `"level":"WARN","msg":"error while serving","error":"boom","request_id":"req-1"`)
+	assert.NotContains(t, buf.String(), "filtered out")
+
+	var entries []string
+	logging.Install(logging.Func(func(_ context.Context, level slog.Level, msg string, fields map[string]interface{}) {
+		entries = append(entries, level.String()+" "+msg)
+	}))
+	logrus.Error("replaced")
+	assert.Equal(t, []string{"ERROR replaced"}, entries)
+
+	logging.Install(nil)
+	assert.Equal(t, out, std.Out, "the output is restored")
+	logrus.Error("not forwarded")
+	assert.Len(t, entries, 1)
+}
+
+func TestLogrus(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&logrus.JSONFormatter{DisableTimestamp: true})
+	logger := logging.Logrus(l)
+
+	require.Implements(t, (*logging.Enabler)(nil), logger)
+	assert.False(t, logger.(logging.Enabler).Enabled(context.Background(), slog.LevelDebug))
+	logger.Log(context.Background(), slog.LevelError+4, "fatal as error", map[string]interface{}{"port": 8080})
+	assert.JSONEq(t, `{"level":"error","msg":"fatal as error","port":8080}`, buf.String())
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&logrus.JSONFormatter{DisableTimestamp: true})
+	l.SetLevel(logrus.InfoLevel)
+	logger := slog.New(logging.NewHandler(l.WithField("request_id", "req-1")))
+
+	logger.Debug("filtered out")
+	logger.WithGroup("order").With("id", 42).Warn("late", slog.Group("carrier", "name", "ups"))
+	assert.JSONEq(t, `{"level":"warning","msg":"late","request_id":"req-1","order.id":42,"order.carrier.name":"ups"}`, buf.String())
+}
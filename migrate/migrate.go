@@ -0,0 +1,132 @@
+package migrate
+
+// Schema migrations executed as part of the server startup sequence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultLeaseTTL      = 30 * time.Second
+	DefaultRetryInterval = 2 * time.Second
+)
+
+// ErrLocked is returned by a Locker while another instance holds the lock.
+var ErrLocked = errors.New("migration lock held by another instance")
+
+type Migrator interface {
+	Name() string
+	Migrate(ctx context.Context) error
+}
+
+// Lease is a time bound hold on the migration lock.
+type Lease interface {
+	Renew(ctx context.Context) error
+	Release(ctx context.Context) error
+}
+
+// Locker serializes migrations between instances of a multi-instance deploy.
+type Locker interface {
+	Acquire(ctx context.Context, ttl time.Duration) (Lease, error)
+}
+
+type Runner struct {
+	Locker        Locker
+	LeaseTTL      time.Duration
+	RetryInterval time.Duration
+	Migrators     []Migrator
+}
+
+// Run executes the migrators in order. When a Locker is set the lock is
+// acquired first and its lease is renewed until the migrations complete.
+func (x *Runner) Run(ctx context.Context) error {
+	if len(x.Migrators) == 0 {
+		return nil
+	}
+	if x.Locker == nil {
+		return x.migrate(ctx)
+	}
+
+	ttl := x.LeaseTTL
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+
+	lease, err := x.acquire(ctx, ttl)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lease.Release(context.Background()); err != nil {
+			logrus.WithError(err).Warn("unable to release migration lock")
+		}
+	}()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go renew(ctx, cancel, lease, ttl/2)
+
+	if err := x.migrate(ctx); err != nil {
+		if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, context.Canceled) {
+			return cause
+		}
+		return err
+	}
+	return nil
+}
+
+func (x *Runner) acquire(ctx context.Context, ttl time.Duration) (Lease, error) {
+	interval := x.RetryInterval
+	if interval <= 0 {
+		interval = DefaultRetryInterval
+	}
+
+	for {
+		lease, err := x.Locker.Acquire(ctx, ttl)
+		if err == nil {
+			return lease, nil
+		}
+		if !errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("unable to acquire migration lock: %w", err)
+		}
+
+		logrus.Info("waiting for migration lock")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (x *Runner) migrate(ctx context.Context) error {
+	for _, m := range x.Migrators {
+		logrus.WithField("migrator", m.Name()).Info("running migrations")
+		if err := m.Migrate(ctx); err != nil {
+			return fmt.Errorf("migrator %s failed: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+func renew(ctx context.Context, cancel context.CancelCauseFunc, lease Lease, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := lease.Renew(ctx); err != nil {
+				cancel(fmt.Errorf("migration lock lease lost: %w", err))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/migrate"
+)
+
+type migrator struct {
+	name  string
+	err   error
+	calls *[]string
+}
+
+func (m *migrator) Name() string { return m.name }
+
+func (m *migrator) Migrate(ctx context.Context) error {
+	*m.calls = append(*m.calls, m.name)
+	return m.err
+}
+
+type locker struct {
+	mu       sync.Mutex
+	busy     int
+	released bool
+}
+
+func (l *locker) Acquire(ctx context.Context, ttl time.Duration) (migrate.Lease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.busy > 0 {
+		l.busy--
+		return nil, migrate.ErrLocked
+	}
+	return l, nil
+}
+
+func (l *locker) Renew(ctx context.Context) error { return nil }
+
+func (l *locker) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.released = true
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	var calls []string
+	lock := &locker{busy: 2}
+	runner := migrate.Runner{
+		Locker:        lock,
+		RetryInterval: time.Millisecond,
+		Migrators: []migrate.Migrator{
+			&migrator{name: "first", calls: &calls},
+			&migrator{name: "second", calls: &calls},
+		},
+	}
+
+	assert.NoError(t, runner.Run(context.Background()))
+	assert.Equal(t, []string{"first", "second"}, calls)
+	assert.True(t, lock.released)
+}
+
+func TestRunFailure(t *testing.T) {
+	var calls []string
+	runner := migrate.Runner{
+		Migrators: []migrate.Migrator{
+			&migrator{name: "first", err: errors.New("boom"), calls: &calls},
+			&migrator{name: "second", calls: &calls},
+		},
+	}
+
+	err := runner.Run(context.Background())
+	assert.ErrorContains(t, err, "migrator first failed: boom")
+	assert.Equal(t, []string{"first"}, calls)
+}
+
+func TestRunLockWaitCancelled(t *testing.T) {
+	var calls []string
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	runner := migrate.Runner{
+		Locker:    &locker{busy: 1},
+		Migrators: []migrate.Migrator{&migrator{name: "first", calls: &calls}},
+	}
+
+	assert.ErrorIs(t, runner.Run(ctx), context.Canceled)
+	assert.Empty(t, calls)
+}
@@ -0,0 +1,266 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxDepth bounds the nesting of the validated documents and references.
+const maxDepth = 32
+
+// Schema is the subset of the OpenAPI schema object used for validation.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []interface{}      `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"` // boolean or schema
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	AllOf                []*Schema          `json:"allOf"`
+	AnyOf                []*Schema          `json:"anyOf"`
+	OneOf                []*Schema          `json:"oneOf"`
+}
+
+// FieldError reports an invalid field, such as "body.items[0].quantity".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the invalid fields of a request or response.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Validate checks a decoded JSON value against the schema, reporting the
+// invalid fields under the given root name.
+func (s *Spec) Validate(schema *Schema, v interface{}, root string) []FieldError {
+	errs := []FieldError{}
+	s.validate(schema, v, root, 0, &errs)
+	return errs
+}
+
+func (s *Spec) validate(schema *Schema, v interface{}, field string, depth int, errs *[]FieldError) {
+	schema = s.schema(schema)
+	if schema == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	if depth > maxDepth {
+		fail("is nested too deeply")
+		return
+	}
+
+	for _, sub := range schema.AllOf {
+		s.validate(sub, v, field, depth+1, errs)
+	}
+	if len(schema.AnyOf) > 0 && s.matching(schema.AnyOf, v, depth) == 0 {
+		fail("matches none of the allowed schemas")
+	}
+	if len(schema.OneOf) > 0 && s.matching(schema.OneOf, v, depth) != 1 {
+		fail("must match exactly one of the allowed schemas")
+	}
+
+	if v == nil {
+		if !schema.Nullable && schema.Type != "" {
+			fail("must not be null")
+		}
+		return
+	}
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, v) {
+		fail("must be one of %s", enumString(schema.Enum))
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		s.object(schema, obj, field, depth, errs)
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		if schema.MinItems != nil && len(arr) < *schema.MinItems {
+			fail("must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(arr) > *schema.MaxItems {
+			fail("must have at most %d items", *schema.MaxItems)
+		}
+		for i, item := range arr {
+			s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", field, i), depth+1, errs)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		if msg := checkString(schema, str); msg != "" {
+			fail("%s", msg)
+		}
+	case "number", "integer":
+		n, ok := v.(float64)
+		if !ok {
+			fail("must be a number")
+			return
+		}
+		if schema.Type == "integer" && n != math.Trunc(n) {
+			fail("must be an integer")
+		}
+		if schema.Minimum != nil && n < *schema.Minimum {
+			fail("must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			fail("must be at most %v", *schema.Maximum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("must be a boolean")
+		}
+	}
+}
+
+func (s *Spec) object(schema *Schema, obj map[string]interface{}, field string, depth int, errs *[]FieldError) {
+	for _, name := range schema.Required {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, FieldError{Field: join(field, name), Message: "is required"})
+		}
+	}
+
+	var additional *Schema
+	closed := false
+	if len(schema.AdditionalProperties) > 0 {
+		if err := json.Unmarshal(schema.AdditionalProperties, &additional); err != nil {
+			closed = string(schema.AdditionalProperties) == "false"
+		}
+	}
+	for name, value := range obj {
+		prop, ok := schema.Properties[name]
+		switch {
+		case ok:
+			s.validate(prop, value, join(field, name), depth+1, errs)
+		case closed:
+			*errs = append(*errs, FieldError{Field: join(field, name), Message: "is not allowed"})
+		case additional != nil:
+			s.validate(additional, value, join(field, name), depth+1, errs)
+		}
+	}
+}
+
+// matching counts the schemas v is valid against.
+func (s *Spec) matching(schemas []*Schema, v interface{}, depth int) int {
+	n := 0
+	for _, sub := range schemas {
+		errs := []FieldError{}
+		s.validate(sub, v, "", depth+1, &errs)
+		if len(errs) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+var (
+	patternsMu sync.Mutex
+	patterns   = map[string]*regexp.Regexp{}
+)
+
+func checkString(schema *Schema, str string) string {
+	length := utf8.RuneCountInString(str)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		return fmt.Sprintf("must be at least %d characters long", *schema.MinLength)
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		return fmt.Sprintf("must be at most %d characters long", *schema.MaxLength)
+	}
+	if schema.Pattern != "" {
+		patternsMu.Lock()
+		re, ok := patterns[schema.Pattern]
+		if !ok {
+			re, _ = regexp.Compile(schema.Pattern)
+			patterns[schema.Pattern] = re
+		}
+		patternsMu.Unlock()
+		if re != nil && !re.MatchString(str) {
+			return fmt.Sprintf("must match %s", schema.Pattern)
+		}
+	}
+
+	var err error
+	switch schema.Format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, str)
+	case "date":
+		_, err = time.Parse(time.DateOnly, str)
+	case "email":
+		_, err = mail.ParseAddress(str)
+	case "uuid":
+		if !uuidRegexp.MatchString(str) {
+			err = fmt.Errorf("invalid uuid")
+		}
+	}
+	if err != nil {
+		return "must be a valid " + schema.Format
+	}
+	return ""
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumString(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		data, _ := json.Marshal(e)
+		values[i] = string(data)
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,177 @@
+package openapi
+
+// Validates requests, and optionally responses, against an OpenAPI 3
+// document
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Spec is the subset of an OpenAPI 3 document used for validation.
+type Spec struct {
+	Paths      map[string]*PathItem `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// PathItem holds the operations of a path keyed by method, such as "GET".
+type PathItem struct {
+	Parameters []*Parameter
+	Operations map[string]*Operation
+}
+
+var methods = []string{
+	http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete,
+	http.MethodOptions, http.MethodHead, http.MethodPatch, http.MethodTrace,
+}
+
+func (p *PathItem) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if params, ok := fields["parameters"]; ok {
+		if err := json.Unmarshal(params, &p.Parameters); err != nil {
+			return err
+		}
+	}
+	p.Operations = make(map[string]*Operation)
+	for _, method := range methods {
+		raw, ok := fields[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+		op := &Operation{}
+		if err := json.Unmarshal(raw, op); err != nil {
+			return err
+		}
+		p.Operations[method] = op
+	}
+	return nil
+}
+
+type Operation struct {
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"` // path, query or header
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Content map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Parse reads an OpenAPI 3 JSON document.
+func Parse(data []byte) (*Spec, error) {
+	spec := &Spec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Load reads an OpenAPI 3 JSON document from a file.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Find returns the operation documenting the method and path, along with
+// the path parameters, or nil when it is not documented. Literal segments
+// take precedence over parameters.
+func (s *Spec) Find(method, path string) (*Operation, []*Parameter, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var (
+		best       *PathItem
+		bestParams map[string]string
+		bestScore  = -1
+	)
+	for pattern, item := range s.Paths {
+		if _, ok := item.Operations[method]; !ok {
+			continue
+		}
+		params, score, ok := match(strings.Split(strings.Trim(pattern, "/"), "/"), segments)
+		if ok && score > bestScore {
+			best, bestParams, bestScore = item, params, score
+		}
+	}
+	if best == nil {
+		return nil, nil, nil
+	}
+
+	op := best.Operations[method]
+	// Operation parameters override the path ones of the same name and location
+	params := make([]*Parameter, 0, len(best.Parameters)+len(op.Parameters))
+	seen := make(map[string]bool)
+	for _, p := range append(append([]*Parameter{}, op.Parameters...), best.Parameters...) {
+		if p = s.parameter(p); p == nil || seen[p.In+" "+p.Name] {
+			continue
+		}
+		seen[p.In+" "+p.Name] = true
+		params = append(params, p)
+	}
+	return op, params, bestParams
+}
+
+// match matches the segments of a path to those of a pattern, scoring the
+// literal segments matched.
+func match(pattern, segments []string) (map[string]string, int, bool) {
+	if len(pattern) != len(segments) {
+		return nil, 0, false
+	}
+	params := make(map[string]string)
+	score := 0
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			params[strings.Trim(p, "{}")] = segments[i]
+			continue
+		}
+		if p != segments[i] {
+			return nil, 0, false
+		}
+		score++
+	}
+	return params, score, true
+}
+
+func (s *Spec) parameter(p *Parameter) *Parameter {
+	if p == nil || p.Ref == "" {
+		return p
+	}
+	return s.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+}
+
+func (s *Spec) schema(schema *Schema) *Schema {
+	for i := 0; schema != nil && schema.Ref != "" && i < maxDepth; i++ {
+		schema = s.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
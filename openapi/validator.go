@@ -0,0 +1,289 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/request"
+)
+
+var ErrValidation = errors.New("request validation failed")
+
+// Validator checks the requests of the operations documented by Spec
+// against their parameters, content types and body schemas, replying 400
+// Bad Request with the invalid fields, as a Failure or a request.Problem
+// with a "fields" member depending on the error format. Undocumented
+// operations are served as is.
+//
+// Responses also validates the JSON responses, logging a warning per
+// invalid one without altering it. It is meant for development.
+type Validator struct {
+	Spec      *Spec
+	Responses bool
+}
+
+// Failure is the reply to an invalid request.
+type Failure struct {
+	request.Result
+	Fields []FieldError `json:"fields"`
+}
+
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		op, params, pathParams := v.Spec.Find(r.Method, r.URL.Path)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		fields := v.parameters(r, params, pathParams)
+		bodyFields, err := v.body(w, r, op.RequestBody)
+		if err != nil {
+			request.ReplyErr(w, r, err)
+			return
+		}
+		if fields = append(fields, bodyFields...); len(fields) > 0 {
+			if request.ErrorFormat() == request.ErrorFormatProblem {
+				p := request.NewProblem(ErrValidation, http.StatusBadRequest)
+				p.Extensions = map[string]interface{}{"fields": fields}
+				request.ReplyProblem(w, r, p)
+				return
+			}
+			request.Reply(r, w, Failure{
+				Result: request.Result{Error: ErrValidation.Error()},
+				Fields: fields,
+			}, http.StatusBadRequest)
+			return
+		}
+
+		if !v.Responses {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body := &capped{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(body)
+		next.ServeHTTP(ww, r)
+		if body.overflow || !isJSON(ww.Header().Get(request.HeaderContentType)) {
+			return
+		}
+		if fields := v.response(op, ww.Status(), body.Bytes()); len(fields) > 0 {
+			logrus.WithFields(logrus.Fields{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"status": ww.Status(),
+				"fields": (&ValidationError{Fields: fields}).Error(),
+			}).Warn("response does not match the OpenAPI document")
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// parameters validates the path, query and header parameters, converting
+// their values to the type of their schema.
+func (v *Validator) parameters(r *http.Request, params []*Parameter, pathParams map[string]string) []FieldError {
+	fields := []FieldError{}
+	query := r.URL.Query()
+	for _, p := range params {
+		var values []string
+		switch p.In {
+		case "path":
+			if value, ok := pathParams[p.Name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		default:
+			continue
+		}
+		field := p.In + "." + p.Name
+		if len(values) == 0 {
+			if p.Required || p.In == "path" {
+				fields = append(fields, FieldError{Field: field, Message: "is required"})
+			}
+			continue
+		}
+		value, err := v.convert(p.Schema, values)
+		if err != nil {
+			fields = append(fields, FieldError{Field: field, Message: err.Error()})
+			continue
+		}
+		fields = append(fields, v.Spec.Validate(p.Schema, value, field)...)
+	}
+	return fields
+}
+
+// convert turns the raw values of a parameter into the JSON value its
+// schema describes. Arrays are either repeated or comma separated.
+func (v *Validator) convert(schema *Schema, values []string) (interface{}, error) {
+	schema = v.Spec.schema(schema)
+	if schema == nil {
+		return values[0], nil
+	}
+	if schema.Type != "array" {
+		return scalar(schema.Type, values[0])
+	}
+	if len(values) == 1 {
+		values = strings.Split(values[0], ",")
+	}
+	itemType := ""
+	if items := v.Spec.schema(schema.Items); items != nil {
+		itemType = items.Type
+	}
+	arr := make([]interface{}, len(values))
+	for i, value := range values {
+		item, err := scalar(itemType, value)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = item
+	}
+	return arr, nil
+}
+
+func scalar(typ, value string) (interface{}, error) {
+	switch typ {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+// body validates the content type and, when JSON, the request body, which
+// is restored for the handler.
+func (v *Validator) body(w http.ResponseWriter, r *http.Request, rb *RequestBody) ([]FieldError, error) {
+	if rb == nil {
+		return nil, nil
+	}
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		if rb.Required {
+			return []FieldError{{Field: "body", Message: "is required"}}, nil
+		}
+		return nil, nil
+	}
+
+	contentType := r.Header.Get(request.HeaderContentType)
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	media, ok := rb.Content[mediaType]
+	if err != nil || !ok {
+		media, ok = matchContent(rb.Content, mediaType)
+	}
+	if err != nil || !ok {
+		types := make([]string, 0, len(rb.Content))
+		for t := range rb.Content {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		w.Header().Set("Accept", strings.Join(types, ", "))
+		return nil, request.NewHTTPError(
+			fmt.Errorf("%w %q, expecting %s", request.ErrUnsupportedMediaType, contentType, strings.Join(types, " or ")),
+			http.StatusUnsupportedMediaType,
+		)
+	}
+	if media == nil || media.Schema == nil || !isJSON(mediaType) {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, request.MaxBodySize))
+	r.Body.Close()
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, request.NewHTTPError(err, http.StatusRequestEntityTooLarge)
+		}
+		return nil, request.NewHTTPError(err, http.StatusBadRequest)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []FieldError{{Field: "body", Message: "must be valid JSON"}}, nil
+	}
+	return v.Spec.Validate(media.Schema, doc, "body"), nil
+}
+
+// response validates a JSON response body against the schema documented
+// for its status, its class such as "2XX", or the default one.
+func (v *Validator) response(op *Operation, status int, body []byte) []FieldError {
+	code := strconv.Itoa(status)
+	resp, ok := op.Responses[code]
+	if !ok {
+		resp, ok = op.Responses[code[:1]+"XX"]
+	}
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok || resp == nil {
+		return []FieldError{{Field: "status", Message: "is not documented"}}
+	}
+
+	var media *MediaType
+	for t, m := range resp.Content {
+		if isJSON(t) {
+			media = m
+			break
+		}
+	}
+	if media == nil || media.Schema == nil {
+		return nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return []FieldError{{Field: "response", Message: "must be valid JSON"}}
+	}
+	return v.Spec.Validate(media.Schema, doc, "response")
+}
+
+// matchContent finds the media type of a "type/*" or "*/*" content entry
+// matching mediaType.
+func matchContent(content map[string]*MediaType, mediaType string) (*MediaType, bool) {
+	major, _, _ := strings.Cut(mediaType, "/")
+	if m, ok := content[major+"/*"]; ok && mediaType != "" {
+		return m, true
+	}
+	m, ok := content["*/*"]
+	return m, ok
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// capped buffers up to request.MaxBodySize bytes written to it.
+type capped struct {
+	bytes.Buffer
+	overflow bool
+}
+
+func (c *capped) Write(p []byte) (int, error) {
+	if c.overflow || c.Len()+len(p) > request.MaxBodySize {
+		c.overflow = true
+		c.Reset()
+		return len(p), nil
+	}
+	return c.Buffer.Write(p)
+}
@@ -0,0 +1,196 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/openapi"
+	"github.com/go-obvious/server/request"
+)
+
+const document = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/orders": {
+      "get": {
+        "parameters": [
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 100}},
+          {"name": "status", "in": "query", "schema": {"type": "array", "items": {"type": "string", "enum": ["open", "closed"]}}}
+        ],
+        "responses": {"200": {"content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Order"}}}}}}
+      },
+      "post": {
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Order"}}}},
+        "responses": {"201": {}}
+      }
+    },
+    "/orders/{id}": {
+      "parameters": [{"$ref": "#/components/parameters/ID"}],
+      "get": {"responses": {"200": {}}}
+    },
+    "/orders/latest": {
+      "get": {"responses": {"200": {}}}
+    }
+  },
+  "components": {
+    "parameters": {
+      "ID": {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}
+    },
+    "schemas": {
+      "Order": {
+        "type": "object",
+        "required": ["id", "items"],
+        "additionalProperties": false,
+        "properties": {
+          "id": {"type": "integer"},
+          "email": {"type": "string", "format": "email"},
+          "note": {"type": "string", "nullable": true, "maxLength": 5},
+          "items": {"type": "array", "minItems": 1, "items": {
+            "type": "object",
+            "required": ["sku"],
+            "properties": {"sku": {"type": "string", "pattern": "^[A-Z]+$"}, "quantity": {"type": "integer", "minimum": 1}}
+          }}
+        }
+      }
+    }
+  }
+}`
+
+func validator(t *testing.T, responses bool) *openapi.Validator {
+	spec, err := openapi.Parse([]byte(document))
+	require.NoError(t, err)
+	return &openapi.Validator{Spec: spec, Responses: responses}
+}
+
+func serve(h http.Handler, method, target, contentType, body string) (*httptest.ResponseRecorder, openapi.Failure) {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var failure openapi.Failure
+	_ = json.Unmarshal(w.Body.Bytes(), &failure)
+	return w, failure
+}
+
+func TestValidateRequest(t *testing.T) {
+	var received string
+	h := validator(t, false).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	valid := `{"id": 1, "note": null, "items": [{"sku": "AB", "quantity": 2}]}`
+	w, _ := serve(h, http.MethodPost, "/orders", "application/json; charset=utf-8", valid)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, valid, received, "the body is restored for the handler")
+
+	w, failure := serve(h, http.MethodPost, "/orders", "application/json",
+		`{"id": 1.5, "email": "nope", "note": "too long", "extra": 1, "items": [{"quantity": 0}, {"sku": "ab"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.False(t, failure.Success)
+	assert.Equal(t, "request validation failed", failure.Error)
+	assert.ElementsMatch(t, []openapi.FieldError{
+		{Field: "body.id", Message: "must be an integer"},
+		{Field: "body.email", Message: "must be a valid email"},
+		{Field: "body.note", Message: "must be at most 5 characters long"},
+		{Field: "body.extra", Message: "is not allowed"},
+		{Field: "body.items[0].sku", Message: "is required"},
+		{Field: "body.items[0].quantity", Message: "must be at least 1"},
+		{Field: "body.items[1].sku", Message: "must match ^[A-Z]+$"},
+	}, failure.Fields)
+
+	w, failure = serve(h, http.MethodPost, "/orders", "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []openapi.FieldError{{Field: "body", Message: "is required"}}, failure.Fields)
+
+	w, failure = serve(h, http.MethodPost, "/orders", "application/json", `{"id": `)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []openapi.FieldError{{Field: "body", Message: "must be valid JSON"}}, failure.Fields)
+
+	w, _ = serve(h, http.MethodPost, "/orders", "text/plain", "hello")
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Accept"))
+}
+
+func TestValidateParameters(t *testing.T) {
+	h := validator(t, false).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for target, want := range map[string][]openapi.FieldError{
+		"/orders?limit=10&status=open,closed": nil,
+		"/orders?status=open&status=closed":   nil,
+		"/orders/latest":                      nil,
+		"/orders/42":                          nil,
+		"/undocumented":                       nil,
+		"/orders?limit=0":                     {{Field: "query.limit", Message: "must be at least 1"}},
+		"/orders?limit=ten":                   {{Field: "query.limit", Message: "must be a number"}},
+		"/orders?status=open,lost":            {{Field: "query.status[1]", Message: `must be one of "open", "closed"`}},
+		"/orders/abc":                         {{Field: "path.id", Message: "must be a number"}},
+	} {
+		w, failure := serve(h, http.MethodGet, target, "", "")
+		if want == nil {
+			assert.Equal(t, http.StatusNoContent, w.Code, target)
+			continue
+		}
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		assert.Equal(t, want, failure.Fields, target)
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	var body string
+	h := validator(t, true).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, body)
+	}))
+
+	body = `[{"id": "1", "items": []}]`
+	w, _ := serve(h, http.MethodGet, "/orders", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, body, w.Body.String(), "invalid responses are only reported")
+}
+
+func TestSpecValidate(t *testing.T) {
+	spec, err := openapi.Parse([]byte(document))
+	require.NoError(t, err)
+
+	var doc interface{}
+	require.NoError(t, json.Unmarshal([]byte(`[{"id": "1", "items": []}]`), &doc))
+	assert.ElementsMatch(t, []openapi.FieldError{
+		{Field: "response[0].id", Message: "must be a number"},
+		{Field: "response[0].items", Message: "must have at least 1 items"},
+	}, spec.Validate(spec.Paths["/orders"].Operations[http.MethodGet].Responses["200"].Content["application/json"].Schema, doc, "response"))
+}
+
+func TestValidateProblem(t *testing.T) {
+	require.NoError(t, request.SetErrorFormat(request.ErrorFormatProblem))
+	t.Cleanup(func() { _ = request.SetErrorFormat(request.ErrorFormatResult) })
+
+	h := validator(t, false).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w, _ := serve(h, http.MethodGet, "/orders?limit=0", "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, request.ContentTypeProblemJSON, w.Header().Get(request.HeaderContentType))
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Bad Request",
+		"status": 400,
+		"detail": "request validation failed",
+		"instance": "/orders",
+		"fields": [{"field": "query.limit", "message": "must be at least 1"}]
+	}`, w.Body.String())
+}
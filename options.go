@@ -0,0 +1,492 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/cors"
+
+	"github.com/go-obvious/server/alert"
+	"github.com/go-obvious/server/api"
+	"github.com/go-obvious/server/audit"
+	"github.com/go-obvious/server/config"
+	"github.com/go-obvious/server/discovery"
+	"github.com/go-obvious/server/docs"
+	"github.com/go-obvious/server/drift"
+	"github.com/go-obvious/server/logging"
+	"github.com/go-obvious/server/migrate"
+	"github.com/go-obvious/server/openapi"
+	"github.com/go-obvious/server/ratelimit"
+	"github.com/go-obvious/server/request"
+	"github.com/go-obvious/server/security"
+	"github.com/go-obvious/server/static"
+)
+
+// Option customizes the server at construction, taking precedence over
+// the environment configuration.
+type Option func(*server)
+
+// WithAPIs registers the APIs served by the server.
+func WithAPIs(apis ...API) Option {
+	return func(a *server) {
+		a.apis = append(a.apis, apis...)
+	}
+}
+
+// WithRouter registers the APIs on r, which may be pre-configured with its
+// own middlewares and routes. It is mounted behind the server middleware
+// stack, next to the built in routes. Alternative muxers can be mounted on
+// a chi router:
+//
+//	r := chi.NewRouter()
+//	r.Mount("/", mux)
+//	app := server.NewWithOptions(version, server.WithRouter(r))
+func WithRouter(r chi.Router) Option {
+	return func(a *server) {
+		a.router = r
+	}
+}
+
+// WithPort sets the listening port, overriding SERVER_PORT.
+func WithPort(port uint) Option {
+	return func(a *server) {
+		a.cfg.Port = port
+	}
+}
+
+// WithBindAddress binds the ports to address, such as "127.0.0.1" or "::1",
+// rather than to all the interfaces.
+func WithBindAddress(address string) Option {
+	return func(a *server) {
+		a.cfg.BindAddress = address
+	}
+}
+
+// WithAdminPort serves the operational endpoints on a dedicated port,
+// overriding SERVER_ADMIN_PORT.
+func WithAdminPort(port uint) Option {
+	return func(a *server) {
+		a.cfg.AdminPort = port
+	}
+}
+
+// WithHealthcheckCertificate makes Healthcheck present cert to the ports
+// requiring a client certificate. It does not apply to the server.
+func WithHealthcheckCertificate(cert tls.Certificate) Option {
+	return func(a *server) {
+		a.probeCert = &cert
+	}
+}
+
+// WithGRPC co-hosts the gRPC server, such as a *grpc.Server, served on
+// the HTTP port, or on SERVER_GRPC_PORT when set, and stopped gracefully
+// along with the HTTP server. It requires an HTTP server mode, such as
+// http or gcp-cloud-run.
+func WithGRPC(srv GRPCServer) Option {
+	return func(a *server) {
+		a.grpc = srv
+	}
+}
+
+// WithGRPCHealth sets the health service of the gRPC server, such as a
+// *health.Server, which reports NOT_SERVING once the server drains.
+func WithGRPCHealth(h GRPCHealth) Option {
+	return func(a *server) {
+		a.grpcHealth = h
+	}
+}
+
+// WithGRPCPort serves the gRPC server on a dedicated port, overriding
+// SERVER_GRPC_PORT.
+func WithGRPCPort(port uint) Option {
+	return func(a *server) {
+		a.cfg.GRPCPort = port
+	}
+}
+
+// WithMode sets the server mode, overriding SERVER_MODE.
+func WithMode(mode string) Option {
+	return func(a *server) {
+		a.cfg.Mode = mode
+	}
+}
+
+// WithHTTP sets the timeouts, header limit and framing validation of the
+// HTTP server, overriding the SERVER_*_TIMEOUT, SERVER_MAX_HEADER_BYTES and
+// SERVER_STRICT_FRAMING variables.
+func WithHTTP(cfg config.HTTP) Option {
+	return func(a *server) {
+		a.cfg.HTTP = cfg
+	}
+}
+
+// WithAllowedHosts rejects the requests for hosts other than the domain and
+// the given ones, overriding SERVER_ALLOWED_HOSTS.
+func WithAllowedHosts(hosts ...string) Option {
+	return func(a *server) {
+		a.cfg.AllowedHosts = hosts
+	}
+}
+
+// WithRoutesEndpoint enables or disables the /routes endpoint listing the
+// routes, overriding SERVER_ROUTES_ENDPOINT_ENABLED.
+func WithRoutesEndpoint(enabled bool) Option {
+	return func(a *server) {
+		a.cfg.RoutesEndpoint = enabled
+	}
+}
+
+// WithHealthPath serves the health endpoint on path, an empty path
+// disabling it, overriding SERVER_HEALTH_PATH.
+func WithHealthPath(path string) Option {
+	return func(a *server) {
+		a.cfg.HealthPath = path
+	}
+}
+
+// WithRuntimeEndpoint enables or disables the /runtime endpoint serving the
+// runtime settings and statistics.
+func WithRuntimeEndpoint(enabled bool) Option {
+	return func(a *server) {
+		a.cfg.RuntimeEndpoint = enabled
+	}
+}
+
+// WithVersionPath serves the version endpoint on path, an empty path
+// disabling it, overriding SERVER_VERSION_PATH.
+func WithVersionPath(path string) Option {
+	return func(a *server) {
+		a.cfg.VersionPath = path
+	}
+}
+
+// WithShutdown sets how the in-flight requests are drained on shutdown,
+// overriding the SERVER_SHUTDOWN_* variables.
+func WithShutdown(cfg config.Shutdown) Option {
+	return func(a *server) {
+		a.cfg.Shutdown = cfg
+	}
+}
+
+// WithShutdownSignals traps the SERVER_SHUTDOWN_SIGNALS and
+// SERVER_SHUTDOWN_DUMP_SIGNALS, SIGINT and SIGTERM by default, to shut the
+// server down gracefully. Run otherwise stops only once its context is done,
+// leaving the signals to the application.
+func WithShutdownSignals() Option {
+	return func(a *server) {
+		a.trapSignals = true
+	}
+}
+
+// WithOnShutdown registers functions called on shutdown once the grace
+// period elapsed, before waiting for the in-flight requests, such as the
+// Close of a ws.Hub ending its long-lived connections.
+func WithOnShutdown(fns ...func()) Option {
+	return func(a *server) {
+		a.onShutdown = append(a.onShutdown, fns...)
+	}
+}
+
+// WithOnReady registers functions called once the HTTP servers listen,
+// before the first request may be served. They are only called in the
+// HTTP server modes.
+func WithOnReady(fns ...func()) Option {
+	return func(a *server) {
+		a.onReady = append(a.onReady, fns...)
+	}
+}
+
+// WithOnDraining registers functions called when the server starts
+// draining on shutdown, before the grace period, such as announcing the
+// instance is going away or the Close of a sse.Broker ending its streams.
+func WithOnDraining(fns ...func()) Option {
+	return func(a *server) {
+		a.onDraining = append(a.onDraining, fns...)
+	}
+}
+
+// WithDiscovery registers the server with the registrar once it listens
+// and deregisters it when it starts draining, overriding
+// SERVER_DISCOVERY_PROVIDER. The service is described by the other
+// SERVER_DISCOVERY_* variables.
+func WithDiscovery(r discovery.Registrar) Option {
+	return func(a *server) {
+		a.registrar = r
+	}
+}
+
+// WithAuditSink records the audit trail to the sink, overriding
+// SERVER_AUDIT_SINK.
+func WithAuditSink(sink audit.Sink) Option {
+	return func(a *server) {
+		a.trail = &audit.Trail{Sink: sink}
+	}
+}
+
+// WithPanicReporter calls fn with each panic recovered from a handler,
+// once the error response is sent, to forward it to an error tracker such
+// as Sentry or Bugsnag. A panic in fn is logged.
+func WithPanicReporter(fn func(ctx context.Context, rep PanicReport)) Option {
+	return func(a *server) {
+		a.panicReporters = append(a.panicReporters, fn)
+	}
+}
+
+// WithPanicRetry enables or disables serving the GET and HEAD requests
+// once more after a panic, before answering 500.
+func WithPanicRetry(enabled bool) Option {
+	return func(a *server) {
+		a.cfg.PanicRetry = enabled
+	}
+}
+
+// WithResponseHooks runs the hooks before the headers of every response
+// are sent, to stamp headers, such as Cache-Control or security overrides,
+// based on what the handler produced.
+func WithResponseHooks(hooks ...api.ResponseHook) Option {
+	return func(a *server) {
+		a.responseHooks = append(a.responseHooks, hooks...)
+	}
+}
+
+// WithDebugEndpoints enables or disables the pprof and expvar endpoints,
+// overriding SERVER_DEBUG_ENDPOINTS_ENABLED.
+func WithDebugEndpoints(enabled bool) Option {
+	return func(a *server) {
+		a.cfg.DebugEndpoints = enabled
+	}
+}
+
+// WithDebugToken sets the token elevating request logging, overriding
+// SERVER_DEBUG_TOKEN.
+func WithDebugToken(token string) Option {
+	return func(a *server) {
+		a.cfg.DebugToken = token
+	}
+}
+
+// WithAdminTokens enables the /admin/toggles endpoint flipping the runtime
+// switches for the bearers of the tokens, overriding SERVER_ADMIN_TOKENS.
+func WithAdminTokens(tokens ...string) Option {
+	return func(a *server) {
+		a.cfg.AdminTokens = make([]config.Secret, len(tokens))
+		for i, token := range tokens {
+			a.cfg.AdminTokens[i] = config.Secret(token)
+		}
+	}
+}
+
+// WithQuietRoutes sets the patterns of the paths kept out of the logs,
+// overriding SERVER_QUIET_ROUTES. Routes may also be quieted with
+// api.Route.Quiet.
+func WithQuietRoutes(patterns ...string) Option {
+	return func(a *server) {
+		a.cfg.QuietRoutes = patterns
+	}
+}
+
+// WithRedactPatterns sets the patterns of the sensitive names whose values
+// are redacted from the logs, overriding SERVER_REDACT_PATTERNS.
+func WithRedactPatterns(patterns ...string) Option {
+	return func(a *server) {
+		a.cfg.RedactPatterns = patterns
+	}
+}
+
+// WithCookieKeys sets the keys of the encrypted cookies, the first one
+// encrypting them, overriding SERVER_COOKIE_KEYS.
+func WithCookieKeys(keys ...string) Option {
+	return func(a *server) {
+		a.cfg.CookieKeys = make([]config.Secret, len(keys))
+		for i, key := range keys {
+			a.cfg.CookieKeys[i] = config.Secret(key)
+		}
+	}
+}
+
+// WithHeaderAudit enables the response header audit, requiring the
+// responses under the given path prefixes not to be cacheable.
+func WithHeaderAudit(sensitivePaths ...string) Option {
+	return func(a *server) {
+		a.cfg.HeaderAudit = true
+		a.cfg.HeaderAuditSensitive = sensitivePaths
+	}
+}
+
+// WithCORS replaces the CORS options loaded from the environment.
+func WithCORS(opts cors.Options) Option {
+	return func(a *server) {
+		a.cors = &opts
+	}
+}
+
+// WithCORSOrigins replaces the allowed CORS origins, keeping the other
+// CORS options.
+func WithCORSOrigins(origins ...string) Option {
+	return func(a *server) {
+		opts := *a.cors
+		opts.AllowedOrigins = origins
+		a.cors = &opts
+	}
+}
+
+// WithCORSPolicy applies a dedicated CORS policy to the routes under the
+// given mount prefix.
+func WithCORSPolicy(prefix string, opts cors.Options) Option {
+	return func(a *server) {
+		if a.corsPolicies == nil {
+			a.corsPolicies = make(map[string]cors.Options)
+		}
+		a.corsPolicies[prefix] = opts
+	}
+}
+
+// WithMigrations registers migrators run by Run before the server listens.
+func WithMigrations(migrators ...migrate.Migrator) Option {
+	return func(a *server) {
+		a.migrations.Migrators = append(a.migrations.Migrators, migrators...)
+	}
+}
+
+// WithMigrationLock serializes migrations across instances using the given
+// locker, holding a lease of the given ttl while they run.
+func WithMigrationLock(locker migrate.Locker, ttl time.Duration) Option {
+	return func(a *server) {
+		a.migrations.Locker = locker
+		a.migrations.LeaseTTL = ttl
+	}
+}
+
+// WithSecurity replaces the security header values loaded from the environment.
+func WithSecurity(cfg security.Config) Option {
+	return func(a *server) {
+		a.security = cfg
+	}
+}
+
+// WithSecurityHeader sets one security header, such as
+// security.HeaderFrameOptions, keeping the others loaded from the environment.
+// An empty value disables the header.
+func WithSecurityHeader(name, value string) Option {
+	return func(a *server) {
+		a.security = a.security.With(name, value)
+	}
+}
+
+// WithAlerting replaces the alert monitor configured from the environment.
+func WithAlerting(m *alert.Monitor) Option {
+	return func(a *server) {
+		a.monitor = m
+	}
+}
+
+// WithRateLimit replaces the per client rate limit configured from the
+// environment, a zero rate disables it.
+func WithRateLimit(cfg ratelimit.Config) Option {
+	return func(a *server) {
+		a.limiter = nil
+		if cfg.Rate > 0 {
+			a.limiter = ratelimit.New(cfg)
+		}
+	}
+}
+
+// WithDocs serves the markdown and OpenAPI documents of fsys, typically an
+// embed.FS, under /docs.
+func WithDocs(fsys fs.FS) Option {
+	return func(a *server) {
+		a.docs = docs.Endpoint(fsys)
+	}
+}
+
+// WithStatic serves the frontend assets of fsys, such as an embed.FS,
+// under prefix, "/" included since the routes of the APIs take precedence.
+func WithStatic(prefix string, fsys fs.FS, opts static.Options) Option {
+	return func(a *server) {
+		if a.statics == nil {
+			a.statics = make(map[string]http.Handler)
+		}
+		a.statics[prefix] = static.Endpoint(fsys, opts)
+	}
+}
+
+// WithOpenAPI serves an OpenAPI document generated from the routes and
+// their documentation under /openapi.json.
+func WithOpenAPI(title string) Option {
+	return func(a *server) {
+		a.openAPITitle = title
+	}
+}
+
+// WithSchemaDrift reports the JSON responses drifting from the baseline of
+// the detector. It is meant for staging environments.
+func WithSchemaDrift(d *drift.Detector) Option {
+	return func(a *server) {
+		a.drift = d
+	}
+}
+
+// WithValidation validates the requests, and optionally the responses,
+// against the OpenAPI document of the validator.
+func WithValidation(v *openapi.Validator) Option {
+	return func(a *server) {
+		a.validator = v
+	}
+}
+
+// WithRequestIDPolicy selects how the IDs supplied by the clients are
+// handled, request.RequestIDEcho, request.RequestIDSanitize,
+// request.RequestIDReplace or request.RequestIDReject.
+func WithRequestIDPolicy(policy string) Option {
+	return func(a *server) {
+		a.cfg.RequestIDPolicy = policy
+	}
+}
+
+// WithBaggageHeaders carries the headers along with the request IDs, such
+// as X-Tenant-ID or X-User-ID, in addition to SERVER_BAGGAGE_HEADERS: their
+// values reach the logs, the response headers and the outbound requests of
+// client.New, and are read with request.GetBaggage.
+func WithBaggageHeaders(headers ...string) Option {
+	return func(a *server) {
+		a.cfg.BaggageHeaders = append(a.cfg.BaggageHeaders, headers...)
+	}
+}
+
+// WithIDGenerator generates the IDs of the requests arriving without one,
+// also their correlation IDs, with generate instead of
+// SERVER_REQUEST_ID_FORMAT.
+func WithIDGenerator(generate func() string) Option {
+	return func(a *server) {
+		a.idGenerator = generate
+	}
+}
+
+// WithErrorFormat selects how errors are rendered, request.ErrorFormatResult
+// or the RFC 7807 request.ErrorFormatProblem.
+func WithErrorFormat(format string) Option {
+	return func(a *server) {
+		a.cfg.ErrorFormat = format
+	}
+}
+
+// WithErrorEncoder replaces the encoder of every error response, recovered
+// panics included, overriding the error format.
+func WithErrorEncoder(enc request.ErrorEncoder) Option {
+	return func(a *server) {
+		a.errorEncoder = enc
+	}
+}
+
+// WithLogger sends the logs of the server, and those of request.Logger, to
+// l rather than to the logrus standard logger's output, such as
+// logging.Slog(slog.Default()).
+func WithLogger(l logging.Logger) Option {
+	return func(a *server) {
+		a.logger = l
+	}
+}
@@ -0,0 +1,184 @@
+package ratelimit
+
+// Per client token bucket rate limiting
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-obvious/server/request"
+)
+
+// MaxClients bounds the tracked clients: beyond it, those whose quota has
+// refilled are evicted, or else the least recently seen one.
+const MaxClients = 10000
+
+var ErrTooManyRequests = errors.New(http.StatusText(http.StatusTooManyRequests))
+
+type Config struct {
+	Rate  float64                      // requests per second per client, zero disables limiting
+	Burst int                          // requests allowed at once, defaults to Rate rounded up
+	Key   func(r *http.Request) string // identifies the client, defaults to ClientIP
+	Store Store                        // persists the client quotas across restarts when set
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter allows each client Rate requests per second, with bursts of up
+// to Burst requests.
+type Limiter struct {
+	cfg Config
+
+	mu         sync.Mutex
+	buckets    map[string]*bucket
+	multiplier float64
+	now        func() time.Time
+}
+
+func New(cfg Config) *Limiter {
+	if cfg.Burst <= 0 {
+		cfg.Burst = int(math.Ceil(cfg.Rate))
+	}
+	if cfg.Key == nil {
+		cfg.Key = ClientIP
+	}
+	return &Limiter{
+		cfg:        cfg,
+		buckets:    make(map[string]*bucket),
+		multiplier: 1,
+		now:        time.Now,
+	}
+}
+
+// SetMultiplier scales the rate and burst of every client at runtime, such
+// as 2 to absorb a legitimate surge or 0.5 to shed load. One restores the
+// configured limits.
+func (l *Limiter) SetMultiplier(m float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.multiplier = m
+}
+
+// Multiplier returns the scale of the rate and burst set by SetMultiplier.
+func (l *Limiter) Multiplier() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.multiplier
+}
+
+// limits returns the rate and burst scaled by the multiplier, the burst
+// allowing a request at least.
+func (l *Limiter) limits() (float64, float64) {
+	return l.cfg.Rate * l.multiplier, math.Max(1, math.Round(float64(l.cfg.Burst)*l.multiplier))
+}
+
+// ClientIP keys clients on their IP address, forwarded by the trusted
+// proxies, see request.ClientIP.
+func ClientIP(r *http.Request) string {
+	return request.ClientIP(r)
+}
+
+// RemoteIP keys clients on the host part of the request remote address,
+// such as the proxies when they are not trusted.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Allow reports whether the client may make a request now, consuming a token
+// when it may.
+func (l *Limiter) Allow(key string) bool {
+	return l.AllowN(key, 1)
+}
+
+// AllowN reports whether the client may make a request costing n tokens
+// now, consuming them when it may. A cost over Burst is never allowed.
+func (l *Limiter) AllowN(key string, n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate, burst := l.limits()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= MaxClients {
+			l.evict(now)
+		}
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// evict drops the clients whose bucket has refilled, they are
+// indistinguishable from new clients, or else the least recently seen one.
+func (l *Limiter) evict(now time.Time) {
+	rate, burst := l.limits()
+	var oldest string
+	var oldestLast time.Time
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= burst {
+			delete(l.buckets, key)
+		} else if oldestLast.IsZero() || b.last.Before(oldestLast) {
+			oldest, oldestLast = key, b.last
+		}
+	}
+	if len(l.buckets) >= MaxClients {
+		delete(l.buckets, oldest)
+	}
+}
+
+type clientKeyType int
+
+const clientKey clientKeyType = 0
+
+// client is the client of a request admitted by a limiter.
+type client struct {
+	limiter *Limiter
+	key     string
+}
+
+// Consume charges n more tokens to the client of the request, for the
+// routes costing more than a request, reporting whether it may proceed.
+// Requests not admitted by a limiter always may.
+func Consume(ctx context.Context, n int) bool {
+	c, ok := ctx.Value(clientKey).(client)
+	if !ok || n <= 0 {
+		return true
+	}
+	return c.limiter.AllowN(c.key, n)
+}
+
+// Middleware replies 429 Too Many Requests to clients over their rate.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		key := l.cfg.Key(r)
+		if !l.Allow(key) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(1/(l.cfg.Rate*l.Multiplier())))))
+			request.ReplyErr(w, r, request.NewHTTPError(ErrTooManyRequests, http.StatusTooManyRequests))
+			return
+		}
+		ctx := context.WithValue(r.Context(), clientKey, client{limiter: l, key: key})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
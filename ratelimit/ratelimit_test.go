@@ -0,0 +1,85 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/ratelimit"
+)
+
+func TestAllow(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{Rate: 20, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.Allow("a"), "burst request %d", i)
+	}
+	assert.False(t, l.Allow("a"))
+	assert.True(t, l.Allow("b"), "clients are limited independently")
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := ratelimit.New(ratelimit.Config{Rate: 1}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req.RemoteAddr = "10.0.0.1:5678"
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	// Behind a trusted proxy, the loopback one by default
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", client)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "the forwarded clients are limited independently")
+	}
+}
+
+func TestMaxClients(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{Rate: 0.001, Burst: 1})
+	for i := 0; i <= ratelimit.MaxClients; i++ {
+		assert.True(t, l.Allow(strconv.Itoa(i)))
+	}
+	assert.Len(t, l.Snapshot(), ratelimit.MaxClients, "the least recently seen client is evicted")
+	assert.False(t, l.Allow(strconv.Itoa(ratelimit.MaxClients)), "the latest client is kept")
+}
+
+func TestAllowN(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{Rate: 0.001, Burst: 5})
+	assert.True(t, l.AllowN("a", 4))
+	assert.False(t, l.AllowN("a", 2))
+	assert.True(t, l.AllowN("a", 1))
+	assert.False(t, l.AllowN("b", 6), "a cost over the burst is never allowed")
+	assert.True(t, ratelimit.Consume(context.Background(), 10), "requests not admitted by a limiter")
+}
+
+func TestSetMultiplier(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{Rate: 0.001, Burst: 2})
+	l.SetMultiplier(2)
+	assert.Equal(t, 2.0, l.Multiplier())
+	assert.True(t, l.AllowN("a", 4), "the burst is doubled")
+	assert.False(t, l.Allow("a"))
+
+	l.SetMultiplier(0.5)
+	assert.True(t, l.Allow("b"))
+	assert.False(t, l.Allow("b"), "the burst is halved")
+}
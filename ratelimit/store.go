@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Bucket is the persisted quota of a client.
+type Bucket struct {
+	Tokens float64   `json:"tokens"`
+	Last   time.Time `json:"last"`
+}
+
+// Store persists the quotas of the clients, so a rolling restart does not
+// hand every client a full burst.
+type Store interface {
+	Load(ctx context.Context) (map[string]Bucket, error)
+	Save(ctx context.Context, state map[string]Bucket) error
+}
+
+// FileStore keeps the quotas in a JSON file. A missing file holds no quota.
+type FileStore struct {
+	Path string
+}
+
+func (s FileStore) Load(_ context.Context) (map[string]Bucket, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]Bucket{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Save writes the quotas to a temporary file renamed over the previous one,
+// so a crash never leaves a partial file.
+func (s FileStore) Save(_ context.Context, state map[string]Bucket) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// Snapshot returns the quotas of the clients whose bucket has not refilled,
+// the others being indistinguishable from new clients.
+func (l *Limiter) Snapshot() map[string]Bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate, burst := l.limits()
+	state := make(map[string]Bucket)
+	for key, b := range l.buckets {
+		tokens := b.tokens + now.Sub(b.last).Seconds()*rate
+		if tokens < burst {
+			state[key] = Bucket{Tokens: b.tokens, Last: b.last}
+		}
+	}
+	return state
+}
+
+// Restore sets the quotas of the clients, up to MaxClients.
+func (l *Limiter) Restore(state map[string]Bucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, burst := l.limits()
+	for key, b := range state {
+		if len(l.buckets) >= MaxClients {
+			return
+		}
+		l.buckets[key] = &bucket{
+			tokens: math.Max(0, math.Min(burst, b.Tokens)),
+			last:   b.Last,
+		}
+	}
+}
+
+// Load restores the quotas kept by the store, if any.
+func (l *Limiter) Load(ctx context.Context) error {
+	if l.cfg.Store == nil {
+		return nil
+	}
+	state, err := l.cfg.Store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	l.Restore(state)
+	return nil
+}
+
+// Save persists the quotas to the store, if any.
+func (l *Limiter) Save(ctx context.Context) error {
+	if l.cfg.Store == nil {
+		return nil
+	}
+	return l.cfg.Store.Save(ctx, l.Snapshot())
+}
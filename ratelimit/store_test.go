@@ -0,0 +1,29 @@
+package ratelimit_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/ratelimit"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := ratelimit.FileStore{Path: filepath.Join(t.TempDir(), "ratelimit.json")}
+
+	l := ratelimit.New(ratelimit.Config{Rate: 0.1, Burst: 2, Store: store})
+	require.NoError(t, l.Load(ctx), "a missing file holds no quota")
+	assert.True(t, l.Allow("a"))
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+	require.NoError(t, l.Save(ctx))
+
+	restarted := ratelimit.New(ratelimit.Config{Rate: 0.1, Burst: 2, Store: store})
+	require.NoError(t, restarted.Load(ctx))
+	assert.False(t, restarted.Allow("a"), "the quota survives the restart")
+	assert.True(t, restarted.Allow("b"))
+}
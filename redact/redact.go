@@ -0,0 +1,260 @@
+package redact
+
+// Redaction of the values of sensitive environment variables, headers,
+// query parameters and secrets from the logs and error messages
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces the redacted values.
+const Placeholder = "[REDACTED]"
+
+// minLength is the length below which values are not scrubbed from text,
+// short values such as "1" or "on" being indistinguishable from the rest.
+const minLength = 4
+
+// DefaultPatterns match the names of the usual sensitive environment
+// variables, headers and query parameters.
+var DefaultPatterns = []string{
+	"*secret*", "*token*", "*password*", "*passwd*", "*key*", "*credential*",
+	"*authorization", "*cookie", "*session*", "*signature*",
+}
+
+var (
+	mu       sync.RWMutex
+	patterns = DefaultPatterns
+	values   = map[string]struct{}{}
+)
+
+// SetPatterns replaces the patterns, in path.Match syntax and matched
+// case-insensitively, of the sensitive names. No pattern restores the
+// defaults.
+func SetPatterns(p ...string) error {
+	if len(p) == 0 {
+		p = DefaultPatterns
+	}
+	lowered := make([]string, 0, len(p))
+	for _, pattern := range p {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("redaction pattern %q: %w", pattern, err)
+		}
+		lowered = append(lowered, pattern)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	patterns = lowered
+	return nil
+}
+
+// Sensitive reports whether the environment variable, header or parameter
+// name matches one of the patterns, or one of the extra ones.
+func Sensitive(name string, extra ...string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range extra {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AddValue registers a secret, such as a resolved configuration secret, to
+// be scrubbed by String wherever it appears.
+func AddValue(v string) {
+	if len(v) < minLength {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	values[v] = struct{}{}
+}
+
+// String replaces the registered secrets, the extra ones, such as the ones
+// of RequestSecrets, and the values of the sensitive environment variables
+// found in s.
+func String(s string, extra ...string) string {
+	for _, v := range secrets(extra) {
+		s = strings.ReplaceAll(s, v, Placeholder)
+	}
+	return s
+}
+
+// RequestSecrets returns the values of the sensitive headers, cookies and
+// query parameters of a request, along with the credentials of the
+// Authorization schemes, to be scrubbed from what the request may leak
+// into, such as a panic message.
+func RequestSecrets(r *http.Request) []string {
+	var found []string
+	for name, vs := range r.Header {
+		if !Sensitive(name) {
+			continue
+		}
+		for _, v := range vs {
+			found = append(found, v)
+			found = append(found, strings.Fields(v)...)
+		}
+	}
+	if Sensitive("Cookie") {
+		for _, c := range r.Cookies() {
+			found = append(found, c.Value)
+		}
+	}
+	for name, vs := range r.URL.Query() {
+		if Sensitive(name) {
+			found = append(found, vs...)
+		}
+	}
+	return found
+}
+
+// secrets returns the values to scrub, longest first so a secret holding
+// another one is replaced whole.
+func secrets(extra []string) []string {
+	mu.RLock()
+	found := make([]string, 0, len(values)+len(extra))
+	for v := range values {
+		found = append(found, v)
+	}
+	mu.RUnlock()
+	for _, v := range extra {
+		if len(v) >= minLength {
+			found = append(found, v)
+		}
+	}
+	for _, kv := range os.Environ() {
+		name, v, _ := strings.Cut(kv, "=")
+		if len(v) >= minLength && Sensitive(name) {
+			found = append(found, v)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return len(found[i]) > len(found[j]) })
+	return found
+}
+
+// Error returns err with a redacted message, nil when err is nil. The
+// returned error still unwraps to err.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := String(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redacted{msg: msg, err: err}
+}
+
+type redacted struct {
+	msg string
+	err error
+}
+
+func (e *redacted) Error() string { return e.msg }
+func (e *redacted) Unwrap() error { return e.err }
+
+// Header returns a copy of h whose sensitive header values are redacted.
+func Header(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, vs := range h {
+		if Sensitive(name) {
+			out[name] = []string{Placeholder}
+			continue
+		}
+		redactedValues := make([]string, len(vs))
+		for i, v := range vs {
+			redactedValues[i] = String(v)
+		}
+		out[name] = redactedValues
+	}
+	return out
+}
+
+// jsonField matches the scalar fields of a JSON document, the value of the
+// last one being unterminated in a truncated document.
+var jsonField = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|[-+.\w]+)`)
+
+// JSON redacts the scalar values of the sensitive fields of a JSON
+// document, which may be truncated, the extra patterns also naming
+// sensitive fields.
+func JSON(doc string, extra ...string) string {
+	return jsonField.ReplaceAllStringFunc(doc, func(field string) string {
+		m := jsonField.FindStringSubmatch(field)
+		if !Sensitive(m[1], extra...) {
+			return field
+		}
+		return `"` + m[1] + `"` + m[2] + `"` + Placeholder + `"`
+	})
+}
+
+// URL returns u as a string whose sensitive query parameters, and user
+// password, are redacted.
+func URL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	c := *u
+	if c.User != nil {
+		if _, ok := c.User.Password(); ok {
+			c.User = url.UserPassword(c.User.Username(), Placeholder)
+		}
+	}
+	if c.RawQuery != "" {
+		c.RawQuery = Query(c.RawQuery)
+	}
+	return String(c.String())
+}
+
+// Query redacts the values of the sensitive parameters of a raw query,
+// keeping the order of the other ones, the extra patterns also naming
+// sensitive parameters.
+func Query(rawQuery string, extra ...string) string {
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		key, _, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		if name, err := url.QueryUnescape(key); err == nil && Sensitive(name, extra...) {
+			parts[i] = key + "=" + url.QueryEscape(Placeholder)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Writer returns a writer redacting what is written to w, line by line
+// writes being expected, such as the ones of the flag package.
+func Writer(w io.Writer) io.Writer {
+	return writer{w}
+}
+
+type writer struct {
+	w io.Writer
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,177 @@
+package request
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ContentTypeXML = "application/xml"
+	HeaderAccept   = "Accept"
+)
+
+// Codec encodes the responses and decodes the request bodies of a media
+// type, such as msgpack or CBOR ones built on a third party library:
+//
+//	type msgpackCodec struct{}
+//
+//	func (msgpackCodec) Encode(w io.Writer, v interface{}) error { return msgpack.NewEncoder(w).Encode(v) }
+//	func (msgpackCodec) Decode(r io.Reader, v interface{}) error { return msgpack.NewDecoder(r).Decode(v) }
+//
+//	request.RegisterCodec("application/msgpack", msgpackCodec{})
+type Codec interface {
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		ContentTypeJSON: JSONCodec{},
+	}
+)
+
+// RegisterCodec makes Reply honor the Accept header asking for mediaType,
+// and GetBody decode the bodies of this Content-Type, with the codec.
+func RegisterCodec(mediaType string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToLower(mediaType)] = c
+}
+
+// DeregisterCodec removes the codec of mediaType registered with
+// RegisterCodec. Removing the JSON one restores the default JSONCodec,
+// JSON being the fallback of every negotiation.
+func DeregisterCodec(mediaType string) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	mediaType = strings.ToLower(mediaType)
+	if mediaType == ContentTypeJSON {
+		codecs[mediaType] = JSONCodec{}
+		return
+	}
+	delete(codecs, mediaType)
+}
+
+func codecOf(mediaType string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[mediaType]
+	return c, ok
+}
+
+// Negotiate returns the media type and codec of the response preferred by
+// the Accept header of the request, JSON when there is no acceptable one.
+func Negotiate(r *http.Request) (string, Codec) {
+	accept := r.Header.Get(HeaderAccept)
+	switch accept {
+	case "", "*/*", ContentTypeJSON:
+		// The usual cases, without parsing
+		c, _ := codecOf(ContentTypeJSON)
+		return ContentTypeJSON, c
+	}
+	best, bestQ := ContentTypeJSON, 0.0
+	for _, accepted := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		if candidate, ok := matchCodec(mediaType); ok {
+			best, bestQ = candidate, q
+		}
+	}
+	c, _ := codecOf(best)
+	return best, c
+}
+
+// matchCodec returns the registered media type matching a media range,
+// JSON being preferred for wildcards.
+func matchCodec(mediaRange string) (string, bool) {
+	if _, ok := codecOf(mediaRange); ok {
+		return mediaRange, true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "/*")
+	if !ok {
+		return "", false
+	}
+	if prefix == "*" || prefix == "application" {
+		return ContentTypeJSON, true
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for t := range codecs {
+		if strings.HasPrefix(t, prefix+"/") {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// JSONCodec is the default codec, leaving HTML characters unescaped.
+type JSONCodec struct {
+	Indent string
+}
+
+func (c JSONCodec) Encode(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if c.Indent != "" {
+		encoder.SetIndent("", c.Indent)
+	}
+	return encoder.Encode(v)
+}
+
+func (JSONCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// XMLCodec encodes the values without XMLName field, such as the generic
+// responses, under a <response> root element. It is not registered by
+// default:
+//
+//	request.RegisterCodec(request.ContentTypeXML, request.XMLCodec{})
+//	request.RegisterCodec("text/xml", request.XMLCodec{})
+type XMLCodec struct{}
+
+func (XMLCodec) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	if hasXMLName(v) {
+		return encoder.Encode(v)
+	}
+	return encoder.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "response"}})
+}
+
+func (XMLCodec) Decode(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+func hasXMLName(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+	_, ok := t.FieldByName("XMLName")
+	return ok
+}
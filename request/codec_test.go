@@ -0,0 +1,103 @@
+package request_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/request"
+)
+
+type order struct {
+	ID   int    `json:"id" xml:"id"`
+	Note string `json:"note" xml:"note"`
+}
+
+// gobCodec stands for a third party binary codec, such as msgpack
+type gobCodec struct{}
+
+func (gobCodec) Encode(w io.Writer, v interface{}) error { return gob.NewEncoder(w).Encode(v) }
+func (gobCodec) Decode(r io.Reader, v interface{}) error { return gob.NewDecoder(r).Decode(v) }
+
+// registerCodec registers the codec for the duration of the test
+func registerCodec(t *testing.T, mediaType string, c request.Codec) {
+	request.RegisterCodec(mediaType, c)
+	t.Cleanup(func() { request.DeregisterCodec(mediaType) })
+}
+
+func TestNegotiate(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(request.HeaderAccept, "application/xml")
+	got, _ := request.Negotiate(r)
+	assert.Equal(t, request.ContentTypeJSON, got, "XML is opt-in")
+
+	registerCodec(t, "application/x-gob", gobCodec{})
+	registerCodec(t, request.ContentTypeXML, request.XMLCodec{})
+	registerCodec(t, "text/xml", request.XMLCodec{})
+
+	for accept, want := range map[string]string{
+		"":                                    request.ContentTypeJSON,
+		"*/*":                                 request.ContentTypeJSON,
+		"text/html":                           request.ContentTypeJSON,
+		"application/xml":                     request.ContentTypeXML,
+		"text/*":                              "text/xml",
+		"application/json;q=0.5, text/xml":    "text/xml",
+		"application/xml;q=0.2, */*;q=0.8":    request.ContentTypeJSON,
+		"application/x-gob, application/json": "application/x-gob",
+		"application/xml;q=bogus, text/plain": request.ContentTypeJSON,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(request.HeaderAccept, accept)
+		got, codec := request.Negotiate(r)
+		assert.Equal(t, want, got, accept)
+		assert.NotNil(t, codec, accept)
+	}
+}
+
+func TestReplyXML(t *testing.T) {
+	registerCodec(t, request.ContentTypeXML, request.XMLCodec{})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(request.HeaderAccept, "application/xml")
+	w := httptest.NewRecorder()
+	request.Reply(r, w, request.SingleResponse[order]{Status: request.NewResult(), Data: order{ID: 1, Note: "a<b"}}, http.StatusOK)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, request.ContentTypeXML, w.Header().Get(request.HeaderContentType))
+	assert.Equal(t, request.HeaderAccept, w.Header().Get("Vary"))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<response><status><success>true</success></status><data><id>1</id><note>a&lt;b</note></data></response>`,
+		w.Body.String())
+}
+
+func TestGetBodyCodecs(t *testing.T) {
+	registerCodec(t, "application/x-gob", gobCodec{})
+	registerCodec(t, request.ContentTypeXML, request.XMLCodec{})
+
+	var buf bytes.Buffer
+	require.NoError(t, gobCodec{}.Encode(&buf, order{ID: 7, Note: "gob"}))
+
+	for contentType, body := range map[string]string{
+		"application/x-gob":                 buf.String(),
+		"application/xml; charset=utf-8":    `<order><id>7</id><note>gob</note></order>`,
+		"application/json":                  `{"id": 7, "note": "gob"}`,
+		"application/x-www-form-urlencoded": `{"id": 7, "note": "gob"}`, // decoded as JSON
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(request.HeaderContentType, contentType)
+		var got order
+		require.NoError(t, request.GetBody(httptest.NewRecorder(), r, &got), contentType)
+		assert.Equal(t, order{ID: 7, Note: "gob"}, got, contentType)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("<order><id>"))
+	r.Header.Set(request.HeaderContentType, request.ContentTypeXML)
+	assert.ErrorContains(t, request.GetBody(httptest.NewRecorder(), r, &order{}), "malformed application/xml document")
+}
@@ -0,0 +1,57 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	ContentTypeForm        = "application/x-www-form-urlencoded"
+	ContentTypeMultipart   = "multipart/form-data"
+	ContentTypeOctetStream = "application/octet-stream"
+)
+
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// RequireContentType replies 415 Unsupported Media Type to the requests
+// carrying a body whose Content-Type is none of types, ignoring parameters
+// such as the charset. A "type/*" entry accepts any subtype.
+//
+//	r.With(request.RequireContentType(request.ContentTypeJSON)).Post("/", create)
+func RequireContentType(types ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get(HeaderContentType))
+			if err != nil || !matchMediaType(mediaType, types) {
+				w.Header().Set("Accept", strings.Join(types, ", "))
+				ReplyErr(w, r, NewHTTPError(
+					fmt.Errorf("%w %q, expecting %s", ErrUnsupportedMediaType, r.Header.Get(HeaderContentType), strings.Join(types, " or ")),
+					http.StatusUnsupportedMediaType,
+				))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func matchMediaType(mediaType string, types []string) bool {
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
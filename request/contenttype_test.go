@@ -0,0 +1,45 @@
+package request_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/request"
+)
+
+func TestRequireContentType(t *testing.T) {
+	handler := request.RequireContentType(request.ContentTypeJSON, "text/*")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		expected    int
+	}{
+		{name: "JSON", body: `{}`, contentType: "application/json; charset=utf-8", expected: http.StatusNoContent},
+		{name: "Wildcard", body: "hello", contentType: "text/plain", expected: http.StatusNoContent},
+		{name: "Form", body: "a=b", contentType: request.ContentTypeForm, expected: http.StatusUnsupportedMediaType},
+		{name: "Missing", body: `{}`, expected: http.StatusUnsupportedMediaType},
+		{name: "No body", expected: http.StatusNoContent},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set(request.HeaderContentType, tc.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tc.expected, rr.Code)
+			if tc.expected == http.StatusUnsupportedMediaType {
+				assert.Contains(t, rr.Body.String(), "unsupported media type")
+			}
+		})
+	}
+}
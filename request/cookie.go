@@ -0,0 +1,146 @@
+package request
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-obvious/server/keys"
+)
+
+// MinCookieKeyLength is the length of the shortest key accepted, such as
+// the 44 characters of "openssl rand -base64 32".
+const MinCookieKeyLength = 32
+
+// maxCookieSize is the size of the largest cookie the browsers keep.
+const maxCookieSize = 4096
+
+var (
+	ErrNoCookieKeys   = errors.New("no cookie encryption key")
+	ErrCookieKey      = fmt.Errorf("cookie encryption key shorter than %d characters", MinCookieKeyLength)
+	ErrInvalidCookie  = errors.New("invalid cookie")
+	ErrCookieTooLarge = errors.New("cookie too large")
+)
+
+var (
+	cookieMu   sync.RWMutex
+	cookieRing = &keys.Ring{}
+)
+
+// SetCookieKeys replaces the keys of the encrypted cookies. Cookies are
+// encrypted with the first key and decrypted with any of them, so a new key
+// is put first while the previous ones keep decrypting the cookies issued
+// before the rotation.
+func SetCookieKeys(secrets ...string) error {
+	for _, secret := range secrets {
+		if len(secret) < MinCookieKeyLength {
+			return ErrCookieKey
+		}
+	}
+	SetCookieRing(keys.FromSecrets(secrets...))
+	return nil
+}
+
+// SetCookieRing sets the ring of the keys of the encrypted cookies, to
+// share it with the other uses of the keys or rotate them with Watch.
+func SetCookieRing(ring *keys.Ring) {
+	cookieMu.Lock()
+	defer cookieMu.Unlock()
+	cookieRing = ring
+}
+
+func cookieKeys() *keys.Ring {
+	cookieMu.RLock()
+	defer cookieMu.RUnlock()
+	return cookieRing
+}
+
+// SetEncryptedCookie sets the cookie with its value encrypted and
+// authenticated, bound to the name and expiry of the cookie. Its other
+// attributes, such as HttpOnly, Secure and SameSite, are sent as set.
+//
+//	err := request.SetEncryptedCookie(w, &http.Cookie{
+//		Name: "cart", Value: cartID, Path: "/", MaxAge: 3600,
+//		HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode,
+//	})
+func SetEncryptedCookie(w http.ResponseWriter, cookie *http.Cookie) error {
+	key, err := cookieKeys().Current()
+	if err != nil {
+		return ErrNoCookieKeys
+	}
+	aead, err := key.AEAD()
+	if err != nil {
+		return err
+	}
+
+	// The expiry is sealed along with the value, so it is enforced whatever
+	// the client keeps
+	var expires int64
+	switch {
+	case cookie.MaxAge > 0:
+		expires = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second).Unix()
+	case !cookie.Expires.IsZero():
+		expires = cookie.Expires.Unix()
+	}
+	plaintext := binary.BigEndian.AppendUint64(nil, uint64(expires))
+	plaintext = append(plaintext, cookie.Value...)
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(cookie.Name))
+
+	encrypted := *cookie
+	encrypted.Value = key.ID + "." + base64.RawURLEncoding.EncodeToString(sealed)
+	if len(encrypted.String()) > maxCookieSize {
+		return ErrCookieTooLarge
+	}
+	http.SetCookie(w, &encrypted)
+	return nil
+}
+
+// GetEncryptedCookie returns the decrypted value of the named cookie set by
+// SetEncryptedCookie, http.ErrNoCookie when absent and ErrInvalidCookie
+// when it was tampered with, expired or encrypted with a retired key.
+func GetEncryptedCookie(r *http.Request, name string) (string, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	ring := cookieKeys()
+	if _, err := ring.Current(); err != nil {
+		return "", ErrNoCookieKeys
+	}
+	id, encoded, _ := strings.Cut(cookie.Value, ".")
+	key, ok := ring.Lookup(id)
+	if !ok {
+		return "", ErrInvalidCookie
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	aead, err := key.AEAD()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidCookie
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil || len(plaintext) < 8 {
+		return "", ErrInvalidCookie
+	}
+	if expires := int64(binary.BigEndian.Uint64(plaintext)); expires != 0 && time.Now().Unix() >= expires {
+		return "", ErrInvalidCookie
+	}
+	return string(plaintext[8:]), nil
+}
@@ -0,0 +1,106 @@
+package request_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/keys"
+	"github.com/go-obvious/server/request"
+)
+
+const (
+	oldKey = "0123456789abcdef0123456789abcdef-old"
+	newKey = "0123456789abcdef0123456789abcdef-new"
+)
+
+// roundTrip returns a request carrying the cookies set on w.
+func roundTrip(w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestEncryptedCookie(t *testing.T) {
+	require.NoError(t, request.SetCookieKeys(oldKey))
+	t.Cleanup(func() { _ = request.SetCookieKeys() })
+
+	w := httptest.NewRecorder()
+	require.NoError(t, request.SetEncryptedCookie(w, &http.Cookie{Name: "cart", Value: "42; items=3", HttpOnly: true, MaxAge: 60}))
+	set := w.Result().Cookies()[0]
+	assert.NotContains(t, set.Value, "items=", "the value is not readable")
+	assert.True(t, set.HttpOnly)
+	assert.Equal(t, 60, set.MaxAge)
+
+	value, err := request.GetEncryptedCookie(roundTrip(w), "cart")
+	require.NoError(t, err)
+	assert.Equal(t, "42; items=3", value)
+
+	// Rotated, the cookies issued with the previous key are still read
+	require.NoError(t, request.SetCookieKeys(newKey, oldKey))
+	value, err = request.GetEncryptedCookie(roundTrip(w), "cart")
+	require.NoError(t, err)
+	assert.Equal(t, "42; items=3", value)
+
+	// Retired, they are not
+	require.NoError(t, request.SetCookieKeys(newKey))
+	_, err = request.GetEncryptedCookie(roundTrip(w), "cart")
+	assert.ErrorIs(t, err, request.ErrInvalidCookie)
+
+	_, err = request.GetEncryptedCookie(roundTrip(w), "session")
+	assert.ErrorIs(t, err, http.ErrNoCookie)
+}
+
+func TestEncryptedCookieInvalid(t *testing.T) {
+	require.NoError(t, request.SetCookieKeys(newKey))
+	t.Cleanup(func() { _ = request.SetCookieKeys() })
+
+	w := httptest.NewRecorder()
+	require.NoError(t, request.SetEncryptedCookie(w, &http.Cookie{Name: "cart", Value: "42"}))
+	sealed := w.Result().Cookies()[0].Value
+
+	get := func(name, value string) error {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: name, Value: value})
+		_, err := request.GetEncryptedCookie(r, name)
+		return err
+	}
+	tampered := []byte(sealed)
+	tampered[len(tampered)-2] ^= 1
+	assert.ErrorIs(t, get("cart", string(tampered)), request.ErrInvalidCookie)
+	assert.ErrorIs(t, get("session", sealed), request.ErrInvalidCookie, "bound to the cookie name")
+	assert.ErrorIs(t, get("cart", "not base64!"), request.ErrInvalidCookie)
+	assert.ErrorIs(t, get("cart", "c2hvcnQ"), request.ErrInvalidCookie)
+
+	w = httptest.NewRecorder()
+	require.NoError(t, request.SetEncryptedCookie(w, &http.Cookie{Name: "cart", Value: "42", Expires: time.Now().Add(-time.Minute)}))
+	_, err := request.GetEncryptedCookie(roundTrip(w), "cart")
+	assert.ErrorIs(t, err, request.ErrInvalidCookie, "the sealed expiry is enforced")
+
+	assert.ErrorIs(t, request.SetEncryptedCookie(httptest.NewRecorder(), &http.Cookie{Name: "cart", Value: strings.Repeat("x", 4096)}), request.ErrCookieTooLarge)
+	assert.ErrorIs(t, request.SetCookieKeys("short"), request.ErrCookieKey)
+	require.NoError(t, request.SetCookieKeys())
+	assert.ErrorIs(t, request.SetEncryptedCookie(httptest.NewRecorder(), &http.Cookie{Name: "cart", Value: "42"}), request.ErrNoCookieKeys)
+}
+
+func TestEncryptedCookieRing(t *testing.T) {
+	ring := keys.FromSecrets(oldKey)
+	request.SetCookieRing(ring)
+	t.Cleanup(func() { _ = request.SetCookieKeys() })
+
+	w := httptest.NewRecorder()
+	require.NoError(t, request.SetEncryptedCookie(w, &http.Cookie{Name: "cart", Value: "42"}))
+	assert.True(t, strings.HasPrefix(w.Result().Cookies()[0].Value, keys.ID([]byte(oldKey))+"."), "tagged with the key ID")
+
+	require.NoError(t, ring.Rotate(keys.Key{ID: "v2", Secret: []byte(newKey)}))
+	value, err := request.GetEncryptedCookie(roundTrip(w), "cart")
+	require.NoError(t, err)
+	assert.Equal(t, "42", value)
+}
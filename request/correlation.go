@@ -0,0 +1,95 @@
+package request
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-obvious/server/internal/middleware/requestid"
+)
+
+const (
+	HeaderRequestID     = requestid.HeaderRequestID
+	HeaderCorrelationID = requestid.HeaderCorrelationID
+	HeaderTraceID       = requestid.HeaderTraceID
+	HeaderTraceParent   = requestid.HeaderTraceParent
+	HeaderTraceState    = requestid.HeaderTraceState
+
+	HeaderB3             = requestid.HeaderB3
+	HeaderB3TraceID      = requestid.HeaderB3TraceID
+	HeaderB3SpanID       = requestid.HeaderB3SpanID
+	HeaderB3ParentSpanID = requestid.HeaderB3ParentSpanID
+	HeaderB3Sampled      = requestid.HeaderB3Sampled
+	HeaderB3Flags        = requestid.HeaderB3Flags
+)
+
+// Policies of the request, correlation and trace IDs supplied by the
+// clients, see server.WithRequestIDPolicy
+const (
+	RequestIDEcho     = requestid.PolicyEcho
+	RequestIDSanitize = requestid.PolicySanitize
+	RequestIDReplace  = requestid.PolicyReplace
+	RequestIDReject   = requestid.PolicyReject
+)
+
+// GetRequestID returns the ID assigned to the current request.
+func GetRequestID(ctx context.Context) string {
+	if rid := requestid.GetContext(ctx); rid != nil {
+		return rid.RequestID
+	}
+	return ""
+}
+
+// GetCorrelationID returns the ID shared by all requests of a single operation.
+// It defaults to the request ID when the caller did not provide one.
+func GetCorrelationID(ctx context.Context) string {
+	if rid := requestid.GetContext(ctx); rid != nil {
+		return rid.CorrelationID
+	}
+	return ""
+}
+
+// GetTraceID returns the trace ID provided by the caller, or the one of the
+// trace context.
+func GetTraceID(ctx context.Context) string {
+	if rid := requestid.GetContext(ctx); rid != nil {
+		return rid.TraceID
+	}
+	return ""
+}
+
+// GetTraceParent returns the W3C traceparent header provided by the caller,
+// converted from its B3 headers or generated.
+func GetTraceParent(ctx context.Context) string {
+	if rid := requestid.GetContext(ctx); rid != nil {
+		return rid.TraceParent
+	}
+	return ""
+}
+
+// GetTraceState returns the W3C tracestate header provided by the caller,
+// if any.
+func GetTraceState(ctx context.Context) string {
+	if rid := requestid.GetContext(ctx); rid != nil {
+		return rid.TraceState
+	}
+	return ""
+}
+
+// GetBaggage returns the value of the baggage header, one of
+// SERVER_BAGGAGE_HEADERS, provided by the caller, if any.
+func GetBaggage(ctx context.Context, header string) string {
+	if rid := requestid.GetContext(ctx); rid != nil {
+		return rid.Baggage[http.CanonicalHeaderKey(header)]
+	}
+	return ""
+}
+
+// TraceHeaders returns the headers propagating the request, correlation and
+// trace IDs of ctx, along with its W3C trace context and the B3 and
+// baggage headers of the caller, to an outbound request.
+func TraceHeaders(ctx context.Context) map[string]string {
+	if rid := requestid.GetContext(ctx); rid != nil {
+		return rid.Headers()
+	}
+	return map[string]string{}
+}
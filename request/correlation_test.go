@@ -0,0 +1,48 @@
+package request_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/internal/middleware/requestid"
+	"github.com/go-obvious/server/request"
+)
+
+func TestCorrelationAccessors(t *testing.T) {
+	handler := requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-request-id", request.GetRequestID(r.Context()))
+		assert.Equal(t, "test-correlation-id", request.GetCorrelationID(r.Context()))
+		assert.Equal(t, "test-trace-id", request.GetTraceID(r.Context()))
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", request.GetTraceParent(r.Context()))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(request.HeaderRequestID, "test-request-id")
+	req.Header.Set(request.HeaderCorrelationID, "test-correlation-id")
+	req.Header.Set(request.HeaderTraceID, "test-trace-id")
+	req.Header.Set(request.HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Empty(t, request.GetRequestID(context.Background()))
+	assert.Empty(t, request.GetCorrelationID(context.Background()))
+	assert.Empty(t, request.GetTraceID(context.Background()))
+}
+
+func TestGetBaggage(t *testing.T) {
+	ids, err := requestid.New(requestid.Config{Policy: request.RequestIDSanitize, Baggage: []string{"X-Tenant-ID"}})
+	assert.NoError(t, err)
+	handler := ids(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "acme", request.GetBaggage(r.Context(), "x-tenant-id"))
+		assert.Equal(t, "acme", request.TraceHeaders(r.Context())["X-Tenant-Id"])
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Empty(t, request.GetBaggage(context.Background(), "X-Tenant-ID"))
+}
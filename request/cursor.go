@@ -0,0 +1,135 @@
+package request
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-obvious/server/keys"
+)
+
+var (
+	ErrCursorInvalid = errors.New("invalid cursor")
+	ErrCursorExpired = errors.New("cursor expired")
+	ErrCursorNoKey   = errors.New("no cursor signing key")
+)
+
+// CursorInfo is the content of a signed cursor.
+type CursorInfo struct {
+	Position  string    `json:"p"`
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp,omitempty"`
+}
+
+// CursorSigner issues cursors signed with Key, carrying their issue time
+// and, when TTL is set, their expiry. Backends may prune the snapshot state
+// behind a cursor once it expired, clients presenting it are answered
+// 410 Gone.
+type CursorSigner struct {
+	Key []byte
+	TTL time.Duration
+
+	// Keys, when set in place of Key, sign the cursors with their current
+	// key, tagging them with its ID so the cursors issued before a rotation
+	// stay valid until the key is retired
+	Keys *keys.Ring
+}
+
+// NewCursorSigner returns a signer of the cursors with the key, which must
+// not be empty as anyone could forge the cursors signed with it.
+func NewCursorSigner(key []byte, ttl time.Duration) (*CursorSigner, error) {
+	if len(key) == 0 {
+		return nil, ErrCursorNoKey
+	}
+	return &CursorSigner{Key: key, TTL: ttl}, nil
+}
+
+// Encode signs a backend position into an opaque cursor.
+func (s *CursorSigner) Encode(position string) string {
+	info := CursorInfo{Position: position, IssuedAt: time.Now().UTC().Truncate(time.Second)}
+	if s.TTL > 0 {
+		info.ExpiresAt = info.IssuedAt.Add(s.TTL)
+	}
+	payload, _ := json.Marshal(info)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	if s.Keys != nil {
+		// Without key, the cursor is refused when presented
+		tag, _ := s.Keys.Sign([]byte(encoded))
+		return encoded + "." + tag
+	}
+	return encoded + "." + s.sign(encoded)
+}
+
+// Decode verifies a cursor. Tampered cursors fail with ErrCursorInvalid
+// and expired ones with ErrCursorExpired, as ResponseErrors replying
+// 400 Bad Request and 410 Gone.
+func (s *CursorSigner) Decode(cursor string) (CursorInfo, error) {
+	var info CursorInfo
+	encoded, sig, ok := strings.Cut(cursor, ".")
+	if !ok || !s.verify(encoded, sig) {
+		return info, NewHTTPError(ErrCursorInvalid, http.StatusBadRequest)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &info) != nil {
+		return info, NewHTTPError(ErrCursorInvalid, http.StatusBadRequest)
+	}
+	if !info.ExpiresAt.IsZero() && !time.Now().Before(info.ExpiresAt) {
+		return info, NewHTTPError(ErrCursorExpired, http.StatusGone)
+	}
+	return info, nil
+}
+
+func (s *CursorSigner) verify(encoded, sig string) bool {
+	if s.Keys != nil {
+		return s.Keys.Verify([]byte(encoded), sig) == nil
+	}
+	if len(s.Key) == 0 {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.sign(encoded)))
+}
+
+func (s *CursorSigner) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewCursor signs the previous and next positions, an empty position has
+// no cursor. The expiry of the cursors is reported when TTL is set.
+func (s *CursorSigner) NewCursor(prev, next string) Cursor {
+	c := Cursor{prev: prev, next: next}
+	if prev != "" {
+		v := s.Encode(prev)
+		c.Prev = &v
+	}
+	if next != "" {
+		v := s.Encode(next)
+		c.Next = &v
+	}
+	if s.TTL > 0 && (c.Prev != nil || c.Next != nil) {
+		expires := time.Now().UTC().Truncate(time.Second).Add(s.TTL)
+		c.ExpiresAt = &expires
+	}
+	return c
+}
+
+// GetPagingOpts extracts the pagination options of the request, replacing
+// the cursor with the position it was signed for.
+func (s *CursorSigner) GetPagingOpts(r *http.Request) (PaginationOptions, error) {
+	opts := GetPagingOpts(r)
+	if opts.Cursor == DefaultCursor {
+		return opts, nil
+	}
+	info, err := s.Decode(opts.Cursor)
+	if err != nil {
+		return opts, err
+	}
+	opts.Cursor = info.Position
+	return opts, nil
+}
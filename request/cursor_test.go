@@ -0,0 +1,82 @@
+package request_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/keys"
+	"github.com/go-obvious/server/request"
+)
+
+func TestCursorSigner(t *testing.T) {
+	_, err := request.NewCursorSigner(nil, time.Hour)
+	assert.ErrorIs(t, err, request.ErrCursorNoKey)
+
+	signer, err := request.NewCursorSigner([]byte("key"), time.Hour)
+	require.NoError(t, err)
+
+	cursor := signer.Encode("offset:100")
+	info, err := signer.Decode(cursor)
+	require.NoError(t, err)
+	assert.Equal(t, "offset:100", info.Position)
+	assert.Equal(t, info.IssuedAt.Add(time.Hour), info.ExpiresAt)
+
+	_, err = (&request.CursorSigner{Key: []byte("other")}).Decode(cursor)
+	assert.ErrorIs(t, err, request.ErrCursorInvalid)
+	assert.True(t, request.HasCode(err, http.StatusBadRequest))
+
+	unkeyed := &request.CursorSigner{}
+	_, err = unkeyed.Decode(unkeyed.Encode("offset:100"))
+	assert.ErrorIs(t, err, request.ErrCursorInvalid, "refused without key")
+
+	expired := (&request.CursorSigner{Key: []byte("key"), TTL: time.Nanosecond}).Encode("offset:100")
+	_, err = signer.Decode(expired)
+	assert.True(t, errors.Is(err, request.ErrCursorExpired))
+	assert.True(t, request.HasCode(err, http.StatusGone))
+}
+
+func TestCursorSignerKeys(t *testing.T) {
+	ring := keys.FromSecrets("first-secret")
+	signer := &request.CursorSigner{Keys: ring}
+	cursor := signer.Encode("offset:100")
+
+	require.NoError(t, ring.Rotate(keys.Key{ID: "v2", Secret: []byte("second-secret")}))
+	info, err := signer.Decode(cursor)
+	require.NoError(t, err, "issued before the rotation")
+	assert.Equal(t, "offset:100", info.Position)
+
+	ring.Retire(keys.ID([]byte("first-secret")))
+	_, err = signer.Decode(cursor)
+	assert.ErrorIs(t, err, request.ErrCursorInvalid)
+	_, err = signer.Decode(signer.Encode("offset:100"))
+	assert.NoError(t, err)
+}
+
+func TestCursorSignerPaging(t *testing.T) {
+	signer := &request.CursorSigner{Key: []byte("key"), TTL: time.Hour}
+
+	cursor := signer.NewCursor("", "offset:100")
+	assert.Nil(t, cursor.Prev)
+	require.NotNil(t, cursor.Next)
+	require.NotNil(t, cursor.ExpiresAt)
+
+	opts, err := signer.GetPagingOpts(httptest.NewRequest(http.MethodGet, "/items?cursor="+*cursor.Next, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "offset:100", opts.Cursor)
+
+	list := request.ListResponse[string]{Cursor: cursor, Data: []string{"a"}}
+	etag, err := list.ETag()
+	require.NoError(t, err)
+
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	list.Cursor = signer.NewCursor("", "offset:100")
+	reissued, err := list.ETag()
+	require.NoError(t, err)
+	assert.Equal(t, etag, reissued, "reissued cursors keep the entity tag")
+}
@@ -0,0 +1,113 @@
+package request
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	HeaderContentDisposition = "Content-Disposition"
+
+	DispositionInline     = "inline"
+	DispositionAttachment = "attachment"
+
+	maxFilenameLength = 255
+)
+
+// ContentDisposition returns a RFC 6266 Content-Disposition value for the
+// user supplied filename, sanitized by SafeFilename. Non ASCII names are
+// sent in a UTF-8 filename* parameter along with an ASCII fallback:
+//
+//	attachment; filename="rapport _.pdf"; filename*=UTF-8''rapport%20%E2%82%AC.pdf
+func ContentDisposition(disposition, filename string) string {
+	if disposition != DispositionInline {
+		disposition = DispositionAttachment
+	}
+	filename = SafeFilename(filename)
+
+	var fallback strings.Builder
+	ascii := true
+	for _, r := range filename {
+		if r > unicode.MaxASCII {
+			ascii = false
+			r = '_'
+		}
+		fallback.WriteRune(r)
+	}
+	value := fmt.Sprintf(`%s; filename="%s"`, disposition, fallback.String())
+	if !ascii {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return value
+}
+
+// SetContentDisposition sets the Content-Disposition header of the response.
+func SetContentDisposition(w http.ResponseWriter, disposition, filename string) {
+	w.Header().Set(HeaderContentDisposition, ContentDisposition(disposition, filename))
+}
+
+// SafeFilename reduces a user supplied filename to its base name, dropping
+// the control characters, quotes and backslashes which could inject headers
+// or escape the quoted parameter, and bounding its length. An empty result
+// is replaced by "download".
+func SafeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for len(name) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" || name == ".." {
+		return "download"
+	}
+	return name
+}
+
+// InlineSafe reports whether a content type may be displayed inline, the
+// active ones, such as HTML, SVG or scripts, running in the origin of the
+// server when opened.
+func InlineSafe(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"):
+		return true
+	}
+	switch mediaType {
+	case "application/pdf", "text/plain", "text/csv", ContentTypeJSON:
+		return true
+	}
+	return false
+}
+
+// encodeRFC5987 percent encodes the bytes outside the RFC 5987 attr-char set.
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package request_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/request"
+)
+
+func TestContentDisposition(t *testing.T) {
+	for _, tt := range []struct {
+		disposition, filename, want string
+	}{
+		{request.DispositionInline, "invoice.pdf", `inline; filename="invoice.pdf"`},
+		{request.DispositionAttachment, "Größe 1.pdf", `attachment; filename="Gr__e 1.pdf"; filename*=UTF-8''Gr%C3%B6%C3%9Fe%201.pdf`},
+		{"bogus", "a.pdf", `attachment; filename="a.pdf"`},
+		{request.DispositionAttachment, "x.pdf\"\r\nSet-Cookie: a=b", `attachment; filename="x.pdfSet-Cookie: a=b"`},
+		{request.DispositionAttachment, `..\..\etc/passwd`, `attachment; filename="passwd"`},
+		{request.DispositionAttachment, "\r\n", `attachment; filename="download"`},
+	} {
+		got := request.ContentDisposition(tt.disposition, tt.filename)
+		assert.Equal(t, tt.want, got, tt.filename)
+		assert.NotContains(t, got, "\n")
+	}
+	assert.Len(t, request.SafeFilename(strings.Repeat("é", 300)), 254, "bounded without splitting a rune")
+}
+
+func TestInlineSafe(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"application/pdf":           true,
+		"image/png":                 true,
+		"text/plain; charset=utf-8": true,
+		"image/svg+xml":             false,
+		"text/html":                 false,
+		"application/javascript":    false,
+		"application/octet-stream":  false,
+		"":                          false,
+	} {
+		assert.Equal(t, want, request.InlineSafe(contentType), contentType)
+	}
+}
@@ -0,0 +1,114 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const (
+	// Error formats of ReplyErr
+	ErrorFormatResult  = "result"  // {"success": false, "error": "..."}
+	ErrorFormatProblem = "problem" // RFC 7807 application/problem+json
+)
+
+// ErrorEncoder writes the response of an error, its status being the one
+// returned by HTTPStatus.
+type ErrorEncoder func(w http.ResponseWriter, r *http.Request, err error)
+
+var (
+	errorFormatMu sync.RWMutex
+	errorFormat   = ErrorFormatResult
+	errorEncoder  ErrorEncoder // overrides the format when set
+)
+
+// SetErrorFormat selects how ReplyErr renders errors, ErrorFormatResult or
+// ErrorFormatProblem. Problem errors are rendered as such regardless.
+func SetErrorFormat(format string) error {
+	switch format {
+	case ErrorFormatResult, ErrorFormatProblem:
+	default:
+		return fmt.Errorf("unknown error format %q", format)
+	}
+	errorFormatMu.Lock()
+	defer errorFormatMu.Unlock()
+	errorFormat = format
+	return nil
+}
+
+// ErrorFormat returns the format selected with SetErrorFormat.
+func ErrorFormat() string {
+	errorFormatMu.RLock()
+	defer errorFormatMu.RUnlock()
+	return errorFormat
+}
+
+// SetErrorEncoder replaces the encoder of every error response: the ones of
+// ReplyErr, of the recovered panics and of the rendered ResponseErrors. Nil
+// restores the encoder of the error format.
+func SetErrorEncoder(enc ErrorEncoder) {
+	errorFormatMu.Lock()
+	defer errorFormatMu.Unlock()
+	errorEncoder = enc
+}
+
+func encodeError(w http.ResponseWriter, r *http.Request, err error) {
+	err = mapError(err)
+
+	errorFormatMu.RLock()
+	enc, format := errorEncoder, errorFormat
+	errorFormatMu.RUnlock()
+
+	var p *Problem
+	switch {
+	case enc != nil:
+		enc(w, r, err)
+	case format == ErrorFormatProblem || errors.As(err, &p):
+		ReplyProblem(w, r, err)
+	default:
+		EncodeResult(w, r, err)
+	}
+}
+
+// EncodeResult writes err as a Result, {"success": false, "error": "..."},
+// along with its application code if any.
+func EncodeResult(w http.ResponseWriter, r *http.Request, err error) {
+	reply(r, w, Result{Error: ErrorMessage(err), Code: appCode(err)}, HTTPStatus(err), false)
+}
+
+// HTTPStatus returns the status code carried by err, or one of the errors
+// it wraps, 500 Internal Server Error by default.
+func HTTPStatus(err error) int {
+	var hec HTTPErrorCoder
+	if errors.As(err, &hec) && hec.HTTPCode() != 0 {
+		return hec.HTTPCode()
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorMessage returns the message of err shown to clients, the status text
+// of a ResponseError carrying no error.
+func ErrorMessage(err error) string {
+	if err == nil {
+		return "unexpected server error"
+	}
+	var re *ResponseError
+	if errors.As(err, &re) && re.Err == nil && re.CallerInfo == "" {
+		switch {
+		case re.ErrorText != "":
+			return re.ErrorText
+		case re.StatusText != "":
+			return re.StatusText
+		}
+	}
+	return err.Error()
+}
+
+func appCode(err error) *int64 {
+	var re *ResponseError
+	if errors.As(err, &re) {
+		return re.AppCode
+	}
+	return nil
+}
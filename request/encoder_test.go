@@ -0,0 +1,86 @@
+package request_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/request"
+)
+
+func TestEncodeResult(t *testing.T) {
+	code := int64(42)
+	for _, tt := range []struct {
+		err    error
+		status int
+		body   string
+	}{
+		{nil, http.StatusInternalServerError, `{"success": false, "error": "unexpected server error"}`},
+		{errors.New("boom"), http.StatusInternalServerError, `{"success": false, "error": "boom"}`},
+		{
+			fmt.Errorf("loading: %w", request.NewHTTPError(errors.New("no such order"), http.StatusNotFound)),
+			http.StatusNotFound, `{"success": false, "error": "loading: no such order"}`,
+		},
+		{request.NewErrNotFound(), http.StatusNotFound, `{"success": false, "error": "resource not found"}`},
+		{
+			&request.ResponseError{HTTPStatusCode: http.StatusConflict, StatusText: "conflict", AppCode: &code},
+			http.StatusConflict, `{"success": false, "error": "conflict", "code": 42}`,
+		},
+	} {
+		w := httptest.NewRecorder()
+		request.ReplyErr(w, httptest.NewRequest(http.MethodGet, "/", nil), tt.err)
+		assert.Equal(t, tt.status, w.Code, tt.body)
+		assert.JSONEq(t, tt.body, w.Body.String())
+	}
+}
+
+func TestSetErrorEncoder(t *testing.T) {
+	request.SetErrorEncoder(func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(request.HTTPStatus(err))
+		_, _ = w.Write([]byte("custom: " + request.ErrorMessage(err)))
+	})
+	t.Cleanup(func() { request.SetErrorEncoder(nil) })
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.ReplyErr(w, r, request.NewHTTPError(errors.New("bad input"), http.StatusBadRequest))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "custom: bad input", w.Body.String())
+
+	w = httptest.NewRecorder()
+	request.WrapRender(w, r, request.NewErrNotFound())
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "custom: resource not found", w.Body.String(), "rendered errors share the encoder")
+}
+
+type outOfStockError struct{ sku string }
+
+func (e *outOfStockError) Error() string { return e.sku + " is out of stock" }
+
+func TestRegisterErrorMapper(t *testing.T) {
+	request.RegisterErrorMapper(func(err error) (*request.ResponseError, bool) {
+		var oos *outOfStockError
+		if !errors.As(err, &oos) {
+			return nil, false
+		}
+		return &request.ResponseError{HTTPStatusCode: http.StatusConflict, StatusText: oos.Error()}, true
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	request.ReplyErr(w, r, fmt.Errorf("ordering: %w", &outOfStockError{sku: "ABC"}))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"success": false, "error": "ABC is out of stock"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	request.ReplyErr(w, r, request.NewHTTPError(&outOfStockError{sku: "ABC"}, http.StatusGone))
+	assert.Equal(t, http.StatusGone, w.Code, "errors carrying a status are not mapped")
+
+	w = httptest.NewRecorder()
+	request.ReplyErr(w, r, errors.New("boom"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
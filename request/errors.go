@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/go-chi/render"
 	"github.com/sirupsen/logrus"
@@ -26,6 +27,48 @@ type ResponseError struct {
 	ErrorText  string `json:"error,omitempty"` // application-level error message, for debugging
 }
 
+// ErrorMapper translates a domain error, such as a repository not found
+// one, to the ResponseError sent in its place, reporting whether it did.
+type ErrorMapper func(error) (*ResponseError, bool)
+
+var (
+	mappersMu    sync.RWMutex
+	errorMappers []ErrorMapper
+)
+
+// RegisterErrorMapper adds a mapper applied by ReplyErr, and so WrapRender,
+// to the errors carrying no HTTP status, letting handlers return domain
+// errors as is. Mappers are tried in the order they were registered.
+//
+//	request.RegisterErrorMapper(func(err error) (*request.ResponseError, bool) {
+//		if errors.Is(err, sql.ErrNoRows) {
+//			return request.NewErrNotFound(), true
+//		}
+//		return nil, false
+//	})
+func RegisterErrorMapper(mapper ErrorMapper) {
+	mappersMu.Lock()
+	defer mappersMu.Unlock()
+	errorMappers = append(errorMappers, mapper)
+}
+
+// mapError returns the ResponseError registered for err, or err when it
+// carries a status or no mapper applies.
+func mapError(err error) error {
+	var hec HTTPErrorCoder
+	if err == nil || errors.As(err, &hec) {
+		return err
+	}
+	mappersMu.RLock()
+	defer mappersMu.RUnlock()
+	for _, mapper := range errorMappers {
+		if re, ok := mapper(err); ok && re != nil {
+			return re
+		}
+	}
+	return err
+}
+
 // NewHTTPError creates a new ResponseError with the given error and HTTP status code.
 func NewHTTPError(err error, code int) error {
 	return &ResponseError{
@@ -36,6 +79,10 @@ func NewHTTPError(err error, code int) error {
 
 func (e *ResponseError) HTTPCode() int { return e.HTTPStatusCode }
 
+// Unwrap returns the low-level error, so errors.Is sees through the
+// ResponseError.
+func (e *ResponseError) Unwrap() error { return e.Err }
+
 // Error returns a string representation of the ResponseError.
 func (e *ResponseError) Error() string {
 	switch {
@@ -103,12 +150,15 @@ func ErrRender(err error) render.Renderer {
 	}
 }
 
-// WrapRender wraps the render.Render function and handles errors.
+// WrapRender wraps the render.Render function and handles errors. Errors,
+// such as ResponseErrors, are sent by ReplyErr so they share its format.
 func WrapRender(w http.ResponseWriter, r *http.Request, v render.Renderer) {
+	if err, ok := v.(error); ok {
+		ReplyErr(w, r, err)
+		return
+	}
 	if err := render.Render(w, r, v); err != nil {
-		if rerr := render.Render(w, r, ErrRender(err)); rerr != nil {
-			panic(rerr)
-		}
+		ReplyErr(w, r, ErrRender(err).(error))
 	}
 }
 
@@ -0,0 +1,69 @@
+package request
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderETag        = "ETag"
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+// ETag returns a strong entity tag hashing the cursor and data of the list,
+// so a page changes tag whenever its items or its position change. Signed
+// cursors are hashed by position, as they are reissued on every request.
+func (l ListResponse[DataType]) ETag() (string, error) {
+	cursor := l.Cursor
+	if cursor.prev != "" || cursor.next != "" {
+		cursor = Cursor{Prev: &cursor.prev, Next: &cursor.next}
+	}
+	data, err := json.Marshal(struct {
+		Cursor Cursor     `json:"cursor"`
+		Data   []DataType `json:"data"`
+	}{cursor, l.Data})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// ReplyList sends the list with its ETag and pagination Link headers. It
+// replies 304 Not Modified when the request If-None-Match matches the ETag,
+// letting clients poll a page cheaply.
+func ReplyList[DataType any](r *http.Request, w http.ResponseWriter, list ListResponse[DataType], statusCode int) {
+	etag, err := list.ETag()
+	if err != nil {
+		ReplyErr(w, r, err)
+		return
+	}
+
+	w.Header().Set(HeaderETag, etag)
+	_ = BuildLinkHeaders(r, w, "", "", list.Cursor)
+
+	if MatchETag(r.Header.Get(HeaderIfNoneMatch), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	Reply(r, w, list, statusCode)
+}
+
+// MatchETag reports whether an If-None-Match header value matches the
+// entity tag, using the weak comparison of RFC 9110.
+func MatchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
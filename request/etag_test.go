@@ -0,0 +1,51 @@
+package request_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/request"
+)
+
+func TestListETag(t *testing.T) {
+	list := request.ListResponse[string]{Count: 2, Data: []string{"a", "b"}}
+	etag, err := list.ETag()
+	require.NoError(t, err)
+
+	same, err := request.ListResponse[string]{Status: request.NewResult(), Count: 2, Data: []string{"a", "b"}}.ETag()
+	require.NoError(t, err)
+	assert.Equal(t, etag, same)
+
+	list.Cursor.Next = StringPtr("c")
+	moved, err := list.ETag()
+	require.NoError(t, err)
+	assert.NotEqual(t, etag, moved, "the cursor is part of the tag")
+}
+
+func TestReplyList(t *testing.T) {
+	list := request.ListResponse[string]{
+		Status: request.NewResult(),
+		Cursor: request.Cursor{Next: StringPtr("next")},
+		Count:  1,
+		Data:   []string{"a"},
+	}
+
+	rr := httptest.NewRecorder()
+	request.ReplyList(httptest.NewRequest(http.MethodGet, "http://example.com/items", nil), rr, list, http.StatusOK)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get(request.HeaderETag)
+	require.NotEmpty(t, etag)
+	assert.Contains(t, rr.Header().Get("Link"), `rel="next"`)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/items", nil)
+	req.Header.Set(request.HeaderIfNoneMatch, `"other", W/`+etag)
+	rr = httptest.NewRecorder()
+	request.ReplyList(req, rr, list, http.StatusOK)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	assert.Contains(t, rr.Header().Get("Link"), `rel="next"`)
+}
@@ -0,0 +1,190 @@
+package request
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidPath = errors.New("invalid file path")
+
+// FileOptions customize the responses of ReplyFile and ReplyFS.
+type FileOptions struct {
+	Attachment  bool   // Content-Disposition attachment, prompting a download, instead of inline when InlineSafe
+	Filename    string // name in Content-Disposition, the base name of the file by default
+	ContentType string // guessed from the extension, or else the content, by default
+}
+
+// ReplyFile serves the file name, a slash separated path relative to the
+// root directory usually taken from the request, refusing the paths and
+// symbolic links escaping root. Active content, such as HTML, is always
+// sent as an attachment. Range, If-Range, If-None-Match and
+// If-Modified-Since requests are honored. Directories are not listed.
+//
+//	request.ReplyFile(w, r, "/var/exports", request.Param(r, "*"), request.FileOptions{Attachment: true})
+func ReplyFile(w http.ResponseWriter, r *http.Request, root, name string, opts FileOptions) {
+	name, err := cleanPath(name)
+	if err != nil {
+		ReplyErr(w, r, err)
+		return
+	}
+	if err := withinRoot(root, name); err != nil {
+		ReplyErr(w, r, err)
+		return
+	}
+	ReplyFS(w, r, os.DirFS(root), name, opts)
+}
+
+// ReplyFS serves the file name of fsys, such as an embed.FS, as ReplyFile
+// does.
+func ReplyFS(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string, opts FileOptions) {
+	name, err := cleanPath(name)
+	if err != nil {
+		ReplyErr(w, r, err)
+		return
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		ReplyErr(w, r, fileError(err))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		ReplyErr(w, r, fileError(err))
+		return
+	}
+	if info.IsDir() {
+		ReplyErr(w, r, NewHTTPError(fs.ErrNotExist, http.StatusNotFound))
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			ReplyErr(w, r, err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	ReplyReaderSeeker(w, r, name, info.ModTime(), content, opts)
+}
+
+// ReplyReaderSeeker serves content, such as a blob of an object store, as
+// ReplyFile does. The name gives the default Content-Type and filename, and
+// modTime the Last-Modified header, unknown when zero. The ETag is the one
+// already set on w, or else derived from the size and modTime, or the
+// content when modTime is zero.
+//
+//	request.ReplyReaderSeeker(w, r, "report.pdf", blob.Updated, blob.Reader, request.FileOptions{Attachment: true})
+func ReplyReaderSeeker(w http.ResponseWriter, r *http.Request, name string, modTime time.Time, content io.ReadSeeker, opts FileOptions) {
+	header := w.Header()
+	if header.Get(HeaderETag) == "" {
+		etag, err := contentETag(modTime, content)
+		if err != nil {
+			ReplyErr(w, r, err)
+			return
+		}
+		header.Set(HeaderETag, etag)
+	}
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	if contentType != "" {
+		// Left unset, http.ServeContent sniffs the content
+		header.Set(HeaderContentType, contentType)
+	}
+	header.Set("X-Content-Type-Options", "nosniff")
+	disposition := DispositionInline
+	if opts.Attachment || !InlineSafe(contentType) {
+		disposition = DispositionAttachment
+	}
+	filename := opts.Filename
+	if filename == "" {
+		filename = path.Base(name)
+	}
+	SetContentDisposition(w, disposition, filename)
+
+	http.ServeContent(w, r, name, modTime, content)
+}
+
+// cleanPath turns a request path into a fs.FS one, refusing the paths
+// climbing out of the root.
+func cleanPath(name string) (string, error) {
+	if strings.ContainsAny(name, "\\\x00") {
+		return "", NewHTTPError(ErrInvalidPath, http.StatusBadRequest)
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", NewHTTPError(ErrInvalidPath, http.StatusBadRequest)
+		}
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" || !fs.ValidPath(name) {
+		return "", NewHTTPError(ErrInvalidPath, http.StatusBadRequest)
+	}
+	return name, nil
+}
+
+// withinRoot checks the file, its symbolic links resolved, is located
+// within root.
+func withinRoot(root, name string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fileError(err)
+	}
+	realPath, err := filepath.EvalSymlinks(filepath.Join(realRoot, filepath.FromSlash(name)))
+	if err != nil {
+		return fileError(err)
+	}
+	rel, err := filepath.Rel(realRoot, realPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return NewHTTPError(ErrInvalidPath, http.StatusNotFound)
+	}
+	return nil
+}
+
+func fileError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return NewHTTPError(fs.ErrNotExist, http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		return NewHTTPError(fs.ErrPermission, http.StatusForbidden)
+	}
+	return err
+}
+
+// contentETag returns a strong entity tag of the size and modification
+// time of the content, or of the content itself when the modification time
+// is unknown, as in an embed.FS.
+func contentETag(modTime time.Time, content io.ReadSeeker) (string, error) {
+	h := sha256.New()
+	if modTime.IsZero() {
+		if _, err := io.Copy(h, content); err != nil {
+			return "", err
+		}
+	} else {
+		size, err := content.Seek(0, io.SeekEnd)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%d-%d", size, modTime.UnixNano())
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
@@ -0,0 +1,116 @@
+package request_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/request"
+)
+
+func TestReplyFile(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "report.csv"), []byte("a,b\n1,2\n"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o755))
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link.txt")))
+
+	serve := func(name string, opts request.FileOptions, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		request.ReplyFile(w, r, root, name, opts)
+		return w
+	}
+
+	w := serve("/report.csv", request.FileOptions{Attachment: true, Filename: "rapport €.csv"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "a,b\n1,2\n", w.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="rapport _.csv"; filename*=UTF-8''rapport%20%E2%82%AC.csv`, w.Header().Get("Content-Disposition"))
+	assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	w = serve("report.csv", request.FileOptions{}, "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = serve("report.csv", request.FileOptions{}, "Range", "bytes=4-6")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "1,2", w.Body.String())
+	assert.Equal(t, `inline; filename="report.csv"`, w.Header().Get("Content-Disposition"))
+
+	for name, status := range map[string]int{
+		"../secret.txt": http.StatusBadRequest,
+		"sub/../../x":   http.StatusBadRequest,
+		`..\secret.txt`: http.StatusBadRequest,
+		"link.txt":      http.StatusNotFound,
+		"sub":           http.StatusNotFound,
+		"missing.csv":   http.StatusNotFound,
+		"":              http.StatusBadRequest,
+	} {
+		assert.Equal(t, status, serve(name, request.FileOptions{}).Code, name)
+	}
+}
+
+func TestReplyFS(t *testing.T) {
+	fsys := fstest.MapFS{"static/app.js": {Data: []byte("console.log(1)")}}
+
+	w := httptest.NewRecorder()
+	request.ReplyFS(w, httptest.NewRequest(http.MethodGet, "/", nil), fsys, "static/app.js", request.FileOptions{})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "console.log(1)", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Type"), "javascript")
+	assert.NotEmpty(t, w.Header().Get("ETag"), "hashed from the content without modification time")
+}
+
+func TestReplyReaderSeeker(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	serve := func(w http.ResponseWriter, header ...string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		request.ReplyReaderSeeker(w, r, "build.tar.gz", modTime, strings.NewReader("0123456789"), request.FileOptions{Attachment: true})
+	}
+
+	w := httptest.NewRecorder()
+	serve(w)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, `attachment; filename="build.tar.gz"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "Wed, 01 May 2024 12:00:00 GMT", w.Header().Get("Last-Modified"))
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	w = httptest.NewRecorder()
+	serve(w, "Range", "bytes=-3", "If-Range", etag)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "789", w.Body.String())
+	assert.Equal(t, "bytes 7-9/10", w.Header().Get("Content-Range"))
+
+	w = httptest.NewRecorder()
+	serve(w, "Range", "bytes=0-1", "If-Range", `"stale"`)
+	assert.Equal(t, http.StatusOK, w.Code, "the whole content once changed")
+
+	w = httptest.NewRecorder()
+	serve(w, "If-Modified-Since", modTime.Format(http.TimeFormat))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = httptest.NewRecorder()
+	w.Header().Set("ETag", `"v42"`)
+	serve(w, "If-None-Match", `"v42"`)
+	assert.Equal(t, http.StatusNotModified, w.Code, "the ETag set by the caller is kept")
+}
@@ -0,0 +1,48 @@
+package request
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/internal/middleware/logger"
+	"github.com/go-obvious/server/logging"
+)
+
+// Logger returns a log entry carrying the request, correlation and trace IDs
+// along with the matched route, so handler logs can be tied to the request.
+func Logger(r *http.Request) *logrus.Entry {
+	entry := logger.GetContext(r.Context())
+	if entry == nil {
+		entry = logger.NewEntry(r)
+	}
+	return withContext(r.Context(), entry)
+}
+
+// LoggerFromContext is Logger given the context of the request, or of work
+// it started, carrying the IDs of the request.
+func LoggerFromContext(ctx context.Context) *logrus.Entry {
+	entry := logger.GetContext(ctx)
+	if entry == nil {
+		entry = logger.NewContextEntry(ctx)
+	}
+	return withContext(ctx, entry)
+}
+
+// Slog returns the slog.Logger of LoggerFromContext, its records going
+// through the logger of the server, or the one of server.WithLogger.
+func Slog(ctx context.Context) *slog.Logger {
+	return slog.New(logging.NewHandler(LoggerFromContext(ctx)))
+}
+
+func withContext(ctx context.Context, entry *logrus.Entry) *logrus.Entry {
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if route := rctx.RoutePattern(); route != "" {
+			entry = entry.WithField("route", route)
+		}
+	}
+	return entry.WithContext(ctx)
+}
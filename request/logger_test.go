@@ -0,0 +1,87 @@
+package request_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/middleware/logger"
+	"github.com/go-obvious/server/internal/middleware/requestid"
+	"github.com/go-obvious/server/request"
+)
+
+func TestLogger(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(requestid.Middleware)
+	router.Use(logger.Middleware)
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		entry := request.Logger(r)
+		assert.Equal(t, "test-request-id", entry.Data["request_id"])
+		assert.Equal(t, "/users/{id}", entry.Data["route"])
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set(request.HeaderRequestID, "test-request-id")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestLoggerWithoutMiddleware(t *testing.T) {
+	entry := request.Logger(httptest.NewRequest(http.MethodGet, "/foo", nil))
+	assert.Equal(t, "/foo", entry.Data["path"])
+}
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	std := logrus.StandardLogger()
+	out, formatter := std.Out, std.Formatter
+	t.Cleanup(func() {
+		std.SetOutput(out)
+		std.SetFormatter(formatter)
+	})
+	std.SetOutput(&buf)
+	std.SetFormatter(&logrus.JSONFormatter{DisableTimestamp: true})
+
+	router := chi.NewRouter()
+	router.Use(requestid.Middleware)
+	router.Use(logger.Middleware)
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		request.Slog(r.Context()).With("user", "42").Info("charged", "amount", 7)
+		request.Slog(r.Context()).Debug("below the level")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set(request.HeaderRequestID, "test-request-id")
+	req.Header.Set(request.HeaderTraceID, "test-trace-id")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry), "a single entry")
+	assert.Equal(t, "charged", entry["msg"])
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "test-request-id", entry["request_id"])
+	assert.Equal(t, "test-trace-id", entry["trace_id"])
+	assert.Equal(t, "/users/{id}", entry["route"])
+	assert.Equal(t, "42", entry["user"])
+	assert.Equal(t, float64(7), entry["amount"])
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	var ctx context.Context
+	handler := requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(request.HeaderCorrelationID, "test-correlation-id")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := request.LoggerFromContext(ctx)
+	assert.Equal(t, "test-correlation-id", entry.Data["correlation_id"])
+	assert.Equal(t, ctx, entry.Context)
+}
@@ -0,0 +1,52 @@
+package request
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-obvious/server/internal/middleware/apicaller"
+	"github.com/go-obvious/server/internal/middleware/requestid"
+)
+
+type principalKeyType int
+
+const principalKey principalKeyType = 0
+
+// Metadata is the request information gathered by the server middleware.
+type Metadata struct {
+	RequestID     string      `json:"request_id,omitempty"`
+	CorrelationID string      `json:"correlation_id,omitempty"`
+	TraceID       string      `json:"trace_id,omitempty"`
+	UserAgent     string      `json:"user_agent,omitempty"`
+	APIVersion    string      `json:"api_version,omitempty"`
+	Principal     interface{} `json:"-"` // set by authentication middleware
+}
+
+// GetMetadata returns the metadata stored in the context by the server middleware.
+func GetMetadata(ctx context.Context) Metadata {
+	md := Metadata{}
+	if ctx == nil {
+		return md
+	}
+	if caller := apicaller.GetContext(ctx); caller != nil {
+		md.UserAgent = caller.UserAgent
+		md.APIVersion = caller.APIVersion
+	}
+	if rid := requestid.GetContext(ctx); rid != nil {
+		md.RequestID = rid.RequestID
+		md.CorrelationID = rid.CorrelationID
+		md.TraceID = rid.TraceID
+	}
+	md.Principal = ctx.Value(principalKey)
+	return md
+}
+
+// RequestMetadata returns the metadata of the request.
+func RequestMetadata(r *http.Request) Metadata {
+	return GetMetadata(r.Context())
+}
+
+// WithPrincipal stores the authenticated principal in the context.
+func WithPrincipal(ctx context.Context, principal interface{}) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
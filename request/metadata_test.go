@@ -0,0 +1,42 @@
+package request_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/internal/middleware/apicaller"
+	"github.com/go-obvious/server/internal/middleware/requestid"
+	"github.com/go-obvious/server/request"
+)
+
+func TestGetMetadata(t *testing.T) {
+	var md request.Metadata
+	handler := apicaller.Middleware(requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md = request.RequestMetadata(r.WithContext(request.WithPrincipal(r.Context(), "user-1")))
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set(apicaller.APIVersionHdr, "v1")
+	req.Header.Set("X-Request-Id", "test-request-id")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Len(t, md.TraceID, 32, "generated")
+	assert.Equal(t, request.Metadata{
+		RequestID:     "test-request-id",
+		CorrelationID: "test-request-id",
+		TraceID:       md.TraceID,
+		UserAgent:     "test-agent",
+		APIVersion:    "v1",
+		Principal:     "user-1",
+	}, md)
+}
+
+func TestGetMetadataEmpty(t *testing.T) {
+	assert.Equal(t, request.Metadata{}, request.GetMetadata(context.Background()))
+}
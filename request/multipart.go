@@ -0,0 +1,208 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultMaxPartSize  = 32 << 20  // 32MB
+	DefaultMaxTotalSize = 128 << 20 // 128MB
+	DefaultMaxParts     = 100
+)
+
+var (
+	ErrNotMultipart    = errors.New("request body is not multipart/form-data")
+	ErrPartTooLarge    = errors.New("part too large")
+	ErrUploadTooLarge  = errors.New("request body too large")
+	ErrTooManyParts    = errors.New("too many parts")
+	ErrPartType        = errors.New("part content type not allowed")
+	ErrMalformedUpload = errors.New("malformed multipart body")
+)
+
+// MultipartOptions limit the requests parsed by GetMultipart.
+type MultipartOptions struct {
+	MaxPartSize  int64 // bytes of a part, DefaultMaxPartSize when zero
+	MaxTotalSize int64 // bytes of the body, DefaultMaxTotalSize when zero
+	MaxParts     int   // DefaultMaxParts when zero
+
+	// Media types of the file parts, "type/*" accepting any subtype. Files
+	// of any type are accepted when empty.
+	AllowedTypes []string
+}
+
+// Part is a file of a multipart request, read from the request body as the
+// sink consumes it.
+type Part struct {
+	FormName    string
+	FileName    string
+	ContentType string // application/octet-stream when not given
+	Header      textproto.MIMEHeader
+	io.Reader
+}
+
+// PartError tells the part, by its form and file names, a multipart request
+// failed on.
+type PartError struct {
+	FormName string
+	FileName string
+	Err      error
+}
+
+func (e *PartError) Error() string {
+	if e.FileName != "" {
+		return fmt.Sprintf("part %q (file %q): %v", e.FormName, e.FileName, e.Err)
+	}
+	return fmt.Sprintf("part %q: %v", e.FormName, e.Err)
+}
+
+func (e *PartError) Unwrap() error { return e.Err }
+
+// GetMultipart parses a multipart/form-data request, streaming its files to
+// sink one part at a time, and returns its other fields. The limits are
+// enforced while reading, whatever the Content-Length, and the errors are
+// ResponseErrors ready for ReplyErr: 413 for the sizes, 415 for the content
+// types, and 400 otherwise, wrapping a PartError when a part is at fault.
+// Errors returned by sink are returned as is.
+//
+//	fields, err := request.GetMultipart(w, r, request.MultipartOptions{AllowedTypes: []string{"image/*"}},
+//		func(p *request.Part) error {
+//			return store.Put(r.Context(), p.FileName, p.ContentType, p)
+//		})
+//	if err != nil {
+//		request.ReplyErr(w, r, err)
+//		return
+//	}
+func GetMultipart(w http.ResponseWriter, r *http.Request, opts MultipartOptions, sink func(p *Part) error) (url.Values, error) {
+	maxPart, maxTotal, maxParts := opts.MaxPartSize, opts.MaxTotalSize, opts.MaxParts
+	if maxPart <= 0 {
+		maxPart = DefaultMaxPartSize
+	}
+	if maxTotal <= 0 {
+		maxTotal = DefaultMaxTotalSize
+	}
+	if maxParts <= 0 {
+		maxParts = DefaultMaxParts
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get(HeaderContentType))
+	if err != nil || mediaType != ContentTypeMultipart || params["boundary"] == "" {
+		return nil, NewHTTPError(ErrNotMultipart, http.StatusUnsupportedMediaType)
+	}
+	if r.ContentLength > maxTotal {
+		return nil, NewHTTPError(ErrUploadTooLarge, http.StatusRequestEntityTooLarge)
+	}
+	reader := multipart.NewReader(http.MaxBytesReader(w, r.Body, maxTotal), params["boundary"])
+
+	fields := url.Values{}
+	for n := 0; ; n++ {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, multipartError(err, nil)
+		}
+		if n == maxParts {
+			part.Close()
+			return nil, NewHTTPError(ErrTooManyParts, http.StatusRequestEntityTooLarge)
+		}
+
+		content := &limitedPart{r: part, n: maxPart}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(content)
+			if err != nil {
+				return nil, multipartError(err, part)
+			}
+			fields.Add(part.FormName(), string(value))
+			part.Close()
+			continue
+		}
+
+		contentType := ContentTypeOctetStream
+		if declared := part.Header.Get(HeaderContentType); declared != "" {
+			if contentType, _, err = mime.ParseMediaType(declared); err != nil {
+				return nil, multipartError(fmt.Errorf("%w %q", ErrPartType, declared), part)
+			}
+		}
+		if len(opts.AllowedTypes) > 0 && !matchMediaType(contentType, opts.AllowedTypes) {
+			return nil, NewHTTPError(&PartError{
+				FormName: part.FormName(),
+				FileName: part.FileName(),
+				Err:      fmt.Errorf("%w %q, expecting %s", ErrPartType, contentType, strings.Join(opts.AllowedTypes, " or ")),
+			}, http.StatusUnsupportedMediaType)
+		}
+
+		err = sink(&Part{
+			FormName:    part.FormName(),
+			FileName:    part.FileName(),
+			ContentType: contentType,
+			Header:      part.Header,
+			Reader:      content,
+		})
+		// Sinks may swallow the errors of the limits
+		if content.exceeded {
+			return nil, multipartError(ErrPartTooLarge, part)
+		}
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return nil, multipartError(err, part)
+			}
+			return nil, err
+		}
+		part.Close()
+	}
+}
+
+// multipartError turns an error reading the body into a ResponseError.
+func multipartError(err error, part *multipart.Part) error {
+	status := http.StatusBadRequest
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		err, status = ErrUploadTooLarge, http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrPartTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrPartType):
+		status = http.StatusUnsupportedMediaType
+	default:
+		err = fmt.Errorf("%w: %v", ErrMalformedUpload, err)
+	}
+	if part != nil {
+		err = &PartError{FormName: part.FormName(), FileName: part.FileName(), Err: err}
+	}
+	return NewHTTPError(err, status)
+}
+
+// limitedPart fails the reads past n bytes with ErrPartTooLarge.
+type limitedPart struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedPart) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, ErrPartTooLarge
+	}
+	// Reading one more byte than allowed tells a part of exactly n bytes
+	// from a larger one
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		l.exceeded = true
+		return int(l.n), ErrPartTooLarge
+	}
+	l.n -= int64(n)
+	return n, err
+}
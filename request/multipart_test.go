@@ -0,0 +1,176 @@
+package request_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/request"
+)
+
+type file struct {
+	field, name, contentType, content string
+}
+
+func multipartRequest(t *testing.T, fields map[string]string, files ...file) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, mw.WriteField(name, value))
+	}
+	for _, f := range files {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+f.field+`"; filename="`+f.name+`"`)
+		if f.contentType != "" {
+			h.Set("Content-Type", f.contentType)
+		}
+		pw, err := mw.CreatePart(h)
+		require.NoError(t, err)
+		_, err = io.WriteString(pw, f.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestGetMultipart(t *testing.T) {
+	r := multipartRequest(t, map[string]string{"title": "holidays"},
+		file{"photos", "beach.png", "image/png", "png data"},
+		file{"photos", "sea.jpg", "image/jpeg", "jpeg data"},
+	)
+	stored := map[string]string{}
+	fields, err := request.GetMultipart(httptest.NewRecorder(), r, request.MultipartOptions{AllowedTypes: []string{"image/*"}},
+		func(p *request.Part) error {
+			data, err := io.ReadAll(p)
+			stored[p.FileName] = p.ContentType + ":" + string(data)
+			return err
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "holidays", fields.Get("title"))
+	assert.Equal(t, map[string]string{"beach.png": "image/png:png data", "sea.jpg": "image/jpeg:jpeg data"}, stored)
+}
+
+func TestGetMultipartErrors(t *testing.T) {
+	discard := func(p *request.Part) error {
+		_, err := io.Copy(io.Discard, p)
+		return err
+	}
+	swallow := func(p *request.Part) error {
+		_, _ = io.Copy(io.Discard, p)
+		return nil
+	}
+	errStore := errors.New("store unavailable")
+
+	tests := []struct {
+		name   string
+		r      *http.Request
+		opts   request.MultipartOptions
+		sink   func(p *request.Part) error
+		status int
+		err    error
+		part   string
+	}{
+		{
+			name:   "not multipart",
+			r:      httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("{}")),
+			status: http.StatusUnsupportedMediaType,
+			err:    request.ErrNotMultipart,
+		},
+		{
+			name:   "part too large",
+			r:      multipartRequest(t, nil, file{"doc", "a.txt", "text/plain", "0123456789"}),
+			opts:   request.MultipartOptions{MaxPartSize: 8},
+			status: http.StatusRequestEntityTooLarge,
+			err:    request.ErrPartTooLarge,
+			part:   "a.txt",
+		},
+		{
+			name:   "part too large swallowed by the sink",
+			r:      multipartRequest(t, nil, file{"doc", "a.txt", "text/plain", "0123456789"}),
+			opts:   request.MultipartOptions{MaxPartSize: 8},
+			sink:   swallow,
+			status: http.StatusRequestEntityTooLarge,
+			err:    request.ErrPartTooLarge,
+			part:   "a.txt",
+		},
+		{
+			name:   "field too large",
+			r:      multipartRequest(t, map[string]string{"title": "0123456789"}),
+			opts:   request.MultipartOptions{MaxPartSize: 8},
+			status: http.StatusRequestEntityTooLarge,
+			err:    request.ErrPartTooLarge,
+		},
+		{
+			name:   "body too large",
+			r:      multipartRequest(t, nil, file{"a", "a.txt", "", strings.Repeat("x", 600)}, file{"b", "b.txt", "", strings.Repeat("x", 600)}),
+			opts:   request.MultipartOptions{MaxTotalSize: 1000},
+			status: http.StatusRequestEntityTooLarge,
+			err:    request.ErrUploadTooLarge,
+		},
+		{
+			name:   "too many parts",
+			r:      multipartRequest(t, map[string]string{"a": "1", "b": "2", "c": "3"}),
+			opts:   request.MultipartOptions{MaxParts: 2},
+			status: http.StatusRequestEntityTooLarge,
+			err:    request.ErrTooManyParts,
+		},
+		{
+			name:   "type not allowed",
+			r:      multipartRequest(t, nil, file{"photo", "page.html", "text/html", "<script>"}),
+			opts:   request.MultipartOptions{AllowedTypes: []string{"image/*"}},
+			status: http.StatusUnsupportedMediaType,
+			err:    request.ErrPartType,
+			part:   "page.html",
+		},
+		{
+			name:   "undeclared type",
+			r:      multipartRequest(t, nil, file{"photo", "photo", "", "data"}),
+			opts:   request.MultipartOptions{AllowedTypes: []string{"image/png"}},
+			status: http.StatusUnsupportedMediaType,
+			err:    request.ErrPartType,
+			part:   "photo",
+		},
+		{
+			name: "sink error",
+			r:    multipartRequest(t, nil, file{"doc", "a.txt", "text/plain", "data"}),
+			sink: func(*request.Part) error { return errStore },
+			err:  errStore,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := tt.sink
+			if sink == nil {
+				sink = discard
+			}
+			r := tt.r
+			if r.Body != nil && r.ContentLength > 0 {
+				r.ContentLength = -1 // limits enforced while reading
+			}
+			_, err := request.GetMultipart(httptest.NewRecorder(), r, tt.opts, sink)
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tt.err)
+			if tt.status != 0 {
+				assert.True(t, request.HasCode(err, tt.status), err)
+			}
+			if tt.part != "" {
+				var partErr *request.PartError
+				require.ErrorAs(t, err, &partErr)
+				assert.Equal(t, tt.part, partErr.FileName)
+			}
+		})
+	}
+}
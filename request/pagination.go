@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -26,8 +27,12 @@ type PaginationOptions struct {
 
 // Forward/Backward cursor
 type Cursor struct {
-	Prev *string `json:"prev"`
-	Next *string `json:"next"`
+	Prev      *string    `json:"prev" xml:"prev"`
+	Next      *string    `json:"next" xml:"next"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" xml:"expires_at,omitempty"` // set for signed cursors with a TTL
+
+	// positions behind signed cursors, which keep entity tags stable
+	prev, next string
 }
 
 // GetPagingOpts extracts pagination options from the HTTP request.
@@ -65,31 +70,39 @@ func getQueryParamAsInt(r *http.Request, param string, defaultValue int) int {
 	return defaultValue
 }
 
-// BuildLinkHeaders adds pagination Link headers to the HTTP response.
+// BuildLinkHeaders adds pagination Link headers to the HTTP response. The
+// links keep the query parameters of the request, replacing the cursor.
+// An empty serverURLWithProtocol uses the Origin of the request, honoring
+// the forwarding headers of trusted proxies. An empty path uses the request
+// path.
 func BuildLinkHeaders(r *http.Request, w http.ResponseWriter, serverURLWithProtocol, path string, cursor Cursor) error {
+	if serverURLWithProtocol == "" {
+		serverURLWithProtocol = Origin(r)
+	}
 	serverURL, err := url.Parse(serverURLWithProtocol)
 	if err != nil {
 		return err
 	}
-	queryParams := r.URL.Query()
-	queryParams.Del(ParamCursor)
-	queryString := queryParams.Encode()
+	if path == "" {
+		path = r.URL.Path
+	}
 
 	if cursor.Prev != nil {
-		addLinkHeader(w, buildLinkHeader(serverURL, path, *cursor.Prev, queryString, "prev"))
+		addLinkHeader(w, buildLinkHeader(serverURL, path, *cursor.Prev, r.URL.Query(), "prev"))
 	}
 	if cursor.Next != nil {
-		addLinkHeader(w, buildLinkHeader(serverURL, path, *cursor.Next, queryString, "next"))
+		addLinkHeader(w, buildLinkHeader(serverURL, path, *cursor.Next, r.URL.Query(), "next"))
 	}
 	return nil
 }
 
-func buildLinkHeader(serverURL *url.URL, path, cursor, queryString, rel string) string {
+func buildLinkHeader(serverURL *url.URL, path, cursor string, query url.Values, rel string) string {
+	query.Set(ParamCursor, cursor)
 	linkURL := &url.URL{
 		Scheme:   serverURL.Scheme,
 		Host:     serverURL.Host,
 		Path:     path,
-		RawQuery: fmt.Sprintf("cursor=%s&%s", url.PathEscape(cursor), queryString),
+		RawQuery: query.Encode(),
 	}
 	return fmt.Sprintf("<%s>; rel=\"%s\"", linkURL.String(), rel)
 }
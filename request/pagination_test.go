@@ -30,7 +30,7 @@ func TestBuildLinkHeaders(t *testing.T) {
 				Prev: StringPtr("abcdefg"),
 				Next: StringPtr("hijklmn"),
 			},
-			expectedLink: `<http://localhost:8080/api/users?cursor=abcdefg&>; rel="prev", <http://localhost:8080/api/users?cursor=hijklmn&>; rel="next"`,
+			expectedLink: `<http://localhost:8080/api/users?cursor=abcdefg>; rel="prev", <http://localhost:8080/api/users?cursor=hijklmn>; rel="next"`,
 		},
 		{
 			name:      "Valid Cursor - Prev Only",
@@ -39,7 +39,7 @@ func TestBuildLinkHeaders(t *testing.T) {
 			cursor: request.Cursor{
 				Prev: StringPtr("abcdefg"),
 			},
-			expectedLink: `<http://localhost:8080/api/users?cursor=abcdefg&>; rel="prev"`,
+			expectedLink: `<http://localhost:8080/api/users?cursor=abcdefg>; rel="prev"`,
 		},
 		{
 			name:      "Valid Cursor - Next Only",
@@ -48,7 +48,7 @@ func TestBuildLinkHeaders(t *testing.T) {
 			cursor: request.Cursor{
 				Next: StringPtr("hijklmn"),
 			},
-			expectedLink: `<http://localhost:8080/api/users?cursor=hijklmn&>; rel="next"`,
+			expectedLink: `<http://localhost:8080/api/users?cursor=hijklmn>; rel="next"`,
 		},
 		{
 			name:             "Empty Cursor",
@@ -88,3 +88,57 @@ func TestBuildLinkHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildLinkHeadersQuery(t *testing.T) {
+	testCases := []struct {
+		name         string
+		url          string
+		remoteAddr   string
+		headers      map[string]string
+		expectedLink string
+	}{
+		{
+			name:         "Preserves query parameters",
+			url:          "http://example.com/api/users?limit=10&cursor=old&q=a+b",
+			expectedLink: `<http://example.com/api/users?cursor=a%2Fb%3D&limit=10&q=a+b>; rel="next"`,
+		},
+		{
+			name:       "Forwarded host and proto",
+			url:        "http://10.0.0.1:8080/api/users",
+			remoteAddr: "127.0.0.1:41000",
+			headers: map[string]string{
+				"X-Forwarded-Host":  "api.example.com, proxy.internal",
+				"X-Forwarded-Proto": "https",
+			},
+			expectedLink: `<https://api.example.com/api/users?cursor=a%2Fb%3D>; rel="next"`,
+		},
+		{
+			name: "Untrusted forwarded host",
+			url:  "http://example.com/api/users",
+			headers: map[string]string{
+				"X-Forwarded-Host": "evil.example.net",
+			},
+			expectedLink: `<http://example.com/api/users?cursor=a%2Fb%3D>; rel="next"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.remoteAddr != "" {
+				req.RemoteAddr = tc.remoteAddr
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			rr := httptest.NewRecorder()
+			if err := request.BuildLinkHeaders(req, rr, "", "", request.Cursor{Next: StringPtr("a/b=")}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if link := rr.Header().Get("Link"); link != tc.expectedLink {
+				t.Errorf("Unexpected Link headers. Expected: %s, Got: %s", tc.expectedLink, link)
+			}
+		})
+	}
+}
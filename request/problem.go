@@ -0,0 +1,144 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+const ContentTypeProblemJSON = "application/problem+json"
+
+var _ HTTPErrorCoder = (*Problem)(nil)
+
+// Problem is a RFC 7807 problem details error. Returned by a handler, it is
+// rendered as application/problem+json whatever the error format.
+//
+//	return &request.Problem{
+//		Type:       "https://example.com/problems/out-of-credit",
+//		Title:      "You do not have enough credit",
+//		Status:     http.StatusForbidden,
+//		Detail:     "Your current balance is 30, but that costs 50",
+//		Extensions: map[string]interface{}{"balance": 30},
+//	}
+type Problem struct {
+	Type     string `json:"type,omitempty"` // URI of the problem type, "about:blank" when unset
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Members added to the standard ones, such as the correlation IDs
+	Extensions map[string]interface{} `json:"-"`
+
+	Err error `json:"-"` // low-level runtime error
+}
+
+// NewProblem creates a Problem of the status code detailing err.
+func NewProblem(err error, code int) *Problem {
+	p := &Problem{Status: code, Title: http.StatusText(code), Err: err}
+	if err != nil {
+		p.Detail = err.Error()
+	}
+	return p
+}
+
+func (p *Problem) HTTPCode() int {
+	if p.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return p.Status
+}
+
+func (p *Problem) Unwrap() error { return p.Err }
+
+func (p *Problem) Error() string {
+	switch {
+	case p.Detail != "":
+		return p.Detail
+	case p.Err != nil:
+		return p.Err.Error()
+	case p.Title != "":
+		return p.Title
+	default:
+		return http.StatusText(p.HTTPCode())
+	}
+}
+
+// MarshalJSON adds the extensions to the standard members, which they
+// cannot override.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	data, err := json.Marshal((*problem)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// ReplyProblem sends err as a RFC 7807 problem details response, adding
+// the instance and the request, correlation and trace IDs when unset.
+func ReplyProblem(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemOf(err)
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" && p.Type == "about:blank" {
+		p.Title = http.StatusText(p.HTTPCode())
+	}
+	if p.Status == 0 {
+		p.Status = p.HTTPCode()
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	md := GetMetadata(r.Context())
+	for name, id := range map[string]string{
+		"request_id":     md.RequestID,
+		"correlation_id": md.CorrelationID,
+		"trace_id":       md.TraceID,
+	} {
+		if _, ok := p.Extensions[name]; !ok && id != "" {
+			if p.Extensions == nil {
+				p.Extensions = map[string]interface{}{}
+			}
+			p.Extensions[name] = id
+		}
+	}
+
+	buffer := getReplyBuffer()
+	defer putReplyBuffer(buffer)
+	if err := buffer.encode(JSONCodec{}, p); err != nil {
+		writeError(w, `{"error": "Unable to encode a response"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(HeaderContentType, ContentTypeProblemJSON)
+	w.WriteHeader(p.Status)
+	writeBytes(w, buffer.Bytes())
+}
+
+// problemOf returns a copy of the Problem err wraps, or a Problem made of
+// err and the status code it carries.
+func problemOf(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		cp := *p
+		cp.Extensions = make(map[string]interface{}, len(p.Extensions))
+		for k, v := range p.Extensions {
+			cp.Extensions[k] = v
+		}
+		return &cp
+	}
+	p = NewProblem(err, HTTPStatus(err))
+	p.Detail = ErrorMessage(err)
+	if code := appCode(err); code != nil {
+		p.Extensions = map[string]interface{}{"code": *code}
+	}
+	return p
+}
@@ -0,0 +1,76 @@
+package request_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/internal/middleware/requestid"
+	"github.com/go-obvious/server/request"
+)
+
+func replyErr(t *testing.T, err error) (*httptest.ResponseRecorder, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/orders/42?x=1", nil)
+	r.Header.Set(request.HeaderCorrelationID, "corr-1")
+	requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request.ReplyErr(w, r, err)
+	})).ServeHTTP(w, r)
+
+	body := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w, body
+}
+
+func TestReplyErrProblem(t *testing.T) {
+	p := &request.Problem{
+		Type:       "https://example.com/problems/out-of-credit",
+		Title:      "You do not have enough credit",
+		Status:     http.StatusForbidden,
+		Detail:     "Your current balance is 30, but that costs 50",
+		Extensions: map[string]interface{}{"balance": 30, "status": 200},
+	}
+
+	w, body := replyErr(t, fmt.Errorf("checkout: %w", p))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, request.ContentTypeProblemJSON, w.Header().Get(request.HeaderContentType))
+	assert.Equal(t, "https://example.com/problems/out-of-credit", body["type"])
+	assert.Equal(t, "You do not have enough credit", body["title"])
+	assert.Equal(t, 403.0, body["status"], "extensions cannot override the standard members")
+	assert.Equal(t, "Your current balance is 30, but that costs 50", body["detail"])
+	assert.Equal(t, "/orders/42", body["instance"])
+	assert.Equal(t, 30.0, body["balance"])
+	assert.Equal(t, "corr-1", body["correlation_id"])
+	assert.NotEmpty(t, body["request_id"])
+	assert.Len(t, p.Extensions, 2, "the problem returned is left untouched")
+}
+
+func TestSetErrorFormat(t *testing.T) {
+	require.Equal(t, request.ErrorFormatResult, request.ErrorFormat())
+	assert.Error(t, request.SetErrorFormat("xml"))
+
+	w, body := replyErr(t, request.NewHTTPError(errors.New("no such order"), http.StatusNotFound))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, map[string]interface{}{"success": false, "error": "no such order"}, body)
+
+	require.NoError(t, request.SetErrorFormat(request.ErrorFormatProblem))
+	t.Cleanup(func() { _ = request.SetErrorFormat(request.ErrorFormatResult) })
+
+	w, body = replyErr(t, request.NewHTTPError(errors.New("no such order"), http.StatusNotFound))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, request.ContentTypeProblemJSON, w.Header().Get(request.HeaderContentType))
+	assert.Equal(t, "about:blank", body["type"])
+	assert.Equal(t, "Not Found", body["title"])
+	assert.Equal(t, 404.0, body["status"])
+	assert.Equal(t, "no such order", body["detail"])
+
+	w, body = replyErr(t, errors.New("boom"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "Internal Server Error", body["title"])
+}
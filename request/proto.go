@@ -0,0 +1,167 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	contentTypeProtobuf = "application/protobuf" // registered alias
+)
+
+var ErrNotAcceptable = errors.New("not acceptable")
+
+// Media types of the protobuf endpoints, by order of preference
+var protoMediaTypes = []string{ContentTypeProtobuf, contentTypeProtobuf, ContentTypeJSON}
+
+// ReplyProto sends msg in the protobuf binary encoding, or in its canonical
+// JSON mapping when the Accept header prefers JSON.
+func ReplyProto(r *http.Request, w http.ResponseWriter, msg proto.Message, statusCode int) {
+	if statusCode == http.StatusNoContent || msg == nil {
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	contentType := ContentTypeProtobuf
+	if r != nil {
+		if preferred := PreferredMediaType(r, protoMediaTypes...); preferred != "" {
+			contentType = preferred
+		}
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if contentType == ContentTypeJSON {
+		data, err = protojson.Marshal(msg)
+	} else {
+		data, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		writeError(w, `{"error": "Unable to encode a response"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Vary", HeaderAccept)
+	ReplyBytes(r, w, data, statusCode, contentType)
+}
+
+// GetBodyProto deserializes the protobuf request body, or its JSON mapping
+// when the Content-Type is JSON, into msg or returns an error.
+func GetBodyProto(w http.ResponseWriter, r *http.Request, msg proto.Message) error {
+	mediaType := ContentTypeJSON
+	if contentType := r.Header.Get(HeaderContentType); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil || !matchMediaType(mediaType, protoMediaTypes) {
+			return NewHTTPError(
+				fmt.Errorf("%w %q, expecting %s", ErrUnsupportedMediaType, contentType, strings.Join(protoMediaTypes, " or ")),
+				http.StatusUnsupportedMediaType,
+			)
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return errors.New("request body must not be larger than 1MB")
+		}
+		return err
+	}
+	if mediaType == ContentTypeJSON {
+		if len(data) == 0 {
+			return errors.New("request body must not be empty")
+		}
+		if err := protojson.Unmarshal(data, msg); err != nil {
+			return fmt.Errorf("request body contains badly-formed JSON: %w", err)
+		}
+		return nil
+	}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("request body contains a malformed protobuf message: %w", err)
+	}
+	return nil
+}
+
+// NegotiateProto guards the endpoints replying with ReplyProto, answering
+// 415 Unsupported Media Type to the bodies neither protobuf nor JSON, and
+// 406 Not Acceptable to the requests accepting neither.
+//
+//	r.With(request.NegotiateProto).Post("/orders", create)
+func NegotiateProto(next http.Handler) http.Handler {
+	return RequireContentType(protoMediaTypes...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if PreferredMediaType(r, protoMediaTypes...) == "" {
+			ReplyErr(w, r, NewHTTPError(
+				fmt.Errorf("%w, expecting %s", ErrNotAcceptable, strings.Join(protoMediaTypes, " or ")),
+				http.StatusNotAcceptable,
+			))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// PreferredMediaType returns the offer the Accept header of the request
+// prefers, the first one when there is no Accept header, and an empty
+// string when none is acceptable. Ties go to the earlier offer.
+func PreferredMediaType(r *http.Request, offers ...string) string {
+	accept := r.Header.Get(HeaderAccept)
+	if strings.TrimSpace(accept) == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality the most specific media range of the
+// Accept header matching mediaType gives it.
+func acceptQuality(accept, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	for _, accepted := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		var s int
+		switch {
+		case mediaRange == mediaType:
+			s = 2
+		case mediaRange == "*/*":
+			s = 0
+		case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+			s = 1
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+		rangeQ := 1.0
+		if v, ok := params["q"]; ok {
+			if rangeQ, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		q, specificity = rangeQ, s
+	}
+	return q
+}
@@ -0,0 +1,109 @@
+package request_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/go-obvious/server/request"
+)
+
+func TestPreferredMediaType(t *testing.T) {
+	offers := []string{request.ContentTypeProtobuf, request.ContentTypeJSON}
+	for accept, want := range map[string]string{
+		"":                                      request.ContentTypeProtobuf,
+		"*/*":                                   request.ContentTypeProtobuf,
+		"application/json":                      request.ContentTypeJSON,
+		"application/*;q=0.5, application/json": request.ContentTypeJSON,
+		"application/json;q=0.5, */*":           request.ContentTypeProtobuf,
+		"application/x-protobuf;q=0, */*":       request.ContentTypeJSON,
+		"text/html":                             "",
+		"application/x-protobuf;q=bogus, text/html": "",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(request.HeaderAccept, accept)
+		assert.Equal(t, want, request.PreferredMediaType(r, offers...), accept)
+	}
+}
+
+func TestReplyProto(t *testing.T) {
+	msg := wrapperspb.String("hello")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	request.ReplyProto(r, w, msg, http.StatusOK)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, request.ContentTypeProtobuf, w.Header().Get(request.HeaderContentType))
+	assert.Equal(t, request.HeaderAccept, w.Header().Get("Vary"))
+	got := &wrapperspb.StringValue{}
+	require.NoError(t, proto.Unmarshal(w.Body.Bytes(), got))
+	assert.Equal(t, "hello", got.GetValue())
+
+	r.Header.Set(request.HeaderAccept, "application/json")
+	w = httptest.NewRecorder()
+	request.ReplyProto(r, w, msg, http.StatusCreated)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, request.ContentTypeJSON, w.Header().Get(request.HeaderContentType))
+	assert.Equal(t, `"hello"`, w.Body.String())
+}
+
+func TestGetBodyProto(t *testing.T) {
+	data, err := proto.Marshal(wrapperspb.Int64(42))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set(request.HeaderContentType, request.ContentTypeProtobuf)
+	got := &wrapperspb.Int64Value{}
+	require.NoError(t, request.GetBodyProto(httptest.NewRecorder(), r, got))
+	assert.Equal(t, int64(42), got.GetValue())
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`"7"`))
+	r.Header.Set(request.HeaderContentType, "application/json; charset=utf-8")
+	require.NoError(t, request.GetBodyProto(httptest.NewRecorder(), r, got))
+	assert.Equal(t, int64(7), got.GetValue())
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("\xff\xff"))
+	r.Header.Set(request.HeaderContentType, request.ContentTypeProtobuf)
+	assert.ErrorContains(t, request.GetBodyProto(httptest.NewRecorder(), r, got), "malformed protobuf")
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("<a/>"))
+	r.Header.Set(request.HeaderContentType, request.ContentTypeXML)
+	err = request.GetBodyProto(httptest.NewRecorder(), r, got)
+	assert.True(t, request.HasCode(err, http.StatusUnsupportedMediaType))
+}
+
+func TestNegotiateProto(t *testing.T) {
+	handler := request.NegotiateProto(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request.ReplyProto(r, w, wrapperspb.Bool(true), http.StatusOK)
+	}))
+
+	tests := []struct {
+		accept, contentType, body string
+		want                      int
+	}{
+		{"", "", "", http.StatusOK},
+		{"application/protobuf", "", "", http.StatusOK},
+		{"text/html", "", "", http.StatusNotAcceptable},
+		{"", request.ContentTypeXML, "<a/>", http.StatusUnsupportedMediaType},
+		{"", request.ContentTypeProtobuf, "\x08\x01", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+		r.Header.Set(request.HeaderAccept, tt.accept)
+		if tt.contentType != "" {
+			r.Header.Set(request.HeaderContentType, tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, tt.want, w.Code, tt)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strings"
 
@@ -39,8 +40,22 @@ func QSDefault(r *http.Request, name string, defaultValue string) string {
 }
 
 // GetBody deserializes the request body into the provided record or returns an error.
+// Bodies are decoded with the codec registered for their Content-Type, as
+// JSON when there is none.
 func GetBody(w http.ResponseWriter, r *http.Request, record interface{}) error {
 	r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get(HeaderContentType)); err == nil && mediaType != ContentTypeJSON {
+		if codec, ok := codecOf(mediaType); ok {
+			if err := codec.Decode(r.Body, record); err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					return errors.New("request body must not be larger than 1MB")
+				}
+				return fmt.Errorf("request body contains a malformed %s document: %w", mediaType, err)
+			}
+			return nil
+		}
+	}
 	decoder := json.NewDecoder(r.Body)
 
 	if err := decoder.Decode(record); err != nil {
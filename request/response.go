@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"sync"
 )
 
 const (
@@ -18,21 +19,22 @@ const (
 
 // SingleResponse simple class to make standard response objects for single element gets
 type SingleResponse[DataType any] struct {
-	Status Result   `json:"status"`
-	Data   DataType `json:"data"`
+	Status Result   `json:"status" xml:"status"`
+	Data   DataType `json:"data" xml:"data"`
 }
 
 // ListResponse simple class to make standard response objects for list of elements.
 type ListResponse[DataType any] struct {
-	Status Result     `json:"status"`
-	Cursor Cursor     `json:"cursor"`
-	Count  int        `json:"count"`
-	Data   []DataType `json:"data"`
+	Status Result     `json:"status" xml:"status"`
+	Cursor Cursor     `json:"cursor" xml:"cursor"`
+	Count  int        `json:"count" xml:"count"`
+	Data   []DataType `json:"data" xml:"data"`
 }
 
 type Result struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error,omitempty"`
+	Success bool   `json:"success" xml:"success"`
+	Error   string `json:"error,omitempty" xml:"error,omitempty"`
+	Code    *int64 `json:"code,omitempty" xml:"code,omitempty"` // application-specific error code
 }
 
 // NewResult creates a new successful Result.
@@ -42,7 +44,8 @@ func NewResult() Result {
 	}
 }
 
-// Reply sends a JSON response with the given data and status code.
+// Reply sends a response with the given data and status code, encoded in
+// JSON or the registered media type preferred by the Accept header.
 func Reply(r *http.Request, w http.ResponseWriter, data interface{}, statusCode int) {
 	reply(r, w, data, statusCode, false)
 }
@@ -52,20 +55,12 @@ func ReplyGzip(r *http.Request, w http.ResponseWriter, data interface{}, statusC
 	replyCompressed(r, w, data, statusCode, pretty, true)
 }
 
-// ReplyErr sends an error response with the given error.
+// ReplyErr sends an error response with the given error, translated by the
+// registered error mappers when it carries no status, with the encoder set
+// by SetErrorEncoder or else in the error format, as a Problem when err is
+// one.
 func ReplyErr(w http.ResponseWriter, r *http.Request, err error) {
-	res := Result{Success: false}
-	if err != nil {
-		res.Error = err.Error()
-	} else {
-		res.Error = "unexpected server error"
-	}
-
-	if hec, ok := err.(HTTPErrorCoder); ok {
-		reply(r, w, res, hec.HTTPCode(), false)
-		return
-	}
-	reply(r, w, res, http.StatusInternalServerError, false)
+	encodeError(w, r, err)
 }
 
 // ReplyRaw sends a raw response with the given reader and status code.
@@ -115,15 +110,17 @@ func reply(r *http.Request, w http.ResponseWriter, data interface{}, statusCode
 		return
 	}
 
-	var buffer bytes.Buffer
-	if err := encodeJSON(&buffer, data, pretty); err != nil {
+	buffer := getReplyBuffer()
+	defer putReplyBuffer(buffer)
+	contentType, err := encodeReply(r, buffer, data, pretty)
+	if err != nil {
 		writeError(w, `{"error": "Unable to encode a response"}`, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set(HeaderContentType, ContentTypeJSON)
+	setReplyHeaders(w.Header(), contentType)
 	w.WriteHeader(statusCode)
-	writeResponse(w, &buffer)
+	writeBytes(w, buffer.Bytes())
 }
 
 func replyCompressed(r *http.Request, w http.ResponseWriter, data interface{}, statusCode int, pretty bool, gzipEnabled bool) {
@@ -132,15 +129,18 @@ func replyCompressed(r *http.Request, w http.ResponseWriter, data interface{}, s
 		return
 	}
 
-	var jsonBuffer bytes.Buffer
-	if err := encodeJSON(&jsonBuffer, data, pretty); err != nil {
+	encoded := getReplyBuffer()
+	defer putReplyBuffer(encoded)
+	contentType, err := encodeReply(r, encoded, data, pretty)
+	if err != nil {
 		writeError(w, `{"error": "Unable to encode a response"}`, http.StatusInternalServerError)
 		return
 	}
+	setReplyHeaders(w.Header(), contentType)
 
 	if gzipEnabled {
 		var gzipBuffer bytes.Buffer
-		if err := compressGzip(&gzipBuffer, jsonBuffer.Bytes()); err != nil {
+		if err := compressGzip(&gzipBuffer, encoded.Bytes()); err != nil {
 			writeError(w, `{"error": "Unable to encode a response"}`, http.StatusInternalServerError)
 			return
 		}
@@ -153,17 +153,77 @@ func replyCompressed(r *http.Request, w http.ResponseWriter, data interface{}, s
 		w.Header().Set(HeaderContentEncoding, ContentTypeGzip)
 		writeResponse(w, &gzipBuffer)
 	} else {
-		writeResponse(w, &jsonBuffer)
+		writeBytes(w, encoded.Bytes())
+	}
+}
+
+// encodeReply encodes data with the codec negotiated for the request,
+// returning its media type.
+func encodeReply(r *http.Request, buffer *replyBuffer, data interface{}, pretty bool) (string, error) {
+	contentType, codec := ContentTypeJSON, Codec(JSONCodec{})
+	if r != nil {
+		contentType, codec = Negotiate(r)
+	}
+	if _, ok := codec.(JSONCodec); ok && pretty {
+		codec = JSONCodec{Indent: "  "}
+	}
+	return contentType, buffer.encode(codec, data)
+}
+
+// setReplyHeaders sets the Content-Type and adds Accept to Vary, both
+// values sharing one allocation when Vary is not set yet.
+func setReplyHeaders(h http.Header, contentType string) {
+	if _, ok := h["Vary"]; ok {
+		h.Set(HeaderContentType, contentType)
+		h.Add("Vary", HeaderAccept)
+		return
 	}
+	// Capped, so appending to either copies it
+	values := []string{contentType, HeaderAccept}
+	h[HeaderContentType] = values[0:1:1]
+	h["Vary"] = values[1:2:2]
+}
+
+// replyBuffer is a pooled buffer along with a JSON encoder writing to it,
+// so the replies allocate neither.
+type replyBuffer struct {
+	bytes.Buffer
+	json *json.Encoder
+}
+
+// maxPooledBuffer is the capacity past which a buffer is dropped rather
+// than pooled, so a large reply does not pin its memory.
+const maxPooledBuffer = 64 << 10
+
+var replyBuffers = sync.Pool{
+	New: func() interface{} {
+		b := &replyBuffer{}
+		b.Grow(512)
+		b.json = json.NewEncoder(&b.Buffer)
+		b.json.SetEscapeHTML(false)
+		return b
+	},
+}
+
+func getReplyBuffer() *replyBuffer {
+	b := replyBuffers.Get().(*replyBuffer)
+	b.Reset()
+	return b
 }
 
-func encodeJSON(buffer *bytes.Buffer, data interface{}, pretty bool) error {
-	encoder := json.NewEncoder(buffer)
-	encoder.SetEscapeHTML(false)
-	if pretty {
-		encoder.SetIndent("", "  ")
+func putReplyBuffer(b *replyBuffer) {
+	if b.Cap() <= maxPooledBuffer {
+		replyBuffers.Put(b)
 	}
-	return encoder.Encode(data)
+}
+
+// encode encodes v with the codec, the compact JSON with the pooled
+// encoder, as JSONCodec would.
+func (b *replyBuffer) encode(codec Codec, v interface{}) error {
+	if c, ok := codec.(JSONCodec); ok && c.Indent == "" {
+		return b.json.Encode(v)
+	}
+	return codec.Encode(&b.Buffer, v)
 }
 
 func compressGzip(buffer *bytes.Buffer, data []byte) error {
@@ -174,6 +234,12 @@ func compressGzip(buffer *bytes.Buffer, data []byte) error {
 	return gw.Close()
 }
 
+func writeBytes(w http.ResponseWriter, p []byte) {
+	if _, err := w.Write(p); err != nil {
+		writeError(w, `{"error": "Unable to write a response"}`, http.StatusInternalServerError)
+	}
+}
+
 func writeResponse(w http.ResponseWriter, src io.Reader) {
 	if _, err := io.Copy(w, src); err != nil {
 		writeError(w, `{"error": "Unable to write a response"}`, http.StatusInternalServerError)
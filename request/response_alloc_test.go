@@ -0,0 +1,27 @@
+//go:build !race
+
+package request_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/request"
+)
+
+// The race detector allocates on its own, hence the build constraint
+
+func TestReplyAllocations(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/invoices/42", nil)
+	r.Header.Set("Accept", "application/json")
+	var data interface{} = &invoice{ID: "42", Items: []string{"book", "pen"}, Total: 12.5}
+	w := &discard{header: http.Header{}}
+	allocs := testing.AllocsPerRun(100, func() {
+		request.Reply(r, w.reset(), data, http.StatusOK)
+	})
+	// The header values only, the buffer and encoder being pooled
+	assert.LessOrEqual(t, allocs, 1.0)
+}
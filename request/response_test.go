@@ -0,0 +1,83 @@
+package request_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/request"
+)
+
+// discard is a ResponseWriter reused by the iterations, so only the
+// allocations of the reply are measured.
+type discard struct {
+	header http.Header
+}
+
+func (d *discard) Header() http.Header         { return d.header }
+func (d *discard) Write(p []byte) (int, error) { return len(p), nil }
+func (d *discard) WriteHeader(int)             {}
+
+func (d *discard) reset() *discard {
+	clear(d.header)
+	return d
+}
+
+type invoice struct {
+	ID    string   `json:"id"`
+	Items []string `json:"items"`
+	Total float64  `json:"total"`
+}
+
+func TestReplyHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/invoices/42", nil)
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Vary", "Origin")
+	request.Reply(r, rr, &invoice{ID: "42"}, http.StatusOK)
+	assert.Equal(t, []string{"Origin", "Accept"}, rr.Header().Values("Vary"))
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"id": "42", "items": null, "total": 0}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	request.Reply(r, rr, &invoice{ID: "<42>"}, http.StatusOK)
+	rr.Header().Add("Vary", "Origin")
+	assert.Equal(t, []string{"Accept", "Origin"}, rr.Header().Values("Vary"))
+	assert.Equal(t, []string{"application/json"}, rr.Header().Values("Content-Type"), "appending to Vary leaves Content-Type")
+	assert.Equal(t, `{"id":"<42>","items":null,"total":0}`+"\n", rr.Body.String(), "HTML left unescaped")
+}
+
+func BenchmarkReply(b *testing.B) {
+	r := httptest.NewRequest(http.MethodGet, "/invoices/42", nil)
+	var data interface{} = &invoice{ID: "42", Items: []string{"book", "pen"}, Total: 12.5}
+	w := &discard{header: http.Header{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		request.Reply(r, w.reset(), data, http.StatusOK)
+	}
+}
+
+func BenchmarkReplyList(b *testing.B) {
+	r := httptest.NewRequest(http.MethodGet, "/invoices", nil)
+	list := request.ListResponse[invoice]{Status: request.NewResult(), Count: 20}
+	for i := 0; i < 20; i++ {
+		list.Data = append(list.Data, invoice{ID: "42", Items: []string{"book", "pen"}, Total: 12.5})
+	}
+	w := &discard{header: http.Header{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		request.ReplyList(r, w.reset(), list, http.StatusOK)
+	}
+}
+
+func BenchmarkReplyErr(b *testing.B) {
+	r := httptest.NewRequest(http.MethodGet, "/invoices/42", nil)
+	err := request.NewHTTPError(errors.New("invoice not found"), http.StatusNotFound)
+	w := &discard{header: http.Header{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		request.ReplyErr(w.reset(), r, err)
+	}
+}
@@ -0,0 +1,133 @@
+package request
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"iter"
+	"net/http"
+	"time"
+)
+
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// StreamFlushInterval is the longest time the values written by ReplyStream
+// are buffered before being flushed to the client.
+var StreamFlushInterval = 200 * time.Millisecond
+
+// ReplyStream sends the values of seq as newline delimited JSON, one per
+// line, without buffering the whole sequence. The output is flushed every
+// StreamFlushInterval, and the iteration stopped once the client is gone.
+//
+// An error of seq before the first value is replied with ReplyErr. Once
+// the response is started, an error ends it with a Result line instead:
+//
+//	{"success":false,"error":"..."}
+func ReplyStream[T any](r *http.Request, w http.ResponseWriter, seq iter.Seq2[T, error], statusCode int) {
+	type item struct {
+		value T
+		err   error
+	}
+	ctx := r.Context()
+	done := make(chan struct{})
+	defer close(done)
+	items := make(chan item)
+	go func() {
+		defer close(items)
+		for v, err := range seq {
+			select {
+			case items <- item{v, err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	s := &stream{w: w, rc: http.NewResponseController(w), statusCode: statusCode}
+	ticker := time.NewTicker(StreamFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.flush() != nil {
+				return
+			}
+		case it, ok := <-items:
+			switch {
+			case !ok:
+				s.start() // even for an empty sequence
+				_ = s.flush()
+				return
+			case it.err != nil && !s.started:
+				ReplyErr(w, r, it.err)
+				return
+			case it.err != nil:
+				_ = s.write(Result{Error: ErrorMessage(it.err), Code: appCode(it.err)})
+				_ = s.flush()
+				return
+			}
+			if s.write(it.value) != nil {
+				return
+			}
+		}
+	}
+}
+
+// ReplyStreamChan sends the values received from ch as ReplyStream does,
+// until ch is closed or the client is gone. The producer should stop on
+// the cancellation of the request context.
+func ReplyStreamChan[T any](r *http.Request, w http.ResponseWriter, ch <-chan T, statusCode int) {
+	ReplyStream(r, w, func(yield func(T, error) bool) {
+		for v := range ch {
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}, statusCode)
+}
+
+type stream struct {
+	w          http.ResponseWriter
+	rc         *http.ResponseController
+	buf        *bufio.Writer
+	encoder    *json.Encoder
+	statusCode int
+	started    bool
+}
+
+func (s *stream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.w.Header().Set(HeaderContentType, ContentTypeNDJSON)
+	s.w.Header().Set("X-Content-Type-Options", "nosniff")
+	s.w.WriteHeader(s.statusCode)
+	s.buf = bufio.NewWriter(s.w)
+	s.encoder = json.NewEncoder(s.buf)
+	s.encoder.SetEscapeHTML(false)
+}
+
+func (s *stream) write(v interface{}) error {
+	s.start()
+	return s.encoder.Encode(v)
+}
+
+// flush sends the buffered lines, if any.
+func (s *stream) flush() error {
+	if !s.started {
+		return nil
+	}
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
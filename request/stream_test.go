@@ -0,0 +1,105 @@
+package request_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/request"
+)
+
+func orders(n int, err error) func(yield func(order, error) bool) {
+	return func(yield func(order, error) bool) {
+		for i := 1; i <= n; i++ {
+			if !yield(order{ID: i, Note: "a<b"}, nil) {
+				return
+			}
+		}
+		if err != nil {
+			yield(order{}, err)
+		}
+	}
+}
+
+func TestReplyStream(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	request.ReplyStream(r, w, orders(2, nil), http.StatusOK)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, request.ContentTypeNDJSON, w.Header().Get(request.HeaderContentType))
+	assert.Equal(t, `{"id":1,"note":"a<b"}`+"\n"+`{"id":2,"note":"a<b"}`+"\n", w.Body.String())
+	assert.True(t, w.Flushed)
+
+	w = httptest.NewRecorder()
+	request.ReplyStream(r, w, orders(0, nil), http.StatusOK)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, request.ContentTypeNDJSON, w.Header().Get(request.HeaderContentType))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestReplyStreamError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	request.ReplyStream(r, w, orders(0, request.NewHTTPError(errors.New("no such store"), http.StatusNotFound)), http.StatusOK)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"success":false,"error":"no such store"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	request.ReplyStream(r, w, orders(1, errors.New("connection reset")), http.StatusOK)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"id":1,"note":"a<b"}`+"\n"+`{"success":false,"error":"connection reset"}`+"\n", w.Body.String())
+}
+
+func TestReplyStreamChan(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	ch := make(chan order)
+	go func() {
+		ch <- order{ID: 1}
+		cancel() // the client is gone, the producer keeps the channel open
+	}()
+
+	w := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		request.ReplyStreamChan(r, w, ch, http.StatusOK)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not stopped on cancellation")
+	}
+}
+
+func TestReplyStreamFlushInterval(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ch := make(chan order)
+		go func() {
+			defer close(ch)
+			ch <- order{ID: 1}
+			<-time.After(time.Second) // slow producer
+			ch <- order{ID: 2}
+		}()
+		request.ReplyStreamChan(r, w, ch, http.StatusOK)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	start := time.Now()
+	line := make([]byte, len(`{"id":1,"note":""}`+"\n"))
+	_, err = resp.Body.Read(line)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":1,"note":""}`+"\n", string(line))
+	assert.Less(t, time.Since(start), 900*time.Millisecond, "first line not flushed before the second one")
+}
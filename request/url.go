@@ -0,0 +1,224 @@
+package request
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	HeaderForwarded      = "Forwarded"
+	HeaderForwardedHost  = "X-Forwarded-Host"
+	HeaderForwardedProto = "X-Forwarded-Proto"
+	HeaderForwardedFor   = "X-Forwarded-For"
+)
+
+// DefaultTrustedProxies are the loopback networks, a sidecar proxy. The
+// private networks are not trusted by default as any of their hosts could
+// then forge the forwarding headers.
+var DefaultTrustedProxies = []string{"127.0.0.0/8", "::1/128"}
+
+var (
+	proxiesMu      sync.RWMutex
+	trustedProxies = mustParseCIDRs(DefaultTrustedProxies)
+)
+
+// SetTrustedProxies replaces the networks of the proxies whose forwarding
+// headers are honored. No network disables the forwarding headers.
+func SetTrustedProxies(cidrs ...string) error {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	proxiesMu.Lock()
+	defer proxiesMu.Unlock()
+	trustedProxies = nets
+	return nil
+}
+
+// TrustedProxy reports whether the request comes from a trusted proxy.
+func TrustedProxy(r *http.Request) bool {
+	ip := net.ParseIP(remoteHost(r))
+	return ip != nil && trusted(ip)
+}
+
+func trusted(ip net.IP) bool {
+	proxiesMu.RLock()
+	defer proxiesMu.RUnlock()
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIP returns the IP address of the client of the request. From a
+// trusted proxy, it is the address the Forwarded header, or else the
+// X-Forwarded-For one, was given by the first trusted proxy, walking the
+// chain back from the remote address: the addresses before it may be
+// forged by the client.
+func ClientIP(r *http.Request) string {
+	host := remoteHost(r)
+	ip := net.ParseIP(host)
+	if ip == nil || !trusted(ip) {
+		return host
+	}
+
+	chain := forwardedFor(r.Header.Values(HeaderForwarded))
+	if len(chain) == 0 {
+		for _, v := range r.Header.Values(HeaderForwardedFor) {
+			chain = append(chain, strings.Split(v, ",")...)
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := parseNode(chain[i])
+		if hop == nil {
+			// Unknown or obfuscated, the last proxy is the closest known hop
+			break
+		}
+		ip = hop
+		if !trusted(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// forwardedFor returns the for parameters of the elements of the RFC 7239
+// Forwarded headers, the client first.
+func forwardedFor(headers []string) []string {
+	var nodes []string
+	for _, header := range headers {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					nodes = append(nodes, value)
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// parseNode returns the IP address of a forwarded node, such as
+// "192.0.2.60", "192.0.2.60:443" or the quoted "[2001:db8::1]:443", nil
+// when unknown or obfuscated.
+func parseNode(node string) net.IP {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	return net.ParseIP(strings.Trim(node, "[]"))
+}
+
+// Origin returns the scheme and host the client used to reach the server,
+// such as "https://api.example.com". The Forwarded header, then the
+// X-Forwarded-Proto and X-Forwarded-Host ones, are honored when the request
+// comes from a trusted proxy.
+func Origin(r *http.Request) string {
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if TrustedProxy(r) {
+		proto, fwdHost := forwarded(r.Header.Get(HeaderForwarded))
+		if proto == "" && fwdHost == "" {
+			proto = firstValue(r.Header.Get(HeaderForwardedProto))
+			fwdHost = firstValue(r.Header.Get(HeaderForwardedHost))
+		}
+		if proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if validHost(fwdHost) {
+			host = fwdHost
+		}
+	}
+	return scheme + "://" + host
+}
+
+// AbsoluteURL returns the externally correct URL of a path, resolved
+// against the request URL when relative, for Location headers, links and
+// callbacks.
+func AbsoluteURL(r *http.Request, path string) string {
+	base, err := url.Parse(Origin(r) + r.URL.EscapedPath())
+	if err != nil {
+		return path
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// forwarded returns the proto and host of the first element of a RFC 7239
+// Forwarded header, the one added by the proxy closest to the client.
+func forwarded(header string) (proto, host string) {
+	first, _, _ := strings.Cut(header, ",")
+	for _, pair := range strings.Split(first, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		switch strings.ToLower(key) {
+		case "proto":
+			proto = strings.ToLower(value)
+		case "host":
+			host = value
+		}
+	}
+	return proto, host
+}
+
+// firstValue returns the first of the comma separated values set by a
+// chain of proxies.
+func firstValue(v string) string {
+	first, _, _ := strings.Cut(v, ",")
+	return strings.TrimSpace(first)
+}
+
+func validHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	u, err := url.Parse("http://" + host)
+	return err == nil && u.Host == host && u.User == nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func mustParseCIDRs(cidrs []string) []*net.IPNet {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
@@ -0,0 +1,145 @@
+package request_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/request"
+)
+
+func TestAbsoluteURL(t *testing.T) {
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		path       string
+		expected   string
+	}{
+		{
+			name:     "Direct request",
+			path:     "/orders/1",
+			expected: "http://internal:8080/orders/1",
+		},
+		{
+			name:       "Relative path",
+			remoteAddr: "127.0.0.1:41000",
+			path:       "1?expand=items",
+			expected:   "http://internal:8080/api/1?expand=items",
+		},
+		{
+			name:       "Forwarded header",
+			remoteAddr: "127.0.0.1:41000",
+			headers: map[string]string{
+				"Forwarded":        `for=192.0.2.60;proto=https;host="api.example.com", for=10.0.0.1`,
+				"X-Forwarded-Host": "ignored.example.com",
+			},
+			path:     "/orders/1",
+			expected: "https://api.example.com/orders/1",
+		},
+		{
+			name:       "X-Forwarded headers",
+			remoteAddr: "[::1]:41000",
+			headers: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "api.example.com",
+			},
+			path:     "/orders/1",
+			expected: "https://api.example.com/orders/1",
+		},
+		{
+			name:       "Private network",
+			remoteAddr: "10.1.2.3:41000",
+			headers: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "api.example.com",
+			},
+			path:     "/orders/1",
+			expected: "http://internal:8080/orders/1",
+		},
+		{
+			name:       "Untrusted proxy",
+			remoteAddr: "203.0.113.9:41000",
+			headers: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "evil.example.net",
+			},
+			path:     "/orders/1",
+			expected: "http://internal:8080/orders/1",
+		},
+		{
+			name:       "Invalid forwarded host",
+			remoteAddr: "127.0.0.1:41000",
+			headers: map[string]string{
+				"X-Forwarded-Host": "evil.example.net/path",
+			},
+			path:     "/orders/1",
+			expected: "http://internal:8080/orders/1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://internal:8080/api/orders", nil)
+			if tc.remoteAddr != "" {
+				req.RemoteAddr = tc.remoteAddr
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tc.expected, request.AbsoluteURL(req, tc.path))
+		})
+	}
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	defer func() {
+		require.NoError(t, request.SetTrustedProxies(request.DefaultTrustedProxies...))
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "http://internal/", nil)
+	req.RemoteAddr = "203.0.113.9:41000"
+	assert.False(t, request.TrustedProxy(req))
+
+	require.NoError(t, request.SetTrustedProxies("203.0.113.0/24"))
+	assert.True(t, request.TrustedProxy(req))
+
+	require.NoError(t, request.SetTrustedProxies())
+	assert.False(t, request.TrustedProxy(req))
+
+	assert.Error(t, request.SetTrustedProxies("not a network"))
+}
+
+func TestClientIP(t *testing.T) {
+	defer func() {
+		require.NoError(t, request.SetTrustedProxies(request.DefaultTrustedProxies...))
+	}()
+	require.NoError(t, request.SetTrustedProxies("10.0.0.0/8"))
+
+	for _, tt := range []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{name: "Direct", remote: "203.0.113.9:41000", want: "203.0.113.9"},
+		{name: "Untrusted forwarding", remote: "203.0.113.9:41000", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, want: "203.0.113.9"},
+		{name: "Proxied", remote: "10.0.0.2:41000", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "Forged", remote: "10.0.0.2:41000", headers: map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.0.0.3"}, want: "198.51.100.1"},
+		{name: "Forwarded", remote: "10.0.0.2:41000", headers: map[string]string{"Forwarded": `for=1.2.3.4, for="[2001:db8::1]:443";proto=https`, "X-Forwarded-For": "198.51.100.1"}, want: "2001:db8::1"},
+		{name: "Obfuscated", remote: "10.0.0.2:41000", headers: map[string]string{"Forwarded": "for=_hidden, for=10.0.0.3"}, want: "10.0.0.3"},
+		{name: "Proxies only", remote: "10.0.0.2:41000", want: "10.0.0.2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			assert.Equal(t, tt.want, request.ClientIP(req))
+		})
+	}
+}
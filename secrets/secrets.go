@@ -0,0 +1,145 @@
+package secrets
+
+// Resolves secret references such as "vault://secret/data/app#jwt" through
+// pluggable providers, so sensitive values need not live in plain
+// environment variables or on disk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrNotFound = errors.New("secret not found")
+
+// Provider fetches the secret named by the part of a reference following
+// its scheme, such as "secret/data/app#jwt" for "vault://secret/data/app#jwt".
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+type ProviderFunc func(ctx context.Context, name string) (string, error)
+
+func (f ProviderFunc) Get(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{
+		"env":   Env{},
+		"file":  File{},
+		"vault": &Vault{},
+	}
+)
+
+// Register makes a provider available under the given reference scheme,
+// replacing any previous one.
+func Register(scheme string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[scheme] = p
+}
+
+// Resolve returns the secret a reference points to. Values which are not a
+// reference to a registered provider are returned as is.
+func Resolve(ctx context.Context, value string) (string, error) {
+	scheme, name, ok := strings.Cut(value, "://")
+	if !ok {
+		return value, nil
+	}
+	mu.RLock()
+	p, ok := providers[scheme]
+	mu.RUnlock()
+	if !ok {
+		return value, nil
+	}
+
+	secret, err := p.Get(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s secret %q: %w", scheme, name, err)
+	}
+	return secret, nil
+}
+
+// splitKey separates the optional "#key" selecting a field of a JSON secret.
+func splitKey(name string) (string, string) {
+	name, key, _ := strings.Cut(name, "#")
+	return name, key
+}
+
+// selectKey returns the field of a JSON object secret, or the secret when
+// no key is requested.
+func selectKey(secret, key string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", err
+	}
+	return field(fields, key)
+}
+
+func field(fields map[string]interface{}, key string) (string, error) {
+	v, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("%w: no key %q", ErrNotFound, key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// Env reads "env://NAME" references from the environment.
+type Env struct{}
+
+func (Env) Get(_ context.Context, name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// File reads "file:///path" references, trimming the trailing newline.
+type File struct{}
+
+func (File) Get(_ context.Context, name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// AWSSecretsManager reads "awssm://secret-id#key" references. It is not
+// registered by default, Fetch is expected to call GetSecretValue of the
+// AWS SDK:
+//
+//	secrets.Register("awssm", &secrets.AWSSecretsManager{
+//		Fetch: func(ctx context.Context, id string) (string, error) {
+//			out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &id})
+//			if err != nil {
+//				return "", err
+//			}
+//			return aws.ToString(out.SecretString), nil
+//		},
+//	})
+type AWSSecretsManager struct {
+	Fetch func(ctx context.Context, secretID string) (string, error)
+}
+
+func (p *AWSSecretsManager) Get(ctx context.Context, name string) (string, error) {
+	id, key := splitKey(name)
+	secret, err := p.Fetch(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return selectKey(secret, key)
+}
@@ -0,0 +1,75 @@
+package secrets_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/secrets"
+)
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("SECRET_VALUE", "s3cr3t")
+
+	v, err := secrets.Resolve(ctx, "env://SECRET_VALUE")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", v)
+
+	v, err = secrets.Resolve(ctx, "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", v, "unknown schemes are not references")
+
+	_, err = secrets.Resolve(ctx, "env://SECRET_MISSING")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	secrets.Register("awssm", &secrets.AWSSecretsManager{
+		Fetch: func(ctx context.Context, id string) (string, error) {
+			assert.Equal(t, "prod/app", id)
+			return `{"jwt": "signing-key"}`, nil
+		},
+	})
+
+	v, err := secrets.Resolve(context.Background(), "awssm://prod/app#jwt")
+	require.NoError(t, err)
+	assert.Equal(t, "signing-key", v)
+}
+
+func TestVault(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/secret/data/broken" {
+			_, _ = w.Write([]byte(`{"data":`))
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "token" || r.URL.Path != "/v1/secret/data/app" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": {"data": {"jwt": "signing-key"}, "metadata": {"version": 3}}}`))
+	}))
+	defer vault.Close()
+
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+
+	v, err := secrets.Resolve(context.Background(), "vault://secret/data/app#jwt")
+	require.NoError(t, err)
+	assert.Equal(t, "signing-key", v)
+
+	_, err = secrets.Resolve(context.Background(), "vault://secret/data/other#jwt")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+
+	_, err = secrets.Resolve(context.Background(), "vault://secret/data/broken#jwt")
+	assert.ErrorContains(t, err, "decoding the vault reply")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = secrets.Resolve(ctx, "vault://secret/data/app#jwt")
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultClient is used when the Vault has no Client, bounding the requests
+// which would otherwise hang the start of the server.
+var vaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Vault reads "vault://path#key" references from the HashiCorp Vault HTTP
+// API, such as "vault://secret/data/app#jwt" for a KV version 2 engine.
+// Address and Token default to the VAULT_ADDR and VAULT_TOKEN variables,
+// Client to a client timing out after 10 seconds.
+type Vault struct {
+	Address string
+	Token   string
+	Client  *http.Client
+}
+
+func (v *Vault) Get(ctx context.Context, name string) (string, error) {
+	path, key := splitKey(name)
+	if key == "" {
+		return "", fmt.Errorf("vault references require a #key")
+	}
+
+	address, token, client := v.Address, v.Token, v.Client
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if client == nil {
+		client = vaultClient
+	}
+	if address == "" {
+		return "", fmt.Errorf("vault address is not configured")
+	}
+
+	url := strings.TrimSuffix(address, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("vault replied %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding the vault reply: %w", err)
+	}
+	// KV version 2 nests the secret under data.data
+	if nested, ok := body.Data["data"].(map[string]interface{}); ok {
+		if _, ok := body.Data["metadata"]; ok {
+			return field(nested, key)
+		}
+	}
+	return field(body.Data, key)
+}
@@ -0,0 +1,49 @@
+package security_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/security"
+)
+
+func TestCSPString(t *testing.T) {
+	base := security.CSP{}.DefaultSrc(security.SourceSelf)
+	csp := base.ScriptSrc(security.SourceSelf, "https://cdn.example.com").ObjectSrc(security.SourceNone)
+
+	assert.Equal(t, "default-src 'self'", base.String())
+	assert.Equal(t, "default-src 'self'; script-src 'self' https://cdn.example.com; object-src 'none'", csp.String())
+	assert.Equal(t, "default-src 'self' https://img.example.com", base.DefaultSrc("https://img.example.com").String())
+}
+
+func TestCSPNonce(t *testing.T) {
+	csp := security.CSP{}.DefaultSrc(security.SourceSelf).ScriptSrc(security.SourceStrictDynamic).Nonce()
+
+	var nonce string
+	handler := security.Middleware(security.Config{CSP: &csp})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = security.GetNonce(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NotEmpty(t, nonce)
+	assert.Equal(t,
+		"default-src 'self'; script-src 'strict-dynamic' 'nonce-"+nonce+"'",
+		rr.Header().Get(security.HeaderContentSecurityPolicy),
+	)
+
+	first := nonce
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEqual(t, first, nonce, "Expected a new nonce per request")
+
+	styled := security.CSP{}.StyleSrc(security.SourceSelf).Nonce()
+	assert.Equal(t,
+		"style-src 'self' 'nonce-abc'; script-src 'nonce-abc'",
+		styled.Build("abc"),
+		"Expected the nonce on style-src only when the policy sets it",
+	)
+}
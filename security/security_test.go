@@ -0,0 +1,30 @@
+package security_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-obvious/server/security"
+)
+
+func TestMiddleware(t *testing.T) {
+	cfg := security.DefaultConfig()
+	cfg.ContentSecurityPolicy = "default-src 'none'"
+	cfg.FrameOptions = ""
+
+	handler := security.Middleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, "default-src 'none'", rr.Header().Get(security.HeaderContentSecurityPolicy))
+	assert.Equal(t, security.DefaultReferrerPolicy, rr.Header().Get(security.HeaderReferrerPolicy))
+	assert.Equal(t, security.DefaultPermissionsPolicy, rr.Header().Get(security.HeaderPermissionsPolicy))
+	assert.Equal(t, security.DefaultContentTypeOptions, rr.Header().Get(security.HeaderContentTypeOptions))
+	assert.NotContains(t, rr.Header(), security.HeaderFrameOptions)
+}
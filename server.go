@@ -2,19 +2,61 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/go-obvious/server/alert"
+	"github.com/go-obvious/server/api"
+	"github.com/go-obvious/server/audit"
+	"github.com/go-obvious/server/client"
 	"github.com/go-obvious/server/config"
+	"github.com/go-obvious/server/discovery"
+	"github.com/go-obvious/server/drift"
+	"github.com/go-obvious/server/egress"
 	"github.com/go-obvious/server/internal/about"
+	"github.com/go-obvious/server/internal/certs"
+	"github.com/go-obvious/server/internal/chain"
+	"github.com/go-obvious/server/internal/drain"
 	"github.com/go-obvious/server/internal/healthz"
 	"github.com/go-obvious/server/internal/listener"
+	"github.com/go-obvious/server/internal/middleware/allowedhosts"
 	"github.com/go-obvious/server/internal/middleware/apicaller"
+	"github.com/go-obvious/server/internal/middleware/bodycapture"
+	"github.com/go-obvious/server/internal/middleware/cloudtrace"
+	"github.com/go-obvious/server/internal/middleware/compress"
+	"github.com/go-obvious/server/internal/middleware/corspolicy"
+	"github.com/go-obvious/server/internal/middleware/debuglog"
+	"github.com/go-obvious/server/internal/middleware/headeraudit"
+	"github.com/go-obvious/server/internal/middleware/logger"
 	"github.com/go-obvious/server/internal/middleware/panic"
 	"github.com/go-obvious/server/internal/middleware/requestid"
+	"github.com/go-obvious/server/internal/toggles"
+	"github.com/go-obvious/server/internal/tuning"
+	"github.com/go-obvious/server/internal/upgrade"
+	"github.com/go-obvious/server/internal/warmup"
+	"github.com/go-obvious/server/internal/winsvc"
+	"github.com/go-obvious/server/logging"
+	"github.com/go-obvious/server/migrate"
+	"github.com/go-obvious/server/openapi"
+	"github.com/go-obvious/server/ratelimit"
+	"github.com/go-obvious/server/redact"
+	"github.com/go-obvious/server/request"
+	"github.com/go-obvious/server/security"
+	"github.com/go-obvious/server/supervisor"
 )
 
 type Server interface {
@@ -22,9 +64,35 @@ type Server interface {
 	Run(ctx context.Context)
 }
 
+// RouteLister is implemented by the servers New returns, listing the
+// routes served, built in ones included.
+type RouteLister interface {
+	Routes() []api.RouteInfo
+}
+
+// RunnerE is implemented by the servers New returns, RunE being Run
+// returning the error, a *BindError when a port could not be listened on.
+type RunnerE interface {
+	RunE(ctx context.Context) error
+}
+
+var (
+	_ api.ChiServer = (*server)(nil)
+	_ RouteLister   = (*server)(nil)
+	_ RunnerE       = (*server)(nil)
+)
+
 // Expose the Version struct
 type ServerVersion = about.ServerVersion
 
+// PanicReport describes a recovered panic to the reporters registered with
+// WithPanicReporter.
+type PanicReport = panic.Report
+
+// BindError is returned by RunE when a port could not be listened on, after
+// the retries of SERVER_BIND_RETRIES when taken.
+type BindError = listener.BindError
+
 type API interface {
 	Name() string
 	Register(app Server) error
@@ -33,6 +101,15 @@ type API interface {
 func New(
 	version *ServerVersion,
 	apis ...API,
+) Server {
+	return NewWithOptions(version, WithAPIs(apis...))
+}
+
+// NewWithOptions returns the server New would, customized by the options,
+// the APIs being given by WithAPIs.
+func NewWithOptions(
+	version *ServerVersion,
+	opts ...Option,
 ) Server {
 	cfg := config.Server{}
 	config.Register(&cfg)
@@ -45,63 +122,915 @@ func New(
 	// Registers the callers version
 	about.SetVersion(version)
 
+	if cfg.AutoMaxProcs || cfg.MemoryLimitRatio > 0 {
+		tuneRuntime(&cfg.Runtime)
+	}
+
+	// Unset, the proxies default to request.DefaultTrustedProxies
+	if cfg.TrustedProxies != nil {
+		if err := request.SetTrustedProxies(cfg.TrustedProxies...); err != nil {
+			logrus.WithError(err).Fatal("error while parsing the trusted proxies")
+		}
+	}
+
 	app := server{
-		addr:   fmt.Sprintf(":%d", cfg.Port),
-		router: chi.NewRouter(),
-		serve:  listener.GetListener(cfg.Mode),
-	}
-
-	//app.router.Use(middleware.Logger)
-	app.router.Use(panic.Middleware)
-	cors := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{
-			"Origin",
-			"Accept",
-			"Authorization",
-			"Content-Type",
-			"X-Api-Key",
-			"User-Agent",
-			"Referer",
-			"Accept-Encoding",
-			"Accept-Language",
-			"Sec-Fetch-Dest",
-			"Sec-Fetch-Mode",
-			"Sec-Fetch-Site",
+		cfg:   &cfg,
+		mux:   chi.NewRouter(),
+		cors:  corsOptions(&cfg.CORS),
+		drain: &drain.Tracker{},
+	}
+	app.warmup = &warmup.Tracker{}
+	app.security = securityConfig(&cfg.Security)
+	policy, err := egress.New(cfg.Egress.AllowedHosts, cfg.Egress.AllowedNetworks)
+	if err != nil {
+		logrus.WithError(err).Fatal("error while parsing the egress policy")
+	}
+	app.monitor = alertMonitor(&cfg.Alert, policy)
+	app.registrar = discoveryRegistrar(&cfg.Discovery, policy)
+	app.trail = auditTrail(&cfg.Audit, policy)
+	app.limiter = rateLimiter(&cfg.RateLimit)
+	if cfg.SchemaDriftBaseline != "" {
+		baseline, err := drift.LoadBaseline(cfg.SchemaDriftBaseline)
+		if err != nil {
+			logrus.WithError(err).Fatal("error while loading the schema drift baseline")
+		}
+		app.drift = &drift.Detector{Baseline: baseline, SampleRate: cfg.SchemaDriftSampleRate}
+	}
+	if cfg.OpenAPISpec != "" {
+		spec, err := openapi.Load(cfg.OpenAPISpec)
+		if err != nil {
+			logrus.WithError(err).Fatal("error while loading the OpenAPI document")
+		}
+		app.validator = &openapi.Validator{Spec: spec, Responses: cfg.OpenAPIValidateResponses}
+	}
+	for _, opt := range opts {
+		opt(&app)
+	}
+	if app.logger != nil {
+		logging.Install(app.logger)
+	}
+	if app.router == nil {
+		app.router = app.mux
+	}
+	if err := request.SetErrorFormat(cfg.ErrorFormat); err != nil {
+		logrus.WithError(err).Fatal("error while selecting the error format")
+	}
+	generate := app.idGenerator
+	if generate == nil {
+		if generate, err = requestid.Generator(cfg.RequestIDFormat); err != nil {
+			logrus.WithError(err).Fatal("error while selecting the request ID format")
+		}
+	}
+	app.requestID, err = requestid.New(requestid.Config{
+		Policy:   cfg.RequestIDPolicy,
+		Generate: generate,
+		Baggage:  cfg.BaggageHeaders,
+		Reject: func(w http.ResponseWriter, r *http.Request, err error) {
+			request.ReplyErr(w, r, request.NewHTTPError(err, http.StatusBadRequest))
 		},
-		MaxAge: 0,
 	})
-	app.router.Use(cors.Handler)
-	app.router.Use(apicaller.Middleware)
-	app.router.Use(requestid.Middleware)
+	if err != nil {
+		logrus.WithError(err).Fatal("error while selecting the request ID policy")
+	}
+	if app.grpc != nil {
+		if !listener.IsHTTP(cfg.Mode) {
+			logrus.WithField("mode", cfg.Mode).Fatal("gRPC requires an HTTP server mode")
+		}
+		if cfg.GRPCPort != 0 {
+			app.grpcAddr = listener.Addr(cfg.BindAddress, cfg.GRPCPort)
+		}
+	}
+	if app.signals, err = newSignalSet(&cfg.Shutdown); err != nil {
+		logrus.WithError(err).Fatal("error while parsing the shutdown signals")
+	}
+	if app.registrar != nil {
+		if !listener.IsHTTP(cfg.Mode) {
+			logrus.WithField("mode", cfg.Mode).Fatal("service discovery requires an HTTP server mode")
+		}
+		app.withDiscovery(app.registrar)
+	}
+	if app.errorEncoder != nil {
+		request.SetErrorEncoder(app.errorEncoder)
+	}
+	if err := redact.SetPatterns(cfg.RedactPatterns...); err != nil {
+		logrus.WithError(err).Fatal("error while parsing the redaction patterns")
+	}
+	cookieKeys := make([]string, len(cfg.CookieKeys))
+	for i, key := range cfg.CookieKeys {
+		cookieKeys[i] = key.String()
+	}
+	if err := request.SetCookieKeys(cookieKeys...); err != nil {
+		logrus.WithError(err).Fatal("error while loading the cookie keys")
+	}
+
+	if !listener.ValidNetwork(cfg.BindNetwork) {
+		logrus.WithField("network", cfg.BindNetwork).Fatal("SERVER_BIND_NETWORK must be tcp, tcp4 or tcp6")
+	}
+	app.addr = listener.Addr(cfg.BindAddress, listener.Port(cfg.Mode, cfg.Port))
+	app.httpOpts = listener.Options{
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		Strict:            cfg.StrictFraming,
+		Network:           cfg.BindNetwork,
+		BindRetries:       cfg.BindRetries,
+		BindBackoff:       cfg.BindBackoff,
+	}
+	if listener.IsHTTP(cfg.Mode) {
+		if app.upgrader, err = upgrade.New(); err != nil {
+			logrus.WithError(err).Fatal("error while inheriting the listeners")
+		}
+		app.upgrader.Timeout = cfg.Shutdown.UpgradeTimeout
+		app.httpOpts.Bind = app.upgrader.Listen
+	}
+	if cfg.Mode == listener.Https {
+		if err = app.loadTLS(&cfg); err != nil {
+			logrus.WithError(err).Fatal("error while loading the TLS configuration")
+		}
+		if cfg.StrictFraming {
+			logrus.Warn("SERVER_STRICT_FRAMING does not apply to the TLS connections")
+		}
+	}
+	app.serve = listener.NewListener(cfg.Mode, app.httpOpts)
+	if cfg.AdminPort != 0 && listener.IsHTTP(cfg.Mode) {
+		app.adminAddr = listener.Addr(cfg.BindAddress, cfg.AdminPort)
+		app.admin = chi.NewRouter()
+		if app.trail != nil {
+			app.admin.Use(app.trail.Middleware)
+		}
+		app.admin.Use(panic.New(panic.Config{Reporters: app.panicReporters, Retry: cfg.PanicRetry}))
+		app.admin.Use(app.requestID)
+		app.admin.Use(logger.Middleware)
+	}
 
-	// Built in routes
-	app.router.Mount("/about", about.Endpoint())
-	app.router.Mount("/healthz", healthz.Endpoint())
+	if cfg.CORS.OriginsSource != "" {
+		app.origins = &corspolicy.Origins{
+			Source:   cfg.CORS.OriginsSource,
+			Interval: cfg.CORS.OriginsRefresh,
+			Client:   client.New(client.Config{Timeout: 10 * time.Second, Egress: policy}),
+		}
+		if slices.Contains(app.cors.AllowedOrigins, "*") {
+			logrus.Warn("SERVER_CORS_ALLOWED_ORIGINS allows any origin, set it to the fixed origins for SERVER_CORS_ORIGINS_SOURCE to apply")
+		}
+	}
+	// Applied to the policies the APIs register too
+	var adjustCORS []func(cors.Options) cors.Options
+	if app.origins != nil {
+		adjustCORS = append(adjustCORS, app.origins.Allow)
+	}
+	if cfg.CORS.DevAllowLocalhost {
+		logrus.Warn("CORS allows the localhost origins, unset SERVER_CORS_DEV_ALLOW_LOCALHOST outside of development")
+		adjustCORS = append(adjustCORS, corspolicy.AllowLocalhost)
+	}
+	app.policies = corspolicy.New(*app.cors, adjustCORS...)
+	for prefix, opts := range app.corsPolicies {
+		app.policies.Set(prefix, opts)
+	}
 
-	for _, api := range apis {
+	// Composed ahead of time for the static paths, see compileChain
+	app.mux.Use(app.chain.Middleware)
+	app.chain.Use(app.drain.Middleware)
+	if cfg.HeaderAudit {
+		app.chain.Use(headeraudit.Middleware(cfg.HeaderAuditSensitive))
+	}
+	if app.monitor != nil {
+		app.chain.Use(app.monitor.Middleware)
+	}
+	if app.trail != nil {
+		app.chain.Use(app.trail.Middleware)
+	}
+	app.chain.Use(panic.New(panic.Config{Reporters: app.panicReporters, Retry: cfg.PanicRetry}))
+	app.chain.Use(security.Middleware(app.security))
+	if len(app.responseHooks) > 0 {
+		// Within the security middleware, whose headers hooks may override
+		app.chain.Use(api.BeforeResponse(app.responseHooks...))
+	}
+	app.chain.Use(app.policies.Middleware)
+	app.chain.Use(apicaller.Middleware)
+	if listener.IsGCP(cfg.Mode) {
+		app.chain.Use(cloudtrace.Middleware)
+	}
+	app.chain.Use(app.requestID)
+	app.chain.Use(logger.Middleware)
+	if len(cfg.QuietRoutes) > 0 {
+		app.chain.UseUnless(func(path string) bool { return !logger.Quieted(cfg.QuietRoutes, path) }, logger.Quiet(cfg.QuietRoutes))
+	}
+	if cfg.Compression.Enabled {
+		app.chain.Use(compress.Middleware(compress.Config{
+			MinSize:              cfg.Compression.MinSize,
+			ExcludedContentTypes: cfg.Compression.ExcludedContentTypes,
+			ExcludedPaths:        cfg.Compression.ExcludedPaths,
+		}))
+	}
+	if len(cfg.AdminTokens) > 0 {
+		app.toggles = &toggles.Toggles{Limiter: app.limiter}
+		if app.admin == nil {
+			// The operational endpoints of the public port, so the toggles
+			// may be flipped back in maintenance
+			app.toggles.Exempt = []string{"/admin/toggles", cfg.HealthPath, cfg.VersionPath}
+			if cfg.DebugEndpoints {
+				app.toggles.Exempt = append(app.toggles.Exempt, "/debug")
+			}
+		}
+		app.chain.UseUnless(app.toggles.Exempted, app.toggles.Middleware)
+	}
+	if len(cfg.AllowedHosts) > 0 {
+		app.chain.UseUnless(app.isOps, app.exceptOps(allowedhosts.Middleware(append([]string{cfg.Domain}, cfg.AllowedHosts...))))
+	}
+	if app.limiter != nil {
+		app.chain.UseUnless(app.isOps, app.exceptOps(app.limiter.Middleware))
+	}
+	app.chain.Use(debuglog.Middleware(cfg.DebugToken))
+	if cfg.BodyCapture.Sink != "" {
+		app.chain.Use(app.bodyCapture(&cfg.BodyCapture))
+	}
+	if app.drift != nil {
+		app.chain.Use(app.drift.Middleware)
+	}
+	if app.validator != nil {
+		app.chain.Use(app.validator.Middleware)
+	}
+	app.mux.MethodNotAllowed(app.methodNotAllowed)
+	if app.router != app.mux {
+		// A custom router serves everything but the built in routes
+		app.mux.Mount("/", app.router)
+	}
+
+	app.mountBuiltins()
+
+	for _, api := range app.apis {
 		if err := api.Register(&app); err != nil {
 			logrus.Fatal(err)
 		}
 	}
+	app.compileChain()
 
 	return &app
 }
 
 type server struct {
-	addr   string
-	router *chi.Mux
-	serve  listener.ListenAndServeFunc
+	cfg      *config.Server
+	addr     string
+	mux      *chi.Mux   // served, running the middleware stack
+	router   chi.Router // where the APIs register, mux unless customized
+	serve    listener.ListenAndServeFunc
+	httpOpts listener.Options
+	cors     *cors.Options
+	apis     []API
+
+	corsPolicies   map[string]cors.Options
+	policies       *corspolicy.Policies
+	origins        *corspolicy.Origins
+	requestID      func(http.Handler) http.Handler
+	idGenerator    func() string
+	security       security.Config
+	monitor        *alert.Monitor
+	trail          *audit.Trail
+	chain          chain.Chain // the middlewares of mux
+	limiter        *ratelimit.Limiter
+	toggles        *toggles.Toggles
+	docs           http.Handler
+	statics        map[string]http.Handler // frontend assets keyed by mount prefix
+	openAPITitle   string
+	routeDocs      map[string]api.RouteDoc
+	drift          *drift.Detector
+	validator      *openapi.Validator
+	errorEncoder   request.ErrorEncoder
+	logger         logging.Logger
+	drain          *drain.Tracker
+	warmup         *warmup.Tracker
+	grpc           GRPCServer
+	grpcHealth     GRPCHealth
+	grpcAddr       string
+	onReady        []func()
+	onDraining     []func()
+	onShutdown     []func()
+	registrar      discovery.Registrar
+	signals        signalSet
+	trapSignals    bool
+	upgrader       *upgrade.Upgrader // nil unless serving an HTTP mode
+	upgraded       atomic.Bool       // the listeners were handed over
+	responseHooks  []api.ResponseHook
+	panicReporters []panic.Reporter
+	captures       *bodycapture.Ring
+
+	adminAddr string
+	admin     *chi.Mux
+	adminTLS  *tls.Config      // nil unless the admin port serves TLS
+	probeCert *tls.Certificate // presented by Healthcheck
+	certs     *certs.Monitor   // of the certificate of the https mode
+	tickets   *certs.Tickets   // nil when crypto/tls rotates the session ticket keys
+
+	migrations migrate.Runner
 }
 
 func (a *server) Router() interface{} {
 	return a.router
 }
 
+func (a *server) ChiRouter() chi.Router {
+	return a.router
+}
+
+var errMethodNotAllowed = errors.New("method not allowed")
+
+// Methods listed by the Allow header of the 405 responses
+var allowMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// methodNotAllowed replies 405 in the error format of the other responses,
+// the Allow header listing the methods routed for the path.
+func (a *server) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	allowed := make([]string, 0, len(allowMethods))
+	for _, method := range allowMethods {
+		if routed(a.mux, method, path) {
+			allowed = append(allowed, method)
+		}
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	request.ReplyErr(w, r, request.NewHTTPError(fmt.Errorf("%w: %s", errMethodNotAllowed, r.Method), http.StatusMethodNotAllowed))
+}
+
+// routed reports whether routes serve the method on path. Match stops at
+// the exact prefix a router is mounted on, served by chi as the "/" of the
+// mounted router, which is then matched in its place.
+func routed(routes chi.Routes, method, path string) bool {
+	rctx := chi.NewRouteContext()
+	if !routes.Match(rctx, method, path) {
+		return false
+	}
+	patterns := rctx.RoutePatterns
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns[:len(patterns)-1] {
+		if routes = subRoutes(routes, pattern); routes == nil {
+			return true
+		}
+	}
+	last := patterns[len(patterns)-1]
+	if strings.HasSuffix(last, "*") {
+		return true
+	}
+	if mounted := subRoutes(routes, strings.TrimSuffix(last, "/")+"/*"); mounted != nil {
+		return routed(mounted, method, "/")
+	}
+	return true
+}
+
+func subRoutes(routes chi.Routes, pattern string) chi.Routes {
+	for _, route := range routes.Routes() {
+		if route.Pattern == pattern {
+			return route.SubRoutes
+		}
+	}
+	return nil
+}
+
+// mountBuiltins mounts the operational endpoints, the documentation and
+// the OpenAPI document, once the options are applied.
+func (a *server) mountBuiltins() {
+	ops := a.opsRouter()
+	if a.cfg.VersionPath != "" {
+		ops.Mount(a.cfg.VersionPath, about.Endpoint())
+	}
+	if a.cfg.HealthPath != "" {
+		ops.Mount(a.cfg.HealthPath, healthz.Endpoint(a.drain.Ready, a.warmup.Ready, a.certCheck))
+	}
+	if a.cfg.DebugEndpoints {
+		if a.admin == nil {
+			logrus.Warn("debug endpoints are exposed on the public port, set SERVER_ADMIN_PORT to isolate them")
+		}
+		ops.Mount("/debug", middleware.Profiler())
+	}
+	if a.cfg.RoutesEndpoint {
+		if a.admin == nil {
+			logrus.Warn("the routes endpoint is exposed on the public port, set SERVER_ADMIN_PORT to isolate it")
+		}
+		ops.Get("/routes", a.routes)
+	}
+	if a.captures != nil {
+		if a.admin == nil {
+			logrus.Warn("the body captures are exposed on the public port, set SERVER_ADMIN_PORT to isolate them")
+		}
+		ops.Get("/captures", a.captures.Endpoint)
+	}
+	if a.cfg.RuntimeEndpoint {
+		if a.admin == nil {
+			logrus.Warn("the runtime endpoint is exposed on the public port, set SERVER_ADMIN_PORT to isolate it")
+		}
+		ops.Mount("/runtime", tuning.Endpoint())
+	}
+	if a.toggles != nil {
+		if a.admin == nil {
+			logrus.Warn("the runtime toggles are exposed on the public port, set SERVER_ADMIN_PORT to isolate them")
+		}
+		tokens := make([]string, len(a.cfg.AdminTokens))
+		for i, token := range a.cfg.AdminTokens {
+			tokens[i] = token.String()
+		}
+		ops.Handle("/admin/toggles", a.toggles.Endpoint(tokens))
+	}
+	if a.docs != nil {
+		a.mux.Mount("/docs", a.docs)
+	}
+	for prefix, assets := range a.statics {
+		// Beside the APIs, which take precedence under "/"
+		a.router.Mount(prefix, assets)
+	}
+	if a.openAPITitle != "" {
+		a.mux.Get("/openapi.json", a.openAPI)
+	}
+}
+
+// opsRouter returns the router serving the operational endpoints, which is
+// the admin router when a dedicated admin port is configured.
+func (a *server) opsRouter() *chi.Mux {
+	if a.admin != nil {
+		return a.admin
+	}
+	return a.mux
+}
+
+// exceptOps applies mw to the requests but those of the operational
+// endpoints served on the public port, which probes and operators reach
+// whatever the clients do.
+func (a *server) exceptOps(mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if a.isOps(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isOps reports whether path is served by an operational endpoint of the
+// public port.
+func (a *server) isOps(path string) bool {
+	if a.admin != nil {
+		return false
+	}
+	for _, prefix := range []string{a.cfg.VersionPath, a.cfg.HealthPath, "/debug"} {
+		if prefix != "" && (path == prefix || strings.HasPrefix(path, prefix+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Document records the documentation of a route, rendered in the OpenAPI
+// document.
+func (a *server) Document(method, pattern string, doc api.RouteDoc) {
+	if a.routeDocs == nil {
+		a.routeDocs = make(map[string]api.RouteDoc)
+	}
+	a.routeDocs[api.RouteKey(method, pattern)] = doc
+}
+
+func (a *server) Routes() []api.RouteInfo {
+	// The walk only fails when the walk function does
+	routes, _ := api.Routes(a.mux, a.routeDocs)
+	return routes
+}
+
+// routes replies the routes served.
+func (a *server) routes(w http.ResponseWriter, r *http.Request) {
+	request.Reply(r, w, a.Routes(), http.StatusOK)
+}
+
+// openAPI replies the OpenAPI document generated from the routes.
+func (a *server) openAPI(w http.ResponseWriter, r *http.Request) {
+	doc, err := api.OpenAPI(a.openAPITitle, about.GetVersion().Tag, a.mux, a.routeDocs)
+	if err != nil {
+		request.ReplyErr(w, r, err)
+		return
+	}
+	request.ReplyBytes(r, w, doc, http.StatusOK, request.ContentTypeJSON)
+}
+
+// Warmup registers a function run once the server started, the readiness
+// check failing until it completes or SERVER_WARMUP_TIMEOUT elapses.
+func (a *server) Warmup(name string, fn func(ctx context.Context) error) {
+	a.warmup.Add(name, fn)
+}
+
+// CORS applies a dedicated CORS policy to the routes under the given mount
+// prefix, replacing the server-wide policy for those routes.
+func (a *server) CORS(prefix string, opts cors.Options) {
+	a.policies.Set(prefix, opts)
+}
+
 func (a *server) Run(ctx context.Context) {
+	if err := a.RunE(ctx); err != nil {
+		logrus.WithError(err).Fatal("error while running the server")
+	}
+}
+
+func (a *server) RunE(ctx context.Context) error {
+	ctx, stop := a.signals.notify(ctx, a.trapSignals)
+	defer stop()
+	ctx, service := winsvc.Start(ctx, a.cfg.Shutdown.GracePeriod+a.cfg.Shutdown.Timeout)
+	defer service.Stopped()
+
+	// Companion processes must be up before we accept traffic
+	if err := supervisor.Start(ctx); err != nil {
+		supervisor.Stop()
+		return fmt.Errorf("error while starting companion processes: %w", err)
+	}
+	defer supervisor.Stop()
+
+	if err := a.migrations.Run(ctx); err != nil {
+		return fmt.Errorf("error while running migrations: %w", err)
+	}
+
+	if a.limiter != nil {
+		if err := a.limiter.Load(ctx); err != nil {
+			logrus.WithError(err).Warn("error while restoring the rate limit state")
+		}
+	}
+
+	if a.origins != nil {
+		if err := a.origins.Refresh(ctx); err != nil {
+			logrus.WithError(err).Warn("serving the configured CORS origins only")
+		}
+		go a.origins.Run(ctx)
+	}
+	if a.certs != nil {
+		go a.certs.Run(ctx)
+	}
+	if a.tickets != nil {
+		go a.tickets.Run(ctx)
+	}
+
+	// Routes may have been added since New
+	a.compileChain()
+	ls, err := a.listen(ctx)
+	if err != nil {
+		return err
+	}
 	logrus.Debug("Running HTTP server")
-	if err := a.serve(a.addr, a.router); err != nil {
-		logrus.WithError(err).Fatal("error while running HTTP server")
+	errCh := make(chan error, 3)
+	var srv *http.Server
+	if ls.http != nil {
+		var handler http.Handler = a.mux
+		if a.grpc != nil && a.grpcAddr == "" {
+			handler = a.withGRPC(handler)
+		}
+		srv = a.httpOpts.Server(a.addr, handler)
+		srv.ConnState = a.drain.ConnState
+		go func() {
+			errCh <- srv.Serve(ls.http)
+		}()
+	} else {
+		go func() {
+			errCh <- a.serve(a.addr, a.mux)
+		}()
+	}
+	if ls.grpc != nil {
+		go func() {
+			logrus.WithField("addr", a.grpcAddr).Debug("Running gRPC server")
+			errCh <- a.grpc.Serve(ls.grpc)
+		}()
+	}
+	if ls.admin != nil {
+		admin := a.adminOpts().Server(a.adminAddr, a.admin)
+		defer admin.Close()
+		go func() {
+			logrus.WithField("addr", a.adminAddr).Debug("Running admin server")
+			errCh <- admin.Serve(ls.admin)
+		}()
+	}
+	// The ports are bound, the health endpoint answering
+	runHooks("ready", a.onReady)
+	service.Running()
+	if a.upgrader != nil {
+		if err := a.upgrader.Ready(); err != nil {
+			logrus.WithError(err).Warn("error while reporting ready to the previous process")
+		}
+		if len(a.signals.upgrade) > 0 {
+			go a.upgradeOn(ctx, stop)
+		}
+	}
+
+	go a.warmup.Run(ctx, a.cfg.WarmupTimeout)
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			if srv != nil {
+				_ = srv.Close()
+			}
+			if ls.grpc != nil {
+				a.grpc.Stop()
+			}
+			return fmt.Errorf("error while running HTTP server: %w", err)
+		}
+	case <-ctx.Done():
+		logrus.Debug("Shutting down HTTP server")
+		a.shutdown(srv)
+	}
+	return nil
+}
+
+// loadTLS sets the TLS configurations of the public and admin ports of the
+// https mode, the admin one being nil unless SERVER_ADMIN_TLS_CLIENT_AUTH
+// is set, both serving the certificate of the monitor.
+func (a *server) loadTLS(cfg *config.Server) error {
+	if cfg.Certificate == nil || cfg.Cert == "" || cfg.Key == "" {
+		return errors.New("the https mode requires SERVER_CERTIFICATE_CERT and SERVER_CERTIFICATE_KEY")
+	}
+	cert, err := cfg.Certificate.TLS()
+	if err != nil {
+		return err
+	}
+	if a.certs, err = certs.New(cert); err != nil {
+		return err
+	}
+	a.certs.Stapling, a.certs.Warning = cfg.OCSPStapling, cfg.ExpiryWarning
+	clientCAs, err := cfg.TLSClientAuth.ClientCAs()
+	if err != nil {
+		return err
 	}
+	if a.httpOpts.TLS, err = listener.TLSConfig(cert, clientCAs, cfg.ClientAuth); err != nil {
+		return err
+	}
+	a.httpOpts.TLS.Certificates, a.httpOpts.TLS.GetCertificate = nil, a.certs.GetCertificate
+	if cfg.AdminClientAuth != "" {
+		if a.adminTLS, err = listener.TLSConfig(cert, clientCAs, cfg.AdminClientAuth); err != nil {
+			return err
+		}
+		a.adminTLS.Certificates, a.adminTLS.GetCertificate = nil, a.certs.GetCertificate
+	}
+	if cfg.TicketRotation > 0 || len(cfg.TicketSecrets) > 0 {
+		configs := []*tls.Config{a.httpOpts.TLS}
+		if a.adminTLS != nil {
+			configs = append(configs, a.adminTLS)
+		}
+		a.tickets = certs.NewTickets(configs...)
+		a.tickets.Interval, a.tickets.Secrets = cfg.TicketRotation, cfg.TicketSecrets
+	}
+	return nil
+}
+
+// certCheck fails once the certificate of the https mode expires within
+// SERVER_TLS_EXPIRY_CHECK, or is revoked.
+func (a *server) certCheck() error {
+	if a.certs == nil {
+		return nil
+	}
+	return a.certs.Check(a.cfg.ExpiryCheck)
+}
+
+// adminOpts returns the options of the admin port, serving TLS as
+// SERVER_ADMIN_TLS_CLIENT_AUTH sets only.
+func (a *server) adminOpts() listener.Options {
+	opts := a.httpOpts
+	opts.TLS = a.adminTLS
+	return opts
+}
+
+// listeners of the HTTP, gRPC and admin ports, nil when not served
+type listeners struct {
+	http, grpc, admin net.Listener
+}
+
+// listen binds the ports before any is served, so a port taken fails the
+// server as a whole. The HTTP port falls back to SERVER_FALLBACK_PORT when
+// taken.
+func (a *server) listen(ctx context.Context) (ls listeners, err error) {
+	defer func() {
+		if err != nil {
+			for _, l := range []net.Listener{ls.http, ls.grpc, ls.admin} {
+				if l != nil {
+					_ = l.Close()
+				}
+			}
+		}
+	}()
+	if listener.IsHTTP(a.cfg.Mode) {
+		ls.http, err = a.httpOpts.ListenContext(ctx, a.addr)
+		if err != nil && a.cfg.FallbackPort != 0 && listener.AddrInUse(err) {
+			fallback := listener.Addr(a.cfg.BindAddress, a.cfg.FallbackPort)
+			logrus.WithError(err).WithField("addr", fallback).Warn("listening on the fallback port")
+			if ls.http, err = a.httpOpts.ListenContext(ctx, fallback); err == nil {
+				a.addr = fallback
+			}
+		}
+		if err != nil {
+			return ls, err
+		}
+	}
+	if a.grpc != nil && a.grpcAddr != "" {
+		// Not through httpOpts, the strict framing being HTTP/1
+		opts := listener.Options{Network: a.httpOpts.Network, Bind: a.upgrader.Listen, BindRetries: a.httpOpts.BindRetries, BindBackoff: a.httpOpts.BindBackoff}
+		if ls.grpc, err = opts.ListenContext(ctx, a.grpcAddr); err != nil {
+			return ls, err
+		}
+	}
+	if a.admin != nil {
+		if ls.admin, err = a.adminOpts().ListenContext(ctx, a.adminAddr); err != nil {
+			return ls, err
+		}
+	}
+	return ls, nil
+}
+
+// runHooks calls the functions registered for a stage of the lifecycle, a
+// panicking one being logged so the others still run and the server goes
+// on shutting down.
+func runHooks(stage string, fns []func()) {
+	for _, fn := range fns {
+		func() {
+			defer func() {
+				if rvr := recover(); rvr != nil {
+					logrus.WithFields(logrus.Fields{
+						"stage": stage,
+						"panic": fmt.Sprint(rvr),
+						"stack": strings.Split(string(debug.Stack()), "\n"),
+					}).Error("panicked in a lifecycle hook")
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+// freshConnTimeout is how long shutdown waits for the accepted connections
+// to send their request before closing them.
+const freshConnTimeout = time.Second
+
+// shutdown drains the in-flight requests: the readiness check fails for
+// the grace period, then the server stops accepting connections and waits
+// for the requests to complete until the shutdown timeout.
+func (a *server) shutdown(srv *http.Server) {
+	a.drain.Start()
+	if a.grpcHealth != nil {
+		runHooks("draining", []func(){a.grpcHealth.Shutdown})
+	}
+	runHooks("draining", a.onDraining)
+	logrus.WithFields(logrus.Fields{
+		"active":       a.drain.Active(),
+		"grace_period": a.cfg.Shutdown.GracePeriod,
+	}).Info("Draining HTTP server")
+	time.Sleep(a.cfg.Shutdown.GracePeriod)
+	runHooks("shutdown", a.onShutdown)
+
+	ctx := context.Background()
+	if a.cfg.Shutdown.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.cfg.Shutdown.Timeout)
+		defer cancel()
+	}
+	if srv != nil {
+		closing, stopClosing := context.WithCancel(ctx)
+		go a.drain.CloseFresh(closing, freshConnTimeout)
+		err := srv.Shutdown(ctx)
+		stopClosing()
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			logrus.WithError(err).Warn("error while shutting down HTTP server")
+		}
+	}
+	if a.grpc != nil && a.grpcAddr != "" {
+		a.stopGRPC(ctx)
+	}
+	aborted := a.drain.Wait(ctx)
+	if srv != nil && aborted > 0 {
+		_ = srv.Close()
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"drained": a.drain.Drained(),
+		"aborted": aborted,
+	}).Info("HTTP server drained")
+
+	if a.limiter != nil {
+		if err := a.limiter.Save(context.Background()); err != nil {
+			logrus.WithError(err).Warn("error while saving the rate limit state")
+		}
+	}
+}
+
+func corsOptions(cfg *config.CORS) *cors.Options {
+	return &cors.Options{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+	}
+}
+
+func securityConfig(cfg *config.Security) security.Config {
+	return security.Config{
+		ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+		FrameOptions:          cfg.FrameOptions,
+		ReferrerPolicy:        cfg.ReferrerPolicy,
+		PermissionsPolicy:     cfg.PermissionsPolicy,
+		ContentTypeOptions:    cfg.ContentTypeOptions,
+	}
+}
+
+func alertMonitor(cfg *config.Alert, policy *egress.Policy) *alert.Monitor {
+	notifiers := alert.Multi{}
+	httpClient := client.New(client.Config{Timeout: 30 * time.Second, Egress: policy})
+	if cfg.WebhookURL != "" {
+		notifiers = append(notifiers, &alert.Webhook{URL: cfg.WebhookURL, Client: httpClient})
+	}
+	if cfg.SlackWebhookURL != "" {
+		notifiers = append(notifiers, &alert.Slack{WebhookURL: cfg.SlackWebhookURL, Client: httpClient})
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+	return &alert.Monitor{
+		Notifier: notifiers,
+		Thresholds: map[string]float64{
+			alert.ClassServerError:     cfg.ServerErrorRate,
+			alert.ClassTooManyRequests: cfg.TooManyRate,
+		},
+		Window:      cfg.Window,
+		MinRequests: cfg.MinRequests,
+		Cooldown:    cfg.Cooldown,
+	}
+}
+
+func auditTrail(cfg *config.Audit, policy *egress.Policy) *audit.Trail {
+	switch cfg.Sink {
+	case "":
+		return nil
+	case "stdout":
+		return &audit.Trail{Sink: &audit.Writer{W: os.Stdout}}
+	case "file":
+		return &audit.Trail{Sink: &audit.File{Dir: cfg.Dir, Retention: cfg.Retention}}
+	case "webhook":
+		httpClient := client.New(client.Config{Timeout: 10 * time.Second, Egress: policy})
+		return &audit.Trail{Sink: &audit.Webhook{URL: cfg.WebhookURL, Client: httpClient}}
+	}
+	logrus.WithField("sink", cfg.Sink).Fatal("unknown audit sink")
+	return nil
+}
+
+// bodyCapture returns the middleware capturing the bodies to the log or to
+// the ring of a.captures.
+func (a *server) bodyCapture(cfg *config.BodyCapture) func(http.Handler) http.Handler {
+	capture := bodycapture.Config{Size: cfg.Size, Redact: cfg.Redact, ErrorsOnly: cfg.ErrorsOnly}
+	switch cfg.Sink {
+	case "log":
+	case "ring":
+		a.captures = bodycapture.NewRing(cfg.RingSize)
+		capture.Ring = a.captures
+	default:
+		logrus.WithField("sink", cfg.Sink).Fatal("unknown body capture sink")
+	}
+	logrus.Warn("the request and response bodies are captured, unset SERVER_BODY_CAPTURE once diagnosed")
+	return bodycapture.Middleware(capture)
+}
+
+// tuneRuntime sizes the runtime to the cgroup limits and logs the settings
+// resolved.
+func tuneRuntime(cfg *config.Runtime) {
+	limits, err := tuning.ReadLimits(tuning.CgroupRoot)
+	if err != nil {
+		logrus.WithError(err).Warn("error while reading the cgroup limits")
+	}
+	s := tuning.Apply(limits, cfg.AutoMaxProcs, cfg.MemoryLimitRatio)
+	logrus.WithFields(logrus.Fields{
+		"cpu_limit":         limits.CPU,
+		"memory_limit":      limits.Memory,
+		"gomaxprocs":        s.GOMAXPROCS,
+		"gomaxprocs_source": s.GOMAXPROCSSource,
+		"gomemlimit":        s.GOMEMLIMIT,
+		"gomemlimit_source": s.GOMEMLIMITSource,
+	}).Info("Tuned the runtime")
+}
+
+func rateLimiter(cfg *config.RateLimit) *ratelimit.Limiter {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+	rl := ratelimit.Config{Rate: cfg.Rate, Burst: cfg.Burst}
+	if cfg.StateFile != "" {
+		rl.Store = ratelimit.FileStore{Path: cfg.StateFile}
+	}
+	return ratelimit.New(rl)
+}
+
+// compileChain composes the middleware chain of each static route some
+// middleware skips, such as the health check exempt from maintenance, so
+// its requests go through the middlewares applying to them only.
+func (a *server) compileChain() {
+	a.chain.Compile(chain.StaticPaths(a.mux)...)
+	logrus.WithField("paths", a.chain.Compiled()).Debug("compiled the middleware chain")
 }
@@ -0,0 +1,1163 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/cors"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+
+	"github.com/go-obvious/server"
+	"github.com/go-obvious/server/api"
+	"github.com/go-obvious/server/config"
+	"github.com/go-obvious/server/discovery"
+	"github.com/go-obvious/server/ratelimit"
+	"github.com/go-obvious/server/request"
+	"github.com/go-obvious/server/security"
+	"github.com/go-obvious/server/sse"
+	"github.com/go-obvious/server/static"
+	"github.com/go-obvious/server/ws"
+)
+
+var version = &server.ServerVersion{Revision: "test", Tag: "test", Time: "test"}
+
+func preflight(t *testing.T, app server.Server, origin string) *httptest.ResponseRecorder {
+	router, ok := app.Router().(*chi.Mux)
+	require.True(t, ok)
+
+	req := httptest.NewRequest(http.MethodOptions, "/healthz", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCORSFromEnvironment(t *testing.T) {
+	t.Setenv("SERVER_CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	t.Setenv("SERVER_CORS_ALLOWED_METHODS", "GET,PUT")
+	t.Setenv("SERVER_CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("SERVER_CORS_MAX_AGE", "600")
+
+	rr := preflight(t, server.New(version), "https://app.example.com")
+
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "PUT", rr.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "600", rr.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestWithCORS(t *testing.T) {
+	app := server.NewWithOptions(version, server.WithCORS(cors.Options{
+		AllowedOrigins: []string{"https://admin.example.com"},
+		AllowedMethods: []string{http.MethodGet},
+	}))
+
+	rr := preflight(t, app, "https://admin.example.com")
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"), "PUT is not an allowed method")
+
+	rr = preflight(t, app, "https://other.example.com")
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+}
+
+// service adapts an api.Service to the server.API interface
+type service struct {
+	*api.Service
+}
+
+func (s service) Register(app server.Server) error {
+	return s.Service.Register(app)
+}
+
+func TestServiceCORSPolicy(t *testing.T) {
+	admin := chi.NewRouter()
+	admin.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	app := server.NewWithOptions(version, server.WithAPIs(service{&api.Service{
+		APIName: "admin",
+		Mounts:  map[string]*chi.Mux{"/admin": admin},
+		CORS: map[string]cors.Options{
+			"/admin": {AllowedOrigins: []string{"https://admin.example.com"}},
+		},
+	}}))
+	router, ok := app.Router().(*chi.Mux)
+	require.True(t, ok)
+
+	for origin, expected := range map[string]string{
+		"https://admin.example.com": "https://admin.example.com",
+		"https://other.example.com": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("Origin", origin)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, expected, rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	t.Setenv("SERVER_FRAME_OPTIONS", "SAMEORIGIN")
+	t.Setenv("SERVER_PERMISSIONS_POLICY", "")
+
+	app := server.New(version)
+	router, ok := app.Router().(*chi.Mux)
+	require.True(t, ok)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, "SAMEORIGIN", rr.Header().Get(security.HeaderFrameOptions))
+	assert.NotContains(t, rr.Header(), security.HeaderContentSecurityPolicy, "the policy is opt-in")
+	assert.NotContains(t, rr.Header(), security.HeaderPermissionsPolicy)
+	assert.Equal(t, security.DefaultContentTypeOptions, rr.Header().Get(security.HeaderContentTypeOptions))
+
+	app = server.NewWithOptions(version, server.WithSecurityHeader(security.HeaderContentSecurityPolicy, "default-src 'none'"))
+	router, ok = app.Router().(*chi.Mux)
+	require.True(t, ok)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, "default-src 'none'", rr.Header().Get(security.HeaderContentSecurityPolicy))
+	assert.Equal(t, "SAMEORIGIN", rr.Header().Get(security.HeaderFrameOptions), "keeps the other headers")
+
+	app = server.NewWithOptions(version, server.WithSecurity(security.Config{ReferrerPolicy: "no-referrer"}))
+	router, ok = app.Router().(*chi.Mux)
+	require.True(t, ok)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, "no-referrer", rr.Header().Get(security.HeaderReferrerPolicy))
+	assert.NotContains(t, rr.Header(), security.HeaderContentSecurityPolicy)
+}
+
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestAdminPort(t *testing.T) {
+	port, adminPort := freePort(t), freePort(t)
+	t.Setenv("SERVER_PORT", port)
+	t.Setenv("SERVER_ADMIN_PORT", adminPort)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		server.New(version).Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://127.0.0.1:" + adminPort + "/healthz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp, err := http.Get("http://127.0.0.1:" + port + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestBindFailure(t *testing.T) {
+	port := freePort(t)
+	taken, err := net.Listen("tcp", ":"+port)
+	require.NoError(t, err)
+	defer taken.Close()
+	t.Setenv("SERVER_PORT", port)
+	t.Setenv("SERVER_BIND_RETRIES", "2")
+	t.Setenv("SERVER_BIND_BACKOFF", "1ms")
+
+	err = server.New(version).(server.RunnerE).RunE(context.Background())
+	var bindErr *server.BindError
+	require.ErrorAs(t, err, &bindErr)
+	assert.Equal(t, ":"+port, bindErr.Addr)
+	assert.Equal(t, 3, bindErr.Attempts)
+
+	fallback := freePort(t)
+	t.Setenv("SERVER_FALLBACK_PORT", fallback)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.New(version).(server.RunnerE).RunE(ctx)
+	}()
+	defer func() {
+		// The next test starts once this server stopped
+		cancel()
+		assert.NoError(t, <-stopped)
+	}()
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://127.0.0.1:" + fallback + "/healthz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBindAddress(t *testing.T) {
+	if l, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skip("IPv6 is not available")
+	} else {
+		l.Close()
+	}
+	for _, tt := range []struct{ address, network, other string }{
+		{address: "127.0.0.1", network: "tcp", other: "[::1]"},
+		{address: "::1", network: "tcp6", other: "127.0.0.1"},
+		{network: "tcp6", other: "127.0.0.1"},
+	} {
+		t.Run(tt.address+"/"+tt.network, func(t *testing.T) {
+			port := freePort(t)
+			t.Setenv("SERVER_PORT", port)
+			t.Setenv("SERVER_BIND_ADDRESS", tt.address)
+			t.Setenv("SERVER_BIND_NETWORK", tt.network)
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				server.New(version).Run(ctx)
+				close(stopped)
+			}()
+			defer func() {
+				cancel()
+				<-stopped
+			}()
+
+			require.Eventually(t, func() bool {
+				return server.Healthcheck(ctx) == nil
+			}, 5*time.Second, 10*time.Millisecond)
+			_, err := net.Dial("tcp", tt.other+":"+port)
+			assert.Error(t, err, "not listening on %s", tt.other)
+		})
+	}
+}
+
+// testCert is a certificate and its key, in PEM.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM string
+	keyPEM  string
+}
+
+// issue returns a certificate for 127.0.0.1 signed by ca, a CA certificate
+// when nil.
+func issue(t *testing.T, ca *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+func TestTLSClientAuth(t *testing.T) {
+	ca := issue(t, nil)
+	serverCert, clientCert := issue(t, ca), issue(t, ca)
+	port, adminPort := freePort(t), freePort(t)
+	t.Setenv("SERVER_MODE", "https")
+	t.Setenv("SERVER_PORT", port)
+	t.Setenv("SERVER_ADMIN_PORT", adminPort)
+	t.Setenv("SERVER_CERTIFICATE_CERT", serverCert.certPEM)
+	t.Setenv("SERVER_CERTIFICATE_KEY", serverCert.keyPEM)
+	t.Setenv("SERVER_TLS_CLIENT_CA", ca.certPEM)
+	t.Setenv("SERVER_ADMIN_TLS_CLIENT_AUTH", "none")
+	svc := &api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": chi.NewRouter()}}
+	svc.Mounts["/orders"].Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		server.NewWithOptions(version, server.WithAPIs(service{svc})).Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(ctx) == nil
+	}, 5*time.Second, 10*time.Millisecond, "the admin port serves TLS without client certificates")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+			ForceAttemptHTTP2: true,
+		}}
+		return client.Get("https://127.0.0.1:" + port + "/orders")
+	}
+	_, err := get()
+	assert.Error(t, err, "a client certificate is required on the public port")
+
+	pair, err := tls.X509KeyPair([]byte(clientCert.certPEM), []byte(clientCert.keyPEM))
+	require.NoError(t, err)
+	resp, err := get(pair)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor, "HTTP/2 is negotiated")
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	for enabled, expected := range map[string]int{"true": http.StatusOK, "false": http.StatusNotFound} {
+		t.Setenv("SERVER_DEBUG_ENDPOINTS_ENABLED", enabled)
+
+		router, ok := server.New(version).Router().(*chi.Mux)
+		require.True(t, ok)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+		assert.Equal(t, expected, rr.Code)
+	}
+}
+
+func TestBuiltinPaths(t *testing.T) {
+	t.Setenv("SERVER_VERSION_PATH", "/version")
+	for path, expected := range map[string]int{"/version": http.StatusOK, "/about": http.StatusNotFound} {
+		rr := httptest.NewRecorder()
+		api.ChiRouter(server.New(version)).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, expected, rr.Code, path)
+	}
+
+	router := api.ChiRouter(server.NewWithOptions(version, server.WithHealthPath("/livez"), server.WithVersionPath("")))
+	for path, expected := range map[string]int{"/livez": http.StatusOK, "/healthz": http.StatusNotFound, "/version": http.StatusNotFound} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, expected, rr.Code, path)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	svc := &api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": chi.NewRouter()}}
+	svc.Mounts["/orders"].Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	svc.Describe(http.MethodGet, "/orders", api.RouteDoc{Summary: "List orders"})
+	app := server.NewWithOptions(version, server.WithRoutesEndpoint(true), server.WithAPIs(service{svc}))
+
+	rr := httptest.NewRecorder()
+	api.ChiRouter(app).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/routes", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var routes []api.RouteInfo
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &routes))
+	assert.Equal(t, app.(server.RouteLister).Routes(), routes)
+
+	var found bool
+	for _, route := range routes {
+		if route.Method == http.MethodGet && route.Pattern == "/orders" {
+			found = true
+			require.NotNil(t, route.Doc)
+			assert.Equal(t, "List orders", route.Doc.Summary)
+			assert.NotEmpty(t, route.Middlewares)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	orders := chi.NewRouter()
+	orders.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	orders.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	app := server.NewWithOptions(version, server.WithAPIs(service{&api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": orders}}}))
+
+	rr := httptest.NewRecorder()
+	api.ChiRouter(app).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/orders/42", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, DELETE", rr.Header().Get("Allow"))
+	assert.Contains(t, rr.Header().Get("Content-Type"), "application/json")
+	assert.Contains(t, rr.Body.String(), "method not allowed")
+
+	rr = httptest.NewRecorder()
+	api.ChiRouter(app).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET", rr.Header().Get("Allow"))
+}
+
+func TestWithStatic(t *testing.T) {
+	orders := chi.NewRouter()
+	orders.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("orders"))
+	})
+	app := server.NewWithOptions(version,
+		server.WithStatic("/", fstest.MapFS{"index.html": {Data: []byte("<html>app</html>")}}, static.Options{SPA: true}),
+		server.WithAPIs(service{&api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": orders}}}),
+	)
+
+	get := func(path string) string {
+		rr := httptest.NewRecorder()
+		api.ChiRouter(app).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Body.String()
+	}
+	assert.Equal(t, "<html>app</html>", get("/"))
+	assert.Equal(t, "<html>app</html>", get("/settings/profile"))
+	assert.Equal(t, "orders", get("/orders"), "the APIs take precedence")
+	assert.Contains(t, get("/healthz"), "success")
+}
+
+func TestWithResponseHooks(t *testing.T) {
+	app := server.NewWithOptions(version, server.WithResponseHooks(func(r *http.Request, status int, h http.Header) {
+		if r.URL.Path == "/about" {
+			h.Set(security.HeaderFrameOptions, "SAMEORIGIN")
+		}
+	}))
+
+	rr := httptest.NewRecorder()
+	api.ChiRouter(app).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/about", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "SAMEORIGIN", rr.Header().Get(security.HeaderFrameOptions), "overrides the security headers")
+}
+
+func TestHealthcheck(t *testing.T) {
+	port := freePort(t)
+	t.Setenv("SERVER_PORT", port)
+
+	require.Error(t, server.Healthcheck(context.Background()), "nothing is listening yet")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		server.New(version).Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(ctx) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHealthcheckOptions(t *testing.T) {
+	port := freePort(t)
+	p, err := strconv.ParseUint(port, 10, 0)
+	require.NoError(t, err)
+	t.Setenv("SERVER_PORT", "1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		server.NewWithOptions(version, server.WithPort(uint(p))).Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(ctx, server.WithPort(uint(p))) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Error(t, server.Healthcheck(ctx), "SERVER_PORT is probed without the options")
+
+	t.Setenv("SERVER_COOKIE_KEYS", "env://APP_MISSING_KEY")
+	assert.NoError(t, server.Healthcheck(ctx, server.WithPort(uint(p))), "the secrets are not resolved")
+}
+
+func TestHealthcheckClientCertificate(t *testing.T) {
+	ca := issue(t, nil)
+	serverCert, clientCert := issue(t, ca), issue(t, ca)
+	t.Setenv("SERVER_MODE", "https")
+	t.Setenv("SERVER_PORT", freePort(t))
+	t.Setenv("SERVER_CERTIFICATE_CERT", serverCert.certPEM)
+	t.Setenv("SERVER_CERTIFICATE_KEY", serverCert.keyPEM)
+	t.Setenv("SERVER_TLS_CLIENT_CA", ca.certPEM)
+	pair, err := tls.X509KeyPair([]byte(clientCert.certPEM), []byte(clientCert.keyPEM))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		server.New(version).Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(ctx, server.WithHealthcheckCertificate(pair)) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Error(t, server.Healthcheck(ctx), "the port requires a client certificate")
+}
+
+func TestOptions(t *testing.T) {
+	port := freePort(t)
+	p, err := strconv.ParseUint(port, 10, 0)
+	require.NoError(t, err)
+	t.Setenv("SERVER_PORT", "1")
+
+	app := server.NewWithOptions(version,
+		server.WithPort(uint(p)),
+		server.WithCORSOrigins("https://app.example.com"),
+	)
+
+	rr := preflight(t, app, "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://127.0.0.1:" + port + "/healthz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond, "served on the port of WithPort")
+}
+
+func TestRateLimit(t *testing.T) {
+	orders := chi.NewRouter()
+	orders.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	app := server.NewWithOptions(version,
+		server.WithAPIs(service{&api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": orders}}}),
+		server.WithRateLimit(ratelimit.Config{Rate: 1}),
+	)
+	router, ok := app.Router().(*chi.Mux)
+	require.True(t, ok)
+	get := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("/orders"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/orders"), "the second request within a second is limited")
+	for range 3 {
+		assert.Equal(t, http.StatusOK, get("/healthz"), "the probes are not limited")
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	t.Setenv("SERVER_ALLOWED_HOSTS", "api.example.com")
+
+	orders := chi.NewRouter()
+	orders.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	app := server.NewWithOptions(version,
+		server.WithAPIs(service{&api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": orders}}}),
+	)
+	router, ok := app.Router().(*chi.Mux)
+	require.True(t, ok)
+	get := func(host, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("api.example.com", "/orders"))
+	assert.Equal(t, http.StatusBadRequest, get("10.0.0.7:8080", "/orders"))
+	assert.Equal(t, http.StatusOK, get("10.0.0.7:8080", "/healthz"), "the probes reach the pod address")
+	assert.Equal(t, http.StatusOK, get("10.0.0.7:8080", "/about"))
+}
+
+func TestToggles(t *testing.T) {
+	orders := chi.NewRouter()
+	orders.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	router := api.ChiRouter(server.NewWithOptions(version,
+		server.WithAdminTokens("token"),
+		server.WithAPIs(service{&api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/admin/orders": orders}}}),
+	))
+	serve := func(method, path, body string) int {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve(http.MethodPatch, "/admin/toggles", `{"maintenance": true}`))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodGet, "/admin/orders", ""), "the routes of the APIs are in maintenance")
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodGet, "/healthzX", ""))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/healthz", ""))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPatch, "/admin/toggles", `{"maintenance": false}`))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/admin/orders", ""))
+}
+
+func TestNewAPIs(t *testing.T) {
+	orders := chi.NewRouter()
+	orders.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	app := server.New(version, service{&api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": orders}}})
+	router, ok := app.Router().(*chi.Mux)
+	require.True(t, ok)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestWithRouter(t *testing.T) {
+	port := freePort(t)
+	p, err := strconv.ParseUint(port, 10, 0)
+	require.NoError(t, err)
+
+	custom := chi.NewRouter()
+	custom.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Custom", "yes")
+			next.ServeHTTP(w, r)
+		})
+	})
+	custom.Get("/hello", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+	orders := chi.NewRouter()
+	orders.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("orders"))
+	})
+
+	app := server.NewWithOptions(version,
+		server.WithPort(uint(p)),
+		server.WithRouter(custom),
+		server.WithAPIs(service{&api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": orders}}}),
+	)
+	assert.Equal(t, custom, app.Router())
+	assert.Equal(t, custom, api.ChiRouter(app))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	get := func(path string) *http.Response {
+		resp, err := http.Get("http://127.0.0.1:" + port + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://127.0.0.1:" + port + "/healthz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp := get("/hello")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "yes", resp.Header.Get("X-Custom"))
+	assert.Equal(t, security.DefaultContentTypeOptions, resp.Header.Get(security.HeaderContentTypeOptions), "the server middlewares still run")
+
+	resp = get("/orders")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "yes", resp.Header.Get("X-Custom"))
+}
+
+func TestWarmup(t *testing.T) {
+	port := freePort(t)
+	t.Setenv("SERVER_PORT", port)
+
+	release := make(chan struct{})
+	app := server.NewWithOptions(version, server.WithAPIs(service{&api.Service{
+		APIName: "cached",
+		Warmups: map[string]func(ctx context.Context) error{
+			"cache": func(ctx context.Context) error {
+				<-release
+				return nil
+			},
+		},
+	}}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	var body string
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://127.0.0.1:" + port + "/healthz")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body = string(data)
+		return resp.StatusCode == http.StatusServiceUnavailable
+	}, 5*time.Second, 10*time.Millisecond, "the readiness check fails while warming up")
+	assert.Contains(t, body, "0/1 done, pending cache")
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return server.Healthcheck(context.Background()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestShutdownDrains(t *testing.T) {
+	port := freePort(t)
+	t.Setenv("SERVER_PORT", port)
+
+	release := make(chan struct{})
+	svc := &api.Service{APIName: "slow", Mounts: map[string]*chi.Mux{"/slow": chi.NewRouter()}}
+	svc.Mounts["/slow"].Get("/", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte("done"))
+	})
+	app := server.NewWithOptions(version,
+		server.WithShutdown(config.Shutdown{GracePeriod: 200 * time.Millisecond, Timeout: 5 * time.Second}),
+		server.WithAPIs(service{svc}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(context.Background()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://127.0.0.1:" + port + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(context.Background()) != nil
+	}, time.Second, 10*time.Millisecond, "the readiness check fails while draining")
+
+	close(release)
+	assert.Equal(t, "done", <-body)
+	<-stopped
+}
+
+func TestShutdownClosesEventStreams(t *testing.T) {
+	port := freePort(t)
+	t.Setenv("SERVER_PORT", port)
+
+	events := &sse.Broker{}
+	svc := &api.Service{APIName: "events", Mounts: map[string]*chi.Mux{"/events": chi.NewRouter()}}
+	svc.Mounts["/events"].Handle("/", events)
+	app := server.NewWithOptions(version,
+		server.WithShutdown(config.Shutdown{Timeout: 5 * time.Second}),
+		server.WithOnDraining(events.Close),
+		server.WithAPIs(service{svc}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(context.Background()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp, err := http.Get("http://127.0.0.1:" + port + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Eventually(t, func() bool { return events.Clients() == 1 }, time.Second, 10*time.Millisecond)
+	cancel()
+
+	_, err = io.ReadAll(resp.Body)
+	assert.NoError(t, err, "the stream ends cleanly")
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not stopped")
+	}
+}
+
+func TestShutdownClosesWebSockets(t *testing.T) {
+	port := freePort(t)
+	t.Setenv("SERVER_PORT", port)
+
+	hub := &ws.Hub{}
+	svc := &api.Service{APIName: "ws", Mounts: map[string]*chi.Mux{"/ws": chi.NewRouter()}}
+	svc.Mounts["/ws"].Handle("/", hub.Handler(func(c *ws.Conn, r *http.Request) {
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	app := server.NewWithOptions(version,
+		server.WithShutdown(config.Shutdown{Timeout: 5 * time.Second}),
+		server.WithOnShutdown(hub.Close),
+		server.WithAPIs(service{svc}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(context.Background()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:"+port+"/ws", nil)
+	require.NoError(t, err, "the middleware stack lets the connection be upgraded")
+	defer conn.Close()
+	require.Eventually(t, func() bool { return hub.Conns() == 1 }, time.Second, 10*time.Millisecond)
+	cancel()
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not stopped")
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	orders := chi.NewRouter()
+	orders.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	svc := &api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": orders}}
+	svc.Describe(http.MethodGet, "/orders", api.RouteDoc{Summary: "List orders"})
+
+	router, ok := server.NewWithOptions(version, server.WithOpenAPI("Orders"), server.WithAPIs(service{svc})).Router().(*chi.Mux)
+	require.True(t, ok)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"summary": "List orders"`)
+}
+
+// grpcServer stands for a *grpc.Server.
+type grpcServer struct {
+	listener chan net.Listener
+	stopped  chan struct{}
+}
+
+func (g *grpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func (g *grpcServer) Serve(l net.Listener) error {
+	g.listener <- l
+	<-g.stopped
+	return nil
+}
+
+func (g *grpcServer) GracefulStop() { close(g.stopped) }
+
+func (g *grpcServer) Stop() {}
+
+type grpcHealth struct{ down atomic.Bool }
+
+func (h *grpcHealth) Shutdown() { h.down.Store(true) }
+
+func TestWithGRPC(t *testing.T) {
+	port := freePort(t)
+	t.Setenv("SERVER_PORT", port)
+	health := &grpcHealth{}
+	app := server.NewWithOptions(version,
+		server.WithShutdown(config.Shutdown{Timeout: time.Second}),
+		server.WithGRPC(&grpcServer{}),
+		server.WithGRPCHealth(health),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(context.Background()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// gRPC is HTTP/2 without TLS, along with the HTTP requests
+	h2c := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:"+port+"/orders.Orders/Get", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	resp, err := h2c.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "0", resp.Header.Get("Grpc-Status"))
+
+	resp, err = h2c.Get("http://127.0.0.1:" + port + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Grpc-Status"))
+
+	cancel()
+	<-stopped
+	assert.True(t, health.down.Load(), "the gRPC health reports the draining")
+}
+
+func TestGRPCPort(t *testing.T) {
+	port, grpcPort := freePort(t), freePort(t)
+	t.Setenv("SERVER_PORT", port)
+	t.Setenv("SERVER_GRPC_PORT", grpcPort)
+	rpc := &grpcServer{listener: make(chan net.Listener, 1), stopped: make(chan struct{})}
+	app := server.NewWithOptions(version, server.WithShutdown(config.Shutdown{Timeout: time.Second}), server.WithGRPC(rpc))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	l := <-rpc.listener
+	assert.Equal(t, grpcPort, strconv.Itoa(l.Addr().(*net.TCPAddr).Port))
+
+	cancel()
+	<-stopped
+	select {
+	case <-rpc.stopped:
+	default:
+		t.Error("the gRPC server was not stopped")
+	}
+}
+
+// registrar records the registrations, checking the health of the server
+// at each.
+type registrar struct {
+	events chan string
+}
+
+func (x *registrar) Register(ctx context.Context, s discovery.Service) error {
+	x.events <- "register " + s.ID + " " + s.HealthURL + " " + healthStatus(s.HealthURL)
+	return nil
+}
+
+func (x *registrar) Deregister(ctx context.Context, s discovery.Service) error {
+	x.events <- "deregister " + s.ID + " " + healthStatus(s.HealthURL)
+	return nil
+}
+
+func healthStatus(url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err.Error()
+	}
+	_ = resp.Body.Close()
+	return strconv.Itoa(resp.StatusCode)
+}
+
+func TestDiscovery(t *testing.T) {
+	port := freePort(t)
+	t.Setenv("SERVER_PORT", port)
+	t.Setenv("SERVER_DISCOVERY_SERVICE", "orders")
+	t.Setenv("SERVER_DISCOVERY_ADDRESS", "127.0.0.1")
+	reg := &registrar{events: make(chan string, 2)}
+	app := server.NewWithOptions(version,
+		server.WithShutdown(config.Shutdown{GracePeriod: 50 * time.Millisecond, Timeout: time.Second}),
+		server.WithDiscovery(reg),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	id := "orders-127.0.0.1-" + port
+	assert.Equal(t, "register "+id+" http://127.0.0.1:"+port+"/healthz 200", <-reg.events)
+
+	cancel()
+	assert.Equal(t, "deregister "+id+" 503", <-reg.events, "deregistered once draining")
+	<-stopped
+}
+
+func TestBodyCapture(t *testing.T) {
+	t.Setenv("SERVER_BODY_CAPTURE", "ring")
+	t.Setenv("SERVER_BODY_CAPTURE_ERRORS_ONLY", "true")
+	svc := &api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": chi.NewRouter()}}
+	svc.Mounts["/orders"].Post("/", func(w http.ResponseWriter, r *http.Request) {
+		request.ReplyErr(w, r, request.NewHTTPError(errors.New("qty must be positive"), http.StatusBadRequest))
+	})
+	router := api.ChiRouter(server.NewWithOptions(version, server.WithAPIs(service{svc})))
+
+	r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"qty": -1, "password": "hunter22"}`))
+	r.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/captures", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var captures []struct {
+		RequestID    string `json:"request_id"`
+		Status       int    `json:"status"`
+		RequestBody  string `json:"request_body"`
+		ResponseBody string `json:"response_body"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &captures))
+	require.Len(t, captures, 1, "only the errors")
+	assert.NotEmpty(t, captures[0].RequestID)
+	assert.Equal(t, http.StatusBadRequest, captures[0].Status)
+	assert.Equal(t, `{"qty": -1, "password": "[REDACTED]"}`, captures[0].RequestBody)
+	assert.Contains(t, captures[0].ResponseBody, "qty must be positive")
+}
+
+func TestPanicReporter(t *testing.T) {
+	svc := &api.Service{APIName: "orders", Mounts: map[string]*chi.Mux{"/orders": chi.NewRouter()}}
+	svc.Mounts["/orders"].Get("/", func(w http.ResponseWriter, r *http.Request) {
+		panic("out of stock")
+	})
+	reports := make(chan server.PanicReport, 1)
+	app := server.NewWithOptions(version, server.WithAPIs(service{svc}), server.WithPanicReporter(func(ctx context.Context, rep server.PanicReport) {
+		reports <- rep
+	}))
+
+	rr := httptest.NewRecorder()
+	api.ChiRouter(app).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	rep := <-reports
+	assert.Equal(t, "out of stock", rep.Value)
+	assert.Equal(t, rr.Header().Get(request.HeaderRequestID), rep.RequestID)
+	assert.NotEmpty(t, rep.RequestID)
+}
+
+func TestShutdownHookPanics(t *testing.T) {
+	t.Setenv("SERVER_PORT", freePort(t))
+	var closed atomic.Bool
+	app := server.NewWithOptions(version,
+		server.WithShutdown(config.Shutdown{Timeout: time.Second}),
+		server.WithOnDraining(func() { panic("deregistration failed") }),
+		server.WithOnShutdown(func() { panic("close failed") }, func() { closed.Store(true) }),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(context.Background()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-stopped
+	assert.True(t, closed.Load(), "the hooks after a panicking one still run")
+}
+
+func TestShutdownSignals(t *testing.T) {
+	t.Setenv("SERVER_PORT", freePort(t))
+	app := server.NewWithOptions(version,
+		server.WithShutdown(config.Shutdown{Timeout: time.Second, Signals: []string{"hup"}}),
+		server.WithShutdownSignals(),
+	)
+
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(context.Background())
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool {
+		return server.Healthcheck(context.Background()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	self, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, self.Signal(syscall.SIGHUP))
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGHUP did not shut the server down")
+	}
+}
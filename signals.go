@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/pprof"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/config"
+)
+
+// signalNames are the signals which may be configured, those defined on
+// every platform.
+var signalNames = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGPIPE": syscall.SIGPIPE,
+	"SIGALRM": syscall.SIGALRM,
+}
+
+// parseSignals returns the signals named, such as "SIGTERM" or "term".
+func parseSignals(names []string) ([]os.Signal, error) {
+	signals := make([]os.Signal, 0, len(names))
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if !strings.HasPrefix(name, "SIG") {
+			name = "SIG" + name
+		}
+		sig, ok := signalNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown signal %q", name)
+		}
+		signals = append(signals, sig)
+	}
+	return signals, nil
+}
+
+// signalSet holds the signals handled by Run.
+type signalSet struct {
+	shutdown, dump, ignored, upgrade []os.Signal
+}
+
+func newSignalSet(cfg *config.Shutdown) (signalSet, error) {
+	var (
+		set signalSet
+		err error
+	)
+	names := cfg.Signals
+	if len(names) == 0 {
+		names = []string{"SIGINT", "SIGTERM"}
+	}
+	if set.shutdown, err = parseSignals(names); err != nil {
+		return set, err
+	}
+	if set.dump, err = parseSignals(cfg.DumpSignals); err != nil {
+		return set, err
+	}
+	if set.ignored, err = parseSignals(cfg.IgnoredSignals); err != nil {
+		return set, err
+	}
+	if set.upgrade, err = parseSignals(cfg.UpgradeSignals); err != nil {
+		return set, err
+	}
+	return set.forPlatform(), nil
+}
+
+// forPlatform drops the signals the platform never delivers, with a
+// warning, the shutdown signals falling back to SIGINT and SIGTERM.
+func (s signalSet) forPlatform() signalSet {
+	if delivered == nil {
+		return s
+	}
+	keep := func(kind string, signals []os.Signal) []os.Signal {
+		kept := make([]os.Signal, 0, len(signals))
+		for _, sig := range signals {
+			if delivered[sig] {
+				kept = append(kept, sig)
+				continue
+			}
+			logrus.WithFields(logrus.Fields{"signal": sig.String(), "kind": kind}).Warn("signal not delivered on this platform, ignored")
+		}
+		return kept
+	}
+	s.shutdown = keep("shutdown", s.shutdown)
+	s.dump = keep("dump", s.dump)
+	s.ignored = keep("ignored", s.ignored)
+	if len(s.shutdown) == 0 {
+		s.shutdown = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	if len(s.upgrade) > 0 {
+		logrus.Warn("zero-downtime restarts are not supported on this platform, upgrade signals ignored")
+		s.upgrade = nil
+	}
+	return s
+}
+
+// notify returns ctx canceled, when trap is set, on the first shutdown or
+// dump signal, the goroutines being written to stderr first on a dump
+// signal, the next one having its default effect, and ignores the ignored
+// signals.
+func (s signalSet) notify(ctx context.Context, trap bool) (context.Context, context.CancelFunc) {
+	if len(s.ignored) > 0 {
+		signal.Ignore(s.ignored...)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if !trap {
+		return ctx, cancel
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, append(append([]os.Signal{}, s.shutdown...), s.dump...)...)
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-ch:
+			// A second signal kills the server as it drains
+			signal.Stop(ch)
+			for _, dump := range s.dump {
+				if sig == dump {
+					_ = pprof.Lookup("goroutine").WriteTo(os.Stderr, 2)
+				}
+			}
+			logrus.WithField("signal", sig.String()).Info("Received shutdown signal")
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(ch)
+		cancel()
+	}
+}
+
+// upgradeOn hands the listeners over to a new process on the upgrade
+// signals, then shuts the server down with stop once the new process is
+// ready. A failed upgrade leaves the server serving.
+func (a *server) upgradeOn(ctx context.Context, stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, a.signals.upgrade...)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-ch:
+			log := logrus.WithField("signal", sig.String())
+			log.Info("Handing the listeners over to a new process")
+			if err := a.upgrader.Upgrade(); err != nil {
+				log.WithError(err).Error("error while upgrading, serving on")
+				continue
+			}
+			a.upgraded.Store(true)
+			stop()
+			return
+		}
+	}
+}
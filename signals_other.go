@@ -0,0 +1,8 @@
+//go:build !windows
+
+package server
+
+import "os"
+
+// delivered are the signals the platform delivers, nil for all of them.
+var delivered map[os.Signal]bool
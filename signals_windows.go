@@ -0,0 +1,14 @@
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// delivered are the signals Windows delivers, emulated from the console
+// events: Ctrl+C and Ctrl+Break as SIGINT, closing the console, logging off
+// and shutting down as SIGTERM. The listeners cannot be handed over.
+var delivered = map[os.Signal]bool{
+	syscall.SIGINT:  true,
+	syscall.SIGTERM: true,
+}
@@ -0,0 +1,251 @@
+package sse
+
+// Server-Sent Events streamed to the connected clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/request"
+)
+
+const (
+	ContentTypeEventStream = "text/event-stream"
+	HeaderLastEventID      = "Last-Event-ID"
+
+	DefaultQueueSize = 16
+	DefaultHeartbeat = 15 * time.Second
+)
+
+var (
+	ErrClosed    = errors.New("event stream closed")
+	ErrStreaming = errors.New("streaming unsupported")
+)
+
+// Event is a message of the stream. Name is the event type listened to by
+// the clients, "message" when empty, and ID the one they send back in the
+// Last-Event-ID header when reconnecting.
+type Event struct {
+	ID    string
+	Name  string
+	Data  string
+	Retry time.Duration // reconnection delay of the client, unchanged when zero
+}
+
+// JSON returns the event of the given name carrying v encoded in JSON.
+func JSON(name string, v interface{}) (Event, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Name: name, Data: string(data)}, nil
+}
+
+// WriteTo writes the event in the text/event-stream format, a data line
+// per line of Data.
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", oneLine(e.ID))
+	}
+	if e.Name != "" {
+		fmt.Fprintf(&b, "event: %s\n", oneLine(e.Name))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// oneLine keeps a field from injecting other fields.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// Broker streams the published events to its clients, each one served by
+// ServeHTTP and buffering QueueSize events. Clients too slow to keep up are
+// disconnected, to reconnect with the Last-Event-ID of the last event they
+// received, the missed events being replayed by Replay. The zero value is
+// ready to use.
+//
+// Close ends the streams, when the server starts draining with
+// server.WithOnDraining:
+//
+//	events := &sse.Broker{Replay: store.EventsSince}
+//	r.Handle("/events", events)
+//	srv := server.NewWithOptions(version, server.WithOnDraining(events.Close))
+type Broker struct {
+	QueueSize int           // DefaultQueueSize when zero
+	Heartbeat time.Duration // comment lines keeping the idle streams open, DefaultHeartbeat when zero, none when negative
+	Retry     time.Duration // reconnection delay sent to the clients when set
+
+	// Replay returns the events published after the one whose ID the
+	// reconnecting client sent, in order. Live events may be delivered
+	// twice, once replayed and once published.
+	Replay func(ctx context.Context, lastEventID string) ([]Event, error)
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+type client struct {
+	events chan Event
+	gone   chan struct{} // closed when disconnected by the broker
+}
+
+// Publish sends the event to the connected clients, without blocking.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		select {
+		case c.events <- e:
+		default:
+			// Too slow, the client reconnects and gets the missed events replayed
+			delete(b.clients, c)
+			close(c.gone)
+		}
+	}
+}
+
+// Clients returns the number of connected clients.
+func (b *Broker) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// Close ends the streams, and answers 503 Service Unavailable to the
+// clients connecting afterwards.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.init()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+}
+
+func (b *Broker) init() {
+	if b.done == nil {
+		b.done = make(chan struct{})
+		b.clients = map[*client]struct{}{}
+	}
+}
+
+func (b *Broker) subscribe() (*client, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.init()
+	if b.closed {
+		return nil, false
+	}
+	size := b.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	c := &client{events: make(chan Event, size), gone: make(chan struct{})}
+	b.clients[c] = struct{}{}
+	return c, true
+}
+
+func (b *Broker) unsubscribe(c *client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.clients[c]; ok {
+		delete(b.clients, c)
+		close(c.gone)
+	}
+}
+
+// ServeHTTP streams the events to the client until it disconnects or the
+// broker is closed.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	c, ok := b.subscribe()
+	if !ok {
+		request.ReplyErr(w, r, request.NewHTTPError(ErrClosed, http.StatusServiceUnavailable))
+		return
+	}
+	defer b.unsubscribe(c)
+
+	header := w.Header()
+	header.Set(request.HeaderContentType, ContentTypeEventStream)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no") // disables the buffering of nginx
+	w.WriteHeader(http.StatusOK)
+	if b.Retry > 0 {
+		if _, err := fmt.Fprintf(w, "retry: %d\n\n", b.Retry.Milliseconds()); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		logrus.WithError(err).Error(ErrStreaming.Error())
+		return
+	}
+
+	if lastID := r.Header.Get(HeaderLastEventID); lastID != "" && b.Replay != nil {
+		missed, err := b.Replay(r.Context(), lastID)
+		if err != nil {
+			logrus.WithError(err).WithField("last_event_id", lastID).Warn("error while replaying the events")
+		}
+		for _, e := range missed {
+			if _, err := e.WriteTo(w); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+
+	heartbeat := b.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	var beats <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		beats = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-b.done:
+			return
+		case <-c.gone:
+			return
+		case e := <-c.events:
+			if _, err := e.WriteTo(w); err != nil {
+				return
+			}
+		case <-beats:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
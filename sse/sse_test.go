@@ -0,0 +1,129 @@
+package sse_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/sse"
+)
+
+func TestEventWriteTo(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := sse.Event{ID: "7", Name: "order\ncreated", Data: "line 1\nline 2", Retry: 3 * time.Second}.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "id: 7\nevent: ordercreated\nretry: 3000\ndata: line 1\ndata: line 2\n\n", buf.String())
+
+	e, err := sse.JSON("order", map[string]int{"id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, sse.Event{Name: "order", Data: `{"id":1}`}, e)
+}
+
+// connect opens a stream, returning a reader of its lines.
+func connect(t *testing.T, url string, header http.Header) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for name, vs := range header {
+		req.Header[name] = vs
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readEvent returns the lines of the next event.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\n" {
+			return strings.Join(lines, "")
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestBroker(t *testing.T) {
+	broker := &sse.Broker{
+		Heartbeat: 50 * time.Millisecond,
+		Replay: func(ctx context.Context, lastEventID string) ([]sse.Event, error) {
+			return []sse.Event{{ID: lastEventID + "+1", Data: "missed"}}, nil
+		},
+	}
+	srv := httptest.NewServer(broker)
+	defer srv.Close()
+
+	resp, stream := connect(t, srv.URL, http.Header{sse.HeaderLastEventID: {"41"}})
+	assert.Equal(t, sse.ContentTypeEventStream, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "id: 41+1\ndata: missed\n", readEvent(t, stream))
+
+	require.Eventually(t, func() bool { return broker.Clients() == 1 }, time.Second, 10*time.Millisecond)
+	broker.Publish(sse.Event{ID: "42", Name: "order", Data: "created"})
+	event := readEvent(t, stream)
+	for event == ": heartbeat\n" {
+		event = readEvent(t, stream)
+	}
+	assert.Equal(t, "id: 42\nevent: order\ndata: created\n", event)
+
+	assert.Equal(t, ": heartbeat\n", readEvent(t, stream))
+
+	broker.Close()
+	_, err := stream.ReadString('\n')
+	assert.Error(t, err, "stream ended by Close")
+	require.Eventually(t, func() bool { return broker.Clients() == 0 }, time.Second, 10*time.Millisecond)
+
+	resp, _ = connect(t, srv.URL, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+// stalled is a client whose writes block until released.
+type stalled struct {
+	*httptest.ResponseRecorder
+	release chan struct{}
+}
+
+func (s stalled) Write(p []byte) (int, error) {
+	<-s.release
+	return s.ResponseRecorder.Write(p)
+}
+
+func (s stalled) WriteString(str string) (int, error) {
+	return s.Write([]byte(str))
+}
+
+func TestBrokerSlowClient(t *testing.T) {
+	broker := &sse.Broker{QueueSize: 1, Heartbeat: -1}
+	w := stalled{httptest.NewRecorder(), make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		broker.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return broker.Clients() == 1 }, time.Second, 10*time.Millisecond)
+
+	// The queue overflows while the client is stuck writing
+	for i := 0; i < 3; i++ {
+		broker.Publish(sse.Event{Data: "x"})
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, broker.Clients())
+	close(w.release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow client not disconnected")
+	}
+}
@@ -0,0 +1,205 @@
+package static
+
+// Serves the assets of web frontends, embedded in the binary or on disk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	Index         = "index.html"
+	DefaultMaxAge = time.Hour
+)
+
+// Pre-compressed variants, by order of preference
+var encodings = []struct {
+	name, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Options customize the serving of the assets.
+type Options struct {
+	// SPA serves Index for the paths without an extension matching no
+	// file, leaving the routing of these paths to a single-page app.
+	SPA bool
+
+	// MaxAge of the assets in the Cache-Control header, DefaultMaxAge when
+	// zero, none when negative. HTML documents, whose links change with
+	// each release, are always revalidated.
+	MaxAge time.Duration
+}
+
+// Endpoint serves the files of fsys, such as an embed.FS or an os.DirFS,
+// along with their pre-compressed variant, "app.js.br" or "app.js.gz" for
+// "app.js", to the clients accepting it. Directories are served their
+// index.html and never listed.
+//
+//	//go:embed dist
+//	var dist embed.FS
+//
+//	sub, _ := fs.Sub(dist, "dist")
+//	server.NewWithOptions(version, server.WithStatic("/", sub, static.Options{SPA: true}))
+func Endpoint(fsys fs.FS, opts Options) http.Handler {
+	s := &assets{fsys: fsys, opts: opts}
+	r := chi.NewRouter()
+	r.Get("/*", s.serve)
+	r.Head("/*", s.serve)
+	return r
+}
+
+type assets struct {
+	fsys  fs.FS
+	opts  Options
+	etags sync.Map // entity tags of the files, by name
+}
+
+func (s *assets) serve(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+chi.URLParam(r, "*")), "/")
+	if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, Index)
+	}
+	if s.isFile(name) {
+		s.serveFile(w, r, name)
+		return
+	}
+	if s.isFile(path.Join(name, Index)) {
+		// Relative links resolve against the directory
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	if s.opts.SPA && path.Ext(name) == "" && s.isFile(Index) {
+		s.serveFile(w, r, Index)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *assets) isFile(name string) bool {
+	info, err := fs.Stat(s.fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+func (s *assets) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	header := w.Header()
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	switch {
+	case strings.HasPrefix(contentType, "text/html"):
+		header.Set("Cache-Control", "no-cache")
+	case s.opts.MaxAge > 0:
+		header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(s.opts.MaxAge.Seconds())))
+	case s.opts.MaxAge == 0:
+		header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(DefaultMaxAge.Seconds())))
+	}
+
+	served := name
+	for _, e := range encodings {
+		if !s.isFile(name + e.ext) {
+			continue
+		}
+		// The response depends on the header once a variant exists
+		header.Add("Vary", "Accept-Encoding")
+		if accepts(r, e.name) {
+			header.Set("Content-Encoding", e.name)
+			served = name + e.ext
+		}
+		break
+	}
+
+	f, err := s.fsys.Open(served)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	etag, err := s.etag(served, info, content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	header.Set("ETag", etag)
+	if contentType == "" && served != name {
+		// Left unset, http.ServeContent sniffs the compressed content
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// etag returns a strong entity tag of the size and modification time of
+// the file, or of its content when the modification time is unknown, as in
+// an embed.FS.
+func (s *assets) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := fmt.Sprintf("%s-%d-%d", name, info.Size(), info.ModTime().UnixNano())
+	if etag, ok := s.etags.Load(key); ok {
+		return etag.(string), nil
+	}
+	h := sha256.New()
+	if info.ModTime().IsZero() {
+		if _, err := io.Copy(h, content); err != nil {
+			return "", err
+		}
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	} else {
+		h.Write([]byte(key))
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.Store(key, etag)
+	return etag, nil
+}
+
+// accepts reports whether the Accept-Encoding header of the request allows
+// the coding.
+func accepts(r *http.Request, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		allowed := true
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				allowed = false
+			}
+		}
+		switch {
+		case strings.EqualFold(name, coding):
+			return allowed
+		case name == "*":
+			wildcard = allowed
+		}
+	}
+	return wildcard
+}
@@ -0,0 +1,103 @@
+package static_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/static"
+)
+
+var dist = fstest.MapFS{
+	"index.html":        {Data: []byte("<html>app</html>")},
+	"assets/app.js":     {Data: []byte("console.log(1)")},
+	"assets/app.js.br":  {Data: []byte("brotli")},
+	"assets/app.js.gz":  {Data: []byte("gzip")},
+	"assets/logo.svg":   {Data: []byte("<svg/>")},
+	"guide/index.html":  {Data: []byte("<html>guide</html>")},
+	"assets/readme.txt": {Data: []byte("readme")},
+}
+
+func get(t *testing.T, h http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	return rr
+}
+
+func TestEndpoint(t *testing.T) {
+	router := chi.NewRouter()
+	router.Mount("/app", static.Endpoint(dist, static.Options{}))
+
+	rr := get(t, router, "/app/")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "<html>app</html>", rr.Body.String())
+	assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control"))
+
+	rr = get(t, router, "/app/assets/logo.svg")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/svg+xml", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=3600", rr.Header().Get("Cache-Control"))
+	etag := rr.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusNotModified, get(t, router, "/app/assets/logo.svg", "If-None-Match", etag).Code)
+
+	rr = get(t, router, "/app/guide")
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "/app/guide/", rr.Header().Get("Location"))
+	assert.Equal(t, "<html>guide</html>", get(t, router, "/app/guide/").Body.String())
+
+	assert.Equal(t, http.StatusNotFound, get(t, router, "/app/orders/42").Code, "no fallback unless SPA")
+	assert.Equal(t, http.StatusNotFound, get(t, router, "/app/../go.mod").Code)
+}
+
+func TestEndpointPrecompressed(t *testing.T) {
+	h := static.Endpoint(dist, static.Options{MaxAge: -1})
+
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+		body           string
+	}{
+		{acceptEncoding: "gzip, deflate, br", encoding: "br", body: "brotli"},
+		{acceptEncoding: "gzip", encoding: "", body: "console.log(1)"},
+		{acceptEncoding: "br;q=0, *", encoding: "", body: "console.log(1)"},
+		{acceptEncoding: "*", encoding: "br", body: "brotli"},
+		{acceptEncoding: "", encoding: "", body: "console.log(1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			rr := get(t, h, "/assets/app.js", "Accept-Encoding", tt.acceptEncoding)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.body, rr.Body.String())
+			assert.Equal(t, tt.encoding, rr.Header().Get("Content-Encoding"))
+			assert.Contains(t, rr.Header().Get("Content-Type"), "javascript")
+			assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+			assert.Empty(t, rr.Header().Get("Cache-Control"))
+		})
+	}
+
+	rr := get(t, h, "/assets/readme.txt", "Accept-Encoding", "br")
+	assert.Empty(t, rr.Header().Get("Vary"), "no variant")
+}
+
+func TestEndpointSPA(t *testing.T) {
+	h := static.Endpoint(dist, static.Options{SPA: true})
+
+	rr := get(t, h, "/orders/42")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "<html>app</html>", rr.Body.String())
+	assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control"))
+
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/assets/missing.js").Code, "missing assets are not the app")
+}
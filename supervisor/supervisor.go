@@ -0,0 +1,186 @@
+package supervisor
+
+// Companion processes (sidecars, one-shot steps) managed alongside the server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-obvious/server/healthz"
+)
+
+const DefaultStopTimeout = 10 * time.Second
+
+type Process struct {
+	Name string
+	Path string
+	Args []string
+	Env  []string // appended to the server's environment
+	Dir  string
+
+	// RunOnce marks a step (e.g. a migration) which must exit successfully
+	// before the server starts listening.
+	RunOnce bool
+
+	// StopTimeout is how long to wait after SIGTERM before killing the process.
+	StopTimeout time.Duration
+}
+
+type running struct {
+	proc *Process
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+var (
+	mu        sync.Mutex
+	processes = make([]*Process, 0)
+	started   = make([]*running, 0)
+)
+
+// Register declares processes to be managed by the server.
+func Register(procs ...*Process) {
+	mu.Lock()
+	defer mu.Unlock()
+	processes = append(processes, procs...)
+}
+
+// Reset stops the sidecars and forgets the registered processes, so that
+// Start may be called again with other ones.
+func Reset() {
+	Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	processes = make([]*Process, 0)
+}
+
+// Start runs the one-shot steps in order and then launches the sidecars.
+// Each sidecar is added to the health checks, failing once the process exits.
+func Start(ctx context.Context) error {
+	mu.Lock()
+	procs := processes
+	mu.Unlock()
+
+	for _, p := range procs {
+		if !p.RunOnce {
+			continue
+		}
+		logrus.WithField("process", p.Name).Info("running step")
+		if err := command(ctx, p).Run(); err != nil {
+			return fmt.Errorf("step %s failed: %w", p.Name, err)
+		}
+	}
+
+	for _, p := range procs {
+		if p.RunOnce {
+			continue
+		}
+		if err := launch(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop terminates the sidecars in the reverse order they were started and
+// removes their health checks.
+func Stop() {
+	mu.Lock()
+	procs := started
+	started = make([]*running, 0)
+	mu.Unlock()
+
+	for i := len(procs) - 1; i >= 0; i-- {
+		procs[i].stop()
+		healthz.Deregister(procs[i].healthCheck())
+	}
+}
+
+func command(ctx context.Context, p *Process) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, p.Path, p.Args...)
+	cmd.Env = append(os.Environ(), p.Env...)
+	cmd.Dir = p.Dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+func launch(p *Process) error {
+	cmd := command(context.Background(), p)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("sidecar %s failed to start: %w", p.Name, err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"process": p.Name,
+		"pid":     cmd.Process.Pid,
+	}).Info("sidecar started")
+
+	ref := &running{proc: p, cmd: cmd, done: make(chan struct{})}
+	go func() {
+		ref.err = cmd.Wait()
+		close(ref.done)
+	}()
+
+	mu.Lock()
+	started = append(started, ref)
+	mu.Unlock()
+
+	healthz.Register(ref.healthCheck(), ref.check)
+	return nil
+}
+
+// healthCheck returns the name the health check of the sidecar is
+// registered under.
+func (x *running) healthCheck() string {
+	return "sidecar:" + x.proc.Name
+}
+
+func (x *running) check() error {
+	select {
+	case <-x.done:
+		if x.err != nil {
+			return fmt.Errorf("sidecar %s exited: %w", x.proc.Name, x.err)
+		}
+		return errors.New("sidecar " + x.proc.Name + " exited")
+	default:
+		return nil
+	}
+}
+
+func (x *running) stop() {
+	select {
+	case <-x.done:
+		return
+	default:
+	}
+
+	timeout := x.proc.StopTimeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+
+	log := logrus.WithField("process", x.proc.Name)
+	if err := x.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		log.WithError(err).Debug("unable to signal sidecar, killing")
+		_ = x.cmd.Process.Kill()
+	}
+
+	select {
+	case <-x.done:
+		log.Info("sidecar stopped")
+	case <-time.After(timeout):
+		log.Warn("sidecar did not stop in time, killing")
+		_ = x.cmd.Process.Kill()
+		<-x.done
+	}
+}
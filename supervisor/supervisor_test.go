@@ -0,0 +1,50 @@
+package supervisor_test
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/healthz"
+	"github.com/go-obvious/server/supervisor"
+)
+
+func TestStartStop(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not available")
+	}
+	step, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("true not available")
+	}
+
+	t.Cleanup(supervisor.Reset)
+	supervisor.Register(
+		&supervisor.Process{Name: "migrate", Path: step, RunOnce: true},
+		&supervisor.Process{Name: "sidecar", Path: sleep, Args: []string{"30"}, StopTimeout: time.Second},
+	)
+
+	require.NoError(t, supervisor.Start(context.Background()))
+	assert.NoError(t, healthz.NewHealthz().Run())
+
+	supervisor.Stop()
+	assert.NoError(t, healthz.NewHealthz().Run(), "Expected the stopped sidecar's health check to be removed")
+}
+
+func TestStartFailedStep(t *testing.T) {
+	step, err := exec.LookPath("false")
+	if err != nil {
+		t.Skip("false not available")
+	}
+
+	t.Cleanup(supervisor.Reset)
+	supervisor.Register(&supervisor.Process{Name: "failing", Path: step, RunOnce: true})
+
+	err = supervisor.Start(context.Background())
+	assert.ErrorContains(t, err, "step failing failed")
+}
@@ -0,0 +1,128 @@
+package bench
+
+// Compares the output of go test -bench -benchmem against a stored baseline,
+// so a change regressing the per-request overhead is caught
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Result is the median of the runs of a benchmark, whose name is stripped
+// of the GOMAXPROCS suffix.
+type Result struct {
+	Name        string
+	NsPerOp     float64
+	BytesPerOp  float64
+	AllocsPerOp float64
+}
+
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// Parse reads the results of go test -bench, -count runs being reduced to
+// their median. The lines other than the benchmark results are skipped.
+func Parse(r io.Reader) (map[string]Result, error) {
+	runs := map[string][]Result{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		res := Result{Name: procsSuffix.ReplaceAllString(fields[0], "")}
+		// Value and unit pairs follow the iterations
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed benchmark line %q", scanner.Text())
+			}
+			switch fields[i+1] {
+			case "ns/op":
+				res.NsPerOp = v
+			case "B/op":
+				res.BytesPerOp = v
+			case "allocs/op":
+				res.AllocsPerOp = v
+			}
+		}
+		runs[res.Name] = append(runs[res.Name], res)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	results := make(map[string]Result, len(runs))
+	for name, rs := range runs {
+		results[name] = Result{
+			Name:        name,
+			NsPerOp:     median(rs, func(r Result) float64 { return r.NsPerOp }),
+			BytesPerOp:  median(rs, func(r Result) float64 { return r.BytesPerOp }),
+			AllocsPerOp: median(rs, func(r Result) float64 { return r.AllocsPerOp }),
+		}
+	}
+	return results, nil
+}
+
+func median(rs []Result, metric func(Result) float64) float64 {
+	values := make([]float64, len(rs))
+	for i, r := range rs {
+		values[i] = metric(r)
+	}
+	sort.Float64s(values)
+	if n := len(values); n%2 == 0 {
+		return (values[n/2-1] + values[n/2]) / 2
+	}
+	return values[len(values)/2]
+}
+
+// Regression is a metric of a benchmark past the tolerance of its baseline.
+type Regression struct {
+	Name     string
+	Metric   string
+	Baseline float64
+	Current  float64
+}
+
+func (r Regression) String() string {
+	change := 100 * (r.Current - r.Baseline) / r.Baseline
+	return fmt.Sprintf("%s: %s %.0f -> %.0f (%+.1f%%)", r.Name, r.Metric, r.Baseline, r.Current, change)
+}
+
+// Compare returns the metrics of the current results exceeding their
+// baseline by more than tolerance, 0.1 for 10%, sorted by benchmark. The
+// benchmarks missing from either side are not compared.
+func Compare(baseline, current map[string]Result, tolerance float64) []Regression {
+	var regressions []Regression
+	for name, cur := range current {
+		base, ok := baseline[name]
+		if !ok {
+			continue
+		}
+		for _, m := range []struct {
+			metric      string
+			base, value float64
+		}{
+			{"ns/op", base.NsPerOp, cur.NsPerOp},
+			{"B/op", base.BytesPerOp, cur.BytesPerOp},
+			{"allocs/op", base.AllocsPerOp, cur.AllocsPerOp},
+		} {
+			if m.base > 0 && m.value > m.base*(1+tolerance) {
+				regressions = append(regressions, Regression{Name: name, Metric: m.metric, Baseline: m.base, Current: m.value})
+			}
+		}
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		if regressions[i].Name != regressions[j].Name {
+			return regressions[i].Name < regressions[j].Name
+		}
+		return regressions[i].Metric < regressions[j].Metric
+	})
+	return regressions
+}
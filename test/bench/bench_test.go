@@ -0,0 +1,47 @@
+package bench_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/test/bench"
+)
+
+const baseline = `goos: linux
+goarch: amd64
+pkg: github.com/go-obvious/server
+BenchmarkMiddlewareChain-8   	  100000	     10000 ns/op	    4000 B/op	      40 allocs/op
+BenchmarkMiddlewareChain-8   	  100000	     12000 ns/op	    4000 B/op	      40 allocs/op
+BenchmarkMiddlewareChain-8   	  100000	     11000 ns/op	    4000 B/op	      40 allocs/op
+BenchmarkReply-8             	 1000000	      1000 ns/op	     800 B/op	       8 allocs/op
+PASS
+ok  	github.com/go-obvious/server	3.000s
+`
+
+func TestParse(t *testing.T) {
+	results, err := bench.Parse(strings.NewReader(baseline))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bench.Result{
+		"BenchmarkMiddlewareChain": {Name: "BenchmarkMiddlewareChain", NsPerOp: 11000, BytesPerOp: 4000, AllocsPerOp: 40},
+		"BenchmarkReply":           {Name: "BenchmarkReply", NsPerOp: 1000, BytesPerOp: 800, AllocsPerOp: 8},
+	}, results, "the median of the runs")
+}
+
+func TestCompare(t *testing.T) {
+	base, err := bench.Parse(strings.NewReader(baseline))
+	require.NoError(t, err)
+	current, err := bench.Parse(strings.NewReader(`
+BenchmarkMiddlewareChain-4   	  100000	     11500 ns/op	    4000 B/op	      44 allocs/op
+BenchmarkReply-4             	 1000000	      1200 ns/op	     800 B/op	       8 allocs/op
+BenchmarkNew-4               	 1000000	      9999 ns/op	     999 B/op	      99 allocs/op
+`))
+	require.NoError(t, err)
+
+	regressions := bench.Compare(base, current, 0.1)
+	require.Len(t, regressions, 1, "within the tolerance, or without a baseline")
+	assert.Equal(t, "BenchmarkReply: ns/op 1000 -> 1200 (+20.0%)", regressions[0].String())
+	assert.Empty(t, bench.Compare(base, current, 0.25))
+}
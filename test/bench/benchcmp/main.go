@@ -0,0 +1,53 @@
+package main
+
+// Fails when the benchmarks regressed from the baseline:
+//
+//	go run ./test/bench/benchcmp -baseline bench_baseline.txt bench_output.txt
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-obvious/server/test/bench"
+)
+
+func main() {
+	baselinePath := flag.String("baseline", "bench_baseline.txt", "output of go test -bench recorded as the baseline")
+	tolerance := flag.Float64("tolerance", 0.1, "increase tolerated, 0.1 for 10%")
+	flag.Parse()
+
+	baseline, err := parseFile(*baselinePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	current, err := parseFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	regressions := bench.Compare(baseline, current, *tolerance)
+	for _, r := range regressions {
+		fmt.Println(r)
+	}
+	if len(regressions) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("%d benchmarks within %.0f%% of the baseline\n", len(current), 100**tolerance)
+}
+
+// parseFile parses the file at path, stdin when empty.
+func parseFile(path string) (map[string]bench.Result, error) {
+	var r io.Reader = os.Stdin
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return bench.Parse(r)
+}
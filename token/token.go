@@ -0,0 +1,169 @@
+package token
+
+// Short-lived signed tokens of the verification links, such as the email
+// verification, password reset and magic link ones
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-obvious/server/keys"
+	"github.com/go-obvious/server/request"
+)
+
+const (
+	DefaultTTL   = 15 * time.Minute
+	DefaultParam = "token"
+)
+
+var (
+	ErrInvalid = errors.New("invalid token")
+	ErrExpired = errors.New("token expired")
+	ErrUsed    = errors.New("token already used")
+)
+
+// Claims are the content of a token.
+type Claims struct {
+	ID        string    `json:"jti"`
+	Purpose   string    `json:"pur"`
+	Subject   string    `json:"sub"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// Store records the tokens used, making them single use.
+type Store interface {
+	// Use marks the token as used until it expires, reporting whether it
+	// was not used before.
+	Use(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+}
+
+// Issuer mints the tokens with the current key of Keys, bound to a purpose
+// and a subject such as a user ID, and verifies them. Tokens of a purpose
+// are refused for another one, and, with a Store, once used.
+//
+//	links := &token.Issuer{Keys: ring, Store: &token.MemoryStore{}}
+//	tok, err := links.Mint("password-reset", user.ID)
+//	r.With(links.Middleware("password-reset", "")).Post("/password/reset", reset)
+type Issuer struct {
+	Keys  *keys.Ring
+	TTL   time.Duration // DefaultTTL when zero
+	Store Store         // tokens may be used until they expire when nil
+}
+
+// Mint returns a token of the purpose for the subject.
+func (x *Issuer) Mint(purpose, subject string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	ttl := x.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	payload, err := json.Marshal(Claims{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Purpose:   purpose,
+		Subject:   subject,
+		ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	tag, err := x.Keys.Sign([]byte(encoded))
+	if err != nil {
+		return "", err
+	}
+	return encoded + "." + tag, nil
+}
+
+// Verify returns the claims of a token of the purpose, consuming it when
+// the issuer has a Store. The errors are ResponseErrors, replying 400 Bad
+// Request to the invalid tokens and 410 Gone to the expired or used ones.
+func (x *Issuer) Verify(ctx context.Context, tok, purpose string) (Claims, error) {
+	var claims Claims
+	encoded, tag, ok := strings.Cut(tok, ".")
+	if !ok || x.Keys.Verify([]byte(encoded), tag) != nil {
+		return claims, request.NewHTTPError(ErrInvalid, http.StatusBadRequest)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &claims) != nil || claims.Purpose != purpose {
+		return Claims{}, request.NewHTTPError(ErrInvalid, http.StatusBadRequest)
+	}
+	if !time.Now().Before(claims.ExpiresAt) {
+		return Claims{}, request.NewHTTPError(ErrExpired, http.StatusGone)
+	}
+	if x.Store != nil {
+		first, err := x.Store.Use(ctx, claims.ID, claims.ExpiresAt)
+		if err != nil {
+			return Claims{}, err
+		}
+		if !first {
+			return Claims{}, request.NewHTTPError(ErrUsed, http.StatusGone)
+		}
+	}
+	return claims, nil
+}
+
+type claimsKeyType int
+
+const claimsKey claimsKeyType = 0
+
+// Middleware verifies the token of the purpose carried by the query
+// parameter param, DefaultParam when empty, or else the form field of that
+// name, replying the errors of Verify. The claims are stored in the
+// context for FromContext.
+func (x *Issuer) Middleware(purpose, param string) func(http.Handler) http.Handler {
+	if param == "" {
+		param = DefaultParam
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := x.Verify(r.Context(), r.FormValue(param), purpose)
+			if err != nil {
+				request.ReplyErr(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey, claims)))
+		})
+	}
+}
+
+// FromContext returns the claims of the token verified by Middleware.
+func FromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(Claims)
+	return claims, ok
+}
+
+// MemoryStore records the used tokens in memory, for a single instance.
+// The zero value is ready to use.
+type MemoryStore struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func (s *MemoryStore) Use(_ context.Context, id string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.used == nil {
+		s.used = map[string]time.Time{}
+	}
+	for usedID, expiry := range s.used {
+		if !now.Before(expiry) {
+			delete(s.used, usedID)
+		}
+	}
+	if _, ok := s.used[id]; ok {
+		return false, nil
+	}
+	s.used[id] = expiresAt
+	return true, nil
+}
@@ -0,0 +1,83 @@
+package token_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/keys"
+	"github.com/go-obvious/server/request"
+	"github.com/go-obvious/server/token"
+)
+
+func TestIssuer(t *testing.T) {
+	issuer := &token.Issuer{Keys: keys.FromSecrets("link-secret"), TTL: time.Hour}
+	ctx := context.Background()
+
+	tok, err := issuer.Mint("verify-email", "user-42")
+	require.NoError(t, err)
+	claims, err := issuer.Verify(ctx, tok, "verify-email")
+	require.NoError(t, err)
+	assert.Equal(t, "user-42", claims.Subject)
+	assert.NotEmpty(t, claims.ID)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt, 2*time.Second)
+
+	_, err = issuer.Verify(ctx, tok, "password-reset")
+	assert.ErrorIs(t, err, token.ErrInvalid, "bound to its purpose")
+	assert.True(t, request.HasCode(err, http.StatusBadRequest))
+
+	other, err := issuer.Mint("verify-email", "user-43")
+	require.NoError(t, err)
+	payload, _, _ := strings.Cut(other, ".")
+	_, tag, _ := strings.Cut(tok, ".")
+	_, err = issuer.Verify(ctx, payload+"."+tag, "verify-email")
+	assert.ErrorIs(t, err, token.ErrInvalid)
+
+	_, err = (&token.Issuer{Keys: keys.FromSecrets("other-secret")}).Verify(ctx, tok, "verify-email")
+	assert.ErrorIs(t, err, token.ErrInvalid)
+
+	expired, err := (&token.Issuer{Keys: issuer.Keys, TTL: time.Nanosecond}).Mint("verify-email", "user-42")
+	require.NoError(t, err)
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	_, err = issuer.Verify(ctx, expired, "verify-email")
+	assert.ErrorIs(t, err, token.ErrExpired)
+	assert.True(t, request.HasCode(err, http.StatusGone))
+}
+
+func TestIssuerSingleUse(t *testing.T) {
+	issuer := &token.Issuer{Keys: keys.FromSecrets("link-secret"), Store: &token.MemoryStore{}}
+	handler := issuer.Middleware("password-reset", "")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := token.FromContext(r.Context())
+		require.True(t, ok)
+		_, _ = w.Write([]byte(claims.Subject))
+	}))
+
+	tok, err := issuer.Mint("password-reset", "user-42")
+	require.NoError(t, err)
+	reset := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(url.Values{"token": {tok}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := reset()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "user-42", rr.Body.String())
+
+	rr = reset()
+	assert.Equal(t, http.StatusGone, rr.Code)
+	assert.Contains(t, rr.Body.String(), token.ErrUsed.Error())
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/password/reset", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
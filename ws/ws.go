@@ -0,0 +1,281 @@
+package ws
+
+// WebSocket endpoints whose connections are tracked, pinged, and closed on
+// shutdown
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/go-obvious/server/request"
+)
+
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+
+	DefaultPingInterval = 30 * time.Second
+	DefaultWriteWait    = 10 * time.Second
+	DefaultQueueSize    = 16
+)
+
+var (
+	ErrClosed = errors.New("websocket closed")
+	ErrSlow   = errors.New("websocket client too slow")
+)
+
+// Hub upgrades the requests of its endpoints to WebSocket connections and
+// keeps track of them, to broadcast messages and close them on shutdown
+// with server.WithOnShutdown. The zero value is ready to use, accepting
+// the connections from the same origin only.
+//
+//	hub := &ws.Hub{}
+//	r.Handle("/chat", hub.Handler(func(c *ws.Conn, r *http.Request) {
+//		for {
+//			_, msg, err := c.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			hub.Broadcast(ws.TextMessage, msg)
+//		}
+//	}))
+//	srv := server.NewWithOptions(version, server.WithOnShutdown(hub.Close))
+type Hub struct {
+	// Upgrader of the requests, whose CheckOrigin allows cross-origin
+	// clients when set
+	Upgrader websocket.Upgrader
+
+	PingInterval time.Duration // DefaultPingInterval when zero, none when negative
+	WriteWait    time.Duration // DefaultWriteWait when zero
+	QueueSize    int           // messages queued per connection, DefaultQueueSize when zero
+
+	mu     sync.Mutex
+	conns  map[*Conn]struct{}
+	closed bool
+}
+
+// Conn is a connection of a Hub. Messages are read by the handler of the
+// endpoint and sent through a queue, so Send and Broadcast do not block.
+type Conn struct {
+	conn      *websocket.Conn
+	writeWait time.Duration
+	send      chan message
+	done      chan struct{}
+	once      sync.Once
+}
+
+type message struct {
+	typ  int
+	data []byte
+}
+
+// Handler returns the handler of an endpoint, upgrading its requests and
+// serving the connections with fn, which reads the messages until it
+// fails. The connection is closed once fn returns.
+func (h *Hub) Handler(fn func(c *Conn, r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.isClosed() {
+			request.ReplyErr(w, r, request.NewHTTPError(ErrClosed, http.StatusServiceUnavailable))
+			return
+		}
+		// The upgrader replies the failed handshakes itself
+		wsConn, err := h.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := h.register(wsConn)
+		if c == nil {
+			_ = wsConn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(h.writeWait()))
+			wsConn.Close()
+			return
+		}
+		defer h.unregister(c)
+
+		ping := h.PingInterval
+		if ping == 0 {
+			ping = DefaultPingInterval
+		}
+		if ping > 0 {
+			// Clients missing two pings in a row are gone
+			wait := 2 * ping
+			_ = wsConn.SetReadDeadline(time.Now().Add(wait))
+			wsConn.SetPongHandler(func(string) error {
+				select {
+				case <-c.done: // closing, the deadline is the one of the close handshake
+					return nil
+				default:
+					return wsConn.SetReadDeadline(time.Now().Add(wait))
+				}
+			})
+		}
+		go c.writeLoop(ping)
+		fn(c, r)
+	})
+}
+
+// Broadcast sends the message to every connection, closing the ones too
+// slow to keep up.
+func (h *Hub) Broadcast(messageType int, data []byte) {
+	h.mu.Lock()
+	conns := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+	for _, c := range conns {
+		_ = c.Send(messageType, data)
+	}
+}
+
+// Conns returns the number of open connections.
+func (h *Hub) Conns() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.conns)
+}
+
+// Close sends a going away close frame to the connections, ending them once
+// the clients acknowledged it or the write wait elapsed, and answers 503
+// Service Unavailable to the requests coming afterwards.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	conns := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+	for _, c := range conns {
+		c.Close(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+func (h *Hub) isClosed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+func (h *Hub) writeWait() time.Duration {
+	if h.WriteWait > 0 {
+		return h.WriteWait
+	}
+	return DefaultWriteWait
+}
+
+func (h *Hub) register(wsConn *websocket.Conn) *Conn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	size := h.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	c := &Conn{
+		conn:      wsConn,
+		writeWait: h.writeWait(),
+		send:      make(chan message, size),
+		done:      make(chan struct{}),
+	}
+	if h.conns == nil {
+		h.conns = map[*Conn]struct{}{}
+	}
+	h.conns[c] = struct{}{}
+	return c
+}
+
+func (h *Hub) unregister(c *Conn) {
+	h.mu.Lock()
+	delete(h.conns, c)
+	h.mu.Unlock()
+	c.Close(websocket.CloseNormalClosure, "")
+	c.conn.Close()
+}
+
+// ReadMessage returns the next message of the client, failing once the
+// connection is closed.
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	return c.conn.ReadMessage()
+}
+
+// ReadJSON decodes the next message of the client into v.
+func (c *Conn) ReadJSON(v interface{}) error {
+	return c.conn.ReadJSON(v)
+}
+
+// Send queues a message, closing the connection when the queue is full.
+func (c *Conn) Send(messageType int, data []byte) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	select {
+	case c.send <- message{messageType, data}:
+		return nil
+	default:
+		c.Close(websocket.CloseTryAgainLater, ErrSlow.Error())
+		return ErrSlow
+	}
+}
+
+// SendJSON queues v encoded in JSON as a text message.
+func (c *Conn) SendJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(TextMessage, data)
+}
+
+// Close sends a close frame, the pending reads failing once the client
+// acknowledged it or the write wait elapsed.
+func (c *Conn) Close(code int, text string) {
+	deadline := time.Now().Add(c.writeWait)
+	c.stop()
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline)
+	_ = c.conn.SetReadDeadline(deadline)
+}
+
+func (c *Conn) stop() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// writeLoop writes the queued messages and the pings, the only writer of
+// the connection besides the control frames.
+func (c *Conn) writeLoop(ping time.Duration) {
+	var ticks <-chan time.Time
+	if ping > 0 {
+		ticker := time.NewTicker(ping)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		select {
+		case <-c.done:
+			return
+		case m := <-c.send:
+			if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeWait)); err != nil {
+				c.conn.Close()
+				return
+			}
+			if err := c.conn.WriteMessage(m.typ, m.data); err != nil {
+				c.conn.Close()
+				return
+			}
+		case <-ticks:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.writeWait)); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package ws_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-obvious/server/ws"
+)
+
+func echoHub(t *testing.T, hub *ws.Hub) string {
+	t.Helper()
+	srv := httptest.NewServer(hub.Handler(func(c *ws.Conn, r *http.Request) {
+		for {
+			typ, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) == "broadcast" {
+				hub.Broadcast(typ, []byte("to all"))
+				continue
+			}
+			if c.Send(typ, msg) != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func read(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	return string(msg)
+}
+
+func TestHub(t *testing.T) {
+	hub := &ws.Hub{}
+	url := echoHub(t, hub)
+
+	first, second := dial(t, url), dial(t, url)
+	require.Eventually(t, func() bool { return hub.Conns() == 2 }, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, first.WriteMessage(websocket.TextMessage, []byte("hello")))
+	assert.Equal(t, "hello", read(t, first))
+
+	require.NoError(t, second.WriteMessage(websocket.TextMessage, []byte("broadcast")))
+	assert.Equal(t, "to all", read(t, first))
+	assert.Equal(t, "to all", read(t, second))
+
+	require.NoError(t, first.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	require.Eventually(t, func() bool { return hub.Conns() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestHubPing(t *testing.T) {
+	hub := &ws.Hub{PingInterval: 20 * time.Millisecond}
+	conn := dial(t, echoHub(t, hub))
+
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-pinged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ping received")
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, hub.Conns(), "answering the pings keeps the connection open")
+}
+
+func TestHubClose(t *testing.T) {
+	hub := &ws.Hub{}
+	url := echoHub(t, hub)
+	conn := dial(t, url)
+	require.Eventually(t, func() bool { return hub.Conns() == 1 }, time.Second, 10*time.Millisecond)
+
+	hub.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	require.Eventually(t, func() bool { return hub.Conns() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}